@@ -0,0 +1,518 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"simple-go-server/model"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+var createCartTableQuery = `CREATE TABLE cart (
+	uid integer,
+	pid integer,
+	quantity integer,
+	price integer,
+	date integer,
+	primary key (uid, pid));`
+var alterOrderProductQuantityQuery = `ALTER TABLE orderproduct ADD COLUMN quantity integer NOT NULL DEFAULT 1;`
+var alterOrderProductPriceQuery = `ALTER TABLE orderproduct ADD COLUMN price integer NOT NULL DEFAULT 0;`
+
+// the prices of cart items and ordered products existing before currencies
+// are in the default currency.
+var alterCartCurrencyQuery = `ALTER TABLE cart ADD COLUMN currency text NOT NULL DEFAULT '` + string(model.DefaultCurrency) + `';`
+var alterGuestCartCurrencyQuery = `ALTER TABLE guestcart ADD COLUMN currency text NOT NULL DEFAULT '` + string(model.DefaultCurrency) + `';`
+var alterOrderProductCurrencyQuery = `ALTER TABLE orderproduct ADD COLUMN currency text NOT NULL DEFAULT '` + string(model.DefaultCurrency) + `';`
+
+var createGuestTableQuery = `CREATE TABLE guest (
+	gid text primary key,
+	expires integer);`
+var createGuestCartTableQuery = `CREATE TABLE guestcart (
+	gid text,
+	pid integer,
+	quantity integer,
+	price integer,
+	date integer,
+	primary key (gid, pid));`
+
+// the cart tables are rebuilt with vid in the primary key,
+// the items added before variants taking vid 0.
+var rebuildCartTableQueries = []string{
+	`CREATE TABLE cart_new (
+	uid integer,
+	pid integer,
+	vid integer NOT NULL DEFAULT 0,
+	quantity integer,
+	price integer,
+	date integer,
+	primary key (uid, pid, vid));`,
+	`INSERT INTO cart_new (uid, pid, vid, quantity, price, date) SELECT uid, pid, 0, quantity, price, date FROM cart;`,
+	`DROP TABLE cart;`,
+	`ALTER TABLE cart_new RENAME TO cart;`,
+}
+var rebuildGuestCartTableQueries = []string{
+	`CREATE TABLE guestcart_new (
+	gid text,
+	pid integer,
+	vid integer NOT NULL DEFAULT 0,
+	quantity integer,
+	price integer,
+	date integer,
+	primary key (gid, pid, vid));`,
+	`INSERT INTO guestcart_new (gid, pid, vid, quantity, price, date) SELECT gid, pid, 0, quantity, price, date FROM guestcart;`,
+	`DROP TABLE guestcart;`,
+	`ALTER TABLE guestcart_new RENAME TO guestcart;`,
+}
+
+// cartQueries are the queries of a cart,
+// run on the cart table for users and the guestcart table for guests.
+type cartQueries struct {
+	selectItems          string
+	selectItem           string
+	insertItem           string
+	updateItem           string
+	deleteItem           string
+	deleteAll            string
+	refreshPrices        string
+	deleteOtherCurrency  string
+	deleteDeletedProduct string
+	deleteSoldOut        string
+	capStock             string
+}
+
+var userCartQueries = cartQueries{
+	selectItems: `SELECT uid, pid, vid, quantity, price, currency, date FROM cart WHERE uid = $1 ORDER BY date, pid, vid`,
+	selectItem:  `SELECT uid, pid, vid, quantity, price, currency, date FROM cart WHERE uid = $1 AND pid = $2 AND vid = $3`,
+	insertItem: `INSERT INTO cart (uid, pid, vid, quantity, price, currency, date) VALUES ($1, $2, $3, $4, $5, $6, $7)
+	ON CONFLICT (uid, pid, vid) DO UPDATE SET quantity=MIN(quantity+excluded.quantity, $8)`,
+	updateItem: `UPDATE cart SET quantity=$1 WHERE uid=$2 AND pid=$3 AND vid=$4`,
+	deleteItem: `DELETE FROM cart WHERE uid=$1 AND pid=$2 AND vid=$3`,
+	deleteAll:  `DELETE FROM cart WHERE uid=$1`,
+	refreshPrices: `UPDATE cart SET price=COALESCE(
+		(SELECT price FROM variant WHERE variant.vid = cart.vid),
+		(SELECT price FROM product WHERE product.pid = cart.pid)),
+		currency=(SELECT currency FROM product WHERE product.pid = cart.pid)
+	WHERE uid=$1 AND pid IN (SELECT pid FROM product WHERE published)`,
+	deleteOtherCurrency: `DELETE FROM cart WHERE uid=$1 AND currency !=
+		(SELECT currency FROM cart WHERE uid=$1 ORDER BY date, pid, vid LIMIT 1)`,
+	deleteDeletedProduct: `DELETE FROM cart WHERE uid=$1 AND (pid NOT IN (SELECT pid FROM product WHERE published)
+	OR (vid != 0 AND vid NOT IN (SELECT vid FROM variant))
+	OR (vid = 0 AND pid IN (SELECT pid FROM variant)))`,
+	deleteSoldOut: `DELETE FROM cart WHERE uid=$1 AND vid IN (SELECT vid FROM variant WHERE stock <= 0)`,
+	capStock: `UPDATE cart SET quantity=(SELECT stock FROM variant WHERE variant.vid = cart.vid)
+	WHERE uid=$1 AND quantity > (SELECT stock FROM variant WHERE variant.vid = cart.vid)`,
+}
+
+var guestCartQueries = cartQueries{
+	selectItems: `SELECT 0, pid, vid, quantity, price, currency, date FROM guestcart WHERE gid = $1 ORDER BY date, pid, vid`,
+	selectItem:  `SELECT 0, pid, vid, quantity, price, currency, date FROM guestcart WHERE gid = $1 AND pid = $2 AND vid = $3`,
+	insertItem: `INSERT INTO guestcart (gid, pid, vid, quantity, price, currency, date) VALUES ($1, $2, $3, $4, $5, $6, $7)
+	ON CONFLICT (gid, pid, vid) DO UPDATE SET quantity=MIN(quantity+excluded.quantity, $8)`,
+	updateItem: `UPDATE guestcart SET quantity=$1 WHERE gid=$2 AND pid=$3 AND vid=$4`,
+	deleteItem: `DELETE FROM guestcart WHERE gid=$1 AND pid=$2 AND vid=$3`,
+	deleteAll:  `DELETE FROM guestcart WHERE gid=$1`,
+	refreshPrices: `UPDATE guestcart SET price=COALESCE(
+		(SELECT price FROM variant WHERE variant.vid = guestcart.vid),
+		(SELECT price FROM product WHERE product.pid = guestcart.pid)),
+		currency=(SELECT currency FROM product WHERE product.pid = guestcart.pid)
+	WHERE gid=$1 AND pid IN (SELECT pid FROM product WHERE published)`,
+	deleteOtherCurrency: `DELETE FROM guestcart WHERE gid=$1 AND currency !=
+		(SELECT currency FROM guestcart WHERE gid=$1 ORDER BY date, pid, vid LIMIT 1)`,
+	deleteDeletedProduct: `DELETE FROM guestcart WHERE gid=$1 AND (pid NOT IN (SELECT pid FROM product WHERE published)
+	OR (vid != 0 AND vid NOT IN (SELECT vid FROM variant))
+	OR (vid = 0 AND pid IN (SELECT pid FROM variant)))`,
+	deleteSoldOut: `DELETE FROM guestcart WHERE gid=$1 AND vid IN (SELECT vid FROM variant WHERE stock <= 0)`,
+	capStock: `UPDATE guestcart SET quantity=(SELECT stock FROM variant WHERE variant.vid = guestcart.vid)
+	WHERE gid=$1 AND quantity > (SELECT stock FROM variant WHERE variant.vid = guestcart.vid)`,
+}
+
+var deleteCart = userCartQueries.deleteAll
+
+// selectCheckoutItems returns the cart items with the current product price,
+// or a null price if the product is deleted or a draft, the variant of the item, if any,
+// and whether the product has variants.
+var selectCheckoutItems = `SELECT cart.pid, cart.vid, cart.quantity, cart.price, cart.currency, product.price, product.currency,
+	variant.vid, variant.price, EXISTS (SELECT 1 FROM variant WHERE variant.pid = cart.pid)
+	FROM cart LEFT JOIN product ON cart.pid = product.pid AND product.published
+	LEFT JOIN variant ON cart.vid = variant.vid AND cart.pid = variant.pid
+	WHERE cart.uid = $1 ORDER BY cart.date, cart.pid, cart.vid`
+var insertCheckoutOrderProduct = `INSERT INTO orderproduct (oid, pid, vid, quantity, price, currency) VALUES ($1, $2, $3, $4, $5, $6)`
+var takeVariantStock = `UPDATE variant SET stock=stock-$1 WHERE vid=$2 AND stock >= $1`
+
+var upsertGuest = `INSERT INTO guest (gid, expires) VALUES ($1, $2)
+	ON CONFLICT (gid) DO UPDATE SET expires=excluded.expires`
+var deleteGuest = `DELETE FROM guest WHERE gid=$1`
+var deleteExpiredGuestCarts = `DELETE FROM guestcart WHERE gid IN (SELECT gid FROM guest WHERE expires < $1)`
+var deleteExpiredGuests = `DELETE FROM guest WHERE expires < $1`
+
+// mergeGuestCart moves the items of the guest cart $2 into the cart of the user $1.
+// The quantities of items in both carts are summed up to $3,
+// and to the stock of the variant, keeping at least 1.
+// (WHERE true tells the upsert from a join, as sqlite requires.)
+var mergeGuestCart = `INSERT INTO cart (uid, pid, vid, quantity, price, currency, date)
+	SELECT $1, pid, vid, quantity, price, currency, date FROM guestcart WHERE gid = $2 AND true
+	ON CONFLICT (uid, pid, vid) DO UPDATE SET quantity=MAX(1, MIN(cart.quantity+excluded.quantity, $3,
+		COALESCE((SELECT stock FROM variant WHERE variant.vid = excluded.vid), $3)))`
+
+var (
+	// ErrCartEmpty is returned when a cart without items is checked out.
+	ErrCartEmpty = errors.New("empty cart")
+	// ErrCartChanged is returned when a cart is checked out
+	// while a product or variant in it is deleted or repriced.
+	ErrCartChanged = errors.New("cart products changed")
+	// ErrOutOfStock is returned when a cart is checked out
+	// with more items of a variant than its stock.
+	ErrOutOfStock = errors.New("variant out of stock")
+)
+
+// cartOf returns the queries of the cart of the owner,
+// and the uid or gid the queries take.
+func cartOf(owner model.CartOwner) (cartQueries, interface{}) {
+	if owner.IsGuest() {
+		return guestCartQueries, owner.GID
+	}
+	return userCartQueries, owner.UID
+}
+
+func (db *Database) SelectCartItems(ctx context.Context, owner model.CartOwner) ([]model.CartItem, error) {
+	items := []model.CartItem{}
+
+	q, key := cartOf(owner)
+
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	rows, err := db.QueryContext(ctx, q.selectItems, key)
+	if err != nil {
+		return nil, errors.Errorf("transaction execution failure")
+	}
+	defer rows.Close()
+
+	for {
+		if !rows.Next() {
+			break
+		}
+
+		item := model.CartItem{}
+		if err = rows.Scan(&item.UID, &item.PID, &item.VID, &item.Quantity, &item.Price.Amount, &item.Price.Currency, &item.Date); err != nil {
+			return nil, errors.Errorf("column scanning failure")
+		}
+
+		items = append(items, item)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, errors.Errorf("rows iteration failure")
+	}
+
+	return items, nil
+}
+
+func (db *Database) SelectCartItem(ctx context.Context, owner model.CartOwner, pid, vid int64) (*model.CartItem, error) {
+	item := model.CartItem{}
+
+	q, key := cartOf(owner)
+
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	err := db.QueryRowContext(ctx, q.selectItem, key, pid, vid).Scan(&item.UID, &item.PID, &item.VID, &item.Quantity, &item.Price.Amount, &item.Price.Currency, &item.Date)
+	if err == nil {
+		return &item, nil
+	}
+
+	if err.Error() != "sql: no rows in result set" {
+		return nil, errors.Errorf("select cart item failure")
+	}
+
+	return nil, nil
+}
+
+// InsertCartItem puts the product or its variant of the price in the cart,
+// or adds the quantity to the item if it is already in the cart, up to max.
+func (db *Database) InsertCartItem(ctx context.Context, owner model.CartOwner, pid, vid, quantity int64, price model.Money, max int64) error {
+	q, key := cartOf(owner)
+
+	_, err := db.Exec(
+		ctx,
+		q.insertItem,
+		key,
+		pid,
+		vid,
+		quantity,
+		price.Amount,
+		price.Currency,
+		time.Now().Unix(),
+		max,
+	)
+	if err != nil {
+		return errors.Errorf("transaction execution failure")
+	}
+
+	return nil
+}
+
+func (db *Database) UpdateCartItem(ctx context.Context, owner model.CartOwner, pid, vid, quantity int64) error {
+	q, key := cartOf(owner)
+
+	_, err := db.Exec(
+		ctx,
+		q.updateItem,
+		quantity,
+		key,
+		pid,
+		vid,
+	)
+	if err != nil {
+		return errors.Errorf("transaction execution failure")
+	}
+
+	return nil
+}
+
+func (db *Database) DeleteCartItem(ctx context.Context, owner model.CartOwner, pid, vid int64) error {
+	q, key := cartOf(owner)
+
+	_, err := db.Exec(
+		ctx,
+		q.deleteItem,
+		key,
+		pid,
+		vid,
+	)
+	if err != nil {
+		return errors.Errorf("transaction execution failure")
+	}
+
+	return nil
+}
+
+func (db *Database) DeleteCart(ctx context.Context, owner model.CartOwner) error {
+	q, key := cartOf(owner)
+
+	_, err := db.Exec(
+		ctx,
+		q.deleteAll,
+		key,
+	)
+	if err != nil {
+		return errors.Errorf("transaction execution failure")
+	}
+
+	return nil
+}
+
+// RefreshCart accepts the current prices of the products in the cart,
+// removes the items of deleted or unpublished products, of deleted variants and of sold out variants,
+// and lowers the quantities of the others to their stock.
+// Then the items priced in another currency than the earliest item are removed.
+func (db *Database) RefreshCart(ctx context.Context, owner model.CartOwner) error {
+	q, key := cartOf(owner)
+
+	err := db.Transaction(ctx, func(ctx context.Context, tx *sql.Tx) error {
+		for _, query := range []string{q.deleteDeletedProduct, q.deleteSoldOut, q.capStock} {
+			if _, err := tx.ExecContext(ctx, query, key); err != nil {
+				return err
+			}
+		}
+
+		if _, err := tx.ExecContext(ctx, q.refreshPrices, key); err != nil {
+			return err
+		}
+
+		_, err := tx.ExecContext(ctx, q.deleteOtherCurrency, key)
+		return err
+	})
+	if err != nil {
+		return errors.Errorf("transaction execution failure")
+	}
+
+	return nil
+}
+
+// CheckoutCart turns the cart into an order of the user and empties it
+// in a single transaction, and returns the oid of the order.
+// The stock of the ordered variants is taken in the same transaction,
+// and the exchange rate to the currency the user chose, if any, is recorded in the order.
+// The promotions are applied to the order, and the coupon is redeemed for it
+// in the same transaction unless the code is empty,
+// and the errors of redeeming it are returned as they are, see IsCouponError.
+// It returns ErrCartEmpty if the cart has no items,
+// ErrCartChanged if a product or variant in the cart is deleted or repriced,
+// model.ErrCurrencyMismatch if the items are priced in different currencies or another than the rate base,
+// and ErrOutOfStock if a variant has less stock than the quantity.
+func (db *Database) CheckoutCart(ctx context.Context, uid int64, rate *model.ExchangeRate, coupon string) (int64, error) {
+	var oid int64
+
+	err := db.Transaction(ctx, func(ctx context.Context, tx *sql.Tx) error {
+		items, err := checkoutItems(ctx, tx, uid)
+		if err != nil {
+			return err
+		}
+
+		if len(items) == 0 {
+			return ErrCartEmpty
+		}
+
+		if rate != nil && items[0].Price.Currency != rate.Base {
+			return model.ErrCurrencyMismatch
+		}
+
+		res, err := tx.ExecContext(ctx, insertOrder, append([]interface{}{uid, time.Now().Unix()}, orderRate(rate)...)...)
+		if err != nil {
+			return err
+		}
+
+		if oid, err = res.LastInsertId(); err != nil {
+			return err
+		}
+
+		ordered := []model.OrderProduct{}
+
+		for _, item := range items {
+			ordered = append(ordered, model.OrderProduct{OID: oid, PID: item.PID, VID: item.VID, Quantity: item.Quantity, Price: item.Price})
+
+			if _, err := tx.ExecContext(ctx, insertCheckoutOrderProduct, oid, item.PID, item.VID, item.Quantity, item.Price.Amount, item.Price.Currency); err != nil {
+				return err
+			}
+
+			if item.VID == 0 {
+				continue
+			}
+
+			res, err := tx.ExecContext(ctx, takeVariantStock, item.Quantity, item.VID)
+			if err != nil {
+				return err
+			}
+
+			if n, err := res.RowsAffected(); err != nil {
+				return err
+			} else if n == 0 {
+				return ErrOutOfStock
+			}
+		}
+
+		promoted, err := promoteOrder(ctx, tx, oid, ordered)
+		if err != nil {
+			return err
+		}
+
+		if coupon != "" {
+			if err := redeemCoupon(ctx, tx, coupon, uid, oid, ordered, promoted); err != nil {
+				return err
+			}
+		}
+
+		_, err = tx.ExecContext(ctx, deleteCart, uid)
+		return err
+	})
+	if err == ErrCartEmpty || err == ErrCartChanged || err == ErrOutOfStock || err == model.ErrCurrencyMismatch || IsCouponError(err) {
+		return 0, err
+	}
+	if err != nil {
+		return 0, errors.Errorf("transaction execution failure")
+	}
+
+	return oid, nil
+}
+
+// checkoutItems returns the items of the cart
+// if all of them are ordered at the price the user saw, in a single currency.
+func checkoutItems(ctx context.Context, tx *sql.Tx, uid int64) ([]model.CartItem, error) {
+	rows, err := tx.QueryContext(ctx, selectCheckoutItems, uid)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	items := []model.CartItem{}
+
+	for rows.Next() {
+		item := model.CartItem{UID: uid}
+		var current, vid, variantPrice sql.NullInt64
+		var currency sql.NullString
+		var hasVariants bool
+
+		if err := rows.Scan(&item.PID, &item.VID, &item.Quantity, &item.Price.Amount, &item.Price.Currency,
+			&current, &currency, &vid, &variantPrice, &hasVariants); err != nil {
+			return nil, err
+		}
+
+		if item.VID != 0 && !vid.Valid || item.VID == 0 && hasVariants {
+			return nil, ErrCartChanged
+		}
+
+		if current.Valid && variantPrice.Valid {
+			current = variantPrice
+		}
+
+		if !current.Valid || current.Int64 != item.Price.Amount || currency.String != string(item.Price.Currency) {
+			return nil, ErrCartChanged
+		}
+
+		if len(items) > 0 && items[0].Price.Currency != item.Price.Currency {
+			return nil, model.ErrCurrencyMismatch
+		}
+
+		items = append(items, item)
+	}
+
+	return items, rows.Err()
+}
+
+// TouchGuest keeps the cart of the guest until the time.
+func (db *Database) TouchGuest(ctx context.Context, gid string, expires time.Time) error {
+	_, err := db.Exec(
+		ctx,
+		upsertGuest,
+		gid,
+		expires.Unix(),
+	)
+	if err != nil {
+		return errors.Errorf("transaction execution failure")
+	}
+
+	return nil
+}
+
+// MergeGuestCart moves the items of the guest cart into the cart of the user
+// and deletes the guest cart, in a single transaction.
+// The quantities of items in both carts are summed up to model.MaxCartQuantity
+// and the stock of their variant, and the user cart keeps the price of its items.
+func (db *Database) MergeGuestCart(ctx context.Context, gid string, uid int64) error {
+	err := db.Transaction(ctx, func(ctx context.Context, tx *sql.Tx) error {
+		if _, err := tx.ExecContext(ctx, mergeGuestCart, uid, gid, model.MaxCartQuantity); err != nil {
+			return err
+		}
+
+		if _, err := tx.ExecContext(ctx, guestCartQueries.deleteAll, gid); err != nil {
+			return err
+		}
+
+		_, err := tx.ExecContext(ctx, deleteGuest, gid)
+		return err
+	})
+	if err != nil {
+		return errors.Errorf("transaction execution failure")
+	}
+
+	return nil
+}
+
+// DeleteExpiredGuestCarts deletes the guest carts expired before the time.
+func (db *Database) DeleteExpiredGuestCarts(ctx context.Context, before time.Time) error {
+	err := db.Transaction(ctx, func(ctx context.Context, tx *sql.Tx) error {
+		if _, err := tx.ExecContext(ctx, deleteExpiredGuestCarts, before.Unix()); err != nil {
+			return err
+		}
+
+		_, err := tx.ExecContext(ctx, deleteExpiredGuests, before.Unix())
+		return err
+	})
+	if err != nil {
+		return errors.Errorf("transaction execution failure")
+	}
+
+	return nil
+}
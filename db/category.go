@@ -0,0 +1,304 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"simple-go-server/model"
+
+	"github.com/pkg/errors"
+)
+
+var createCategoryTableQuery = `CREATE TABLE category (
+	cid integer primary key autoincrement,
+	parent integer NOT NULL DEFAULT 0,
+	name text,
+	slug text unique,
+	position integer NOT NULL DEFAULT 0);`
+var createProductCategoryTableQuery = `CREATE TABLE productcategory (
+	pid integer,
+	cid integer,
+	primary key (pid, cid));`
+var createProductCategoryIndexQuery = `CREATE INDEX productcategory_cid ON productcategory (cid);`
+
+var selectCategory = `SELECT cid, parent, name, slug, position FROM category WHERE cid = $1`
+var selectCategories = `SELECT cid, parent, name, slug, position FROM category ORDER BY parent, position, cid`
+var insertCategory = `INSERT INTO category (parent, name, slug, position) VALUES ($1, $2, $3, $4)`
+var updateCategory = `UPDATE category SET parent=$1, name=$2, slug=$3, position=$4 WHERE cid=$5`
+var deleteCategory = `DELETE FROM category WHERE cid=$1`
+var countCategoryChildren = `SELECT COUNT(*) FROM category WHERE parent = $1`
+
+// categoryTree selects the cid $1 and the cids of all its descendants.
+var categoryTree = `WITH RECURSIVE tree(cid) AS (
+	SELECT $1
+	UNION SELECT category.cid FROM category JOIN tree ON category.parent = tree.cid)`
+
+var countCategoryDescendant = categoryTree + ` SELECT COUNT(*) FROM tree WHERE cid = $2`
+
+// drafts are listed only if $2 is true.
+var selectCategoryProducts = categoryTree + ` SELECT ` + productColumns + ` FROM product
+	WHERE pid IN (SELECT pid FROM productcategory WHERE cid IN tree) AND (published OR $2)
+	ORDER BY pid LIMIT $3 OFFSET $4`
+var countCategoryProducts = categoryTree + ` SELECT COUNT(*) FROM product
+	WHERE pid IN (SELECT pid FROM productcategory WHERE cid IN tree) AND (published OR $2)`
+
+var selectProductCategories = `SELECT cid FROM productcategory WHERE pid = $1 ORDER BY cid`
+var insertProductCategory = `INSERT INTO productcategory (pid, cid) VALUES ($1, $2)`
+var deleteProductCategories = `DELETE FROM productcategory WHERE pid=$1`
+var deleteCategoryProducts = `DELETE FROM productcategory WHERE cid=$1`
+
+var (
+	// ErrSlugTaken is returned when the slug is already used by another category.
+	ErrSlugTaken = errors.New("category slug already used")
+	// ErrCategoryCycle is returned when a category would become
+	// a descendant of itself.
+	ErrCategoryCycle = errors.New("category cycle")
+	// ErrCategoryHasChildren is returned when a category with children is deleted.
+	ErrCategoryHasChildren = errors.New("category has children")
+)
+
+func scanCategory(s scanner, c *model.Category) error {
+	return s.Scan(&c.CID, &c.Parent, &c.Name, &c.Slug, &c.Position)
+}
+
+func (db *Database) SelectCategory(ctx context.Context, cid int64) (*model.Category, error) {
+	category := model.Category{}
+
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	err := scanCategory(db.QueryRowContext(ctx, selectCategory, cid), &category)
+	if err == nil {
+		return &category, nil
+	}
+
+	if err.Error() != "sql: no rows in result set" {
+		return nil, errors.Errorf("select category failure")
+	}
+
+	return nil, nil
+}
+
+// SelectCategories returns all categories ordered by parent and position.
+func (db *Database) SelectCategories(ctx context.Context) ([]model.Category, error) {
+	categories := []model.Category{}
+
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	rows, err := db.QueryContext(ctx, selectCategories)
+	if err != nil {
+		return nil, errors.Errorf("transaction execution failure")
+	}
+	defer rows.Close()
+
+	for {
+		if !rows.Next() {
+			break
+		}
+
+		category := model.Category{}
+		if err = scanCategory(rows, &category); err != nil {
+			return nil, errors.Errorf("column scanning failure")
+		}
+
+		categories = append(categories, category)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, errors.Errorf("rows iteration failure")
+	}
+
+	return categories, nil
+}
+
+// InsertCategory inserts the category under its parent.
+// It returns ErrSlugTaken if the slug is used by another category.
+func (db *Database) InsertCategory(ctx context.Context, c model.Category) (int64, error) {
+	result, err := db.Exec(
+		ctx,
+		insertCategory,
+		c.Parent,
+		c.Name,
+		c.Slug,
+		c.Position,
+	)
+	if isUniqueViolation(err) {
+		return 0, ErrSlugTaken
+	}
+	if err != nil {
+		return 0, errors.Errorf("transaction execution failure")
+	}
+
+	cid, err := result.LastInsertId()
+	if err != nil {
+		return 0, errors.Errorf("invalid result, no cid")
+	}
+
+	return cid, nil
+}
+
+// UpdateCategory updates the category, moving it under its parent.
+// It returns ErrCategoryCycle if the parent is the category or its descendant,
+// and ErrSlugTaken if the slug is used by another category.
+func (db *Database) UpdateCategory(ctx context.Context, c model.Category) error {
+	err := db.Transaction(ctx, func(ctx context.Context, tx *sql.Tx) error {
+		if c.Parent != 0 {
+			var n int64
+			if err := tx.QueryRowContext(ctx, countCategoryDescendant, c.CID, c.Parent).Scan(&n); err != nil {
+				return err
+			}
+
+			if n > 0 {
+				return ErrCategoryCycle
+			}
+		}
+
+		_, err := tx.ExecContext(ctx, updateCategory, c.Parent, c.Name, c.Slug, c.Position, c.CID)
+		if isUniqueViolation(err) {
+			return ErrSlugTaken
+		}
+		return err
+	})
+	if err == ErrCategoryCycle || err == ErrSlugTaken {
+		return err
+	}
+	if err != nil {
+		return errors.Errorf("transaction execution failure")
+	}
+
+	return nil
+}
+
+// DeleteCategory deletes the category and unassigns its products.
+// It returns ErrCategoryHasChildren if the category has children,
+// which must be moved or deleted first.
+func (db *Database) DeleteCategory(ctx context.Context, cid int64) error {
+	err := db.Transaction(ctx, func(ctx context.Context, tx *sql.Tx) error {
+		var n int64
+		if err := tx.QueryRowContext(ctx, countCategoryChildren, cid).Scan(&n); err != nil {
+			return err
+		}
+
+		if n > 0 {
+			return ErrCategoryHasChildren
+		}
+
+		if _, err := tx.ExecContext(ctx, deleteCategoryProducts, cid); err != nil {
+			return err
+		}
+
+		_, err := tx.ExecContext(ctx, deleteCategory, cid)
+		return err
+	})
+	if err == ErrCategoryHasChildren {
+		return err
+	}
+	if err != nil {
+		return errors.Errorf("transaction execution failure")
+	}
+
+	return nil
+}
+
+// SelectCategoryProducts returns the products assigned to the category
+// or any of its descendants, ordered by pid. Drafts are included only if drafts is true.
+func (db *Database) SelectCategoryProducts(ctx context.Context, cid int64, drafts bool, limit, offset int) ([]model.Product, error) {
+	products := []model.Product{}
+
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	rows, err := db.QueryContext(ctx, selectCategoryProducts, cid, drafts, limit, offset)
+	if err != nil {
+		return nil, errors.Errorf("transaction execution failure")
+	}
+	defer rows.Close()
+
+	for {
+		if !rows.Next() {
+			break
+		}
+
+		product := model.Product{}
+		if err = scanProduct(rows, &product); err != nil {
+			return nil, errors.Errorf("column scanning failure")
+		}
+
+		products = append(products, product)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, errors.Errorf("rows iteration failure")
+	}
+
+	return products, nil
+}
+
+// CountCategoryProducts counts the products listed by SelectCategoryProducts.
+func (db *Database) CountCategoryProducts(ctx context.Context, cid int64, drafts bool) (int64, error) {
+	var count int64
+
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	if err := db.QueryRowContext(ctx, countCategoryProducts, cid, drafts).Scan(&count); err != nil {
+		return 0, errors.Errorf("count category products failure")
+	}
+
+	return count, nil
+}
+
+// SelectProductCategories returns the cids of the categories of the product.
+func (db *Database) SelectProductCategories(ctx context.Context, pid int64) ([]int64, error) {
+	cids := []int64{}
+
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	rows, err := db.QueryContext(ctx, selectProductCategories, pid)
+	if err != nil {
+		return nil, errors.Errorf("transaction execution failure")
+	}
+	defer rows.Close()
+
+	for {
+		if !rows.Next() {
+			break
+		}
+
+		var cid int64
+		if err = rows.Scan(&cid); err != nil {
+			return nil, errors.Errorf("column scanning failure")
+		}
+
+		cids = append(cids, cid)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, errors.Errorf("rows iteration failure")
+	}
+
+	return cids, nil
+}
+
+// SetProductCategories replaces the categories of the product.
+func (db *Database) SetProductCategories(ctx context.Context, pid int64, cids []int64) error {
+	err := db.Transaction(ctx, func(ctx context.Context, tx *sql.Tx) error {
+		if _, err := tx.ExecContext(ctx, deleteProductCategories, pid); err != nil {
+			return err
+		}
+
+		for _, cid := range cids {
+			if _, err := tx.ExecContext(ctx, insertProductCategory, pid, cid); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return errors.Errorf("transaction execution failure")
+	}
+
+	return nil
+}
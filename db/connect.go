@@ -1,6 +1,7 @@
 package db
 
 import (
+	"context"
 	"simple-go-server/model"
 
 	_ "github.com/mattn/go-sqlite3"
@@ -45,26 +46,38 @@ func Init() error {
 		return nil
 	}
 
-	db = new(Database)
+	d := new(Database)
 
-	if err := db.Connect(); err != nil {
+	if err := d.Connect(); err != nil {
 		return err
 	}
 
-	if _, err := db.Exec(createUserTableQuery); err != nil {
+	ctx := context.Background()
+
+	if err := d.Migrate(ctx); err != nil {
+		d.Close()
 		return err
 	}
 
-	if _, err := db.Exec(createProductTableQuery); err != nil {
+	if err := d.seed(ctx); err != nil {
+		d.Close()
 		return err
 	}
 
-	if _, err := db.Exec(createOrderTableQuery); err != nil {
+	db = d
+
+	return nil
+}
+
+// seed inserts the initial manager account if it does not exist yet.
+func (db *Database) seed(ctx context.Context) error {
+	master, err := db.SelectUser(ctx, "master01")
+	if err != nil {
 		return err
 	}
 
-	if _, err := db.Exec(createOrderProductQuery); err != nil {
-		return err
+	if master != nil {
+		return nil
 	}
 
 	masterPw, err := model.Password("pwmaster01++").Hash()
@@ -72,9 +85,22 @@ func Init() error {
 		return err
 	}
 
-	if _, err := db.Exec(insertUser, "master01", "manager", masterPw); err != nil {
+	if _, err := db.Exec(ctx, insertUser, "master01", "manager", masterPw, "", "", ""); err != nil {
 		return err
 	}
 
 	return nil
 }
+
+// Close closes the global Database instance.
+// Init must be called again before the database is used after Close.
+func Close() error {
+	if db == nil {
+		return nil
+	}
+
+	err := db.Close()
+	db = nil
+
+	return err
+}
@@ -0,0 +1,372 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"simple-go-server/model"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// the restrictions of a coupon are stored as json arrays of ids.
+var createCouponTableQuery = `CREATE TABLE coupon (
+	code text primary key,
+	kind text,
+	percent integer,
+	amount integer,
+	minorder integer,
+	currency text,
+	products text,
+	categories text,
+	maxuses integer,
+	maxusesperuser integer,
+	starts integer,
+	ends integer);`
+
+// a redemption is inserted with the order it was redeemed by,
+// and the redemptions of a coupon are counted against its caps.
+var createCouponRedemptionTableQuery = `CREATE TABLE couponredemption (
+	code text,
+	uid integer,
+	oid integer,
+	date integer);`
+var createCouponRedemptionIndexQuery = `CREATE INDEX couponredemption_code ON couponredemption (code, uid);`
+
+var createOrderDiscountTableQuery = `CREATE TABLE orderdiscount (
+	oid integer,
+	pid integer,
+	vid integer,
+	source text,
+	ref text,
+	description text,
+	amount integer,
+	currency text);`
+var createOrderDiscountIndexQuery = `CREATE INDEX orderdiscount_oid ON orderdiscount (oid);`
+
+var couponColumns = `code, kind, percent, amount, minorder, currency, products, categories, maxuses, maxusesperuser, starts, ends,
+	(SELECT COUNT(*) FROM couponredemption WHERE couponredemption.code = coupon.code)`
+
+var selectCoupon = `SELECT ` + couponColumns + ` FROM coupon WHERE code = $1`
+var selectCoupons = `SELECT ` + couponColumns + ` FROM coupon ORDER BY code`
+var insertCoupon = `INSERT INTO coupon (code, kind, percent, amount, minorder, currency, products, categories, maxuses, maxusesperuser, starts, ends)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)`
+var deleteCoupon = `DELETE FROM coupon WHERE code=$1`
+var deleteCouponRedemptions = `DELETE FROM couponredemption WHERE code=$1`
+
+// insertCouponRedemption redeems the coupon $1 by the user $2 for the order $3
+// unless a cap is reached, counting and inserting in a single statement,
+// so that concurrent redemptions never exceed the caps.
+var insertCouponRedemption = `INSERT INTO couponredemption (code, uid, oid, date)
+	SELECT $1, $2, $3, $4 FROM coupon WHERE code = $1
+	AND (maxuses = 0 OR (SELECT COUNT(*) FROM couponredemption WHERE code = $1) < maxuses)
+	AND (maxusesperuser = 0 OR (SELECT COUNT(*) FROM couponredemption WHERE code = $1 AND uid = $2) < maxusesperuser)`
+var countUserCouponRedemptions = `SELECT COUNT(*) FROM couponredemption WHERE code = $1 AND uid = $2`
+var deleteOrderCouponRedemptions = `DELETE FROM couponredemption WHERE oid=$1`
+
+// selectCategoryTreeProducts selects the products of the category $1 and its descendants.
+var selectCategoryTreeProducts = categoryTree + ` SELECT pid FROM productcategory WHERE cid IN tree`
+
+var selectOrderDiscounts = `SELECT oid, pid, vid, source, ref, description, amount, currency FROM orderdiscount WHERE oid = $1 ORDER BY rowid`
+var insertOrderDiscount = `INSERT INTO orderdiscount (oid, pid, vid, source, ref, description, amount, currency) VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`
+var deleteOrderDiscounts = `DELETE FROM orderdiscount WHERE oid=$1`
+
+var (
+	// ErrCouponTaken is returned when a coupon is created with the code of another.
+	ErrCouponTaken = errors.New("coupon code already used")
+	// ErrCouponNotFound is returned when an order is placed with an unknown coupon.
+	ErrCouponNotFound = errors.New("coupon not found")
+	// ErrCouponExhausted is returned when a coupon is redeemed as many times as it may be.
+	ErrCouponExhausted = errors.New("coupon usage limit reached")
+	// ErrCouponUserLimit is returned when a user redeemed a coupon as many times as a user may.
+	ErrCouponUserLimit = errors.New("coupon usage limit of the user reached")
+)
+
+// couponErrors are the errors of redeeming a coupon, returned as they are by the transactions.
+var couponErrors = []error{
+	ErrCouponNotFound, ErrCouponExhausted, ErrCouponUserLimit,
+	model.ErrCouponInactive, model.ErrCouponCurrency, model.ErrCouponMinOrder, model.ErrCouponNotEligible,
+}
+
+// IsCouponError returns true if the error tells why a coupon cannot be redeemed.
+func IsCouponError(err error) bool {
+	for _, e := range couponErrors {
+		if err == e {
+			return true
+		}
+	}
+	return false
+}
+
+func scanCoupon(s scanner, c *model.Coupon) error {
+	var currency model.Currency
+	var products, categories string
+
+	err := s.Scan(&c.Code, &c.Kind, &c.Percent, &c.Amount.Amount, &c.MinOrder.Amount, &currency,
+		&products, &categories, &c.MaxUses, &c.MaxUsesPerUser, &c.Starts, &c.Ends, &c.Uses)
+	if err != nil {
+		return err
+	}
+
+	c.Amount.Currency = currency
+	c.MinOrder.Currency = currency
+
+	if err := json.Unmarshal([]byte(products), &c.Products); err != nil {
+		return err
+	}
+
+	return json.Unmarshal([]byte(categories), &c.Categories)
+}
+
+// InsertCoupon inserts the coupon.
+// It returns ErrCouponTaken if another coupon has the code.
+func (db *Database) InsertCoupon(ctx context.Context, c model.Coupon) error {
+	if c.Products == nil {
+		c.Products = []int64{}
+	}
+	if c.Categories == nil {
+		c.Categories = []int64{}
+	}
+
+	products, err := json.Marshal(c.Products)
+	if err != nil {
+		return errors.Errorf("invalid coupon products")
+	}
+
+	categories, err := json.Marshal(c.Categories)
+	if err != nil {
+		return errors.Errorf("invalid coupon categories")
+	}
+
+	_, err = db.Exec(
+		ctx,
+		insertCoupon,
+		c.Code,
+		c.Kind,
+		c.Percent,
+		c.Amount.Amount,
+		c.MinOrder.Amount,
+		c.Amount.Currency,
+		string(products),
+		string(categories),
+		c.MaxUses,
+		c.MaxUsesPerUser,
+		c.Starts,
+		c.Ends,
+	)
+	if isUniqueViolation(err) {
+		return ErrCouponTaken
+	}
+	if err != nil {
+		return errors.Errorf("transaction execution failure")
+	}
+
+	return nil
+}
+
+func (db *Database) SelectCoupon(ctx context.Context, code string) (*model.Coupon, error) {
+	c := model.Coupon{}
+
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	err := scanCoupon(db.QueryRowContext(ctx, selectCoupon, code), &c)
+	if err == nil {
+		return &c, nil
+	}
+
+	if err.Error() != "sql: no rows in result set" {
+		return nil, errors.Errorf("select coupon failure")
+	}
+
+	return nil, nil
+}
+
+func (db *Database) SelectCoupons(ctx context.Context) ([]model.Coupon, error) {
+	coupons := []model.Coupon{}
+
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	rows, err := db.QueryContext(ctx, selectCoupons)
+	if err != nil {
+		return nil, errors.Errorf("transaction execution failure")
+	}
+	defer rows.Close()
+
+	for {
+		if !rows.Next() {
+			break
+		}
+
+		c := model.Coupon{}
+		if err = scanCoupon(rows, &c); err != nil {
+			return nil, errors.Errorf("column scanning failure")
+		}
+
+		coupons = append(coupons, c)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, errors.Errorf("rows iteration failure")
+	}
+
+	return coupons, nil
+}
+
+// DeleteCoupon deletes the coupon with its redemptions.
+// Orders keep the discounts of the coupon.
+func (db *Database) DeleteCoupon(ctx context.Context, code string) error {
+	err := db.Transaction(ctx, func(ctx context.Context, tx *sql.Tx) error {
+		if _, err := tx.ExecContext(ctx, deleteCouponRedemptions, code); err != nil {
+			return err
+		}
+
+		_, err := tx.ExecContext(ctx, deleteCoupon, code)
+		return err
+	})
+	if err != nil {
+		return errors.Errorf("transaction execution failure")
+	}
+
+	return nil
+}
+
+// SelectOrderDiscounts returns the discounts of the order in the order they were granted.
+func (db *Database) SelectOrderDiscounts(ctx context.Context, oid int64) ([]model.OrderDiscount, error) {
+	discounts := []model.OrderDiscount{}
+
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	rows, err := db.QueryContext(ctx, selectOrderDiscounts, oid)
+	if err != nil {
+		return nil, errors.Errorf("transaction execution failure")
+	}
+	defer rows.Close()
+
+	for {
+		if !rows.Next() {
+			break
+		}
+
+		d := model.OrderDiscount{}
+		if err = rows.Scan(&d.OID, &d.PID, &d.VID, &d.Source, &d.Ref, &d.Description, &d.Amount.Amount, &d.Amount.Currency); err != nil {
+			return nil, errors.Errorf("column scanning failure")
+		}
+
+		discounts = append(discounts, d)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, errors.Errorf("rows iteration failure")
+	}
+
+	return discounts, nil
+}
+
+// redeemCoupon redeems the coupon by the user for the items of the order
+// in the transaction of the order, and inserts its discounts of the items
+// less their earlier discounts, e.g. of promotions.
+// The code is looked up in the transaction, so that it sees the redemptions of concurrent orders.
+func redeemCoupon(ctx context.Context, tx *sql.Tx, code string, uid, oid int64, items []model.OrderProduct, earlier []model.OrderDiscount) error {
+	c := model.Coupon{}
+
+	err := scanCoupon(tx.QueryRowContext(ctx, selectCoupon, code), &c)
+	if err == sql.ErrNoRows {
+		return ErrCouponNotFound
+	}
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+
+	if err := c.Active(now); err != nil {
+		return err
+	}
+
+	eligible, err := couponProducts(ctx, tx, &c)
+	if err != nil {
+		return err
+	}
+
+	discounts, err := c.Discounts(items, earlier, func(item model.OrderProduct) bool {
+		if eligible == nil {
+			return true
+		}
+		_, found := eligible[item.PID]
+		return found
+	})
+	if err != nil {
+		return err
+	}
+
+	res, err := tx.ExecContext(ctx, insertCouponRedemption, c.Code, uid, oid, now.Unix())
+	if err != nil {
+		return err
+	}
+
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		var uses int64
+		if err := tx.QueryRowContext(ctx, countUserCouponRedemptions, c.Code, uid).Scan(&uses); err != nil {
+			return err
+		}
+
+		if c.MaxUsesPerUser != 0 && uses >= c.MaxUsesPerUser {
+			return ErrCouponUserLimit
+		}
+		return ErrCouponExhausted
+	}
+
+	return insertOrderDiscounts(ctx, tx, oid, discounts)
+}
+
+// couponProducts returns the products the coupon is restricted to,
+// or nil if it applies to all products.
+func couponProducts(ctx context.Context, tx *sql.Tx, c *model.Coupon) (map[int64]struct{}, error) {
+	if len(c.Products) == 0 && len(c.Categories) == 0 {
+		return nil, nil
+	}
+
+	pids := map[int64]struct{}{}
+	for _, pid := range c.Products {
+		pids[pid] = struct{}{}
+	}
+
+	for _, cid := range c.Categories {
+		rows, err := tx.QueryContext(ctx, selectCategoryTreeProducts, cid)
+		if err != nil {
+			return nil, err
+		}
+
+		for rows.Next() {
+			var pid int64
+			if err := rows.Scan(&pid); err != nil {
+				rows.Close()
+				return nil, err
+			}
+			pids[pid] = struct{}{}
+		}
+
+		if err := rows.Close(); err != nil {
+			return nil, err
+		}
+	}
+
+	return pids, nil
+}
+
+func insertOrderDiscounts(ctx context.Context, tx *sql.Tx, oid int64, discounts []model.OrderDiscount) error {
+	for _, d := range discounts {
+		_, err := tx.ExecContext(ctx, insertOrderDiscount, oid, d.PID, d.VID, d.Source, d.Ref, d.Description, d.Amount.Amount, d.Amount.Currency)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
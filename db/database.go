@@ -1,49 +1,221 @@
 package db
 
 import (
+	"context"
 	"database/sql"
+	"os"
+	"strings"
+	"time"
+
+	"simple-go-server/logger"
 
 	"github.com/jmoiron/sqlx"
 )
 
+const memoryPath = ":memory:"
+
+// memoryDSN names the in-memory database with a shared cache,
+// so the data survives when a connection is discarded (e.g. on a cancelled transaction)
+// as long as the keeper connection of Database stays open.
+const memoryDSN = "file:simple-go-server?mode=memory&cache=shared"
+
+// fileDSNOptions open a database file in write-ahead logging,
+// so that readers and the single writer do not block each other,
+// and begin transactions with the write lock, waiting for it up to the busy timeout
+// instead of failing when another connection writes.
+const fileDSNOptions = "_journal_mode=WAL&_busy_timeout=5000&_txlock=immediate"
+
+const defaultQueryTimeout = 5 * time.Second
+
+// Path returns the sqlite database file path set by DB_PATH.
+// The database is kept in memory if DB_PATH is empty.
+func Path() string {
+	if p := os.Getenv("DB_PATH"); p != "" {
+		return p
+	}
+	return memoryPath
+}
+
+// InMemory returns true if the database is not persisted to a file.
+func InMemory() bool {
+	return Path() == memoryPath
+}
+
+// QueryTimeout returns the deadline of a single query set by DB_QUERY_TIMEOUT.
+func QueryTimeout() time.Duration {
+	d, err := time.ParseDuration(os.Getenv("DB_QUERY_TIMEOUT"))
+	if err != nil || d <= 0 {
+		return defaultQueryTimeout
+	}
+	return d
+}
+
 type Database struct {
 	*sqlx.DB
+	keeper  *sqlx.DB
+	timeout time.Duration
 }
 
 // Connect connects the database or verifies
 // that the database is connected normally by sqlx.DB.Ping().
 func (db *Database) Connect() error {
 	if db.DB == nil {
-		d, err := sqlx.Connect("sqlite3", ":memory:")
+		dsn := Path()
+
+		inMemory := dsn == memoryPath
+
+		if inMemory {
+			dsn = memoryDSN
+
+			keeper, err := sqlx.Connect("sqlite3", dsn)
+			if err != nil {
+				return err
+			}
+			db.keeper = keeper
+		} else if strings.Contains(dsn, "?") {
+			dsn += "&" + fileDSNOptions
+		} else {
+			dsn += "?" + fileDSNOptions
+		}
+
+		d, err := sqlx.Connect("sqlite3", dsn)
 		if err != nil {
+			db.Close()
 			return err
 		}
+
+		// tables in a shared cache are locked by the connection using them,
+		// so the in-memory database is used by a single connection.
+		if inMemory {
+			d.SetMaxOpenConns(1)
+		}
+
 		db.DB = d
+		db.timeout = QueryTimeout()
 	}
 
 	return db.Ping()
 }
 
+// Close closes the connections of db.
+// An in-memory database is dropped when it is closed.
+func (db *Database) Close() error {
+	var err error
+
+	if db.DB != nil {
+		err = db.DB.Close()
+	}
+
+	if db.keeper != nil {
+		if kerr := db.keeper.Close(); err == nil {
+			err = kerr
+		}
+	}
+
+	return err
+}
+
+// SetQueryTimeout sets the deadline of every query.
+// Queries are bounded only by their context if d is 0.
+func (db *Database) SetQueryTimeout(d time.Duration) {
+	db.timeout = d
+}
+
+// withTimeout bounds ctx by the query timeout of db.
+func (db *Database) withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if db.timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, db.timeout)
+}
+
 // Exec executes the transaction for the queries it receives
 // and returns the result as sql.Result.
-func (db *Database) Exec(query string, args ...interface{}) (sql.Result, error) {
-	tx, err := db.Begin()
+// The transaction is rolled back if ctx is done before it commits.
+func (db *Database) Exec(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	start := time.Now()
+	defer func() {
+		txDuration.Observe(time.Since(start).Seconds())
+	}()
+
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	log := logger.FromContext(ctx)
+
+	tx, err := db.BeginTx(ctx, nil)
 	if err != nil {
+		txErrors.Inc("begin")
+		txTotal.Inc("error")
+		log.Error("db transaction begin failure", "error", err)
 		return nil, err
 	}
 
-	res, err := tx.Exec(
+	res, err := tx.ExecContext(
+		ctx,
 		query,
 		args...,
 	)
 	if err != nil {
 		tx.Rollback()
+		txErrors.Inc("exec")
+		txTotal.Inc("rollback")
+		log.Error("db transaction exec failure", "error", err)
 		return nil, err
 	}
 
 	if err := tx.Commit(); err != nil {
+		txErrors.Inc("commit")
+		txTotal.Inc("error")
+		log.Error("db transaction commit failure", "error", err)
 		return nil, err
 	}
 
+	txTotal.Inc("commit")
+	log.Debug("db transaction committed", "duration", time.Since(start))
+
 	return res, nil
 }
+
+// Transaction runs fn in a single transaction, which is committed
+// if fn returns nil and rolled back otherwise.
+// The transaction is rolled back if ctx is done before it commits.
+func (db *Database) Transaction(ctx context.Context, fn func(ctx context.Context, tx *sql.Tx) error) error {
+	start := time.Now()
+	defer func() {
+		txDuration.Observe(time.Since(start).Seconds())
+	}()
+
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	log := logger.FromContext(ctx)
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		txErrors.Inc("begin")
+		txTotal.Inc("error")
+		log.Error("db transaction begin failure", "error", err)
+		return err
+	}
+
+	if err := fn(ctx, tx); err != nil {
+		tx.Rollback()
+		txErrors.Inc("exec")
+		txTotal.Inc("rollback")
+		log.Error("db transaction exec failure", "error", err)
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		txErrors.Inc("commit")
+		txTotal.Inc("error")
+		log.Error("db transaction commit failure", "error", err)
+		return err
+	}
+
+	txTotal.Inc("commit")
+	log.Debug("db transaction committed", "duration", time.Since(start))
+
+	return nil
+}
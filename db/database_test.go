@@ -0,0 +1,207 @@
+package db_test
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"simple-go-server/db"
+	"simple-go-server/model"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// slowQuery counts up to a large number to keep sqlite busy
+// until the query is interrupted.
+var slowQuery = `WITH RECURSIVE c(x) AS (SELECT 1 UNION ALL SELECT x+1 FROM c WHERE x < 1000000000) SELECT count(*) FROM c`
+
+func TestCancellation(t *testing.T) {
+	assert := assert.New(t)
+
+	d, err := db.Get()
+	assert.Nil(err)
+
+	t.Run("test select; cancelled context", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		user, err := d.SelectUser(ctx, "master01")
+		assert.NotNil(err)
+		assert.Nil(user)
+	})
+
+	t.Run("test insert; cancelled context", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		_, err := d.InsertUser(ctx, "cancelled1", "user", "hash", model.Profile{})
+		assert.NotNil(err)
+
+		user, err := d.SelectUser(context.Background(), "cancelled1")
+		assert.Nil(err)
+		assert.Nil(user)
+	})
+
+	t.Run("test exec; deadline exceeded", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+
+		start := time.Now()
+
+		_, err := d.Exec(ctx, slowQuery)
+		assert.NotNil(err)
+		assert.Less(time.Since(start), 5*time.Second)
+	})
+
+	t.Run("test exec; query timeout", func(t *testing.T) {
+		d.SetQueryTimeout(50 * time.Millisecond)
+
+		start := time.Now()
+
+		_, err := d.Exec(context.Background(), slowQuery)
+		assert.NotNil(err)
+		assert.Less(time.Since(start), 5*time.Second)
+
+		d.SetQueryTimeout(db.QueryTimeout())
+
+		user, err := d.SelectUser(context.Background(), "master01")
+		assert.Nil(err)
+		assert.NotNil(user)
+	})
+}
+
+func TestTransaction(t *testing.T) {
+	assert := assert.New(t)
+
+	d, err := db.Get()
+	assert.Nil(err)
+
+	t.Run("test transaction; rollback", func(t *testing.T) {
+		err := d.Transaction(context.Background(), func(ctx context.Context, tx *sql.Tx) error {
+			if _, err := tx.ExecContext(ctx, `INSERT INTO user (userid, role, password) VALUES ('rollback1', 'user', 'hash')`); err != nil {
+				return err
+			}
+			return errors.New("abort")
+		})
+		assert.NotNil(err)
+
+		user, err := d.SelectUser(context.Background(), "rollback1")
+		assert.Nil(err)
+		assert.Nil(user)
+	})
+
+	t.Run("test transaction; commit", func(t *testing.T) {
+		err := d.Transaction(context.Background(), func(ctx context.Context, tx *sql.Tx) error {
+			_, err := tx.ExecContext(ctx, `INSERT INTO user (userid, role, password) VALUES ('commit1', 'user', 'hash')`)
+			return err
+		})
+		assert.Nil(err)
+
+		user, err := d.SelectUser(context.Background(), "commit1")
+		assert.Nil(err)
+		assert.NotNil(user)
+	})
+}
+
+func TestLoginFailure(t *testing.T) {
+	assert := assert.New(t)
+
+	d, err := db.Get()
+	assert.Nil(err)
+
+	now := time.Now()
+	lockedUntil := now.Add(time.Hour)
+
+	t.Run("test increment login failure; concurrent", func(t *testing.T) {
+		assert.Nil(d.DeleteLoginFailure(context.Background(), "failure1"))
+
+		wg := sync.WaitGroup{}
+		for i := 0; i < 20; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				assert.Nil(d.IncrementLoginFailure(context.Background(), "failure1", now, now.Add(-time.Minute), 10, lockedUntil))
+			}()
+		}
+		wg.Wait()
+
+		f, err := d.SelectLoginFailure(context.Background(), "failure1")
+		assert.Nil(err)
+		assert.Equal(int64(20), f.Count)
+		assert.Equal(lockedUntil.Unix(), f.LockedUntil)
+	})
+
+	t.Run("test increment login failure; window passed", func(t *testing.T) {
+		later := now.Add(time.Hour)
+
+		assert.Nil(d.IncrementLoginFailure(context.Background(), "failure1", later, later.Add(-time.Minute), 10, later.Add(time.Hour)))
+
+		f, err := d.SelectLoginFailure(context.Background(), "failure1")
+		assert.Nil(err)
+		assert.Equal(int64(1), f.Count)
+		assert.Equal(int64(0), f.LockedUntil)
+	})
+
+	t.Run("test delete expired login failures", func(t *testing.T) {
+		before := now.Add(-time.Hour)
+
+		// the window of the first has expired, the second is still locked
+		// and the third is within the window.
+		assert.Nil(d.IncrementLoginFailure(context.Background(), "cleanupfailure1", before, before.Add(-time.Minute), 10, before.Add(time.Minute)))
+		assert.Nil(d.IncrementLoginFailure(context.Background(), "cleanupfailure2", before, before.Add(-time.Minute), 1, now.Add(time.Minute)))
+		assert.Nil(d.IncrementLoginFailure(context.Background(), "cleanupfailure3", now, now.Add(-time.Minute), 10, now.Add(time.Minute)))
+
+		assert.Nil(d.DeleteExpiredLoginFailures(context.Background(), now.Add(-15*time.Minute), now))
+
+		f, err := d.SelectLoginFailure(context.Background(), "cleanupfailure1")
+		assert.Nil(err)
+		assert.Nil(f)
+
+		for _, userID := range []string{"cleanupfailure2", "cleanupfailure3"} {
+			f, err := d.SelectLoginFailure(context.Background(), userID)
+			assert.Nil(err)
+			assert.NotNil(f, userID)
+		}
+	})
+}
+
+func TestFileDatabase(t *testing.T) {
+	assert := assert.New(t)
+
+	t.Setenv("DB_PATH", filepath.Join(t.TempDir(), "test.db"))
+
+	d := new(db.Database)
+	assert.Nil(d.Connect())
+	defer d.Close()
+
+	assert.Nil(d.Migrate(context.Background()))
+
+	t.Run("test connect; write-ahead logging", func(t *testing.T) {
+		var mode string
+		assert.Nil(d.QueryRowContext(context.Background(), `PRAGMA journal_mode`).Scan(&mode))
+		assert.Equal("wal", mode)
+		assert.Equal(0, d.Stats().MaxOpenConnections)
+	})
+
+	t.Run("test increment login failure; concurrent connections", func(t *testing.T) {
+		now := time.Now()
+
+		wg := sync.WaitGroup{}
+		for i := 0; i < 20; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				assert.Nil(d.IncrementLoginFailure(context.Background(), "filefailure1", now, now.Add(-time.Minute), 10, now.Add(time.Hour)))
+			}()
+		}
+		wg.Wait()
+
+		f, err := d.SelectLoginFailure(context.Background(), "filefailure1")
+		assert.Nil(err)
+		assert.Equal(int64(20), f.Count)
+	})
+}
@@ -0,0 +1,146 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"simple-go-server/model"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+var createErasureTableQuery = `CREATE TABLE erasure (
+	eid integer primary key autoincrement,
+	uid integer,
+	requestedby integer,
+	policy text,
+	orders integer,
+	date integer);`
+
+var insertErasure = `INSERT INTO erasure (uid, requestedby, policy, orders, date) VALUES ($1, $2, $3, $4, $5)`
+var selectErasures = `SELECT eid, uid, requestedby, policy, orders, date FROM erasure ORDER BY eid desc LIMIT $1`
+
+// anonymousUID is the uid of anonymized orders, which no user has.
+const anonymousUID = 0
+
+var anonymizeUserOrders = `UPDATE "order" SET uid=$1 WHERE uid=$2`
+var purgeUserOrderProducts = `DELETE FROM orderproduct WHERE oid IN (SELECT oid FROM "order" WHERE uid=$1)`
+var purgeUserOrders = `DELETE FROM "order" WHERE uid=$1`
+var purgeUserOrderDiscounts = `DELETE FROM orderdiscount WHERE oid IN (SELECT oid FROM "order" WHERE uid=$1)`
+
+// the coupon redemptions of the user keep counting against the caps of the coupons.
+var anonymizeUserCouponRedemptions = `UPDATE couponredemption SET uid=$1 WHERE uid=$2`
+
+var eraseUserLoginHistory = `DELETE FROM loginhistory WHERE uid=$1`
+var eraseUserLoginFailure = `DELETE FROM loginfailure WHERE userid=$1`
+var eraseUserPasswordResets = `DELETE FROM passwordreset WHERE uid=$1`
+var eraseUserRecoveryCodes = `DELETE FROM recoverycode WHERE uid=$1`
+var eraseUserTOTP = `DELETE FROM totp WHERE uid=$1`
+var eraseUserCart = `DELETE FROM cart WHERE uid=$1`
+var eraseUser = `DELETE FROM user WHERE uid=$1`
+
+// EraseUser deletes the user and all personal data of the user,
+// and anonymizes or purges the orders of the user by the policy,
+// in a single transaction. It returns the audit record of the erasure.
+func (db *Database) EraseUser(ctx context.Context, user *model.User, policy string, requestedBy int64) (*model.Erasure, error) {
+	erasure := model.Erasure{
+		UID:         user.UID,
+		RequestedBy: requestedBy,
+		Policy:      policy,
+		Date:        time.Now().Unix(),
+	}
+
+	err := db.Transaction(ctx, func(ctx context.Context, tx *sql.Tx) error {
+		var res sql.Result
+		var err error
+
+		switch policy {
+		case model.ErasureAnonymize:
+			res, err = tx.ExecContext(ctx, anonymizeUserOrders, anonymousUID, user.UID)
+		case model.ErasurePurge:
+			if _, err = tx.ExecContext(ctx, purgeUserOrderDiscounts, user.UID); err == nil {
+				if _, err = tx.ExecContext(ctx, purgeUserOrderProducts, user.UID); err == nil {
+					res, err = tx.ExecContext(ctx, purgeUserOrders, user.UID)
+				}
+			}
+		default:
+			return errors.Errorf("unknown erasure policy: %q", policy)
+		}
+		if err != nil {
+			return err
+		}
+
+		if erasure.Orders, err = res.RowsAffected(); err != nil {
+			return err
+		}
+
+		if _, err := tx.ExecContext(ctx, anonymizeUserCouponRedemptions, anonymousUID, user.UID); err != nil {
+			return err
+		}
+
+		queries := []struct {
+			query string
+			arg   interface{}
+		}{
+			{eraseUserLoginHistory, user.UID},
+			{eraseUserLoginFailure, user.UserID},
+			{eraseUserPasswordResets, user.UID},
+			{eraseUserRecoveryCodes, user.UID},
+			{eraseUserTOTP, user.UID},
+			{eraseUserCart, user.UID},
+			{eraseUser, user.UID},
+		}
+
+		for _, q := range queries {
+			if _, err := tx.ExecContext(ctx, q.query, q.arg); err != nil {
+				return err
+			}
+		}
+
+		res, err = tx.ExecContext(ctx, insertErasure, erasure.UID, erasure.RequestedBy, erasure.Policy, erasure.Orders, erasure.Date)
+		if err != nil {
+			return err
+		}
+
+		erasure.EID, err = res.LastInsertId()
+		return err
+	})
+	if err != nil {
+		return nil, errors.Errorf("transaction execution failure")
+	}
+
+	return &erasure, nil
+}
+
+// SelectErasures returns the latest erasures, up to limit.
+func (db *Database) SelectErasures(ctx context.Context, limit int) ([]model.Erasure, error) {
+	erasures := []model.Erasure{}
+
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	rows, err := db.QueryContext(ctx, selectErasures, limit)
+	if err != nil {
+		return nil, errors.Errorf("transaction execution failure")
+	}
+	defer rows.Close()
+
+	for {
+		if !rows.Next() {
+			break
+		}
+
+		e := model.Erasure{}
+		if err = rows.Scan(&e.EID, &e.UID, &e.RequestedBy, &e.Policy, &e.Orders, &e.Date); err != nil {
+			return nil, errors.Errorf("column scanning failure")
+		}
+
+		erasures = append(erasures, e)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, errors.Errorf("rows iteration failure")
+	}
+
+	return erasures, nil
+}
@@ -0,0 +1,116 @@
+package db
+
+import (
+	"context"
+	"simple-go-server/model"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+var createProductImageTableQuery = `CREATE TABLE productimage (
+	iid integer primary key autoincrement,
+	pid integer,
+	key text unique,
+	thumbkey text,
+	width integer,
+	height integer,
+	date integer);`
+var createProductImageIndexQuery = `CREATE INDEX productimage_pid ON productimage (pid);`
+
+var selectProductImage = `SELECT iid, pid, key, thumbkey, width, height, date FROM productimage WHERE iid = $1`
+var selectProductImages = `SELECT iid, pid, key, thumbkey, width, height, date FROM productimage WHERE pid = $1 ORDER BY iid`
+var insertProductImage = `INSERT INTO productimage (pid, key, thumbkey, width, height, date) VALUES ($1, $2, $3, $4, $5, $6)`
+var deleteProductImage = `DELETE FROM productimage WHERE iid=$1`
+var deleteProductImages = `DELETE FROM productimage WHERE pid=$1`
+
+func scanProductImage(s scanner, img *model.ProductImage) error {
+	return s.Scan(&img.IID, &img.PID, &img.Key, &img.ThumbKey, &img.Width, &img.Height, &img.Date)
+}
+
+func (db *Database) SelectProductImage(ctx context.Context, iid int64) (*model.ProductImage, error) {
+	img := model.ProductImage{}
+
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	err := scanProductImage(db.QueryRowContext(ctx, selectProductImage, iid), &img)
+	if err == nil {
+		return &img, nil
+	}
+
+	if err.Error() != "sql: no rows in result set" {
+		return nil, errors.Errorf("select product image failure")
+	}
+
+	return nil, nil
+}
+
+// SelectProductImages returns the images of the product in the order they were uploaded.
+func (db *Database) SelectProductImages(ctx context.Context, pid int64) ([]model.ProductImage, error) {
+	images := []model.ProductImage{}
+
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	rows, err := db.QueryContext(ctx, selectProductImages, pid)
+	if err != nil {
+		return nil, errors.Errorf("transaction execution failure")
+	}
+	defer rows.Close()
+
+	for {
+		if !rows.Next() {
+			break
+		}
+
+		img := model.ProductImage{}
+		if err = scanProductImage(rows, &img); err != nil {
+			return nil, errors.Errorf("column scanning failure")
+		}
+
+		images = append(images, img)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, errors.Errorf("rows iteration failure")
+	}
+
+	return images, nil
+}
+
+func (db *Database) InsertProductImage(ctx context.Context, img model.ProductImage) (int64, error) {
+	result, err := db.Exec(
+		ctx,
+		insertProductImage,
+		img.PID,
+		img.Key,
+		img.ThumbKey,
+		img.Width,
+		img.Height,
+		time.Now().Unix(),
+	)
+	if err != nil {
+		return 0, errors.Errorf("transaction execution failure")
+	}
+
+	iid, err := result.LastInsertId()
+	if err != nil {
+		return 0, errors.Errorf("invalid result, no iid")
+	}
+
+	return iid, nil
+}
+
+func (db *Database) DeleteProductImage(ctx context.Context, iid int64) error {
+	_, err := db.Exec(
+		ctx,
+		deleteProductImage,
+		iid,
+	)
+	if err != nil {
+		return errors.Errorf("transaction execution failure")
+	}
+
+	return nil
+}
@@ -0,0 +1,166 @@
+package db
+
+import (
+	"context"
+	"simple-go-server/model"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+var createLoginHistoryTableQuery = `CREATE TABLE loginhistory (
+	lid integer primary key autoincrement,
+	uid integer,
+	ip text,
+	success integer,
+	date integer);`
+var createLoginHistoryIndexQuery = `CREATE INDEX loginhistory_uid ON loginhistory (uid, date);`
+var createLoginFailureTableQuery = `CREATE TABLE loginfailure (
+	userid text primary key,
+	count integer,
+	last integer,
+	lockeduntil integer);`
+
+var selectLoginHistory = `SELECT lid, uid, ip, success, date FROM loginhistory WHERE uid = $1 ORDER BY date desc, lid desc LIMIT $2`
+var selectAllLoginHistory = `SELECT lid, uid, ip, success, date FROM loginhistory WHERE uid = $1 ORDER BY date desc, lid desc`
+var insertLoginHistory = `INSERT INTO loginhistory (uid, ip, success, date) VALUES ($1, $2, $3, $4)`
+
+var selectLoginFailure = `SELECT userid, count, last, lockeduntil FROM loginfailure WHERE userid = $1`
+
+// incrementLoginFailure counts a failure of the user $1 at $2 in a single statement,
+// so that concurrent failures are all counted. The count restarts
+// if the last failure is before $5, and the user is locked until $4
+// once the count reaches $3.
+var incrementLoginFailure = `INSERT INTO loginfailure (userid, count, last, lockeduntil)
+	VALUES ($1, 1, $2, CASE WHEN 1 >= $3 THEN $4 ELSE 0 END)
+	ON CONFLICT (userid) DO UPDATE SET
+	count = CASE WHEN loginfailure.last >= $5 THEN loginfailure.count + 1 ELSE 1 END,
+	last = excluded.last,
+	lockeduntil = CASE WHEN (CASE WHEN loginfailure.last >= $5 THEN loginfailure.count + 1 ELSE 1 END) >= $3 THEN $4 ELSE 0 END`
+var deleteLoginFailure = `DELETE FROM loginfailure WHERE userid=$1`
+var deleteExpiredLoginFailures = `DELETE FROM loginfailure WHERE last < $1 AND lockeduntil <= $2`
+
+func (db *Database) InsertLoginHistory(ctx context.Context, uid int64, ip string, success bool) error {
+	_, err := db.Exec(
+		ctx,
+		insertLoginHistory,
+		uid,
+		ip,
+		success,
+		time.Now().Unix(),
+	)
+	if err != nil {
+		return errors.Errorf("transaction execution failure")
+	}
+
+	return nil
+}
+
+// SelectLoginHistory returns the latest logins of the user, up to limit.
+func (db *Database) SelectLoginHistory(ctx context.Context, uid int64, limit int) ([]model.LoginHistory, error) {
+	return db.selectLoginHistory(ctx, selectLoginHistory, uid, limit)
+}
+
+// SelectAllLoginHistory returns all logins of the user, latest first.
+func (db *Database) SelectAllLoginHistory(ctx context.Context, uid int64) ([]model.LoginHistory, error) {
+	return db.selectLoginHistory(ctx, selectAllLoginHistory, uid)
+}
+
+func (db *Database) selectLoginHistory(ctx context.Context, query string, args ...interface{}) ([]model.LoginHistory, error) {
+	history := []model.LoginHistory{}
+
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, errors.Errorf("transaction execution failure")
+	}
+	defer rows.Close()
+
+	for {
+		if !rows.Next() {
+			break
+		}
+
+		h := model.LoginHistory{}
+		if err = rows.Scan(&h.LID, &h.UID, &h.IP, &h.Success, &h.Date); err != nil {
+			return nil, errors.Errorf("column scanning failure")
+		}
+
+		history = append(history, h)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, errors.Errorf("rows iteration failure")
+	}
+
+	return history, nil
+}
+
+func (db *Database) SelectLoginFailure(ctx context.Context, userID string) (*model.LoginFailure, error) {
+	f := model.LoginFailure{}
+
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	err := db.QueryRowContext(ctx, selectLoginFailure, userID).Scan(&f.UserID, &f.Count, &f.Last, &f.LockedUntil)
+	if err == nil {
+		return &f, nil
+	}
+
+	if err.Error() != "sql: no rows in result set" {
+		return nil, errors.Errorf("select login failure failure")
+	}
+
+	return nil, nil
+}
+
+// IncrementLoginFailure counts a failure of the user at now.
+// Failures before since are forgotten, and the user is locked until lockedUntil
+// once lockAfter failures are counted.
+func (db *Database) IncrementLoginFailure(ctx context.Context, userID string, now, since time.Time, lockAfter int64, lockedUntil time.Time) error {
+	_, err := db.Exec(
+		ctx,
+		incrementLoginFailure,
+		userID,
+		now.Unix(),
+		lockAfter,
+		lockedUntil.Unix(),
+		since.Unix(),
+	)
+	if err != nil {
+		return errors.Errorf("transaction execution failure")
+	}
+
+	return nil
+}
+
+func (db *Database) DeleteLoginFailure(ctx context.Context, userID string) error {
+	_, err := db.Exec(
+		ctx,
+		deleteLoginFailure,
+		userID,
+	)
+	if err != nil {
+		return errors.Errorf("transaction execution failure")
+	}
+
+	return nil
+}
+
+// DeleteExpiredLoginFailures deletes the failures last counted before since
+// of the users who are not locked at now.
+func (db *Database) DeleteExpiredLoginFailures(ctx context.Context, since, now time.Time) error {
+	_, err := db.Exec(
+		ctx,
+		deleteExpiredLoginFailures,
+		since.Unix(),
+		now.Unix(),
+	)
+	if err != nil {
+		return errors.Errorf("transaction execution failure")
+	}
+
+	return nil
+}
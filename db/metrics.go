@@ -0,0 +1,54 @@
+package db
+
+import (
+	"database/sql"
+
+	"simple-go-server/metrics"
+)
+
+var (
+	txTotal = metrics.NewCounterVec(
+		"db_transactions_total",
+		"Total number of database transactions by result.",
+		"result",
+	)
+	txDuration = metrics.NewHistogramVec(
+		"db_transaction_duration_seconds",
+		"Latency of database transactions in seconds.",
+		nil,
+	)
+	txErrors = metrics.NewCounterVec(
+		"db_transaction_errors_total",
+		"Total number of failed database transactions by failed step.",
+		"step",
+	)
+)
+
+func init() {
+	metrics.NewGaugeFunc("db_open_connections", "Number of established connections.", func() float64 {
+		return float64(poolStats().OpenConnections)
+	})
+	metrics.NewGaugeFunc("db_in_use_connections", "Number of connections currently in use.", func() float64 {
+		return float64(poolStats().InUse)
+	})
+	metrics.NewGaugeFunc("db_idle_connections", "Number of idle connections.", func() float64 {
+		return float64(poolStats().Idle)
+	})
+	metrics.NewGaugeFunc("db_max_open_connections", "Maximum number of open connections.", func() float64 {
+		return float64(poolStats().MaxOpenConnections)
+	})
+	metrics.NewCounterFunc("db_wait_count_total", "Total number of connections waited for.", func() float64 {
+		return float64(poolStats().WaitCount)
+	})
+	metrics.NewCounterFunc("db_wait_duration_seconds_total", "Total time blocked waiting for a connection.", func() float64 {
+		return poolStats().WaitDuration.Seconds()
+	})
+}
+
+// poolStats returns the connection pool statistics of the global Database.
+func poolStats() sql.DBStats {
+	if db == nil || db.DB == nil {
+		return sql.DBStats{}
+	}
+	return db.Stats()
+}
@@ -0,0 +1,174 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/pkg/errors"
+)
+
+var createMigrationTableQuery = `CREATE TABLE IF NOT EXISTS migration (
+	version integer primary key,
+	date integer);`
+var selectMigrationVersion = `SELECT COALESCE(MAX(version), 0) FROM migration`
+var insertMigration = `INSERT INTO migration (version, date) VALUES ($1, strftime('%s', 'now'))`
+
+// migrations holds the schema changes in the order they are applied.
+// The version of a migration is its index + 1.
+// Append new migrations at the end, never edit applied ones.
+var migrations = [][]string{
+	{
+		createUserTableQuery,
+		createProductTableQuery,
+		createOrderTableQuery,
+		createOrderProductQuery,
+	},
+	{
+		createLoginHistoryTableQuery,
+		createLoginHistoryIndexQuery,
+		createLoginFailureTableQuery,
+	},
+	{
+		alterUserTokenVersionQuery,
+		createPasswordResetTableQuery,
+	},
+	{
+		createTOTPTableQuery,
+		createRecoveryCodeTableQuery,
+	},
+	{
+		alterUserSuspendedQuery,
+	},
+	{
+		createErasureTableQuery,
+	},
+	{
+		alterUserEmailQuery,
+		alterUserEmailVerifiedQuery,
+		alterUserDisplayNameQuery,
+		alterUserPhoneQuery,
+		createUserEmailIndexQuery,
+	},
+	{
+		createCartTableQuery,
+		alterOrderProductQuantityQuery,
+		alterOrderProductPriceQuery,
+	},
+	{
+		createGuestTableQuery,
+		createGuestCartTableQuery,
+	},
+	{
+		createCategoryTableQuery,
+		createProductCategoryTableQuery,
+		createProductCategoryIndexQuery,
+	},
+	append(append([]string{
+		createProductOptionTableQuery,
+		createVariantTableQuery,
+		alterOrderProductVariantQuery,
+	}, rebuildCartTableQueries...), rebuildGuestCartTableQueries...),
+	{
+		alterProductDescriptionQuery,
+		alterProductAttributesQuery,
+		alterProductPublishedQuery,
+	},
+	{
+		createProductImageTableQuery,
+		createProductImageIndexQuery,
+	},
+	{
+		alterProductCurrencyQuery,
+		alterCartCurrencyQuery,
+		alterGuestCartCurrencyQuery,
+		alterOrderProductCurrencyQuery,
+	},
+	append([]string{
+		createExchangeRateTableQuery,
+	}, alterOrderRateQueries...),
+	{
+		createCouponTableQuery,
+		createCouponRedemptionTableQuery,
+		createCouponRedemptionIndexQuery,
+		createOrderDiscountTableQuery,
+		createOrderDiscountIndexQuery,
+	},
+	{
+		createPromotionTableQuery,
+	},
+	{
+		dropUserEmailIndexQuery,
+		createUserVerifiedEmailIndexQuery,
+		createUserEmailLookupIndexQuery,
+	},
+}
+
+// LatestSchemaVersion returns the schema version
+// the server expects after all migrations are applied.
+func LatestSchemaVersion() int {
+	return len(migrations)
+}
+
+// SchemaVersion returns the version of the last applied migration.
+func (db *Database) SchemaVersion(ctx context.Context) (int, error) {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	var version int
+
+	if err := db.QueryRowContext(ctx, selectMigrationVersion).Scan(&version); err != nil {
+		return 0, errors.Errorf("select schema version failure")
+	}
+
+	return version, nil
+}
+
+// Migrate applies all migrations newer than the current schema version.
+// Each migration runs in its own transaction.
+func (db *Database) Migrate(ctx context.Context) error {
+	if _, err := db.Exec(ctx, createMigrationTableQuery); err != nil {
+		return err
+	}
+
+	version, err := db.SchemaVersion(ctx)
+	if err != nil {
+		return err
+	}
+
+	for i := version; i < len(migrations); i++ {
+		if err := db.migrate(ctx, i+1, migrations[i]); err != nil {
+			return errors.Wrapf(err, "migration %d failure", i+1)
+		}
+	}
+
+	return nil
+}
+
+func (db *Database) migrate(ctx context.Context, version int, queries []string) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	if err := execAll(ctx, tx, queries); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if _, err := tx.ExecContext(ctx, insertMigration, version); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func execAll(ctx context.Context, tx *sql.Tx, queries []string) error {
+	for _, q := range queries {
+		if _, err := tx.ExecContext(ctx, q); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -1,47 +1,142 @@
 package db
 
 import (
+	"context"
+	"database/sql"
 	"simple-go-server/model"
 	"time"
 
 	"github.com/pkg/errors"
 )
 
-var selectOrder = `SELECT * FROM "order" WHERE oid = $1`
-var insertOrder = `INSERT INTO "order" (uid, date) VALUES ($1, $2)`
+var orderColumns = `oid, uid, date, raterid, ratebase, ratequote, rate, rateeffective`
+
+var selectOrder = `SELECT ` + orderColumns + ` FROM "order" WHERE oid = $1`
+var insertOrder = `INSERT INTO "order" (uid, date, raterid, ratebase, ratequote, rate, rateeffective) VALUES ($1, $2, $3, $4, $5, $6, $7)`
 var updateOrder = `UPDATE "order" SET date=$1 WHERE oid=$2`
 var deleteOrder = `DELETE FROM "order" WHERE oid=$1`
 
-var selectOrderProduct = `SELECT * FROM orderproduct WHERE oid = $1`
-var insertOrderProduct = `INSERT INTO orderproduct (oid, pid) VALUES ($1, $2)`
+var selectOrderProduct = `SELECT oid, pid, vid, quantity, price, currency FROM orderproduct WHERE oid = $1`
+
+// products ordered without a cart take the current price of the product.
+var insertOrderProduct = `INSERT INTO orderproduct (oid, pid, price, currency)
+	VALUES ($1, $2, COALESCE((SELECT price FROM product WHERE pid = $2), 0),
+	COALESCE((SELECT currency FROM product WHERE pid = $2), '` + string(model.DefaultCurrency) + `'))`
 var updateOrderProduct = `UPDATE orderproduct SET pid=$1 WHERE oid=$2 and pid=$3`
 var deleteOrderProduct = `DELETE FROM orderproduct WHERE oid=$1 and pid=$2`
+var deleteOrderProducts = `DELETE FROM orderproduct WHERE oid=$1`
 
-var selectUserOrders = `SELECT * FROM "order" WHERE uid = $1`
-var selectOrders = `SELECT * FROM "order" ORDER BY date desc`
+// restoreOrderStock returns the quantities of the variants ordered in the order $1 to their stock.
+var restoreOrderStock = `UPDATE variant SET stock=stock+(SELECT SUM(quantity) FROM orderproduct WHERE oid=$1 AND orderproduct.vid = variant.vid)
+	WHERE vid IN (SELECT vid FROM orderproduct WHERE oid=$1)`
 
-func (db *Database) InsertOrder(uid int64) (int64, error) {
-	result, err := db.Exec(
-		insertOrder,
-		uid,
-		time.Now().Unix(),
-	)
+// restoreOrderProductStock returns the quantities of the variants of the product $2 ordered in the order $1 to their stock.
+var restoreOrderProductStock = `UPDATE variant SET stock=stock+(SELECT SUM(quantity) FROM orderproduct WHERE oid=$1 AND pid=$2 AND orderproduct.vid = variant.vid)
+	WHERE vid IN (SELECT vid FROM orderproduct WHERE oid=$1 AND pid=$2)`
+
+var selectUserOrders = `SELECT ` + orderColumns + ` FROM "order" WHERE uid = $1`
+var selectOrders = `SELECT ` + orderColumns + ` FROM "order" ORDER BY date desc`
+
+func scanOrder(s scanner, o *model.Order) error {
+	r := model.ExchangeRate{}
+
+	if err := s.Scan(&o.OID, &o.UID, &o.Date, &r.RID, &r.Base, &r.Quote, &r.Rate, &r.Effective); err != nil {
+		return err
+	}
+
+	if r.Rate != "" {
+		o.ExchangeRate = &r
+	}
+
+	return nil
+}
+
+// orderRate returns the columns of the rate recorded in an order, empty without a rate.
+func orderRate(r *model.ExchangeRate) []interface{} {
+	if r == nil {
+		return []interface{}{0, "", "", "", 0}
+	}
+	return []interface{}{r.RID, r.Base, r.Quote, r.Rate, r.Effective}
+}
+
+// CreateOrder inserts an order of the user with the products in a single transaction,
+// recording the exchange rate to the currency the user chose, if any,
+// applies the promotions to the order and redeems the coupon for it unless the code is empty.
+// It returns the errors of redeeming the coupon as they are, see IsCouponError.
+func (db *Database) CreateOrder(ctx context.Context, uid int64, pids []int64, rate *model.ExchangeRate, coupon string) (int64, error) {
+	var oid int64
+
+	err := db.Transaction(ctx, func(ctx context.Context, tx *sql.Tx) error {
+		res, err := tx.ExecContext(ctx, insertOrder, append([]interface{}{uid, time.Now().Unix()}, orderRate(rate)...)...)
+		if err != nil {
+			return err
+		}
+
+		if oid, err = res.LastInsertId(); err != nil {
+			return err
+		}
+
+		for _, pid := range pids {
+			if _, err := tx.ExecContext(ctx, insertOrderProduct, oid, pid); err != nil {
+				return err
+			}
+		}
+
+		items, err := orderItems(ctx, tx, oid)
+		if err != nil {
+			return err
+		}
+
+		promoted, err := promoteOrder(ctx, tx, oid, items)
+		if err != nil {
+			return err
+		}
+
+		if coupon == "" {
+			return nil
+		}
+
+		return redeemCoupon(ctx, tx, coupon, uid, oid, items, promoted)
+	})
+	if IsCouponError(err) {
+		return 0, err
+	}
 	if err != nil {
 		return 0, errors.Errorf("transaction execution failure")
 	}
 
-	oid, err := result.LastInsertId()
+	return oid, nil
+}
+
+// orderItems returns the ordered products of the order in the transaction.
+func orderItems(ctx context.Context, tx *sql.Tx, oid int64) ([]model.OrderProduct, error) {
+	rows, err := tx.QueryContext(ctx, selectOrderProduct, oid)
 	if err != nil {
-		return 0, errors.Errorf("invalid result, no oid")
+		return nil, err
 	}
+	defer rows.Close()
 
-	return oid, nil
+	items := []model.OrderProduct{}
+
+	for rows.Next() {
+		item := model.OrderProduct{}
+		if err := rows.Scan(&item.OID, &item.PID, &item.VID, &item.Quantity, &item.Price.Amount, &item.Price.Currency); err != nil {
+			return nil, err
+		}
+
+		items = append(items, item)
+	}
+
+	return items, rows.Err()
 }
 
-func (db *Database) SelectOrder(oid int64) (*model.Order, error) {
+func (db *Database) SelectOrder(ctx context.Context, oid int64) (*model.Order, error) {
 	order := model.Order{}
 
-	err := db.QueryRow(selectOrder, oid).Scan(&order.OID, &order.UID, &order.Date)
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	err := scanOrder(db.QueryRowContext(ctx, selectOrder, oid), &order)
 	if err == nil {
 		return &order, nil
 	}
@@ -53,8 +148,9 @@ func (db *Database) SelectOrder(oid int64) (*model.Order, error) {
 	return nil, nil
 }
 
-func (db *Database) UpdateOrder(oid int64) error {
+func (db *Database) UpdateOrder(ctx context.Context, oid int64) error {
 	_, err := db.Exec(
+		ctx,
 		updateOrder,
 		time.Now().Unix(),
 		oid,
@@ -66,11 +162,19 @@ func (db *Database) UpdateOrder(oid int64) error {
 	return nil
 }
 
-func (db *Database) DeleteOrder(oid int64) error {
-	_, err := db.Exec(
-		deleteOrder,
-		oid,
-	)
+// DeleteOrder deletes the order with its products and discounts,
+// and the coupon redemptions of the order, so that the coupons may be redeemed again.
+// The ordered variants are returned to their stock in the same transaction.
+func (db *Database) DeleteOrder(ctx context.Context, oid int64) error {
+	err := db.Transaction(ctx, func(ctx context.Context, tx *sql.Tx) error {
+		for _, q := range []string{restoreOrderStock, deleteOrderProducts, deleteOrderDiscounts, deleteOrderCouponRedemptions, deleteOrder} {
+			if _, err := tx.ExecContext(ctx, q, oid); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
 	if err != nil {
 		return errors.Errorf("transaction execution failure")
 	}
@@ -78,8 +182,9 @@ func (db *Database) DeleteOrder(oid int64) error {
 	return nil
 }
 
-func (db *Database) InsertOrderProduct(oid, pid int64) error {
+func (db *Database) InsertOrderProduct(ctx context.Context, oid, pid int64) error {
 	_, err := db.Exec(
+		ctx,
 		insertOrderProduct,
 		oid,
 		pid,
@@ -91,31 +196,41 @@ func (db *Database) InsertOrderProduct(oid, pid int64) error {
 	return nil
 }
 
-func (db *Database) SelectOrderProduct(oid int64) ([]model.OrderProduct, error) {
+func (db *Database) SelectOrderProduct(ctx context.Context, oid int64) ([]model.OrderProduct, error) {
 	orders := []model.OrderProduct{}
 
-	rows, err := db.Query(selectOrderProduct, oid)
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	rows, err := db.QueryContext(ctx, selectOrderProduct, oid)
 	if err != nil {
 		return nil, errors.Errorf("transaction execution failure")
 	}
+	defer rows.Close()
+
 	for {
 		if !rows.Next() {
 			break
 		}
 
 		order := model.OrderProduct{}
-		if err = rows.Scan(&order.OID, &order.PID); err != nil {
+		if err = rows.Scan(&order.OID, &order.PID, &order.VID, &order.Quantity, &order.Price.Amount, &order.Price.Currency); err != nil {
 			return nil, errors.Errorf("column scanning failure")
 		}
 
 		orders = append(orders, order)
 	}
 
+	if err := rows.Err(); err != nil {
+		return nil, errors.Errorf("rows iteration failure")
+	}
+
 	return orders, nil
 }
 
-func (db *Database) UpdateOrderProduct(oid, oldPid, newPid int64) error {
+func (db *Database) UpdateOrderProduct(ctx context.Context, oid, oldPid, newPid int64) error {
 	_, err := db.Exec(
+		ctx,
 		updateOrderProduct,
 		newPid,
 		oid,
@@ -128,12 +243,18 @@ func (db *Database) UpdateOrderProduct(oid, oldPid, newPid int64) error {
 	return nil
 }
 
-func (db *Database) DeleteOrderProduct(oid, pid int64) error {
-	_, err := db.Exec(
-		deleteOrderProduct,
-		oid,
-		pid,
-	)
+// DeleteOrderProduct deletes the product from the order,
+// and returns its ordered variants to their stock in the same transaction.
+func (db *Database) DeleteOrderProduct(ctx context.Context, oid, pid int64) error {
+	err := db.Transaction(ctx, func(ctx context.Context, tx *sql.Tx) error {
+		for _, q := range []string{restoreOrderProductStock, deleteOrderProduct} {
+			if _, err := tx.ExecContext(ctx, q, oid, pid); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
 	if err != nil {
 		return errors.Errorf("transaction execution failure")
 	}
@@ -141,48 +262,66 @@ func (db *Database) DeleteOrderProduct(oid, pid int64) error {
 	return nil
 }
 
-func (db *Database) SelectUserOrders(uid int64) ([]model.Order, error) {
+func (db *Database) SelectUserOrders(ctx context.Context, uid int64) ([]model.Order, error) {
 	orders := []model.Order{}
 
-	rows, err := db.Query(selectUserOrders, uid)
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	rows, err := db.QueryContext(ctx, selectUserOrders, uid)
 	if err != nil {
 		return nil, errors.Errorf("transaction execution failure")
 	}
+	defer rows.Close()
+
 	for {
 		if !rows.Next() {
 			break
 		}
 
 		order := model.Order{}
-		if err = rows.Scan(&order.OID, &order.UID, &order.Date); err != nil {
+		if err = scanOrder(rows, &order); err != nil {
 			return nil, errors.Errorf("column scanning failure")
 		}
 
 		orders = append(orders, order)
 	}
 
+	if err := rows.Err(); err != nil {
+		return nil, errors.Errorf("rows iteration failure")
+	}
+
 	return orders, nil
 }
 
-func (db *Database) SelectOrders() ([]model.Order, error) {
+func (db *Database) SelectOrders(ctx context.Context) ([]model.Order, error) {
 	orders := []model.Order{}
 
-	rows, err := db.Query(selectOrders)
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	rows, err := db.QueryContext(ctx, selectOrders)
 	if err != nil {
 		return nil, errors.Errorf("transaction execution failure")
 	}
+	defer rows.Close()
+
 	for {
 		if !rows.Next() {
 			break
 		}
 
 		order := model.Order{}
-		if err = rows.Scan(&order.OID, &order.UID, &order.Date); err != nil {
+		if err = scanOrder(rows, &order); err != nil {
 			return nil, errors.Errorf("column scanning failure")
 		}
 
 		orders = append(orders, order)
 	}
 
+	if err := rows.Err(); err != nil {
+		return nil, errors.Errorf("rows iteration failure")
+	}
+
 	return orders, nil
 }
@@ -0,0 +1,100 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"simple-go-server/model"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+var createPasswordResetTableQuery = `CREATE TABLE passwordreset (
+	rid integer primary key autoincrement,
+	uid integer,
+	tokenhash text unique,
+	expires integer,
+	used integer);`
+
+var selectPasswordReset = `SELECT rid, uid, tokenhash, expires, used FROM passwordreset WHERE tokenhash = $1`
+var insertPasswordReset = `INSERT INTO passwordreset (uid, tokenhash, expires, used) VALUES ($1, $2, $3, 0)`
+var usePasswordReset = `UPDATE passwordreset SET used=1 WHERE rid=$1 AND used=0 AND expires > $2`
+var revokePasswordResets = `UPDATE passwordreset SET used=1 WHERE uid=$1 AND used=0`
+var deletePasswordResets = `DELETE FROM passwordreset WHERE expires < $1`
+
+// InsertPasswordReset stores the hash of a new reset token
+// and revokes the unused tokens issued to the user before.
+func (db *Database) InsertPasswordReset(ctx context.Context, uid int64, tokenHash string, expires time.Time) error {
+	err := db.Transaction(ctx, func(ctx context.Context, tx *sql.Tx) error {
+		if _, err := tx.ExecContext(ctx, revokePasswordResets, uid); err != nil {
+			return err
+		}
+
+		_, err := tx.ExecContext(
+			ctx,
+			insertPasswordReset,
+			uid,
+			tokenHash,
+			expires.Unix(),
+		)
+		return err
+	})
+	if err != nil {
+		return errors.Errorf("transaction execution failure")
+	}
+
+	return nil
+}
+
+func (db *Database) SelectPasswordReset(ctx context.Context, tokenHash string) (*model.PasswordReset, error) {
+	r := model.PasswordReset{}
+
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	err := db.QueryRowContext(ctx, selectPasswordReset, tokenHash).Scan(&r.RID, &r.UID, &r.TokenHash, &r.Expires, &r.Used)
+	if err == nil {
+		return &r, nil
+	}
+
+	if err.Error() != "sql: no rows in result set" {
+		return nil, errors.Errorf("select password reset failure")
+	}
+
+	return nil, nil
+}
+
+// UsePasswordReset marks the reset token as used.
+// It returns false if the token was already used or has expired.
+func (db *Database) UsePasswordReset(ctx context.Context, rid int64, now time.Time) (bool, error) {
+	result, err := db.Exec(
+		ctx,
+		usePasswordReset,
+		rid,
+		now.Unix(),
+	)
+	if err != nil {
+		return false, errors.Errorf("transaction execution failure")
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return false, errors.Errorf("invalid result, no rows affected")
+	}
+
+	return n == 1, nil
+}
+
+// DeletePasswordResets deletes the reset tokens expired before the time.
+func (db *Database) DeletePasswordResets(ctx context.Context, before time.Time) error {
+	_, err := db.Exec(
+		ctx,
+		deletePasswordResets,
+		before.Unix(),
+	)
+	if err != nil {
+		return errors.Errorf("transaction execution failure")
+	}
+
+	return nil
+}
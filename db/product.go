@@ -1,21 +1,42 @@
 package db
 
 import (
+	"context"
+	"database/sql"
 	"simple-go-server/model"
 
 	"github.com/pkg/errors"
 )
 
-var selectProduct = `SELECT * FROM product WHERE pid = $1`
-var insertProduct = `INSERT INTO product (name, price) VALUES ($1, $2)`
-var updateProduct = `UPDATE product SET name=$1, price=$2 WHERE pid=$3`
+// products existing before the published flag stay published.
+var alterProductDescriptionQuery = `ALTER TABLE product ADD COLUMN description text NOT NULL DEFAULT '';`
+var alterProductAttributesQuery = `ALTER TABLE product ADD COLUMN attributes text NOT NULL DEFAULT '[]';`
+var alterProductPublishedQuery = `ALTER TABLE product ADD COLUMN published integer NOT NULL DEFAULT 1;`
+
+// prices existing before currencies are in the default currency.
+var alterProductCurrencyQuery = `ALTER TABLE product ADD COLUMN currency text NOT NULL DEFAULT '` + string(model.DefaultCurrency) + `';`
+
+var productColumns = `pid, name, price, currency, description, attributes, published`
+
+var selectProduct = `SELECT ` + productColumns + ` FROM product WHERE pid = $1`
+var insertProduct = `INSERT INTO product (name, price, currency, description, attributes, published) VALUES ($1, $2, $3, $4, $5, $6)`
+var updateProduct = `UPDATE product SET name=$1, price=$2, currency=$3, description=$4, attributes=$5, published=$6 WHERE pid=$7`
 var deleteProduct = `DELETE FROM product WHERE pid=$1`
 
-func (db *Database) InsertProduct(name string, price int64) (int64, error) {
+func scanProduct(s scanner, p *model.Product) error {
+	return s.Scan(&p.PID, &p.Name, &p.Price.Amount, &p.Price.Currency, &p.Description, &p.Attributes, &p.Published)
+}
+
+func (db *Database) InsertProduct(ctx context.Context, product model.Product) (int64, error) {
 	result, err := db.Exec(
+		ctx,
 		insertProduct,
-		name,
-		price,
+		product.Name,
+		product.Price.Amount,
+		product.Price.Currency,
+		product.Description,
+		product.Attributes,
+		product.Published,
 	)
 	if err != nil {
 		return 0, errors.Errorf("transaction execution failure")
@@ -29,10 +50,13 @@ func (db *Database) InsertProduct(name string, price int64) (int64, error) {
 	return pid, nil
 }
 
-func (db *Database) SelectProduct(pid int64) (*model.Product, error) {
+func (db *Database) SelectProduct(ctx context.Context, pid int64) (*model.Product, error) {
 	product := model.Product{}
 
-	err := db.QueryRow(selectProduct, pid).Scan(&product.PID, &product.Name, &product.Price)
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	err := scanProduct(db.QueryRowContext(ctx, selectProduct, pid), &product)
 	if err == nil {
 		return &product, nil
 	}
@@ -44,12 +68,17 @@ func (db *Database) SelectProduct(pid int64) (*model.Product, error) {
 	return nil, nil
 }
 
-func (db *Database) UpdateProduct(pid int64, name string, price int64) error {
+func (db *Database) UpdateProduct(ctx context.Context, product model.Product) error {
 	_, err := db.Exec(
+		ctx,
 		updateProduct,
-		name,
-		price,
-		pid,
+		product.Name,
+		product.Price.Amount,
+		product.Price.Currency,
+		product.Description,
+		product.Attributes,
+		product.Published,
+		product.PID,
 	)
 	if err != nil {
 		return errors.Errorf("transaction execution failure")
@@ -58,11 +87,19 @@ func (db *Database) UpdateProduct(pid int64, name string, price int64) error {
 	return nil
 }
 
-func (db *Database) DeleteProduct(pid int64) error {
-	_, err := db.Exec(
-		deleteProduct,
-		pid,
-	)
+// DeleteProduct deletes the product with its options, variants and image records,
+// and unassigns it from its categories. The image files are left to the caller.
+func (db *Database) DeleteProduct(ctx context.Context, pid int64) error {
+	err := db.Transaction(ctx, func(ctx context.Context, tx *sql.Tx) error {
+		for _, q := range []string{deleteProductCategories, deleteProductOptions, deleteProductVariants, deleteProductImages} {
+			if _, err := tx.ExecContext(ctx, q, pid); err != nil {
+				return err
+			}
+		}
+
+		_, err := tx.ExecContext(ctx, deleteProduct, pid)
+		return err
+	})
 	if err != nil {
 		return errors.Errorf("transaction execution failure")
 	}
@@ -0,0 +1,155 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"simple-go-server/model"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// the rule of a promotion is stored as json, see model.PromotionRule.
+var createPromotionTableQuery = `CREATE TABLE promotion (
+	prid integer primary key autoincrement,
+	name text,
+	kind text,
+	priority integer,
+	rule text,
+	starts integer,
+	ends integer);`
+
+var promotionColumns = `prid, name, kind, priority, rule, starts, ends`
+
+var selectPromotion = `SELECT ` + promotionColumns + ` FROM promotion WHERE prid = $1`
+var selectPromotions = `SELECT ` + promotionColumns + ` FROM promotion ORDER BY priority, prid`
+var insertPromotion = `INSERT INTO promotion (name, kind, priority, rule, starts, ends) VALUES ($1, $2, $3, $4, $5, $6)`
+var deletePromotion = `DELETE FROM promotion WHERE prid=$1`
+
+func scanPromotion(s scanner, p *model.Promotion) error {
+	var rule string
+
+	if err := s.Scan(&p.PRID, &p.Name, &p.Kind, &p.Priority, &rule, &p.Starts, &p.Ends); err != nil {
+		return err
+	}
+
+	return json.Unmarshal([]byte(rule), &p.Rule)
+}
+
+func (db *Database) InsertPromotion(ctx context.Context, p model.Promotion) (int64, error) {
+	rule, err := json.Marshal(p.Rule)
+	if err != nil {
+		return 0, errors.Errorf("invalid promotion rule")
+	}
+
+	result, err := db.Exec(
+		ctx,
+		insertPromotion,
+		p.Name,
+		p.Kind,
+		p.Priority,
+		string(rule),
+		p.Starts,
+		p.Ends,
+	)
+	if err != nil {
+		return 0, errors.Errorf("transaction execution failure")
+	}
+
+	prid, err := result.LastInsertId()
+	if err != nil {
+		return 0, errors.Errorf("invalid result, no prid")
+	}
+
+	return prid, nil
+}
+
+func (db *Database) SelectPromotion(ctx context.Context, prid int64) (*model.Promotion, error) {
+	p := model.Promotion{}
+
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	err := scanPromotion(db.QueryRowContext(ctx, selectPromotion, prid), &p)
+	if err == nil {
+		return &p, nil
+	}
+
+	if err.Error() != "sql: no rows in result set" {
+		return nil, errors.Errorf("select promotion failure")
+	}
+
+	return nil, nil
+}
+
+// SelectPromotions returns all promotions, past and future, in order of evaluation.
+func (db *Database) SelectPromotions(ctx context.Context) ([]model.Promotion, error) {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	rows, err := db.QueryContext(ctx, selectPromotions)
+	if err != nil {
+		return nil, errors.Errorf("transaction execution failure")
+	}
+	defer rows.Close()
+
+	promotions, err := scanPromotions(rows)
+	if err != nil {
+		return nil, errors.Errorf("column scanning failure")
+	}
+
+	return promotions, nil
+}
+
+// DeletePromotion deletes the promotion.
+// Orders keep the discounts of the promotion.
+func (db *Database) DeletePromotion(ctx context.Context, prid int64) error {
+	_, err := db.Exec(
+		ctx,
+		deletePromotion,
+		prid,
+	)
+	if err != nil {
+		return errors.Errorf("transaction execution failure")
+	}
+
+	return nil
+}
+
+func scanPromotions(rows *sql.Rows) ([]model.Promotion, error) {
+	promotions := []model.Promotion{}
+
+	for rows.Next() {
+		p := model.Promotion{}
+		if err := scanPromotion(rows, &p); err != nil {
+			return nil, err
+		}
+
+		promotions = append(promotions, p)
+	}
+
+	return promotions, rows.Err()
+}
+
+// promoteOrder evaluates the promotions on the items of the order
+// in the transaction of the order, inserts the discounts they grant and returns them.
+func promoteOrder(ctx context.Context, tx *sql.Tx, oid int64, items []model.OrderProduct) ([]model.OrderDiscount, error) {
+	rows, err := tx.QueryContext(ctx, selectPromotions)
+	if err != nil {
+		return nil, err
+	}
+
+	promotions, err := scanPromotions(rows)
+	rows.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	discounts := []model.OrderDiscount{}
+	for _, result := range model.EvaluatePromotions(promotions, items, time.Now()) {
+		discounts = append(discounts, result.Discounts...)
+	}
+
+	return discounts, insertOrderDiscounts(ctx, tx, oid, discounts)
+}
@@ -0,0 +1,151 @@
+package db
+
+import (
+	"context"
+	"simple-go-server/model"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+var createExchangeRateTableQuery = `CREATE TABLE exchangerate (
+	rid integer primary key autoincrement,
+	base text,
+	quote text,
+	rate text,
+	effective integer,
+	unique (base, quote, effective));`
+
+// the rate of an order is copied, so that it survives the deletion of the rate.
+var alterOrderRateQueries = []string{
+	`ALTER TABLE "order" ADD COLUMN raterid integer NOT NULL DEFAULT 0;`,
+	`ALTER TABLE "order" ADD COLUMN ratebase text NOT NULL DEFAULT '';`,
+	`ALTER TABLE "order" ADD COLUMN ratequote text NOT NULL DEFAULT '';`,
+	`ALTER TABLE "order" ADD COLUMN rate text NOT NULL DEFAULT '';`,
+	`ALTER TABLE "order" ADD COLUMN rateeffective integer NOT NULL DEFAULT 0;`,
+}
+
+var selectExchangeRate = `SELECT rid, base, quote, rate, effective FROM exchangerate WHERE rid = $1`
+var selectExchangeRates = `SELECT rid, base, quote, rate, effective FROM exchangerate ORDER BY base, quote, effective desc`
+var selectEffectiveExchangeRate = `SELECT rid, base, quote, rate, effective FROM exchangerate
+	WHERE base = $1 AND quote = $2 AND effective <= $3 ORDER BY effective desc LIMIT 1`
+var insertExchangeRate = `INSERT INTO exchangerate (base, quote, rate, effective) VALUES ($1, $2, $3, $4)`
+var deleteExchangeRate = `DELETE FROM exchangerate WHERE rid=$1`
+
+// ErrExchangeRateTaken is returned when a rate of the pair is already effective from the date.
+var ErrExchangeRateTaken = errors.New("exchange rate already effective from the date")
+
+func scanExchangeRate(s scanner, r *model.ExchangeRate) error {
+	return s.Scan(&r.RID, &r.Base, &r.Quote, &r.Rate, &r.Effective)
+}
+
+// InsertExchangeRate inserts the rate of a currency pair.
+// It returns ErrExchangeRateTaken if a rate of the pair is effective from the same date.
+func (db *Database) InsertExchangeRate(ctx context.Context, r model.ExchangeRate) (int64, error) {
+	result, err := db.Exec(
+		ctx,
+		insertExchangeRate,
+		r.Base,
+		r.Quote,
+		r.Rate,
+		r.Effective,
+	)
+	if isUniqueViolation(err) {
+		return 0, ErrExchangeRateTaken
+	}
+	if err != nil {
+		return 0, errors.Errorf("transaction execution failure")
+	}
+
+	rid, err := result.LastInsertId()
+	if err != nil {
+		return 0, errors.Errorf("invalid result, no rid")
+	}
+
+	return rid, nil
+}
+
+func (db *Database) SelectExchangeRate(ctx context.Context, rid int64) (*model.ExchangeRate, error) {
+	r := model.ExchangeRate{}
+
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	err := scanExchangeRate(db.QueryRowContext(ctx, selectExchangeRate, rid), &r)
+	if err == nil {
+		return &r, nil
+	}
+
+	if err.Error() != "sql: no rows in result set" {
+		return nil, errors.Errorf("select exchange rate failure")
+	}
+
+	return nil, nil
+}
+
+// SelectExchangeRates returns all rates by pair, the latest first.
+func (db *Database) SelectExchangeRates(ctx context.Context) ([]model.ExchangeRate, error) {
+	rates := []model.ExchangeRate{}
+
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	rows, err := db.QueryContext(ctx, selectExchangeRates)
+	if err != nil {
+		return nil, errors.Errorf("transaction execution failure")
+	}
+	defer rows.Close()
+
+	for {
+		if !rows.Next() {
+			break
+		}
+
+		r := model.ExchangeRate{}
+		if err = scanExchangeRate(rows, &r); err != nil {
+			return nil, errors.Errorf("column scanning failure")
+		}
+
+		rates = append(rates, r)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, errors.Errorf("rows iteration failure")
+	}
+
+	return rates, nil
+}
+
+// SelectEffectiveExchangeRate returns the rate from base to quote effective at the time,
+// or nil if no rate of the pair is effective yet.
+func (db *Database) SelectEffectiveExchangeRate(ctx context.Context, base, quote model.Currency, at time.Time) (*model.ExchangeRate, error) {
+	r := model.ExchangeRate{}
+
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	err := scanExchangeRate(db.QueryRowContext(ctx, selectEffectiveExchangeRate, base, quote, at.Unix()), &r)
+	if err == nil {
+		return &r, nil
+	}
+
+	if err.Error() != "sql: no rows in result set" {
+		return nil, errors.Errorf("select exchange rate failure")
+	}
+
+	return nil, nil
+}
+
+// DeleteExchangeRate deletes the rate. Orders keep their copy of it.
+func (db *Database) DeleteExchangeRate(ctx context.Context, rid int64) error {
+	_, err := db.Exec(
+		ctx,
+		deleteExchangeRate,
+		rid,
+	)
+	if err != nil {
+		return errors.Errorf("transaction execution failure")
+	}
+
+	return nil
+}
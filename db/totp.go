@@ -0,0 +1,149 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"simple-go-server/model"
+
+	"github.com/pkg/errors"
+)
+
+var createTOTPTableQuery = `CREATE TABLE totp (
+	uid integer primary key,
+	secret text,
+	enabled integer,
+	laststep integer);`
+var createRecoveryCodeTableQuery = `CREATE TABLE recoverycode (
+	uid integer,
+	codehash text,
+	used integer);`
+
+var selectTOTP = `SELECT uid, secret, enabled, laststep FROM totp WHERE uid = $1`
+var upsertTOTP = `INSERT INTO totp (uid, secret, enabled, laststep) VALUES ($1, $2, 0, 0)
+	ON CONFLICT (uid) DO UPDATE SET secret=excluded.secret, enabled=0, laststep=0`
+var enableTOTP = `UPDATE totp SET enabled=1, laststep=$1 WHERE uid=$2`
+var useTOTPStep = `UPDATE totp SET laststep=$1 WHERE uid=$2 AND laststep < $1`
+var deleteTOTP = `DELETE FROM totp WHERE uid=$1`
+
+var insertRecoveryCode = `INSERT INTO recoverycode (uid, codehash, used) VALUES ($1, $2, 0)`
+var useRecoveryCode = `UPDATE recoverycode SET used=1 WHERE uid=$1 AND codehash=$2 AND used=0`
+var deleteRecoveryCodes = `DELETE FROM recoverycode WHERE uid=$1`
+
+func (db *Database) SelectTOTP(ctx context.Context, uid int64) (*model.TOTP, error) {
+	t := model.TOTP{}
+
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	err := db.QueryRowContext(ctx, selectTOTP, uid).Scan(&t.UID, &t.Secret, &t.Enabled, &t.LastStep)
+	if err == nil {
+		return &t, nil
+	}
+
+	if err.Error() != "sql: no rows in result set" {
+		return nil, errors.Errorf("select totp failure")
+	}
+
+	return nil, nil
+}
+
+// InsertTOTP sets a pending secret of the user, replacing the secret
+// and the recovery codes set before.
+func (db *Database) InsertTOTP(ctx context.Context, uid int64, secret string, recoveryCodeHashes []string) error {
+	err := db.Transaction(ctx, func(ctx context.Context, tx *sql.Tx) error {
+		if _, err := tx.ExecContext(ctx, upsertTOTP, uid, secret); err != nil {
+			return err
+		}
+
+		if _, err := tx.ExecContext(ctx, deleteRecoveryCodes, uid); err != nil {
+			return err
+		}
+
+		for _, h := range recoveryCodeHashes {
+			if _, err := tx.ExecContext(ctx, insertRecoveryCode, uid, h); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return errors.Errorf("transaction execution failure")
+	}
+
+	return nil
+}
+
+func (db *Database) EnableTOTP(ctx context.Context, uid, step int64) error {
+	_, err := db.Exec(
+		ctx,
+		enableTOTP,
+		step,
+		uid,
+	)
+	if err != nil {
+		return errors.Errorf("transaction execution failure")
+	}
+
+	return nil
+}
+
+// UseTOTPStep records the step of an accepted code.
+// It returns false if a code of the same or a later step was used before.
+func (db *Database) UseTOTPStep(ctx context.Context, uid, step int64) (bool, error) {
+	result, err := db.Exec(
+		ctx,
+		useTOTPStep,
+		step,
+		uid,
+	)
+	if err != nil {
+		return false, errors.Errorf("transaction execution failure")
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return false, errors.Errorf("invalid result, no rows affected")
+	}
+
+	return n == 1, nil
+}
+
+// DeleteTOTP deletes the secret and the recovery codes of the user.
+func (db *Database) DeleteTOTP(ctx context.Context, uid int64) error {
+	err := db.Transaction(ctx, func(ctx context.Context, tx *sql.Tx) error {
+		for _, q := range []string{deleteTOTP, deleteRecoveryCodes} {
+			if _, err := tx.ExecContext(ctx, q, uid); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return errors.Errorf("transaction execution failure")
+	}
+
+	return nil
+}
+
+// UseRecoveryCode marks the recovery code as used.
+// It returns false if the code does not exist or was used before.
+func (db *Database) UseRecoveryCode(ctx context.Context, uid int64, codeHash string) (bool, error) {
+	result, err := db.Exec(
+		ctx,
+		useRecoveryCode,
+		uid,
+		codeHash,
+	)
+	if err != nil {
+		return false, errors.Errorf("transaction execution failure")
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return false, errors.Errorf("invalid result, no rows affected")
+	}
+
+	return n == 1, nil
+}
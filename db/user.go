@@ -1,20 +1,123 @@
 package db
 
 import (
+	"context"
 	"simple-go-server/model"
+	"strings"
 
+	"github.com/mattn/go-sqlite3"
 	"github.com/pkg/errors"
 )
 
-var selectUser = `SELECT * FROM user WHERE userid = $1`
-var insertUser = `INSERT INTO user (userid, role, password) VALUES ($1, $2, $3)`
-var updateUser = `UPDATE user SET role=$1, password=$2 WHERE userid=$3`
+// userColumns are the columns scanned by scanUser.
+var userColumns = `uid, userid, role, password, tokenversion, suspended,
+	COALESCE(email, ''), emailverified, displayname, phone`
+
+// userSearch matches users by the search pattern $1 and the role $2.
+var userSearch = `(userid LIKE $1 ESCAPE '\' OR email LIKE $1 ESCAPE '\' OR displayname LIKE $1 ESCAPE '\')
+	AND ($2 = '' OR role = $2)`
+
+var selectUser = `SELECT ` + userColumns + ` FROM user WHERE userid = $1`
+var selectUserByUID = `SELECT ` + userColumns + ` FROM user WHERE uid = $1`
+var selectUserByEmail = `SELECT ` + userColumns + ` FROM user WHERE email = $1 ORDER BY emailverified DESC, uid LIMIT 1`
+var selectUsers = `SELECT ` + userColumns + ` FROM user WHERE ` + userSearch + ` ORDER BY uid LIMIT $3 OFFSET $4`
+var countUsers = `SELECT COUNT(*) FROM user WHERE ` + userSearch
+var insertUser = `INSERT INTO user (userid, role, password, email, displayname, phone)
+	SELECT $1, $2, $3, NULLIF($4, ''), $5, $6
+	WHERE NOT EXISTS (SELECT 1 FROM user WHERE email = $4 AND emailverified = 1)`
+var updateUser = `UPDATE user SET role=$1, password=$2, tokenversion=tokenversion+1 WHERE userid=$3`
+var updateUserPassword = `UPDATE user SET password=$1, tokenversion=tokenversion+1 WHERE uid=$2`
+var rehashUserPassword = `UPDATE user SET password=$1 WHERE uid=$2 AND password=$3`
+var updateUserRole = `UPDATE user SET role=$1, tokenversion=tokenversion+1 WHERE uid=$2`
+var updateUserSuspended = `UPDATE user SET suspended=$1, tokenversion=tokenversion+1 WHERE uid=$2`
+var updateUserProfile = `UPDATE user SET
+	emailverified=CASE WHEN COALESCE(email, '') = $1 THEN emailverified ELSE 0 END,
+	email=NULLIF($1, ''), displayname=$2, phone=$3
+	WHERE uid=$4 AND (COALESCE(email, '') = $1
+	OR NOT EXISTS (SELECT 1 FROM user AS other WHERE other.email = $1 AND other.emailverified = 1 AND other.uid != $4))`
+var verifyUserEmail = `UPDATE user SET emailverified=1 WHERE uid=$1 AND email=$2`
 var deleteUser = `DELETE FROM user WHERE userid=$1`
 
-func (db *Database) SelectUser(userID string) (*model.User, error) {
+var alterUserTokenVersionQuery = `ALTER TABLE user ADD COLUMN tokenversion integer NOT NULL DEFAULT 0;`
+var alterUserSuspendedQuery = `ALTER TABLE user ADD COLUMN suspended integer NOT NULL DEFAULT 0;`
+var alterUserEmailQuery = `ALTER TABLE user ADD COLUMN email text;`
+var alterUserEmailVerifiedQuery = `ALTER TABLE user ADD COLUMN emailverified integer NOT NULL DEFAULT 0;`
+var alterUserDisplayNameQuery = `ALTER TABLE user ADD COLUMN displayname text NOT NULL DEFAULT '';`
+var alterUserPhoneQuery = `ALTER TABLE user ADD COLUMN phone text NOT NULL DEFAULT '';`
+var createUserEmailIndexQuery = `CREATE UNIQUE INDEX user_email ON user (email);`
+
+// only verified emails are unique, so that an unverified claim
+// never keeps the owner of the email from registering it.
+var dropUserEmailIndexQuery = `DROP INDEX user_email;`
+var createUserVerifiedEmailIndexQuery = `CREATE UNIQUE INDEX user_verified_email ON user (email) WHERE emailverified = 1;`
+var createUserEmailLookupIndexQuery = `CREATE INDEX user_email ON user (email);`
+
+// ErrEmailTaken is returned when the email is already verified by another user.
+var ErrEmailTaken = errors.New("email already registered")
+
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanUser(s scanner, user *model.User) error {
+	return s.Scan(
+		&user.UID, &user.UserID, &user.Role, &user.Password, &user.TokenVersion, &user.Suspended,
+		&user.Email, &user.EmailVerified, &user.DisplayName, &user.Phone,
+	)
+}
+
+// isUniqueViolation returns true if err is the violation of a unique or primary key constraint.
+func isUniqueViolation(err error) bool {
+	e, ok := err.(sqlite3.Error)
+	return ok && (e.ExtendedCode == sqlite3.ErrConstraintUnique || e.ExtendedCode == sqlite3.ErrConstraintPrimaryKey)
+}
+
+func (db *Database) SelectUser(ctx context.Context, userID string) (*model.User, error) {
+	user := model.User{}
+
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	err := scanUser(db.QueryRowContext(ctx, selectUser, userID), &user)
+	if err == nil {
+		return &user, nil
+	}
+
+	if err.Error() != "sql: no rows in result set" {
+		return nil, errors.Errorf("select user failure")
+	}
+
+	return nil, nil
+}
+
+func (db *Database) SelectUserByUID(ctx context.Context, uid int64) (*model.User, error) {
+	user := model.User{}
+
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	err := scanUser(db.QueryRowContext(ctx, selectUserByUID, uid), &user)
+	if err == nil {
+		return &user, nil
+	}
+
+	if err.Error() != "sql: no rows in result set" {
+		return nil, errors.Errorf("select user failure")
+	}
+
+	return nil, nil
+}
+
+// SelectUserByEmail returns the user of the normalized email.
+// An email may be claimed by many users until one verifies it,
+// and the user who verified it is returned first.
+func (db *Database) SelectUserByEmail(ctx context.Context, email string) (*model.User, error) {
 	user := model.User{}
 
-	err := db.QueryRow(selectUser, userID).Scan(&user.UID, &user.UserID, &user.Role, &user.Password)
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	err := scanUser(db.QueryRowContext(ctx, selectUserByEmail, email), &user)
 	if err == nil {
 		return &user, nil
 	}
@@ -26,17 +129,93 @@ func (db *Database) SelectUser(userID string) (*model.User, error) {
 	return nil, nil
 }
 
-func (db *Database) InsertUser(userID, role, pw string) (int64, error) {
+// UserFilter selects users listed by SelectUsers.
+type UserFilter struct {
+	// Search matches user ids, emails and display names containing it.
+	Search string
+	// Role matches users of the role, or all users if empty.
+	Role string
+}
+
+func (f UserFilter) pattern() string {
+	r := strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+	return "%" + r.Replace(f.Search) + "%"
+}
+
+// SelectUsers returns the users matched by the filter in the order of uid,
+// skipping offset users, up to limit.
+func (db *Database) SelectUsers(ctx context.Context, f UserFilter, limit, offset int) ([]model.User, error) {
+	users := []model.User{}
+
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	rows, err := db.QueryContext(ctx, selectUsers, f.pattern(), f.Role, limit, offset)
+	if err != nil {
+		return nil, errors.Errorf("transaction execution failure")
+	}
+	defer rows.Close()
+
+	for {
+		if !rows.Next() {
+			break
+		}
+
+		user := model.User{}
+		if err = scanUser(rows, &user); err != nil {
+			return nil, errors.Errorf("column scanning failure")
+		}
+
+		users = append(users, user)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, errors.Errorf("rows iteration failure")
+	}
+
+	return users, nil
+}
+
+// CountUsers returns the number of users matched by the filter.
+func (db *Database) CountUsers(ctx context.Context, f UserFilter) (int64, error) {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	var count int64
+
+	if err := db.QueryRowContext(ctx, countUsers, f.pattern(), f.Role).Scan(&count); err != nil {
+		return 0, errors.Errorf("count users failure")
+	}
+
+	return count, nil
+}
+
+// InsertUser inserts the user with the normalized profile.
+// It returns ErrEmailTaken if the email is verified by another user.
+func (db *Database) InsertUser(ctx context.Context, userID, role, pw string, profile model.Profile) (int64, error) {
 	result, err := db.Exec(
+		ctx,
 		insertUser,
 		userID,
 		role,
 		pw,
+		profile.Email,
+		profile.DisplayName,
+		profile.Phone,
 	)
+	if isUniqueViolation(err) {
+		return 0, ErrEmailTaken
+	}
 	if err != nil {
 		return 0, errors.Errorf("transaction execution failure")
 	}
 
+	if n, err := result.RowsAffected(); err != nil {
+		return 0, errors.Errorf("invalid result, no rows affected")
+	} else if n == 0 {
+		return 0, ErrEmailTaken
+	}
+
 	uid, err := result.LastInsertId()
 	if err != nil {
 		return 0, errors.Errorf("invalid result, no uid")
@@ -45,8 +224,9 @@ func (db *Database) InsertUser(userID, role, pw string) (int64, error) {
 	return uid, nil
 }
 
-func (db *Database) UpdateUser(userID, role, pw string) error {
+func (db *Database) UpdateUser(ctx context.Context, userID, role, pw string) error {
 	_, err := db.Exec(
+		ctx,
 		updateUser,
 		role,
 		pw,
@@ -59,8 +239,129 @@ func (db *Database) UpdateUser(userID, role, pw string) error {
 	return nil
 }
 
-func (db *Database) DeleteUser(userID string) error {
+// UpdateUserPassword sets the password hash of the user
+// and revokes all access-tokens issued before.
+func (db *Database) UpdateUserPassword(ctx context.Context, uid int64, pw string) error {
+	_, err := db.Exec(
+		ctx,
+		updateUserPassword,
+		pw,
+		uid,
+	)
+	if err != nil {
+		return errors.Errorf("transaction execution failure")
+	}
+
+	return nil
+}
+
+// RehashUserPassword replaces the password hash of the user
+// with a hash of the same password, keeping the access-tokens.
+// It does nothing if the hash was changed since it was read.
+func (db *Database) RehashUserPassword(ctx context.Context, uid int64, oldHash, newHash string) error {
+	_, err := db.Exec(
+		ctx,
+		rehashUserPassword,
+		newHash,
+		uid,
+		oldHash,
+	)
+	if err != nil {
+		return errors.Errorf("transaction execution failure")
+	}
+
+	return nil
+}
+
+// UpdateUserRole sets the role of the user
+// and revokes all access-tokens issued with the previous role.
+func (db *Database) UpdateUserRole(ctx context.Context, uid int64, role string) error {
+	_, err := db.Exec(
+		ctx,
+		updateUserRole,
+		role,
+		uid,
+	)
+	if err != nil {
+		return errors.Errorf("transaction execution failure")
+	}
+
+	return nil
+}
+
+// UpdateUserSuspended suspends or reactivates the user
+// and revokes all access-tokens issued before.
+func (db *Database) UpdateUserSuspended(ctx context.Context, uid int64, suspended bool) error {
+	_, err := db.Exec(
+		ctx,
+		updateUserSuspended,
+		suspended,
+		uid,
+	)
+	if err != nil {
+		return errors.Errorf("transaction execution failure")
+	}
+
+	return nil
+}
+
+// UpdateUserProfile sets the normalized profile of the user.
+// The email is unverified again if it changes.
+// It returns ErrEmailTaken if the email is verified by another user.
+func (db *Database) UpdateUserProfile(ctx context.Context, uid int64, profile model.Profile) error {
+	result, err := db.Exec(
+		ctx,
+		updateUserProfile,
+		profile.Email,
+		profile.DisplayName,
+		profile.Phone,
+		uid,
+	)
+	if isUniqueViolation(err) {
+		return ErrEmailTaken
+	}
+	if err != nil {
+		return errors.Errorf("transaction execution failure")
+	}
+
+	// the user is selected before, so no row is updated only for the email.
+	if n, err := result.RowsAffected(); err != nil {
+		return errors.Errorf("invalid result, no rows affected")
+	} else if n == 0 {
+		return ErrEmailTaken
+	}
+
+	return nil
+}
+
+// VerifyUserEmail marks the email of the user as verified.
+// It returns false if the email of the user is not the email anymore,
+// and ErrEmailTaken if the email is verified by another user.
+func (db *Database) VerifyUserEmail(ctx context.Context, uid int64, email string) (bool, error) {
+	result, err := db.Exec(
+		ctx,
+		verifyUserEmail,
+		uid,
+		email,
+	)
+	if isUniqueViolation(err) {
+		return false, ErrEmailTaken
+	}
+	if err != nil {
+		return false, errors.Errorf("transaction execution failure")
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return false, errors.Errorf("invalid result, no rows affected")
+	}
+
+	return n == 1, nil
+}
+
+func (db *Database) DeleteUser(ctx context.Context, userID string) error {
 	_, err := db.Exec(
+		ctx,
 		deleteUser,
 		userID,
 	)
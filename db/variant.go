@@ -0,0 +1,306 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"simple-go-server/model"
+
+	"github.com/pkg/errors"
+)
+
+var createProductOptionTableQuery = `CREATE TABLE productoption (
+	pid integer,
+	axis integer,
+	name text,
+	vals text,
+	primary key (pid, axis));`
+
+// the options of a variant are stored as a json object,
+// whose keys are sorted, so that equal options are equal texts.
+var createVariantTableQuery = `CREATE TABLE variant (
+	vid integer primary key autoincrement,
+	pid integer,
+	sku text unique,
+	options text,
+	price integer,
+	stock integer NOT NULL DEFAULT 0,
+	unique (pid, options));`
+var alterOrderProductVariantQuery = `ALTER TABLE orderproduct ADD COLUMN vid integer NOT NULL DEFAULT 0;`
+
+var selectProductOptions = `SELECT name, vals FROM productoption WHERE pid = $1 ORDER BY axis`
+var insertProductOption = `INSERT INTO productoption (pid, axis, name, vals) VALUES ($1, $2, $3, $4)`
+var deleteProductOptions = `DELETE FROM productoption WHERE pid=$1`
+
+// the price of a variant is in the currency of its product.
+var variantColumns = `vid, pid, sku, options, price,
+	COALESCE((SELECT currency FROM product WHERE product.pid = variant.pid), '` + string(model.DefaultCurrency) + `'), stock`
+
+var selectVariant = `SELECT ` + variantColumns + ` FROM variant WHERE vid = $1`
+var selectVariants = `SELECT ` + variantColumns + ` FROM variant WHERE pid = $1 ORDER BY vid`
+var countPricedVariants = `SELECT COUNT(*) FROM variant WHERE pid = $1 AND price IS NOT NULL`
+var countVariants = `SELECT COUNT(*) FROM variant WHERE pid = $1`
+var insertVariant = `INSERT INTO variant (pid, sku, options, price, stock) VALUES ($1, $2, $3, $4, $5)`
+var updateVariant = `UPDATE variant SET sku=$1, price=$2, stock=$3 WHERE vid=$4`
+var deleteVariant = `DELETE FROM variant WHERE vid=$1`
+var deleteProductVariants = `DELETE FROM variant WHERE pid=$1`
+
+var (
+	// ErrProductHasVariants is returned when the options of a product
+	// with variants are changed.
+	ErrProductHasVariants = errors.New("product has variants")
+	// ErrVariantTaken is returned when the sku or the options of a variant
+	// are already used by another variant.
+	ErrVariantTaken = errors.New("variant sku or options already used")
+)
+
+func scanVariant(s scanner, v *model.Variant) error {
+	var options string
+	var price sql.NullInt64
+	var currency model.Currency
+
+	if err := s.Scan(&v.VID, &v.PID, &v.SKU, &options, &price, &currency, &v.Stock); err != nil {
+		return err
+	}
+
+	if price.Valid {
+		m := model.NewMoney(price.Int64, currency)
+		v.Price = &m
+	}
+
+	return json.Unmarshal([]byte(options), &v.Options)
+}
+
+// SelectProductOptions returns the option axes of the product in their order.
+func (db *Database) SelectProductOptions(ctx context.Context, pid int64) (model.ProductOptions, error) {
+	options := model.ProductOptions{}
+
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	rows, err := db.QueryContext(ctx, selectProductOptions, pid)
+	if err != nil {
+		return nil, errors.Errorf("transaction execution failure")
+	}
+	defer rows.Close()
+
+	for {
+		if !rows.Next() {
+			break
+		}
+
+		opt := model.ProductOption{}
+		var vals string
+
+		if err = rows.Scan(&opt.Name, &vals); err != nil {
+			return nil, errors.Errorf("column scanning failure")
+		}
+
+		if err = json.Unmarshal([]byte(vals), &opt.Values); err != nil {
+			return nil, errors.Errorf("column scanning failure")
+		}
+
+		options = append(options, opt)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, errors.Errorf("rows iteration failure")
+	}
+
+	return options, nil
+}
+
+// SetProductOptions replaces the option axes of the product.
+// It returns ErrProductHasVariants if the product has variants,
+// whose options would not match the new axes.
+func (db *Database) SetProductOptions(ctx context.Context, pid int64, options model.ProductOptions) error {
+	err := db.Transaction(ctx, func(ctx context.Context, tx *sql.Tx) error {
+		var n int64
+		if err := tx.QueryRowContext(ctx, countVariants, pid).Scan(&n); err != nil {
+			return err
+		}
+
+		if n > 0 {
+			return ErrProductHasVariants
+		}
+
+		if _, err := tx.ExecContext(ctx, deleteProductOptions, pid); err != nil {
+			return err
+		}
+
+		for i, opt := range options {
+			vals, err := json.Marshal(opt.Values)
+			if err != nil {
+				return err
+			}
+
+			if _, err := tx.ExecContext(ctx, insertProductOption, pid, i, opt.Name, string(vals)); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+	if err == ErrProductHasVariants {
+		return err
+	}
+	if err != nil {
+		return errors.Errorf("transaction execution failure")
+	}
+
+	return nil
+}
+
+// HasVariants returns whether the product has any variant,
+// in which case it is ordered by its variants.
+func (db *Database) HasVariants(ctx context.Context, pid int64) (bool, error) {
+	var n int64
+
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	if err := db.QueryRowContext(ctx, countVariants, pid).Scan(&n); err != nil {
+		return false, errors.Errorf("select variant failure")
+	}
+
+	return n > 0, nil
+}
+
+// HasPricedVariants returns whether any variant of the product overrides its price,
+// in which case the currency of the product cannot change.
+func (db *Database) HasPricedVariants(ctx context.Context, pid int64) (bool, error) {
+	var n int64
+
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	if err := db.QueryRowContext(ctx, countPricedVariants, pid).Scan(&n); err != nil {
+		return false, errors.Errorf("select variant failure")
+	}
+
+	return n > 0, nil
+}
+
+// variantPrice returns the amount of the price override, or null without one.
+func variantPrice(v model.Variant) sql.NullInt64 {
+	if v.Price == nil {
+		return sql.NullInt64{}
+	}
+	return sql.NullInt64{Int64: v.Price.Amount, Valid: true}
+}
+
+func (db *Database) SelectVariant(ctx context.Context, vid int64) (*model.Variant, error) {
+	v := model.Variant{}
+
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	err := scanVariant(db.QueryRowContext(ctx, selectVariant, vid), &v)
+	if err == nil {
+		return &v, nil
+	}
+
+	if err.Error() != "sql: no rows in result set" {
+		return nil, errors.Errorf("select variant failure")
+	}
+
+	return nil, nil
+}
+
+func (db *Database) SelectVariants(ctx context.Context, pid int64) ([]model.Variant, error) {
+	variants := []model.Variant{}
+
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	rows, err := db.QueryContext(ctx, selectVariants, pid)
+	if err != nil {
+		return nil, errors.Errorf("transaction execution failure")
+	}
+	defer rows.Close()
+
+	for {
+		if !rows.Next() {
+			break
+		}
+
+		v := model.Variant{}
+		if err = scanVariant(rows, &v); err != nil {
+			return nil, errors.Errorf("column scanning failure")
+		}
+
+		variants = append(variants, v)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, errors.Errorf("rows iteration failure")
+	}
+
+	return variants, nil
+}
+
+// InsertVariant inserts the variant of its product.
+// It returns ErrVariantTaken if the sku or the options are used by another variant.
+func (db *Database) InsertVariant(ctx context.Context, v model.Variant) (int64, error) {
+	options, err := json.Marshal(v.Options)
+	if err != nil {
+		return 0, errors.Errorf("invalid variant options")
+	}
+
+	result, err := db.Exec(
+		ctx,
+		insertVariant,
+		v.PID,
+		v.SKU,
+		string(options),
+		variantPrice(v),
+		v.Stock,
+	)
+	if isUniqueViolation(err) {
+		return 0, ErrVariantTaken
+	}
+	if err != nil {
+		return 0, errors.Errorf("transaction execution failure")
+	}
+
+	vid, err := result.LastInsertId()
+	if err != nil {
+		return 0, errors.Errorf("invalid result, no vid")
+	}
+
+	return vid, nil
+}
+
+// UpdateVariant updates the sku, price and stock of the variant.
+// It returns ErrVariantTaken if the sku is used by another variant.
+func (db *Database) UpdateVariant(ctx context.Context, v model.Variant) error {
+	_, err := db.Exec(
+		ctx,
+		updateVariant,
+		v.SKU,
+		variantPrice(v),
+		v.Stock,
+		v.VID,
+	)
+	if isUniqueViolation(err) {
+		return ErrVariantTaken
+	}
+	if err != nil {
+		return errors.Errorf("transaction execution failure")
+	}
+
+	return nil
+}
+
+func (db *Database) DeleteVariant(ctx context.Context, vid int64) error {
+	_, err := db.Exec(
+		ctx,
+		deleteVariant,
+		vid,
+	)
+	if err != nil {
+		return errors.Errorf("transaction execution failure")
+	}
+
+	return nil
+}
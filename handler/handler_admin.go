@@ -0,0 +1,245 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"simple-go-server/db"
+	"simple-go-server/model"
+	"simple-go-server/token"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	defaultUsersPerPage = 20
+	maxUsersPerPage     = 100
+)
+
+// checkManager checks the access-token like checkToken
+// and whether it was issued to a manager.
+func checkManager(c *gin.Context) (*token.Claims, bool) {
+	claims, keep := checkToken(c)
+	if !keep {
+		return nil, false
+	}
+
+	if claims.Role != model.RoleManager {
+		writeMessage(c, http.StatusUnauthorized, "only manager can administer users")
+		return nil, false
+	}
+
+	return claims, true
+}
+
+// queryInt returns the query parameter as a positive integer,
+// or def if it is not given.
+func queryInt(c *gin.Context, key string, def int) (int, bool) {
+	v := c.Query(key)
+	if v == "" {
+		return def, true
+	}
+
+	n, err := strconv.Atoi(v)
+	if err != nil || n < 1 {
+		return 0, false
+	}
+
+	return n, true
+}
+
+func handleGetUsers(c *gin.Context) {
+	if _, keep := checkManager(c); !keep {
+		return
+	}
+
+	page, ok := queryInt(c, "page", 1)
+	if !ok {
+		writeMessage(c, http.StatusBadRequest, "invalid page")
+		return
+	}
+
+	perPage, ok := queryInt(c, "per_page", defaultUsersPerPage)
+	if !ok || perPage > maxUsersPerPage {
+		writeMessage(c, http.StatusBadRequest, "invalid per_page")
+		return
+	}
+
+	filter := db.UserFilter{
+		Search: c.Query("q"),
+		Role:   c.Query("role"),
+	}
+
+	if filter.Role != "" && filter.Role != model.RoleUser && filter.Role != model.RoleManager {
+		writeMessage(c, http.StatusBadRequest, "invalid role (not 'user' neither 'manager')")
+		return
+	}
+
+	db, err := db.Get()
+	if err != nil {
+		writeMessage(c, http.StatusInternalServerError, "db failure")
+		return
+	}
+
+	total, err := db.CountUsers(c.Request.Context(), filter)
+	if err != nil {
+		writeMessage(c, http.StatusInternalServerError, fmt.Sprintf("%v", err))
+		return
+	}
+
+	users, err := db.SelectUsers(c.Request.Context(), filter, perPage, (page-1)*perPage)
+	if err != nil {
+		writeMessage(c, http.StatusInternalServerError, fmt.Sprintf("%v", err))
+		return
+	}
+
+	res := make([]model.PrivateUser, len(users))
+	for i := range users {
+		res[i] = users[i].Private()
+	}
+
+	c.JSON(
+		http.StatusOK,
+		GetUsersResponse{
+			res,
+			page,
+			perPage,
+			total,
+		},
+	)
+}
+
+// targetUser returns the user of the user_id parameter
+// administered by the manager of the claims.
+// Managers cannot administer themselves, so that they do not lock themselves out.
+func targetUser(c *gin.Context, db *db.Database, claims *token.Claims) (*model.User, bool) {
+	userID := c.Param("user_id")
+
+	if claims.UserID == userID {
+		writeMessage(c, http.StatusBadRequest, "manager cannot administer itself")
+		return nil, false
+	}
+
+	user, err := db.SelectUser(c.Request.Context(), userID)
+	if err != nil {
+		writeMessage(c, http.StatusInternalServerError, fmt.Sprintf("%v", err))
+		return nil, false
+	}
+
+	if user == nil {
+		writeMessage(c, http.StatusNotFound, "user not found")
+		return nil, false
+	}
+
+	return user, true
+}
+
+func handleUpdateUserRole(c *gin.Context) {
+	req := new(UpdateUserRoleRequest)
+	if err := json.NewDecoder(c.Request.Body).Decode(&req); err != nil {
+		writeMessage(c, http.StatusBadRequest, "invalid request format")
+		return
+	}
+
+	if req.Role != model.RoleUser && req.Role != model.RoleManager {
+		writeMessage(c, http.StatusBadRequest, "invalid role (not 'user' neither 'manager')")
+		return
+	}
+
+	claims, keep := checkManager(c)
+	if !keep {
+		return
+	}
+
+	db, err := db.Get()
+	if err != nil {
+		writeMessage(c, http.StatusInternalServerError, "db failure")
+		return
+	}
+
+	user, keep := targetUser(c, db, claims)
+	if !keep {
+		return
+	}
+
+	if err := db.UpdateUserRole(c.Request.Context(), user.UID, req.Role); err != nil {
+		writeMessage(c, http.StatusInternalServerError, fmt.Sprintf("%v", err))
+		return
+	}
+
+	requestLogger(c).Info("user role changed", "target", user.UID, "role", req.Role)
+
+	writeMessage(c, http.StatusOK, "user role update success")
+}
+
+func handleSuspendUser(c *gin.Context) {
+	setUserSuspended(c, true, "user suspend success")
+}
+
+func handleReactivateUser(c *gin.Context) {
+	setUserSuspended(c, false, "user reactivate success")
+}
+
+func setUserSuspended(c *gin.Context, suspended bool, msg string) {
+	claims, keep := checkManager(c)
+	if !keep {
+		return
+	}
+
+	db, err := db.Get()
+	if err != nil {
+		writeMessage(c, http.StatusInternalServerError, "db failure")
+		return
+	}
+
+	user, keep := targetUser(c, db, claims)
+	if !keep {
+		return
+	}
+
+	if err := db.UpdateUserSuspended(c.Request.Context(), user.UID, suspended); err != nil {
+		writeMessage(c, http.StatusInternalServerError, fmt.Sprintf("%v", err))
+		return
+	}
+
+	requestLogger(c).Info("user suspension changed", "target", user.UID, "suspended", suspended)
+
+	writeMessage(c, http.StatusOK, msg)
+}
+
+// handleForceResetPassword invalidates the password of the user,
+// revoking the access-tokens, and sends a reset token to the user.
+func handleForceResetPassword(c *gin.Context) {
+	claims, keep := checkManager(c)
+	if !keep {
+		return
+	}
+
+	db, err := db.Get()
+	if err != nil {
+		writeMessage(c, http.StatusInternalServerError, "db failure")
+		return
+	}
+
+	user, keep := targetUser(c, db, claims)
+	if !keep {
+		return
+	}
+
+	// an empty hash matches no password.
+	if err := db.UpdateUserPassword(c.Request.Context(), user.UID, ""); err != nil {
+		writeMessage(c, http.StatusInternalServerError, fmt.Sprintf("%v", err))
+		return
+	}
+
+	if err := sendPasswordReset(c.Request.Context(), db, user); err != nil {
+		writeMessage(c, http.StatusInternalServerError, fmt.Sprintf("%v", err))
+		return
+	}
+
+	requestLogger(c).Info("password reset forced", "target", user.UID)
+
+	writeMessage(c, http.StatusAccepted, "password reset forced")
+}
@@ -0,0 +1,250 @@
+package handler_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"simple-go-server/handler"
+	"simple-go-server/model"
+	"simple-go-server/notify"
+	"simple-go-server/token"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAdminUsers(t *testing.T) {
+	assert := assert.New(t)
+
+	notifier := notify.NewMemoryNotifier()
+
+	old := notify.Default()
+	notify.SetDefault(notifier)
+	defer notify.SetDefault(old)
+
+	var mt, ut *http.Cookie
+
+	login := func(userID, pw string) (int, *http.Cookie) {
+		res := httptest.NewRecorder()
+		req := httptest.NewRequest("POST", "/login", strings.NewReader(
+			`{"user_id":"`+userID+`","password":"`+pw+`"}`,
+		))
+
+		TestRouter.ServeHTTP(res, req)
+
+		for _, k := range res.Result().Cookies() {
+			if k.Name == token.ACCESS_TOKEN_NAME {
+				return res.Code, k
+			}
+		}
+		return res.Code, nil
+	}
+
+	t.Run("test create users", func(t *testing.T) {
+		for _, id := range []string{"adminlist1", "adminlist2", "adminlist3"} {
+			res := httptest.NewRecorder()
+			req := httptest.NewRequest("POST", "/user", strings.NewReader(
+				`{"user_id":"`+id+`","role":"user","password":"al1234++"}`,
+			))
+
+			TestRouter.ServeHTTP(res, req)
+			assert.Equal(http.StatusCreated, res.Code)
+		}
+
+		var code int
+
+		code, mt = login("master01", "pwmaster01++")
+		assert.Equal(http.StatusOK, code)
+
+		code, ut = login("adminlist1", "al1234++")
+		assert.Equal(http.StatusOK, code)
+	})
+
+	t.Run("test list users; not manager", func(t *testing.T) {
+		res := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", "/users", nil)
+		req.AddCookie(ut)
+
+		TestRouter.ServeHTTP(res, req)
+		assert.Equal(http.StatusUnauthorized, res.Code)
+	})
+
+	t.Run("test list users; search", func(t *testing.T) {
+		list := handler.GetUsersResponse{}
+
+		res := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", "/users?q=adminlist&per_page=2", nil)
+		req.AddCookie(mt)
+
+		TestRouter.ServeHTTP(res, req)
+		assert.Equal(http.StatusOK, res.Code)
+		assert.NotContains(res.Body.String(), "password")
+
+		err := json.NewDecoder(res.Body).Decode(&list)
+		assert.Nil(err)
+		assert.Equal(int64(3), list.Total)
+		assert.Equal(2, list.PerPage)
+		assert.Len(list.Users, 2)
+		assert.Equal("adminlist1", list.Users[0].UserID)
+
+		res = httptest.NewRecorder()
+		req = httptest.NewRequest("GET", "/users?q=adminlist&per_page=2&page=2", nil)
+		req.AddCookie(mt)
+
+		TestRouter.ServeHTTP(res, req)
+		assert.Equal(http.StatusOK, res.Code)
+
+		err = json.NewDecoder(res.Body).Decode(&list)
+		assert.Nil(err)
+		assert.Len(list.Users, 1)
+		assert.Equal("adminlist3", list.Users[0].UserID)
+	})
+
+	t.Run("test list users; invalid page", func(t *testing.T) {
+		res := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", "/users?page=0", nil)
+		req.AddCookie(mt)
+
+		TestRouter.ServeHTTP(res, req)
+		assert.Equal(http.StatusBadRequest, res.Code)
+	})
+
+	t.Run("test list users; wildcard is literal", func(t *testing.T) {
+		list := handler.GetUsersResponse{}
+
+		res := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", "/users?q=%25", nil)
+		req.AddCookie(mt)
+
+		TestRouter.ServeHTTP(res, req)
+		assert.Equal(http.StatusOK, res.Code)
+
+		err := json.NewDecoder(res.Body).Decode(&list)
+		assert.Nil(err)
+		assert.Equal(int64(0), list.Total)
+	})
+
+	t.Run("test view orders of user", func(t *testing.T) {
+		res := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", "/user/adminlist1/orders", nil)
+		req.AddCookie(mt)
+
+		TestRouter.ServeHTTP(res, req)
+		assert.Equal(http.StatusOK, res.Code)
+	})
+
+	t.Run("test change role; self", func(t *testing.T) {
+		res := httptest.NewRecorder()
+		req := httptest.NewRequest("PUT", "/user/master01/role", strings.NewReader(`{"role":"user"}`))
+		req.AddCookie(mt)
+
+		TestRouter.ServeHTTP(res, req)
+		assert.Equal(http.StatusBadRequest, res.Code)
+	})
+
+	t.Run("test change role", func(t *testing.T) {
+		res := httptest.NewRecorder()
+		req := httptest.NewRequest("PUT", "/user/adminlist2/role", strings.NewReader(`{"role":"manager"}`))
+		req.AddCookie(mt)
+
+		TestRouter.ServeHTTP(res, req)
+		assert.Equal(http.StatusOK, res.Code)
+
+		res = httptest.NewRecorder()
+		req = httptest.NewRequest("GET", "/users?q=adminlist2&role=manager", nil)
+		req.AddCookie(mt)
+
+		TestRouter.ServeHTTP(res, req)
+		assert.Equal(http.StatusOK, res.Code)
+
+		list := handler.GetUsersResponse{}
+
+		err := json.NewDecoder(res.Body).Decode(&list)
+		assert.Nil(err)
+		assert.Len(list.Users, 1)
+		assert.Equal(model.RoleManager, list.Users[0].Role)
+	})
+
+	t.Run("test suspend", func(t *testing.T) {
+		res := httptest.NewRecorder()
+		req := httptest.NewRequest("POST", "/user/adminlist1/suspend", nil)
+		req.AddCookie(mt)
+
+		TestRouter.ServeHTTP(res, req)
+		assert.Equal(http.StatusOK, res.Code)
+
+		// the access-token of the suspended user is revoked.
+		res = httptest.NewRecorder()
+		req = httptest.NewRequest("GET", "/user/adminlist1/logins", nil)
+		req.AddCookie(ut)
+
+		TestRouter.ServeHTTP(res, req)
+		assert.Equal(http.StatusUnauthorized, res.Code)
+
+		code, _ := login("adminlist1", "al1234++")
+		assert.Equal(http.StatusForbidden, code)
+
+		// the wrong password does not reveal the suspension.
+		code, _ = login("adminlist1", "al4321++")
+		assert.Equal(http.StatusUnauthorized, code)
+	})
+
+	t.Run("test reactivate", func(t *testing.T) {
+		res := httptest.NewRecorder()
+		req := httptest.NewRequest("POST", "/user/adminlist1/reactivate", nil)
+		req.AddCookie(mt)
+
+		TestRouter.ServeHTTP(res, req)
+		assert.Equal(http.StatusOK, res.Code)
+
+		code, _ := login("adminlist1", "al1234++")
+		assert.Equal(http.StatusOK, code)
+	})
+
+	t.Run("test force password reset", func(t *testing.T) {
+		res := httptest.NewRecorder()
+		req := httptest.NewRequest("POST", "/user/adminlist3/password/reset", nil)
+		req.AddCookie(mt)
+
+		TestRouter.ServeHTTP(res, req)
+		assert.Equal(http.StatusAccepted, res.Code)
+
+		code, _ := login("adminlist3", "al1234++")
+		assert.Equal(http.StatusUnauthorized, code)
+
+		msgs := notifier.Messages("adminlist3")
+		assert.Len(msgs, 1)
+
+		m := resetTokenRegex.FindStringSubmatch(msgs[0].Body)
+		assert.Len(m, 2)
+
+		res = httptest.NewRecorder()
+		req = httptest.NewRequest("POST", "/password/reset", strings.NewReader(
+			`{"token":"`+m[1]+`","password":"al5678++"}`,
+		))
+
+		TestRouter.ServeHTTP(res, req)
+		assert.Equal(http.StatusOK, res.Code)
+
+		code, _ = login("adminlist3", "al5678++")
+		assert.Equal(http.StatusOK, code)
+	})
+
+	t.Run("test delete user", func(t *testing.T) {
+		res := httptest.NewRecorder()
+		req := httptest.NewRequest("DELETE", "/user/adminlist3", nil)
+		req.AddCookie(mt)
+
+		TestRouter.ServeHTTP(res, req)
+		assert.Equal(http.StatusOK, res.Code)
+		assert.Empty(res.Result().Cookies())
+
+		res = httptest.NewRecorder()
+		req = httptest.NewRequest("GET", "/user/adminlist3", nil)
+
+		TestRouter.ServeHTTP(res, req)
+		assert.Equal(http.StatusNotFound, res.Code)
+	})
+}
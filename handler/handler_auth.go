@@ -1,11 +1,14 @@
 package handler
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"sync"
 
 	"simple-go-server/db"
+	"simple-go-server/hasher"
 	"simple-go-server/model"
 	"simple-go-server/token"
 
@@ -16,18 +19,28 @@ func handleLogin(c *gin.Context) {
 	req := new(LoginRequest)
 
 	if err := json.NewDecoder(c.Request.Body).Decode(&req); err != nil {
+		loginFailures.Inc("invalid_request")
 		writeMessage(c, http.StatusBadRequest, "invalid request format")
 		return
 	}
 
-	userID := model.UserID(req.UserID)
-	if err := userID.IsValid(); err != nil {
+	// users log in with the user id or a verified email.
+	// The policies are not checked, as they may have changed
+	// since existing users chose their user ids and passwords.
+	account := req.UserID
+	if req.Email != "" {
+		account = model.NormalizeEmail(req.Email)
+	}
+
+	if !isCredential(account) {
+		loginFailures.Inc("invalid_request")
 		writeMessage(c, http.StatusBadRequest, "invalid user id format")
 		return
 	}
 
 	pw := model.Password(req.Password)
-	if err := pw.IsValid(); err != nil {
+	if !isCredential(string(pw)) {
+		loginFailures.Inc("invalid_request")
 		writeMessage(c, http.StatusBadRequest, "invalid password format")
 		return
 	}
@@ -38,24 +51,144 @@ func handleLogin(c *gin.Context) {
 		return
 	}
 
-	user, err := db.SelectUser(string(userID))
+	user, err := selectLoginUser(c.Request.Context(), db, req)
 	if err != nil {
 		writeMessage(c, http.StatusInternalServerError, fmt.Sprintf("%v", err))
 		return
 	}
 
-	if user == nil {
-		writeMessage(c, http.StatusNotFound, "user not found")
+	// failures are counted per user, whether it logs in by the user id or email.
+	if user != nil {
+		account = user.UserID
+	}
+
+	ip := c.ClientIP()
+
+	wait, err := loginRetryAfter(c.Request.Context(), db, account, ip)
+	if err != nil {
+		writeMessage(c, http.StatusInternalServerError, fmt.Sprintf("%v", err))
+		return
+	}
+
+	if wait > 0 {
+		loginFailures.Inc("locked")
+		c.Header("Retry-After", ceilSeconds(wait))
+		writeMessage(c, http.StatusTooManyRequests, "too many failed login attempts")
+		return
+	}
+
+	// the password is compared even if the user does not exist,
+	// so that the response time does not reveal registered user ids.
+	hash := dummyPasswordHash()
+	if user != nil {
+		hash = user.Password
+	}
+
+	verified := pw.CompareWithHash(hash)
+	if user == nil || !verified {
+		reason := "wrong_password"
+		if user == nil {
+			reason = "user_not_found"
+		}
+		loginFailures.Inc(reason)
+
+		if err := recordLoginFailure(c.Request.Context(), db, account, ip); err != nil {
+			writeMessage(c, http.StatusInternalServerError, fmt.Sprintf("%v", err))
+			return
+		}
+
+		if user != nil {
+			if err := db.InsertLoginHistory(c.Request.Context(), user.UID, ip, false); err != nil {
+				writeMessage(c, http.StatusInternalServerError, fmt.Sprintf("%v", err))
+				return
+			}
+		}
+
+		writeMessage(c, http.StatusUnauthorized, "invalid credentials")
+		return
+	}
+
+	// failures are cleared only when the login completes, see completeLogin,
+	// so that the password alone does not reset the failures of the second factor.
+
+	// suspension is revealed only to those who know the password.
+	if user.Suspended {
+		loginFailures.Inc("suspended")
+		writeMessage(c, http.StatusForbidden, "suspended user")
+		return
+	}
+
+	rehashPassword(c, db, user, pw)
+
+	tf, err := db.SelectTOTP(c.Request.Context(), user.UID)
+	if err != nil {
+		writeMessage(c, http.StatusInternalServerError, fmt.Sprintf("%v", err))
+		return
+	}
+
+	if tf != nil && tf.Enabled {
+		issuePreAuthToken(c, user, "second factor required")
+		return
+	}
+
+	if user.Role == model.RoleManager && requireManagerTOTP() {
+		issuePreAuthToken(c, user, "second factor enrollment required")
+		return
+	}
+
+	completeLogin(c, db, user)
+}
+
+// selectLoginUser returns the user logging in by the user id,
+// or by the email if it is given and verified.
+func selectLoginUser(ctx context.Context, db *db.Database, req *LoginRequest) (*model.User, error) {
+	if req.Email == "" {
+		return db.SelectUser(ctx, req.UserID)
+	}
+
+	user, err := db.SelectUserByEmail(ctx, model.NormalizeEmail(req.Email))
+	if err != nil || user == nil || !user.EmailVerified {
+		return nil, err
+	}
+
+	return user, nil
+}
+
+// rehashPassword replaces the password hash of the user
+// if it was created with an outdated algorithm or cost.
+// The login goes on even if the rehash fails.
+func rehashPassword(c *gin.Context, db *db.Database, user *model.User, pw model.Password) {
+	if !hasher.NeedsRehash(user.Password) {
 		return
 	}
 
-	verified := model.Password(req.Password).CompareWithHash(string(user.Password))
-	if !verified {
-		writeMessage(c, http.StatusUnauthorized, "wrong password")
+	hash, err := pw.Hash()
+	if err == nil {
+		err = db.RehashUserPassword(c.Request.Context(), user.UID, user.Password, hash)
+	}
+
+	if err != nil {
+		requestLogger(c).Warn("password rehash failure", "error", err)
+		return
+	}
+
+	user.Password = hash
+}
+
+// completeLogin clears the failed logins of the user,
+// records the successful login and issues the access-token.
+func completeLogin(c *gin.Context, db *db.Database, user *model.User) {
+	if err := db.DeleteLoginFailure(c.Request.Context(), user.UserID); err != nil {
+		writeMessage(c, http.StatusInternalServerError, fmt.Sprintf("%v", err))
 		return
 	}
 
-	at, err := token.CreateAccessToken(user.UID, user.UserID, user.Role)
+	if err := db.InsertLoginHistory(c.Request.Context(), user.UID, c.ClientIP(), true); err != nil {
+		writeMessage(c, http.StatusInternalServerError, fmt.Sprintf("%v", err))
+		return
+	}
+
+	at, err := token.CreateAccessToken(user.UID, user.UserID, user.Role, user.TokenVersion)
 	if err != nil {
 		writeMessage(c, http.StatusInternalServerError, "jwt failure")
 		return
@@ -63,6 +196,8 @@ func handleLogin(c *gin.Context) {
 
 	c.SetCookie(token.ACCESS_TOKEN_NAME, at, 3600, "/", "localhost", false, true)
 
+	mergeGuestCart(c, db, user.UID)
+
 	c.JSON(
 		http.StatusOK,
 		LoginResponse{
@@ -72,7 +207,141 @@ func handleLogin(c *gin.Context) {
 	)
 }
 
+// issuePreAuthToken issues the token allowing only the second step of the login.
+func issuePreAuthToken(c *gin.Context, user *model.User, msg string) {
+	pt, err := token.CreatePreAuthToken(user.UID, user.UserID, user.Role, user.TokenVersion)
+	if err != nil {
+		writeMessage(c, http.StatusInternalServerError, "jwt failure")
+		return
+	}
+
+	c.SetCookie(token.PRE_AUTH_TOKEN_NAME, pt, int(token.PreAuthTokenTTL.Seconds()), "/login", "localhost", false, true)
+
+	c.JSON(
+		http.StatusAccepted,
+		LoginResponse{
+			user.UID,
+			msg,
+		},
+	)
+}
+
+// maxCredentialLength bounds user ids and passwords
+// read by the login, in bytes.
+const maxCredentialLength = 1024
+
+// isCredential returns true if v may be a user id or password
+// of an existing user, whatever the current policies are.
+func isCredential(v string) bool {
+	return v != "" && len(v) <= maxCredentialLength
+}
+
+// loginHistoryLimit is the number of recent logins shown to users.
+const loginHistoryLimit = 20
+
+var (
+	dummyHashOnce sync.Once
+	dummyHash     string
+)
+
+// dummyPasswordHash returns a hash compared with the password
+// when the user does not exist.
+func dummyPasswordHash() string {
+	dummyHashOnce.Do(func() {
+		h, err := model.Password("dummy-password1!").Hash()
+		if err != nil {
+			panic(err)
+		}
+		dummyHash = h
+	})
+
+	return dummyHash
+}
+
 func handleLogout(c *gin.Context) {
 	c.SetCookie(token.ACCESS_TOKEN_NAME, "", -1, "/", "localhost", false, true)
 	writeMessage(c, http.StatusOK, "logout success")
 }
+
+func handleGetLoginHistory(c *gin.Context) {
+	userID := c.Param("user_id")
+
+	claims, keep := checkToken(c)
+	if !keep {
+		return
+	}
+
+	if claims.UserID != userID && claims.Role != model.RoleManager {
+		writeMessage(c, http.StatusUnauthorized, "invalid access token for this user")
+		return
+	}
+
+	db, err := db.Get()
+	if err != nil {
+		writeMessage(c, http.StatusInternalServerError, "db failure")
+		return
+	}
+
+	user, err := db.SelectUser(c.Request.Context(), userID)
+	if err != nil {
+		writeMessage(c, http.StatusInternalServerError, fmt.Sprintf("%v", err))
+		return
+	}
+
+	if user == nil {
+		writeMessage(c, http.StatusNotFound, "user not found")
+		return
+	}
+
+	history, err := db.SelectLoginHistory(c.Request.Context(), user.UID, loginHistoryLimit)
+	if err != nil {
+		writeMessage(c, http.StatusInternalServerError, fmt.Sprintf("%v", err))
+		return
+	}
+
+	c.JSON(
+		http.StatusOK,
+		GetLoginHistoryResponse{
+			user.UID,
+			history,
+		},
+	)
+}
+
+func handleUnlockUser(c *gin.Context) {
+	userID := c.Param("user_id")
+
+	claims, keep := checkToken(c)
+	if !keep {
+		return
+	}
+
+	if claims.Role != model.RoleManager {
+		writeMessage(c, http.StatusUnauthorized, "only manager can unlock user")
+		return
+	}
+
+	db, err := db.Get()
+	if err != nil {
+		writeMessage(c, http.StatusInternalServerError, "db failure")
+		return
+	}
+
+	user, err := db.SelectUser(c.Request.Context(), userID)
+	if err != nil {
+		writeMessage(c, http.StatusInternalServerError, fmt.Sprintf("%v", err))
+		return
+	}
+
+	if user == nil {
+		writeMessage(c, http.StatusNotFound, "user not found")
+		return
+	}
+
+	if err := db.DeleteLoginFailure(c.Request.Context(), userID); err != nil {
+		writeMessage(c, http.StatusInternalServerError, fmt.Sprintf("%v", err))
+		return
+	}
+
+	writeMessage(c, http.StatusOK, "unlock user success")
+}
@@ -1,13 +1,17 @@
 package handler_test
 
 import (
+	"context"
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
 	"strings"
 	"testing"
 
+	"simple-go-server/db"
 	"simple-go-server/handler"
+	"simple-go-server/hasher"
+	"simple-go-server/token"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -49,7 +53,144 @@ func TestHandleLogin(t *testing.T) {
 
 		TestRouter.ServeHTTP(res, req)
 		assert.Equal(http.StatusUnauthorized, res.Code)
-		assert.Equal(`{"message":"wrong password"}`, res.Body.String())
+
+		var msg map[string]string
+
+		err := json.NewDecoder(res.Body).Decode(&msg)
+		assert.Nil(err)
+		assert.Equal("invalid credentials", msg["message"])
+		assert.Equal(res.Header().Get("X-Request-ID"), msg["request_id"])
+	})
+}
+
+func TestLoginLockout(t *testing.T) {
+	assert := assert.New(t)
+
+	var at *http.Cookie
+
+	t.Run("test create user", func(t *testing.T) {
+		res := httptest.NewRecorder()
+		req := httptest.NewRequest("POST", "/user", strings.NewReader(
+			`{"user_id":"lockout1","role":"user","password":"lo1234++"}`,
+		))
+
+		TestRouter.ServeHTTP(res, req)
+		assert.Equal(http.StatusCreated, res.Code)
+	})
+
+	t.Run("test login; unknown user", func(t *testing.T) {
+		res := httptest.NewRecorder()
+		req := httptest.NewRequest("POST", "/login", strings.NewReader(
+			`{"user_id":"lockoutnone","password":"lo1234++"}`,
+		))
+
+		TestRouter.ServeHTTP(res, req)
+		assert.Equal(http.StatusUnauthorized, res.Code)
+
+		var msg map[string]string
+
+		err := json.NewDecoder(res.Body).Decode(&msg)
+		assert.Nil(err)
+		assert.Equal("invalid credentials", msg["message"])
+	})
+
+	t.Run("test login; delayed after failures", func(t *testing.T) {
+		for i := 0; i < 3; i++ {
+			res := httptest.NewRecorder()
+			req := httptest.NewRequest("POST", "/login", strings.NewReader(
+				`{"user_id":"lockout1","password":"lo4321++"}`,
+			))
+
+			TestRouter.ServeHTTP(res, req)
+			assert.Equal(http.StatusUnauthorized, res.Code)
+		}
+
+		res := httptest.NewRecorder()
+		req := httptest.NewRequest("POST", "/login", strings.NewReader(
+			`{"user_id":"lockout1","password":"lo1234++"}`,
+		))
+
+		TestRouter.ServeHTTP(res, req)
+		assert.Equal(http.StatusTooManyRequests, res.Code)
+		assert.NotEmpty(res.Header().Get("Retry-After"))
+	})
+
+	t.Run("test unlock; not manager", func(t *testing.T) {
+		res := httptest.NewRecorder()
+		req := httptest.NewRequest("POST", "/user/lockout1/unlock", nil)
+
+		TestRouter.ServeHTTP(res, req)
+		assert.Equal(http.StatusUnauthorized, res.Code)
+	})
+
+	t.Run("test login; manager", func(t *testing.T) {
+		res := httptest.NewRecorder()
+		req := httptest.NewRequest("POST", "/login", strings.NewReader(
+			`{"user_id":"master01","password":"pwmaster01++"}`,
+		))
+
+		TestRouter.ServeHTTP(res, req)
+		assert.Equal(http.StatusOK, res.Code)
+
+		for _, k := range res.Result().Cookies() {
+			if k.Name == token.ACCESS_TOKEN_NAME {
+				at = k
+			}
+		}
+	})
+
+	t.Run("test unlock", func(t *testing.T) {
+		res := httptest.NewRecorder()
+		req := httptest.NewRequest("POST", "/user/lockout1/unlock", nil)
+		req.AddCookie(at)
+
+		TestRouter.ServeHTTP(res, req)
+		assert.Equal(http.StatusOK, res.Code)
+		assert.Equal(`{"message":"unlock user success"}`, res.Body.String())
+	})
+
+	t.Run("test login; success after unlock", func(t *testing.T) {
+		res := httptest.NewRecorder()
+		req := httptest.NewRequest("POST", "/login", strings.NewReader(
+			`{"user_id":"lockout1","password":"lo1234++"}`,
+		))
+
+		TestRouter.ServeHTTP(res, req)
+		assert.Equal(http.StatusOK, res.Code)
+
+		for _, k := range res.Result().Cookies() {
+			if k.Name == token.ACCESS_TOKEN_NAME {
+				at = k
+			}
+		}
+	})
+
+	t.Run("test get login history", func(t *testing.T) {
+		res := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", "/user/lockout1/logins", nil)
+		req.AddCookie(at)
+
+		TestRouter.ServeHTTP(res, req)
+		assert.Equal(http.StatusOK, res.Code)
+
+		var history handler.GetLoginHistoryResponse
+
+		err := json.NewDecoder(res.Body).Decode(&history)
+		assert.Nil(err)
+		assert.Len(history.Logins, 4)
+		assert.True(history.Logins[0].Success)
+		for _, h := range history.Logins[1:] {
+			assert.False(h.Success)
+		}
+	})
+
+	t.Run("test get login history; other user", func(t *testing.T) {
+		res := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", "/user/master01/logins", nil)
+		req.AddCookie(at)
+
+		TestRouter.ServeHTTP(res, req)
+		assert.Equal(http.StatusUnauthorized, res.Code)
 	})
 }
 
@@ -92,3 +233,52 @@ func TestHandleLogout(t *testing.T) {
 		assert.Equal(`{"message":"logout success"}`, res.Body.String())
 	})
 }
+
+func TestLoginRehash(t *testing.T) {
+	assert := assert.New(t)
+
+	old := hasher.Default()
+	defer hasher.SetDefault(old)
+
+	hasher.SetDefault(hasher.Bcrypt{Cost: 4})
+
+	t.Run("test create user; bcrypt", func(t *testing.T) {
+		res := httptest.NewRecorder()
+		req := httptest.NewRequest("POST", "/user", strings.NewReader(
+			`{"user_id":"rehash1","role":"user","password":"rh1234++"}`,
+		))
+
+		TestRouter.ServeHTTP(res, req)
+		assert.Equal(http.StatusCreated, res.Code)
+	})
+
+	hasher.SetDefault(hasher.Argon2id{Memory: 8 * 1024, Time: 1, Threads: 1})
+
+	t.Run("test login; rehash", func(t *testing.T) {
+		res := httptest.NewRecorder()
+		req := httptest.NewRequest("POST", "/login", strings.NewReader(
+			`{"user_id":"rehash1","password":"rh1234++"}`,
+		))
+
+		TestRouter.ServeHTTP(res, req)
+		assert.Equal(http.StatusOK, res.Code)
+
+		d, err := db.Get()
+		assert.Nil(err)
+
+		user, err := d.SelectUser(context.Background(), "rehash1")
+		assert.Nil(err)
+		assert.True(strings.HasPrefix(user.Password, "$argon2id$"))
+		assert.False(hasher.NeedsRehash(user.Password))
+	})
+
+	t.Run("test login; rehashed password", func(t *testing.T) {
+		res := httptest.NewRecorder()
+		req := httptest.NewRequest("POST", "/login", strings.NewReader(
+			`{"user_id":"rehash1","password":"rh1234++"}`,
+		))
+
+		TestRouter.ServeHTTP(res, req)
+		assert.Equal(http.StatusOK, res.Code)
+	})
+}
@@ -0,0 +1,586 @@
+package handler
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"simple-go-server/db"
+	"simple-go-server/model"
+	"simple-go-server/token"
+
+	"github.com/gin-gonic/gin"
+)
+
+const defaultGuestCartTTL = 7 * 24 * time.Hour
+
+// guestCartTTL returns the time a guest cart is kept after its last change,
+// set by GUEST_CART_TTL.
+func guestCartTTL() time.Duration {
+	d, err := time.ParseDuration(os.Getenv("GUEST_CART_TTL"))
+	if err != nil || d <= 0 {
+		return defaultGuestCartTTL
+	}
+	return d
+}
+
+// cartOwner returns the user logged in, or the guest of the guest-cart cookie.
+// A guest without a valid cookie gets an empty gid, owning no items,
+// unless create is true, in which case a new guest is issued.
+// Every change of a guest cart calls cartOwner with create,
+// which keeps the guest cart for another guestCartTTL.
+func cartOwner(c *gin.Context, create bool) (model.CartOwner, bool) {
+	if _, err := c.Cookie(token.ACCESS_TOKEN_NAME); err != http.ErrNoCookie {
+		claims, keep := checkToken(c)
+		if !keep {
+			return model.CartOwner{}, false
+		}
+		return model.CartOwner{UID: claims.UID}, true
+	}
+
+	owner := model.CartOwner{}
+
+	if gt, err := c.Cookie(token.GUEST_CART_TOKEN_NAME); err == nil {
+		if claims, err := token.GetGuestCartToken(gt); err == nil {
+			owner.GID = claims.GID
+		}
+	}
+
+	if !create {
+		return owner, true
+	}
+
+	if owner.GID == "" {
+		gid, err := newGuestID()
+		if err != nil {
+			writeMessage(c, http.StatusInternalServerError, "guest id failure")
+			return model.CartOwner{}, false
+		}
+		owner.GID = gid
+	}
+
+	db, err := db.Get()
+	if err != nil {
+		writeMessage(c, http.StatusInternalServerError, "db failure")
+		return model.CartOwner{}, false
+	}
+
+	ttl := guestCartTTL()
+
+	if err := db.TouchGuest(c.Request.Context(), owner.GID, time.Now().Add(ttl)); err != nil {
+		writeMessage(c, http.StatusInternalServerError, fmt.Sprintf("%v", err))
+		return model.CartOwner{}, false
+	}
+
+	gt, err := token.CreateGuestCartToken(owner.GID, ttl)
+	if err != nil {
+		writeMessage(c, http.StatusInternalServerError, "jwt failure")
+		return model.CartOwner{}, false
+	}
+
+	c.SetCookie(token.GUEST_CART_TOKEN_NAME, gt, int(ttl.Seconds()), "/", "localhost", false, true)
+
+	return owner, true
+}
+
+func newGuestID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// mergeGuestCart moves the cart of the guest-cart cookie, if any,
+// into the cart of the user logging in, and clears the cookie.
+// The login goes on even if the merge fails.
+func mergeGuestCart(c *gin.Context, db *db.Database, uid int64) {
+	gt, err := c.Cookie(token.GUEST_CART_TOKEN_NAME)
+	if err != nil {
+		return
+	}
+
+	c.SetCookie(token.GUEST_CART_TOKEN_NAME, "", -1, "/", "localhost", false, true)
+
+	claims, err := token.GetGuestCartToken(gt)
+	if err != nil {
+		return
+	}
+
+	if err := db.MergeGuestCart(c.Request.Context(), claims.GID, uid); err != nil {
+		requestLogger(c).Warn("guest cart merge failure", "error", err)
+	}
+}
+
+// queryVID returns the variant of the cart item of the vid query,
+// which is 0 for products without variants.
+func queryVID(c *gin.Context) (int64, bool) {
+	v := c.Query("vid")
+	if v == "" {
+		return 0, true
+	}
+
+	vid, err := strconv.Atoi(v)
+	if err != nil || vid < 0 {
+		writeMessage(c, http.StatusBadRequest, "invalid variant id format")
+		return 0, false
+	}
+
+	return int64(vid), true
+}
+
+// priceCart returns the cart of the owner priced at the current product and variant prices,
+// with the issues of deleted or repriced products, of variants out of stock
+// and of items in another currency than the cart, which is the currency of the earliest item.
+// Products turned into drafts are flagged as deleted, as they cannot be ordered.
+func priceCart(ctx context.Context, db *db.Database, owner model.CartOwner) (*GetCartResponse, error) {
+	items, err := db.SelectCartItems(ctx, owner)
+	if err != nil {
+		return nil, err
+	}
+
+	cart := GetCartResponse{
+		UID:   owner.UID,
+		Items: make([]CartLine, len(items)),
+		Total: model.NewMoney(0, model.DefaultCurrency),
+		Valid: true,
+	}
+
+	// the cart takes the currency of its earliest item that can be ordered.
+	priced := false
+
+	for i, item := range items {
+		product, err := db.SelectProduct(ctx, item.PID)
+		if err != nil {
+			return nil, err
+		}
+
+		var variant *model.Variant
+		hasVariants := false
+
+		if product != nil && item.VID != 0 {
+			if variant, err = db.SelectVariant(ctx, item.VID); err != nil {
+				return nil, err
+			}
+		} else if product != nil {
+			if hasVariants, err = db.HasVariants(ctx, item.PID); err != nil {
+				return nil, err
+			}
+		}
+
+		line := CartLine{
+			PID:        item.PID,
+			VID:        item.VID,
+			Quantity:   item.Quantity,
+			AddedPrice: item.Price,
+		}
+
+		mismatch := false
+		deleted := product == nil || !product.Published || hasVariants ||
+			item.VID != 0 && (variant == nil || variant.PID != item.PID)
+
+		if !deleted {
+			line.Name = product.Name
+			line.Price = product.Price
+
+			if variant != nil {
+				line.SKU = variant.SKU
+				line.Options = variant.Options
+				line.Price = variant.UnitPrice(product)
+			}
+
+			line.Subtotal = line.Price.Mul(item.Quantity)
+
+			if !priced {
+				cart.Total = model.NewMoney(0, line.Price.Currency)
+				priced = true
+			}
+
+			if total, err := cart.Total.Add(line.Subtotal); err == nil {
+				cart.Total = total
+			} else {
+				mismatch = true
+			}
+		}
+
+		switch {
+		case deleted:
+			line.Issue = model.CartIssueDeleted
+		case mismatch:
+			line.Issue = model.CartIssueCurrency
+		case line.Price != item.Price:
+			line.Issue = model.CartIssueRepriced
+		case variant != nil && variant.Stock < item.Quantity:
+			line.Issue = model.CartIssueOutOfStock
+		}
+
+		if line.Issue != "" {
+			cart.Valid = false
+		}
+
+		cart.Items[i] = line
+	}
+
+	return &cart, nil
+}
+
+// writeCart responds with the current cart of the owner.
+func writeCart(c *gin.Context, db *db.Database, owner model.CartOwner, code int) {
+	cart, err := priceCart(c.Request.Context(), db, owner)
+	if err != nil {
+		writeMessage(c, http.StatusInternalServerError, fmt.Sprintf("%v", err))
+		return
+	}
+
+	c.JSON(code, cart)
+}
+
+func handleGetCart(c *gin.Context) {
+	owner, keep := cartOwner(c, false)
+	if !keep {
+		return
+	}
+
+	db, err := db.Get()
+	if err != nil {
+		writeMessage(c, http.StatusInternalServerError, "db failure")
+		return
+	}
+
+	writeCart(c, db, owner, http.StatusOK)
+}
+
+func handleAddCartItem(c *gin.Context) {
+	req := new(AddCartItemRequest)
+
+	if err := json.NewDecoder(c.Request.Body).Decode(&req); err != nil {
+		writeMessage(c, http.StatusBadRequest, "invalid request format")
+		return
+	}
+
+	if err := model.CartQuantity(req.Quantity).IsValid(); err != nil {
+		writeMessage(c, http.StatusBadRequest, fmt.Sprintf("%v", err))
+		return
+	}
+
+	owner, keep := cartOwner(c, true)
+	if !keep {
+		return
+	}
+
+	db, err := db.Get()
+	if err != nil {
+		writeMessage(c, http.StatusInternalServerError, "db failure")
+		return
+	}
+
+	product, err := db.SelectProduct(c.Request.Context(), req.PID)
+	if err != nil {
+		writeMessage(c, http.StatusInternalServerError, fmt.Sprintf("%v", err))
+		return
+	}
+
+	if product == nil || !product.Published {
+		writeMessage(c, http.StatusNotFound, "product not found")
+		return
+	}
+
+	price, max := product.Price, int64(model.MaxCartQuantity)
+
+	if req.VID != 0 {
+		variant, err := db.SelectVariant(c.Request.Context(), req.VID)
+		if err != nil {
+			writeMessage(c, http.StatusInternalServerError, fmt.Sprintf("%v", err))
+			return
+		}
+
+		if variant == nil || variant.PID != product.PID {
+			writeMessage(c, http.StatusNotFound, "variant not found")
+			return
+		}
+
+		if variant.Stock < req.Quantity {
+			writeMessage(c, http.StatusConflict, "insufficient stock")
+			return
+		}
+
+		price = variant.UnitPrice(product)
+		if variant.Stock < max {
+			max = variant.Stock
+		}
+	} else {
+		hasVariants, err := db.HasVariants(c.Request.Context(), product.PID)
+		if err != nil {
+			writeMessage(c, http.StatusInternalServerError, fmt.Sprintf("%v", err))
+			return
+		}
+
+		if hasVariants {
+			writeMessage(c, http.StatusBadRequest, "variant required for product with variants")
+			return
+		}
+	}
+
+	// an order is paid in a single currency, and so is a cart.
+	items, err := db.SelectCartItems(c.Request.Context(), owner)
+	if err != nil {
+		writeMessage(c, http.StatusInternalServerError, fmt.Sprintf("%v", err))
+		return
+	}
+
+	for _, item := range items {
+		if item.Price.Currency != price.Currency {
+			writeMessage(c, http.StatusConflict, "cart has items in another currency")
+			return
+		}
+	}
+
+	if err := db.InsertCartItem(c.Request.Context(), owner, product.PID, req.VID, req.Quantity, price, max); err != nil {
+		writeMessage(c, http.StatusInternalServerError, fmt.Sprintf("%v", err))
+		return
+	}
+
+	writeCart(c, db, owner, http.StatusOK)
+}
+
+func handleUpdateCartItem(c *gin.Context) {
+	pid, err := strconv.Atoi(c.Param("pid"))
+	if err != nil {
+		writeMessage(c, http.StatusBadRequest, "invalid product id format")
+		return
+	}
+
+	vid, keep := queryVID(c)
+	if !keep {
+		return
+	}
+
+	req := new(UpdateCartItemRequest)
+
+	if err := json.NewDecoder(c.Request.Body).Decode(&req); err != nil {
+		writeMessage(c, http.StatusBadRequest, "invalid request format")
+		return
+	}
+
+	if err := model.CartQuantity(req.Quantity).IsValid(); err != nil {
+		writeMessage(c, http.StatusBadRequest, fmt.Sprintf("%v", err))
+		return
+	}
+
+	owner, keep := cartOwner(c, true)
+	if !keep {
+		return
+	}
+
+	db, err := db.Get()
+	if err != nil {
+		writeMessage(c, http.StatusInternalServerError, "db failure")
+		return
+	}
+
+	item, err := db.SelectCartItem(c.Request.Context(), owner, int64(pid), vid)
+	if err != nil {
+		writeMessage(c, http.StatusInternalServerError, fmt.Sprintf("%v", err))
+		return
+	}
+
+	if item == nil {
+		writeMessage(c, http.StatusNotFound, "cart item not found")
+		return
+	}
+
+	if item.VID != 0 {
+		variant, err := db.SelectVariant(c.Request.Context(), item.VID)
+		if err != nil {
+			writeMessage(c, http.StatusInternalServerError, fmt.Sprintf("%v", err))
+			return
+		}
+
+		if variant != nil && variant.Stock < req.Quantity {
+			writeMessage(c, http.StatusConflict, "insufficient stock")
+			return
+		}
+	}
+
+	if err := db.UpdateCartItem(c.Request.Context(), owner, item.PID, item.VID, req.Quantity); err != nil {
+		writeMessage(c, http.StatusInternalServerError, fmt.Sprintf("%v", err))
+		return
+	}
+
+	writeCart(c, db, owner, http.StatusOK)
+}
+
+func handleDeleteCartItem(c *gin.Context) {
+	pid, err := strconv.Atoi(c.Param("pid"))
+	if err != nil {
+		writeMessage(c, http.StatusBadRequest, "invalid product id format")
+		return
+	}
+
+	vid, keep := queryVID(c)
+	if !keep {
+		return
+	}
+
+	owner, keep := cartOwner(c, true)
+	if !keep {
+		return
+	}
+
+	db, err := db.Get()
+	if err != nil {
+		writeMessage(c, http.StatusInternalServerError, "db failure")
+		return
+	}
+
+	item, err := db.SelectCartItem(c.Request.Context(), owner, int64(pid), vid)
+	if err != nil {
+		writeMessage(c, http.StatusInternalServerError, fmt.Sprintf("%v", err))
+		return
+	}
+
+	if item == nil {
+		writeMessage(c, http.StatusNotFound, "cart item not found")
+		return
+	}
+
+	if err := db.DeleteCartItem(c.Request.Context(), owner, item.PID, item.VID); err != nil {
+		writeMessage(c, http.StatusInternalServerError, fmt.Sprintf("%v", err))
+		return
+	}
+
+	writeCart(c, db, owner, http.StatusOK)
+}
+
+func handleDeleteCart(c *gin.Context) {
+	owner, keep := cartOwner(c, false)
+	if !keep {
+		return
+	}
+
+	db, err := db.Get()
+	if err != nil {
+		writeMessage(c, http.StatusInternalServerError, "db failure")
+		return
+	}
+
+	if err := db.DeleteCart(c.Request.Context(), owner); err != nil {
+		writeMessage(c, http.StatusInternalServerError, fmt.Sprintf("%v", err))
+		return
+	}
+
+	writeMessage(c, http.StatusOK, "delete cart success")
+}
+
+// handleRefreshCart accepts the issues of the cart,
+// taking the current prices, removing deleted products, sold out variants
+// and items in another currency than the cart, and lowering the quantities to the stock.
+func handleRefreshCart(c *gin.Context) {
+	owner, keep := cartOwner(c, true)
+	if !keep {
+		return
+	}
+
+	db, err := db.Get()
+	if err != nil {
+		writeMessage(c, http.StatusInternalServerError, "db failure")
+		return
+	}
+
+	if err := db.RefreshCart(c.Request.Context(), owner); err != nil {
+		writeMessage(c, http.StatusInternalServerError, fmt.Sprintf("%v", err))
+		return
+	}
+
+	writeCart(c, db, owner, http.StatusOK)
+}
+
+// handleCheckoutCart orders the items of the cart and empties it.
+// A cart with issues responds conflict with the cart,
+// so that the user reviews it before ordering.
+// The current rate to the currency of the currency query, if any, is recorded in the order,
+// and the coupon of the optional request body, if any, is redeemed for the order.
+func handleCheckoutCart(c *gin.Context) {
+	req := new(CheckoutCartRequest)
+
+	if err := json.NewDecoder(c.Request.Body).Decode(&req); err != nil && err != io.EOF {
+		writeMessage(c, http.StatusBadRequest, "invalid request format")
+		return
+	}
+
+	converter, keep := newPriceConverter(c)
+	if !keep {
+		return
+	}
+
+	claims, keep := checkToken(c)
+	if !keep {
+		return
+	}
+
+	d, err := db.Get()
+	if err != nil {
+		writeMessage(c, http.StatusInternalServerError, "db failure")
+		return
+	}
+
+	cart, err := priceCart(c.Request.Context(), d, model.CartOwner{UID: claims.UID})
+	if err != nil {
+		writeMessage(c, http.StatusInternalServerError, fmt.Sprintf("%v", err))
+		return
+	}
+
+	if len(cart.Items) == 0 {
+		writeMessage(c, http.StatusBadRequest, "empty cart")
+		return
+	}
+
+	if !cart.Valid {
+		c.JSON(http.StatusConflict, cart)
+		return
+	}
+
+	rate, keep := converter.rate(c, d, cart.Total.Currency)
+	if !keep {
+		return
+	}
+
+	// the cart is checked again in the transaction,
+	// as products and stock may change while it is priced.
+	coupon := string(model.CouponCode(req.Coupon).Normalized())
+
+	oid, err := d.CheckoutCart(c.Request.Context(), claims.UID, rate, coupon)
+	if writeCouponError(c, err) {
+		return
+	}
+	if err == db.ErrCartEmpty {
+		writeMessage(c, http.StatusBadRequest, "empty cart")
+		return
+	}
+	if err == db.ErrCartChanged || err == db.ErrOutOfStock || err == model.ErrCurrencyMismatch {
+		writeCart(c, d, model.CartOwner{UID: claims.UID}, http.StatusConflict)
+		return
+	}
+	if err != nil {
+		writeMessage(c, http.StatusInternalServerError, fmt.Sprintf("%v", err))
+		return
+	}
+
+	ordersCreated.Inc()
+
+	c.JSON(
+		http.StatusCreated,
+		CreateOrderResponse{
+			oid,
+			"checkout cart success",
+		},
+	)
+}
@@ -0,0 +1,678 @@
+package handler_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"simple-go-server/db"
+	"simple-go-server/handler"
+	"simple-go-server/model"
+	"simple-go-server/token"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHandleCart(t *testing.T) {
+	assert := assert.New(t)
+
+	var at, mt *http.Cookie
+	pids := []int64{}
+
+	// cart returns the cart responded to the request.
+	cart := func(res *httptest.ResponseRecorder) handler.GetCartResponse {
+		c := handler.GetCartResponse{}
+		assert.Nil(json.NewDecoder(res.Body).Decode(&c))
+		return c
+	}
+
+	t.Run("test create user", func(t *testing.T) {
+		res := httptest.NewRecorder()
+		req := httptest.NewRequest("POST", "/user", strings.NewReader(
+			`{"user_id":"handlercart1","role":"user","password":"hct1234++"}`,
+		))
+
+		TestRouter.ServeHTTP(res, req)
+		assert.Equal(http.StatusCreated, res.Code)
+
+		at = login(t, `{"user_id":"handlercart1","password":"hct1234++"}`)
+		mt = login(t, `{"user_id":"master01","password":"pwmaster01++"}`)
+	})
+
+	t.Run("test create product", func(t *testing.T) {
+		for _, body := range []string{`{"name":"cart cookie","price":500}`, `{"name":"cart milk","price":1200}`} {
+			res := httptest.NewRecorder()
+			req := httptest.NewRequest("POST", "/product", strings.NewReader(body))
+			req.AddCookie(mt)
+
+			TestRouter.ServeHTTP(res, req)
+			assert.Equal(http.StatusCreated, res.Code)
+
+			pd := handler.CreateProductResponse{}
+			assert.Nil(json.NewDecoder(res.Body).Decode(&pd))
+
+			pids = append(pids, pd.PID)
+		}
+	})
+
+	t.Run("test get cart; guest", func(t *testing.T) {
+		res := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", "/cart", nil)
+
+		TestRouter.ServeHTTP(res, req)
+		assert.Equal(http.StatusOK, res.Code)
+		assert.Len(cart(res).Items, 0)
+	})
+
+	t.Run("test checkout cart; empty", func(t *testing.T) {
+		res := httptest.NewRecorder()
+		req := httptest.NewRequest("POST", "/cart/checkout", nil)
+		req.AddCookie(at)
+
+		TestRouter.ServeHTTP(res, req)
+		assert.Equal(http.StatusBadRequest, res.Code)
+	})
+
+	t.Run("test add cart item; invalid quantity", func(t *testing.T) {
+		res := httptest.NewRecorder()
+		req := httptest.NewRequest("POST", "/cart/items", strings.NewReader(
+			fmt.Sprintf(`{"pid":%d,"quantity":0}`, pids[0]),
+		))
+		req.AddCookie(at)
+
+		TestRouter.ServeHTTP(res, req)
+		assert.Equal(http.StatusBadRequest, res.Code)
+	})
+
+	t.Run("test add cart item; unknown product", func(t *testing.T) {
+		res := httptest.NewRecorder()
+		req := httptest.NewRequest("POST", "/cart/items", strings.NewReader(
+			`{"pid":100000,"quantity":1}`,
+		))
+		req.AddCookie(at)
+
+		TestRouter.ServeHTTP(res, req)
+		assert.Equal(http.StatusNotFound, res.Code)
+	})
+
+	t.Run("test add cart item", func(t *testing.T) {
+		for _, body := range []string{
+			fmt.Sprintf(`{"pid":%d,"quantity":2}`, pids[0]),
+			fmt.Sprintf(`{"pid":%d,"quantity":1}`, pids[0]),
+			fmt.Sprintf(`{"pid":%d,"quantity":1}`, pids[1]),
+		} {
+			res := httptest.NewRecorder()
+			req := httptest.NewRequest("POST", "/cart/items", strings.NewReader(body))
+			req.AddCookie(at)
+
+			TestRouter.ServeHTTP(res, req)
+			assert.Equal(http.StatusOK, res.Code)
+		}
+
+		res := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", "/cart", nil)
+		req.AddCookie(at)
+
+		TestRouter.ServeHTTP(res, req)
+		assert.Equal(http.StatusOK, res.Code)
+
+		c := cart(res)
+		assert.Len(c.Items, 2)
+		assert.Equal(int64(3), c.Items[0].Quantity)
+		assert.Equal(int64(1500), c.Items[0].Subtotal.Amount)
+		assert.Equal(int64(2700), c.Total.Amount)
+		assert.True(c.Valid)
+	})
+
+	t.Run("test update cart item", func(t *testing.T) {
+		res := httptest.NewRecorder()
+		req := httptest.NewRequest("PUT", fmt.Sprintf("/cart/items/%d", pids[1]), strings.NewReader(
+			`{"quantity":2}`,
+		))
+		req.AddCookie(at)
+
+		TestRouter.ServeHTTP(res, req)
+		assert.Equal(http.StatusOK, res.Code)
+		assert.Equal(int64(3900), cart(res).Total.Amount)
+	})
+
+	t.Run("test update cart item; not in cart", func(t *testing.T) {
+		res := httptest.NewRecorder()
+		req := httptest.NewRequest("PUT", "/cart/items/100000", strings.NewReader(
+			`{"quantity":2}`,
+		))
+		req.AddCookie(at)
+
+		TestRouter.ServeHTTP(res, req)
+		assert.Equal(http.StatusNotFound, res.Code)
+	})
+
+	t.Run("test checkout cart; repriced and deleted products", func(t *testing.T) {
+		res := httptest.NewRecorder()
+		req := httptest.NewRequest("PUT", fmt.Sprintf("/product/%d", pids[0]), strings.NewReader(
+			`{"name":"cart cookie","price":600}`,
+		))
+		req.AddCookie(mt)
+
+		TestRouter.ServeHTTP(res, req)
+		assert.Equal(http.StatusOK, res.Code)
+
+		res = httptest.NewRecorder()
+		req = httptest.NewRequest("DELETE", fmt.Sprintf("/product/%d", pids[1]), nil)
+		req.AddCookie(mt)
+
+		TestRouter.ServeHTTP(res, req)
+		assert.Equal(http.StatusOK, res.Code)
+
+		res = httptest.NewRecorder()
+		req = httptest.NewRequest("POST", "/cart/checkout", nil)
+		req.AddCookie(at)
+
+		TestRouter.ServeHTTP(res, req)
+		assert.Equal(http.StatusConflict, res.Code)
+
+		c := cart(res)
+		assert.False(c.Valid)
+		assert.Equal(model.CartIssueRepriced, c.Items[0].Issue)
+		assert.Equal(int64(500), c.Items[0].AddedPrice.Amount)
+		assert.Equal(int64(600), c.Items[0].Price.Amount)
+		assert.Equal(model.CartIssueDeleted, c.Items[1].Issue)
+		assert.Equal(int64(1800), c.Total.Amount)
+	})
+
+	t.Run("test refresh cart", func(t *testing.T) {
+		res := httptest.NewRecorder()
+		req := httptest.NewRequest("POST", "/cart/refresh", nil)
+		req.AddCookie(at)
+
+		TestRouter.ServeHTTP(res, req)
+		assert.Equal(http.StatusOK, res.Code)
+
+		c := cart(res)
+		assert.True(c.Valid)
+		assert.Len(c.Items, 1)
+		assert.Equal(int64(600), c.Items[0].AddedPrice.Amount)
+	})
+
+	var oid int64
+
+	t.Run("test checkout cart", func(t *testing.T) {
+		res := httptest.NewRecorder()
+		req := httptest.NewRequest("POST", "/cart/checkout", nil)
+		req.AddCookie(at)
+
+		TestRouter.ServeHTTP(res, req)
+		assert.Equal(http.StatusCreated, res.Code)
+
+		od := handler.CreateOrderResponse{}
+		assert.Nil(json.NewDecoder(res.Body).Decode(&od))
+		assert.Equal("checkout cart success", od.Message)
+
+		oid = od.OID
+
+		res = httptest.NewRecorder()
+		req = httptest.NewRequest("GET", "/cart", nil)
+		req.AddCookie(at)
+
+		TestRouter.ServeHTTP(res, req)
+		assert.Equal(http.StatusOK, res.Code)
+		assert.Len(cart(res).Items, 0)
+	})
+
+	t.Run("test get order", func(t *testing.T) {
+		res := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", fmt.Sprintf("/order/%d", oid), nil)
+		req.AddCookie(at)
+
+		TestRouter.ServeHTTP(res, req)
+		assert.Equal(http.StatusOK, res.Code)
+
+		od := handler.GetOrderResponse{}
+		assert.Nil(json.NewDecoder(res.Body).Decode(&od))
+		assert.Equal([]int64{pids[0]}, od.Products)
+		assert.Len(od.Items, 1)
+		assert.Equal(int64(3), od.Items[0].Quantity)
+		assert.Equal(int64(600), od.Items[0].Price.Amount)
+		assert.Equal(int64(1800), od.Total.Amount)
+		assert.Equal("$18.00", od.Total.String())
+	})
+
+	t.Run("test delete cart", func(t *testing.T) {
+		res := httptest.NewRecorder()
+		req := httptest.NewRequest("POST", "/cart/items", strings.NewReader(
+			fmt.Sprintf(`{"pid":%d,"quantity":1}`, pids[0]),
+		))
+		req.AddCookie(at)
+
+		TestRouter.ServeHTTP(res, req)
+		assert.Equal(http.StatusOK, res.Code)
+
+		res = httptest.NewRecorder()
+		req = httptest.NewRequest("DELETE", fmt.Sprintf("/cart/items/%d", pids[0]), nil)
+		req.AddCookie(at)
+
+		TestRouter.ServeHTTP(res, req)
+		assert.Equal(http.StatusOK, res.Code)
+		assert.Len(cart(res).Items, 0)
+
+		res = httptest.NewRecorder()
+		req = httptest.NewRequest("DELETE", "/cart", nil)
+		req.AddCookie(at)
+
+		TestRouter.ServeHTTP(res, req)
+		assert.Equal(http.StatusOK, res.Code)
+	})
+}
+
+func TestHandleGuestCart(t *testing.T) {
+	assert := assert.New(t)
+
+	var gt, mt *http.Cookie
+	var pid int64
+
+	// guestCookie returns the guest-cart cookie set by the response.
+	guestCookie := func(res *httptest.ResponseRecorder) *http.Cookie {
+		for _, k := range res.Result().Cookies() {
+			if k.Name == token.GUEST_CART_TOKEN_NAME {
+				return k
+			}
+		}
+		return nil
+	}
+
+	t.Run("test create user", func(t *testing.T) {
+		res := httptest.NewRecorder()
+		req := httptest.NewRequest("POST", "/user", strings.NewReader(
+			`{"user_id":"handlerguest1","role":"user","password":"hgc1234++"}`,
+		))
+
+		TestRouter.ServeHTTP(res, req)
+		assert.Equal(http.StatusCreated, res.Code)
+
+		mt = login(t, `{"user_id":"master01","password":"pwmaster01++"}`)
+
+		res = httptest.NewRecorder()
+		req = httptest.NewRequest("POST", "/product", strings.NewReader(`{"name":"guest cookie","price":300}`))
+		req.AddCookie(mt)
+
+		TestRouter.ServeHTTP(res, req)
+		assert.Equal(http.StatusCreated, res.Code)
+
+		pd := handler.CreateProductResponse{}
+		assert.Nil(json.NewDecoder(res.Body).Decode(&pd))
+
+		pid = pd.PID
+	})
+
+	t.Run("test add cart item; user", func(t *testing.T) {
+		at := login(t, `{"user_id":"handlerguest1","password":"hgc1234++"}`)
+
+		res := httptest.NewRecorder()
+		req := httptest.NewRequest("POST", "/cart/items", strings.NewReader(
+			fmt.Sprintf(`{"pid":%d,"quantity":90}`, pid),
+		))
+		req.AddCookie(at)
+
+		TestRouter.ServeHTTP(res, req)
+		assert.Equal(http.StatusOK, res.Code)
+	})
+
+	t.Run("test add cart item; guest", func(t *testing.T) {
+		res := httptest.NewRecorder()
+		req := httptest.NewRequest("POST", "/cart/items", strings.NewReader(
+			fmt.Sprintf(`{"pid":%d,"quantity":5}`, pid),
+		))
+
+		TestRouter.ServeHTTP(res, req)
+		assert.Equal(http.StatusOK, res.Code)
+
+		gt = guestCookie(res)
+		assert.NotNil(gt)
+
+		res = httptest.NewRecorder()
+		req = httptest.NewRequest("POST", "/cart/items", strings.NewReader(
+			fmt.Sprintf(`{"pid":%d,"quantity":5}`, pid),
+		))
+		req.AddCookie(gt)
+
+		TestRouter.ServeHTTP(res, req)
+		assert.Equal(http.StatusOK, res.Code)
+
+		c := handler.GetCartResponse{}
+		assert.Nil(json.NewDecoder(res.Body).Decode(&c))
+		assert.Len(c.Items, 1)
+		assert.Equal(int64(10), c.Items[0].Quantity)
+		assert.Equal(int64(3000), c.Total.Amount)
+	})
+
+	t.Run("test get cart; forged guest cookie", func(t *testing.T) {
+		res := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", "/cart", nil)
+		req.AddCookie(&http.Cookie{Name: token.GUEST_CART_TOKEN_NAME, Value: gt.Value + "x"})
+
+		TestRouter.ServeHTTP(res, req)
+		assert.Equal(http.StatusOK, res.Code)
+
+		c := handler.GetCartResponse{}
+		assert.Nil(json.NewDecoder(res.Body).Decode(&c))
+		assert.Len(c.Items, 0)
+	})
+
+	t.Run("test checkout cart; guest", func(t *testing.T) {
+		res := httptest.NewRecorder()
+		req := httptest.NewRequest("POST", "/cart/checkout", nil)
+		req.AddCookie(gt)
+
+		TestRouter.ServeHTTP(res, req)
+		assert.Equal(http.StatusUnauthorized, res.Code)
+	})
+
+	t.Run("test login; merge guest cart", func(t *testing.T) {
+		res := httptest.NewRecorder()
+		req := httptest.NewRequest("POST", "/login", strings.NewReader(
+			`{"user_id":"handlerguest1","password":"hgc1234++"}`,
+		))
+		req.AddCookie(gt)
+
+		TestRouter.ServeHTTP(res, req)
+		assert.Equal(http.StatusOK, res.Code)
+
+		cleared := guestCookie(res)
+		assert.NotNil(cleared)
+		assert.Less(cleared.MaxAge, 0)
+
+		var at *http.Cookie
+		for _, k := range res.Result().Cookies() {
+			if k.Name == token.ACCESS_TOKEN_NAME {
+				at = k
+			}
+		}
+
+		res = httptest.NewRecorder()
+		req = httptest.NewRequest("GET", "/cart", nil)
+		req.AddCookie(at)
+
+		TestRouter.ServeHTTP(res, req)
+		assert.Equal(http.StatusOK, res.Code)
+
+		c := handler.GetCartResponse{}
+		assert.Nil(json.NewDecoder(res.Body).Decode(&c))
+		assert.Len(c.Items, 1)
+		assert.Equal(int64(model.MaxCartQuantity), c.Items[0].Quantity)
+
+		res = httptest.NewRecorder()
+		req = httptest.NewRequest("GET", "/cart", nil)
+		req.AddCookie(gt)
+
+		TestRouter.ServeHTTP(res, req)
+		assert.Equal(http.StatusOK, res.Code)
+
+		c = handler.GetCartResponse{}
+		assert.Nil(json.NewDecoder(res.Body).Decode(&c))
+		assert.Len(c.Items, 0)
+	})
+
+	t.Run("test expire guest cart", func(t *testing.T) {
+		res := httptest.NewRecorder()
+		req := httptest.NewRequest("POST", "/cart/items", strings.NewReader(
+			fmt.Sprintf(`{"pid":%d,"quantity":1}`, pid),
+		))
+
+		TestRouter.ServeHTTP(res, req)
+		assert.Equal(http.StatusOK, res.Code)
+
+		gt = guestCookie(res)
+
+		d, err := db.Get()
+		assert.Nil(err)
+		assert.Nil(d.DeleteExpiredGuestCarts(context.Background(), time.Now()))
+
+		res = httptest.NewRecorder()
+		req = httptest.NewRequest("GET", "/cart", nil)
+		req.AddCookie(gt)
+
+		TestRouter.ServeHTTP(res, req)
+
+		c := handler.GetCartResponse{}
+		assert.Nil(json.NewDecoder(res.Body).Decode(&c))
+		assert.Len(c.Items, 1)
+
+		assert.Nil(d.DeleteExpiredGuestCarts(context.Background(), time.Now().Add(8*24*time.Hour)))
+
+		res = httptest.NewRecorder()
+		req = httptest.NewRequest("GET", "/cart", nil)
+		req.AddCookie(gt)
+
+		TestRouter.ServeHTTP(res, req)
+
+		c = handler.GetCartResponse{}
+		assert.Nil(json.NewDecoder(res.Body).Decode(&c))
+		assert.Len(c.Items, 0)
+	})
+}
+
+func TestHandleCartCurrency(t *testing.T) {
+	assert := assert.New(t)
+
+	var at, mt *http.Cookie
+	var usd, eur, nib int64
+	var oid int64
+
+	// create creates the product of the body and returns the response code and its pid.
+	create := func(body string) (int, int64) {
+		res := httptest.NewRecorder()
+		req := httptest.NewRequest("POST", "/product", strings.NewReader(body))
+		req.AddCookie(mt)
+
+		TestRouter.ServeHTTP(res, req)
+
+		pd := handler.CreateProductResponse{}
+		if res.Code == http.StatusCreated {
+			assert.Nil(json.NewDecoder(res.Body).Decode(&pd))
+		}
+
+		return res.Code, pd.PID
+	}
+
+	// addItem adds the product to the cart and returns the response code.
+	addItem := func(pid int64) int {
+		res := httptest.NewRecorder()
+		req := httptest.NewRequest("POST", "/cart/items", strings.NewReader(
+			fmt.Sprintf(`{"pid":%d,"quantity":3}`, pid),
+		))
+		req.AddCookie(at)
+
+		TestRouter.ServeHTTP(res, req)
+
+		return res.Code
+	}
+
+	t.Run("test create user", func(t *testing.T) {
+		res := httptest.NewRecorder()
+		req := httptest.NewRequest("POST", "/user", strings.NewReader(
+			`{"user_id":"handlercurrency1","role":"user","password":"hcu1234++"}`,
+		))
+
+		TestRouter.ServeHTTP(res, req)
+		assert.Equal(http.StatusCreated, res.Code)
+
+		at = login(t, `{"user_id":"handlercurrency1","password":"hcu1234++"}`)
+		mt = login(t, `{"user_id":"master01","password":"pwmaster01++"}`)
+	})
+
+	t.Run("test create product; invalid price", func(t *testing.T) {
+		for _, price := range []string{`-100`, `{"amount":100,"currency":"XYZ"}`, `"1.00"`, `{"amount":-1,"currency":"EUR"}`} {
+			code, _ := create(fmt.Sprintf(`{"name":"currency pen","price":%s}`, price))
+			assert.Equal(http.StatusBadRequest, code, price)
+		}
+	})
+
+	t.Run("test create product", func(t *testing.T) {
+		var code int
+
+		code, usd = create(`{"name":"currency pen","price":1999}`)
+		assert.Equal(http.StatusCreated, code)
+
+		code, eur = create(`{"name":"currency ink","price":{"amount":1250,"currency":"EUR"}}`)
+		assert.Equal(http.StatusCreated, code)
+	})
+
+	t.Run("test get product", func(t *testing.T) {
+		res := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", fmt.Sprintf("/product/%d", eur), nil)
+
+		TestRouter.ServeHTTP(res, req)
+		assert.Equal(http.StatusOK, res.Code)
+		assert.Contains(res.Body.String(), `"price":{"amount":1250,"currency":"EUR","formatted":"€12.50"}`)
+	})
+
+	t.Run("test variant price; other currency", func(t *testing.T) {
+		res := httptest.NewRecorder()
+		req := httptest.NewRequest("PUT", fmt.Sprintf("/product/%d/options", eur), strings.NewReader(
+			`{"options":[{"name":"color","values":["blue","black"]}]}`,
+		))
+		req.AddCookie(mt)
+
+		TestRouter.ServeHTTP(res, req)
+		assert.Equal(http.StatusOK, res.Code)
+
+		res = httptest.NewRecorder()
+		req = httptest.NewRequest("POST", fmt.Sprintf("/product/%d/variant", eur), strings.NewReader(
+			`{"sku":"INK-BLUE","options":{"color":"blue"},"price":{"amount":1300,"currency":"USD"},"stock":5}`,
+		))
+		req.AddCookie(mt)
+
+		TestRouter.ServeHTTP(res, req)
+		assert.Equal(http.StatusBadRequest, res.Code)
+
+		res = httptest.NewRecorder()
+		req = httptest.NewRequest("POST", fmt.Sprintf("/product/%d/variant", eur), strings.NewReader(
+			`{"sku":"INK-BLUE","options":{"color":"blue"},"price":1300,"stock":5}`,
+		))
+		req.AddCookie(mt)
+
+		TestRouter.ServeHTTP(res, req)
+		assert.Equal(http.StatusCreated, res.Code)
+
+		// the currency of the variant price follows the product.
+		res = httptest.NewRecorder()
+		req = httptest.NewRequest("PUT", fmt.Sprintf("/product/%d", eur), strings.NewReader(
+			`{"name":"currency ink","price":{"amount":1400,"currency":"USD"}}`,
+		))
+		req.AddCookie(mt)
+
+		TestRouter.ServeHTTP(res, req)
+		assert.Equal(http.StatusConflict, res.Code)
+	})
+
+	t.Run("test create order; mixed currencies", func(t *testing.T) {
+		res := httptest.NewRecorder()
+		req := httptest.NewRequest("POST", "/order", strings.NewReader(
+			fmt.Sprintf(`{"products":[%d,%d]}`, usd, eur),
+		))
+		req.AddCookie(at)
+
+		TestRouter.ServeHTTP(res, req)
+		assert.Equal(http.StatusBadRequest, res.Code)
+	})
+
+	t.Run("test add cart item; mixed currencies", func(t *testing.T) {
+		assert.Equal(http.StatusOK, addItem(usd))
+
+		// the eur product is ordered by its variants, so it is added as another eur product.
+		var code int
+
+		code, nib = create(`{"name":"currency nib","price":{"amount":300,"currency":"EUR"}}`)
+		assert.Equal(http.StatusCreated, code)
+		assert.Equal(http.StatusConflict, addItem(nib))
+	})
+
+	t.Run("test checkout cart", func(t *testing.T) {
+		res := httptest.NewRecorder()
+		req := httptest.NewRequest("POST", "/cart/checkout", nil)
+		req.AddCookie(at)
+
+		TestRouter.ServeHTTP(res, req)
+		assert.Equal(http.StatusCreated, res.Code)
+
+		od := handler.CreateOrderResponse{}
+		assert.Nil(json.NewDecoder(res.Body).Decode(&od))
+
+		oid = od.OID
+	})
+
+	t.Run("test get order", func(t *testing.T) {
+		res := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", fmt.Sprintf("/order/%d", oid), nil)
+		req.AddCookie(at)
+
+		TestRouter.ServeHTTP(res, req)
+		assert.Equal(http.StatusOK, res.Code)
+
+		od := handler.GetOrderResponse{}
+		assert.Nil(json.NewDecoder(res.Body).Decode(&od))
+		assert.Equal(model.NewMoney(5997, "USD"), od.Total)
+		assert.Equal("$59.97", od.Total.String())
+	})
+
+	t.Run("test merge guest cart; other currency", func(t *testing.T) {
+		assert.Equal(http.StatusOK, addItem(usd))
+
+		res := httptest.NewRecorder()
+		req := httptest.NewRequest("POST", "/cart/items", strings.NewReader(
+			fmt.Sprintf(`{"pid":%d,"quantity":1}`, nib),
+		))
+
+		TestRouter.ServeHTTP(res, req)
+		assert.Equal(http.StatusOK, res.Code)
+
+		var gt *http.Cookie
+		for _, k := range res.Result().Cookies() {
+			if k.Name == token.GUEST_CART_TOKEN_NAME {
+				gt = k
+			}
+		}
+		assert.NotNil(gt)
+
+		res = httptest.NewRecorder()
+		req = httptest.NewRequest("POST", "/login", strings.NewReader(
+			`{"user_id":"handlercurrency1","password":"hcu1234++"}`,
+		))
+		req.AddCookie(gt)
+
+		TestRouter.ServeHTTP(res, req)
+		assert.Equal(http.StatusOK, res.Code)
+
+		res = httptest.NewRecorder()
+		req = httptest.NewRequest("GET", "/cart", nil)
+		req.AddCookie(at)
+
+		TestRouter.ServeHTTP(res, req)
+		assert.Equal(http.StatusOK, res.Code)
+
+		c := handler.GetCartResponse{}
+		assert.Nil(json.NewDecoder(res.Body).Decode(&c))
+		assert.Len(c.Items, 2)
+		assert.Equal(model.CartIssueCurrency, c.Items[1].Issue)
+		assert.Equal(model.NewMoney(5997, "USD"), c.Total)
+		assert.False(c.Valid)
+
+		res = httptest.NewRecorder()
+		req = httptest.NewRequest("POST", "/cart/refresh", nil)
+		req.AddCookie(at)
+
+		TestRouter.ServeHTTP(res, req)
+		assert.Equal(http.StatusOK, res.Code)
+
+		c = handler.GetCartResponse{}
+		assert.Nil(json.NewDecoder(res.Body).Decode(&c))
+		assert.Len(c.Items, 1)
+		assert.Equal(usd, c.Items[0].PID)
+		assert.True(c.Valid)
+	})
+}
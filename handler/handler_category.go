@@ -0,0 +1,448 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"simple-go-server/db"
+	"simple-go-server/model"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	defaultProductsPerPage = 20
+	maxProductsPerPage     = 100
+)
+
+// categoryTree returns the children of the parent in the categories,
+// which are ordered by position, and their descendants.
+func categoryTree(categories []model.Category, parent int64) []CategoryNode {
+	children := map[int64][]model.Category{}
+	for _, c := range categories {
+		children[c.Parent] = append(children[c.Parent], c)
+	}
+
+	var build func(parent int64) []CategoryNode
+	build = func(parent int64) []CategoryNode {
+		nodes := make([]CategoryNode, len(children[parent]))
+		for i, c := range children[parent] {
+			nodes[i] = CategoryNode{c, build(c.CID)}
+		}
+		return nodes
+	}
+
+	return build(parent)
+}
+
+// checkCategory checks the fields of the category
+// and whether its parent exists.
+func checkCategory(c *gin.Context, db *db.Database, category model.Category) bool {
+	if err := model.CategoryName(category.Name).IsValid(); err != nil {
+		writeMessage(c, http.StatusBadRequest, fmt.Sprintf("%v", err))
+		return false
+	}
+
+	if err := model.CategorySlug(category.Slug).IsValid(); err != nil {
+		writeMessage(c, http.StatusBadRequest, fmt.Sprintf("%v", err))
+		return false
+	}
+
+	if category.Parent == 0 {
+		return true
+	}
+
+	parent, err := db.SelectCategory(c.Request.Context(), category.Parent)
+	if err != nil {
+		writeMessage(c, http.StatusInternalServerError, fmt.Sprintf("%v", err))
+		return false
+	}
+
+	if parent == nil {
+		writeMessage(c, http.StatusNotFound, "parent category not found")
+		return false
+	}
+
+	return true
+}
+
+func handleCreateCategory(c *gin.Context) {
+	req := new(CreateCategoryRequest)
+
+	if err := json.NewDecoder(c.Request.Body).Decode(&req); err != nil {
+		writeMessage(c, http.StatusBadRequest, "invalid request format")
+		return
+	}
+
+	claims, keep := checkToken(c)
+	if !keep {
+		return
+	}
+
+	if claims.Role != model.RoleManager {
+		writeMessage(c, http.StatusUnauthorized, "general user cannot register category")
+		return
+	}
+
+	d, err := db.Get()
+	if err != nil {
+		writeMessage(c, http.StatusInternalServerError, "db failure")
+		return
+	}
+
+	category := model.Category{
+		Parent:   req.Parent,
+		Name:     req.Name,
+		Slug:     req.Slug,
+		Position: req.Position,
+	}
+
+	if !checkCategory(c, d, category) {
+		return
+	}
+
+	cid, err := d.InsertCategory(c.Request.Context(), category)
+	if err == db.ErrSlugTaken {
+		writeMessage(c, http.StatusConflict, "already used category slug")
+		return
+	}
+	if err != nil {
+		writeMessage(c, http.StatusInternalServerError, fmt.Sprintf("%v", err))
+		return
+	}
+
+	c.JSON(
+		http.StatusCreated,
+		CreateCategoryResponse{
+			cid,
+			"register category success",
+		},
+	)
+}
+
+// handleGetCategories responds with the whole category tree.
+func handleGetCategories(c *gin.Context) {
+	db, err := db.Get()
+	if err != nil {
+		writeMessage(c, http.StatusInternalServerError, "db failure")
+		return
+	}
+
+	categories, err := db.SelectCategories(c.Request.Context())
+	if err != nil {
+		writeMessage(c, http.StatusInternalServerError, fmt.Sprintf("%v", err))
+		return
+	}
+
+	c.JSON(
+		http.StatusOK,
+		GetCategoriesResponse{
+			categoryTree(categories, 0),
+		},
+	)
+}
+
+func handleGetCategory(c *gin.Context) {
+	cid, err := strconv.Atoi(c.Param("cid"))
+	if err != nil {
+		writeMessage(c, http.StatusBadRequest, "invalid category id format")
+		return
+	}
+
+	db, err := db.Get()
+	if err != nil {
+		writeMessage(c, http.StatusInternalServerError, "db failure")
+		return
+	}
+
+	category, err := db.SelectCategory(c.Request.Context(), int64(cid))
+	if err != nil {
+		writeMessage(c, http.StatusInternalServerError, fmt.Sprintf("%v", err))
+		return
+	}
+
+	if category == nil {
+		writeMessage(c, http.StatusNotFound, "category not found")
+		return
+	}
+
+	c.JSON(
+		http.StatusOK,
+		GetCategoryResponse{*category},
+	)
+}
+
+func handleUpdateCategory(c *gin.Context) {
+	cid, err := strconv.Atoi(c.Param("cid"))
+	if err != nil {
+		writeMessage(c, http.StatusBadRequest, "invalid category id format")
+		return
+	}
+
+	req := new(UpdateCategoryRequest)
+
+	if err := json.NewDecoder(c.Request.Body).Decode(&req); err != nil {
+		writeMessage(c, http.StatusBadRequest, "invalid request format")
+		return
+	}
+
+	claims, keep := checkToken(c)
+	if !keep {
+		return
+	}
+
+	if claims.Role != model.RoleManager {
+		writeMessage(c, http.StatusUnauthorized, "general user cannot update category")
+		return
+	}
+
+	d, err := db.Get()
+	if err != nil {
+		writeMessage(c, http.StatusInternalServerError, "db failure")
+		return
+	}
+
+	category, err := d.SelectCategory(c.Request.Context(), int64(cid))
+	if err != nil {
+		writeMessage(c, http.StatusInternalServerError, fmt.Sprintf("%v", err))
+		return
+	}
+
+	if category == nil {
+		writeMessage(c, http.StatusNotFound, "category not found")
+		return
+	}
+
+	category.Parent = req.Parent
+	category.Name = req.Name
+	category.Slug = req.Slug
+	category.Position = req.Position
+
+	if !checkCategory(c, d, *category) {
+		return
+	}
+
+	err = d.UpdateCategory(c.Request.Context(), *category)
+	if err == db.ErrCategoryCycle {
+		writeMessage(c, http.StatusBadRequest, "category cannot be under itself or its descendant")
+		return
+	}
+	if err == db.ErrSlugTaken {
+		writeMessage(c, http.StatusConflict, "already used category slug")
+		return
+	}
+	if err != nil {
+		writeMessage(c, http.StatusInternalServerError, fmt.Sprintf("%v", err))
+		return
+	}
+
+	writeMessage(c, http.StatusOK, "update category success")
+}
+
+// handleDeleteCategory deletes a category without children,
+// unassigning its products.
+func handleDeleteCategory(c *gin.Context) {
+	cid, err := strconv.Atoi(c.Param("cid"))
+	if err != nil {
+		writeMessage(c, http.StatusBadRequest, "invalid category id format")
+		return
+	}
+
+	claims, keep := checkToken(c)
+	if !keep {
+		return
+	}
+
+	if claims.Role != model.RoleManager {
+		writeMessage(c, http.StatusUnauthorized, "general user cannot delete category")
+		return
+	}
+
+	d, err := db.Get()
+	if err != nil {
+		writeMessage(c, http.StatusInternalServerError, "db failure")
+		return
+	}
+
+	category, err := d.SelectCategory(c.Request.Context(), int64(cid))
+	if err != nil {
+		writeMessage(c, http.StatusInternalServerError, fmt.Sprintf("%v", err))
+		return
+	}
+
+	if category == nil {
+		writeMessage(c, http.StatusNotFound, "category not found")
+		return
+	}
+
+	err = d.DeleteCategory(c.Request.Context(), category.CID)
+	if err == db.ErrCategoryHasChildren {
+		writeMessage(c, http.StatusConflict, "category has children, move or delete them first")
+		return
+	}
+	if err != nil {
+		writeMessage(c, http.StatusInternalServerError, fmt.Sprintf("%v", err))
+		return
+	}
+
+	writeMessage(c, http.StatusOK, "delete category success")
+}
+
+// handleGetCategoryProducts lists the products of the category
+// and all its descendants, with drafts only for managers.
+func handleGetCategoryProducts(c *gin.Context) {
+	cid, err := strconv.Atoi(c.Param("cid"))
+	if err != nil {
+		writeMessage(c, http.StatusBadRequest, "invalid category id format")
+		return
+	}
+
+	page, ok := queryInt(c, "page", 1)
+	if !ok {
+		writeMessage(c, http.StatusBadRequest, "invalid page")
+		return
+	}
+
+	perPage, ok := queryInt(c, "per_page", defaultProductsPerPage)
+	if !ok || perPage > maxProductsPerPage {
+		writeMessage(c, http.StatusBadRequest, "invalid per_page")
+		return
+	}
+
+	converter, keep := newPriceConverter(c)
+	if !keep {
+		return
+	}
+
+	claims, keep := optionalToken(c)
+	if !keep {
+		return
+	}
+
+	drafts := claims != nil && claims.Role == model.RoleManager
+
+	db, err := db.Get()
+	if err != nil {
+		writeMessage(c, http.StatusInternalServerError, "db failure")
+		return
+	}
+
+	category, err := db.SelectCategory(c.Request.Context(), int64(cid))
+	if err != nil {
+		writeMessage(c, http.StatusInternalServerError, fmt.Sprintf("%v", err))
+		return
+	}
+
+	if category == nil {
+		writeMessage(c, http.StatusNotFound, "category not found")
+		return
+	}
+
+	total, err := db.CountCategoryProducts(c.Request.Context(), category.CID, drafts)
+	if err != nil {
+		writeMessage(c, http.StatusInternalServerError, fmt.Sprintf("%v", err))
+		return
+	}
+
+	products, err := db.SelectCategoryProducts(c.Request.Context(), category.CID, drafts, perPage, (page-1)*perPage)
+	if err != nil {
+		writeMessage(c, http.StatusInternalServerError, fmt.Sprintf("%v", err))
+		return
+	}
+
+	prices := make([]*model.Money, len(products))
+	for i := range products {
+		prices[i] = &products[i].Price
+	}
+
+	if !converter.convert(c, db, prices...) {
+		return
+	}
+
+	c.JSON(
+		http.StatusOK,
+		GetCategoryProductsResponse{
+			products,
+			page,
+			perPage,
+			total,
+			converter.used(),
+		},
+	)
+}
+
+// handleSetProductCategories replaces the categories of the product.
+func handleSetProductCategories(c *gin.Context) {
+	pid, err := strconv.Atoi(c.Param("pid"))
+	if err != nil {
+		writeMessage(c, http.StatusBadRequest, "invalid product id format")
+		return
+	}
+
+	req := new(SetProductCategoriesRequest)
+
+	if err := json.NewDecoder(c.Request.Body).Decode(&req); err != nil {
+		writeMessage(c, http.StatusBadRequest, "invalid request format")
+		return
+	}
+
+	claims, keep := checkToken(c)
+	if !keep {
+		return
+	}
+
+	if claims.Role != model.RoleManager {
+		writeMessage(c, http.StatusUnauthorized, "general user cannot update product")
+		return
+	}
+
+	db, err := db.Get()
+	if err != nil {
+		writeMessage(c, http.StatusInternalServerError, "db failure")
+		return
+	}
+
+	product, err := db.SelectProduct(c.Request.Context(), int64(pid))
+	if err != nil {
+		writeMessage(c, http.StatusInternalServerError, fmt.Sprintf("%v", err))
+		return
+	}
+
+	if product == nil {
+		writeMessage(c, http.StatusNotFound, "product not found")
+		return
+	}
+
+	cids := []int64{}
+	seen := map[int64]struct{}{}
+
+	for _, cid := range req.Categories {
+		if _, found := seen[cid]; found {
+			writeMessage(c, http.StatusBadRequest, "duplicate category found in request")
+			return
+		}
+		seen[cid] = struct{}{}
+
+		category, err := db.SelectCategory(c.Request.Context(), cid)
+		if err != nil {
+			writeMessage(c, http.StatusInternalServerError, fmt.Sprintf("%v", err))
+			return
+		}
+
+		if category == nil {
+			writeMessage(c, http.StatusNotFound, "category not found")
+			return
+		}
+
+		cids = append(cids, cid)
+	}
+
+	if err := db.SetProductCategories(c.Request.Context(), product.PID, cids); err != nil {
+		writeMessage(c, http.StatusInternalServerError, fmt.Sprintf("%v", err))
+		return
+	}
+
+	writeMessage(c, http.StatusOK, "update product categories success")
+}
@@ -0,0 +1,248 @@
+package handler_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"simple-go-server/handler"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHandleCategory(t *testing.T) {
+	assert := assert.New(t)
+
+	var at, mt *http.Cookie
+	cids := map[string]int64{}
+	pids := []int64{}
+
+	// createCategory creates the category and returns the response code.
+	createCategory := func(name, slug string, parent int64) int {
+		res := httptest.NewRecorder()
+		req := httptest.NewRequest("POST", "/category", strings.NewReader(
+			fmt.Sprintf(`{"name":"%s","slug":"%s","parent":%d}`, name, slug, parent),
+		))
+		req.AddCookie(mt)
+
+		TestRouter.ServeHTTP(res, req)
+
+		if res.Code == http.StatusCreated {
+			ct := handler.CreateCategoryResponse{}
+			assert.Nil(json.NewDecoder(res.Body).Decode(&ct))
+			cids[slug] = ct.CID
+		}
+
+		return res.Code
+	}
+
+	// categoryProducts returns the products listed in the category.
+	categoryProducts := func(cid int64) handler.GetCategoryProductsResponse {
+		res := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", fmt.Sprintf("/categories/%d/products", cid), nil)
+
+		TestRouter.ServeHTTP(res, req)
+		assert.Equal(http.StatusOK, res.Code)
+
+		list := handler.GetCategoryProductsResponse{}
+		assert.Nil(json.NewDecoder(res.Body).Decode(&list))
+
+		return list
+	}
+
+	t.Run("test create user", func(t *testing.T) {
+		res := httptest.NewRecorder()
+		req := httptest.NewRequest("POST", "/user", strings.NewReader(
+			`{"user_id":"handlercategory1","role":"user","password":"hcg1234++"}`,
+		))
+
+		TestRouter.ServeHTTP(res, req)
+		assert.Equal(http.StatusCreated, res.Code)
+
+		at = login(t, `{"user_id":"handlercategory1","password":"hcg1234++"}`)
+		mt = login(t, `{"user_id":"master01","password":"pwmaster01++"}`)
+	})
+
+	t.Run("test create category; not manager", func(t *testing.T) {
+		res := httptest.NewRecorder()
+		req := httptest.NewRequest("POST", "/category", strings.NewReader(
+			`{"name":"Clothing","slug":"clothing"}`,
+		))
+		req.AddCookie(at)
+
+		TestRouter.ServeHTTP(res, req)
+		assert.Equal(http.StatusUnauthorized, res.Code)
+	})
+
+	t.Run("test create category", func(t *testing.T) {
+		assert.Equal(http.StatusCreated, createCategory("Clothing", "cat-clothing", 0))
+		assert.Equal(http.StatusCreated, createCategory("Shirts", "cat-shirts", cids["cat-clothing"]))
+		assert.Equal(http.StatusCreated, createCategory("T-Shirts & Tops", "cat-t-shirts", cids["cat-shirts"]))
+	})
+
+	t.Run("test create category; invalid", func(t *testing.T) {
+		assert.Equal(http.StatusBadRequest, createCategory("Shoes", "Cat Shoes", 0))
+		assert.Equal(http.StatusBadRequest, createCategory("", "cat-shoes", 0))
+		assert.Equal(http.StatusNotFound, createCategory("Shoes", "cat-shoes", 100000))
+		assert.Equal(http.StatusConflict, createCategory("Shirts", "cat-shirts", 0))
+	})
+
+	t.Run("test get categories", func(t *testing.T) {
+		res := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", "/categories", nil)
+
+		TestRouter.ServeHTTP(res, req)
+		assert.Equal(http.StatusOK, res.Code)
+
+		tree := handler.GetCategoriesResponse{}
+		assert.Nil(json.NewDecoder(res.Body).Decode(&tree))
+
+		var clothing *handler.CategoryNode
+		for i := range tree.Categories {
+			if tree.Categories[i].CID == cids["cat-clothing"] {
+				clothing = &tree.Categories[i]
+			}
+		}
+
+		assert.NotNil(clothing)
+		assert.Len(clothing.Children, 1)
+		assert.Equal("cat-shirts", clothing.Children[0].Slug)
+		assert.Len(clothing.Children[0].Children, 1)
+		assert.Equal("cat-t-shirts", clothing.Children[0].Children[0].Slug)
+	})
+
+	t.Run("test set product categories", func(t *testing.T) {
+		for _, name := range []string{"category shirt", "category coat", "category tee"} {
+			res := httptest.NewRecorder()
+			req := httptest.NewRequest("POST", "/product", strings.NewReader(
+				fmt.Sprintf(`{"name":"%s","price":1000}`, name),
+			))
+			req.AddCookie(mt)
+
+			TestRouter.ServeHTTP(res, req)
+			assert.Equal(http.StatusCreated, res.Code)
+
+			pd := handler.CreateProductResponse{}
+			assert.Nil(json.NewDecoder(res.Body).Decode(&pd))
+
+			pids = append(pids, pd.PID)
+		}
+
+		for i, categories := range []string{
+			fmt.Sprintf("[%d]", cids["cat-shirts"]),
+			fmt.Sprintf("[%d]", cids["cat-clothing"]),
+			fmt.Sprintf("[%d,%d]", cids["cat-shirts"], cids["cat-t-shirts"]),
+		} {
+			res := httptest.NewRecorder()
+			req := httptest.NewRequest("PUT", fmt.Sprintf("/product/%d/categories", pids[i]), strings.NewReader(
+				fmt.Sprintf(`{"categories":%s}`, categories),
+			))
+			req.AddCookie(mt)
+
+			TestRouter.ServeHTTP(res, req)
+			assert.Equal(http.StatusOK, res.Code)
+		}
+
+		res := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", fmt.Sprintf("/product/%d", pids[2]), nil)
+
+		TestRouter.ServeHTTP(res, req)
+		assert.Equal(http.StatusOK, res.Code)
+
+		pd := handler.GetProductResponse{}
+		assert.Nil(json.NewDecoder(res.Body).Decode(&pd))
+		assert.Equal([]int64{cids["cat-shirts"], cids["cat-t-shirts"]}, pd.Categories)
+	})
+
+	t.Run("test set product categories; unknown category", func(t *testing.T) {
+		res := httptest.NewRecorder()
+		req := httptest.NewRequest("PUT", fmt.Sprintf("/product/%d/categories", pids[0]), strings.NewReader(
+			`{"categories":[100000]}`,
+		))
+		req.AddCookie(mt)
+
+		TestRouter.ServeHTTP(res, req)
+		assert.Equal(http.StatusNotFound, res.Code)
+	})
+
+	t.Run("test get category products", func(t *testing.T) {
+		list := categoryProducts(cids["cat-clothing"])
+		assert.Equal(int64(3), list.Total)
+		assert.Len(list.Products, 3)
+
+		list = categoryProducts(cids["cat-shirts"])
+		assert.Equal(int64(2), list.Total)
+		assert.Equal(pids[0], list.Products[0].PID)
+		assert.Equal(pids[2], list.Products[1].PID)
+
+		res := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", fmt.Sprintf("/categories/%d/products?per_page=1&page=2", cids["cat-clothing"]), nil)
+
+		TestRouter.ServeHTTP(res, req)
+		assert.Equal(http.StatusOK, res.Code)
+
+		list = handler.GetCategoryProductsResponse{}
+		assert.Nil(json.NewDecoder(res.Body).Decode(&list))
+		assert.Len(list.Products, 1)
+		assert.Equal(pids[1], list.Products[0].PID)
+	})
+
+	t.Run("test update category; cycle", func(t *testing.T) {
+		res := httptest.NewRecorder()
+		req := httptest.NewRequest("PUT", fmt.Sprintf("/category/%d", cids["cat-clothing"]), strings.NewReader(
+			fmt.Sprintf(`{"name":"Clothing","slug":"cat-clothing","parent":%d}`, cids["cat-t-shirts"]),
+		))
+		req.AddCookie(mt)
+
+		TestRouter.ServeHTTP(res, req)
+		assert.Equal(http.StatusBadRequest, res.Code)
+	})
+
+	t.Run("test delete category; has children", func(t *testing.T) {
+		res := httptest.NewRecorder()
+		req := httptest.NewRequest("DELETE", fmt.Sprintf("/category/%d", cids["cat-shirts"]), nil)
+		req.AddCookie(mt)
+
+		TestRouter.ServeHTTP(res, req)
+		assert.Equal(http.StatusConflict, res.Code)
+	})
+
+	t.Run("test update category; move", func(t *testing.T) {
+		res := httptest.NewRecorder()
+		req := httptest.NewRequest("PUT", fmt.Sprintf("/category/%d", cids["cat-t-shirts"]), strings.NewReader(
+			fmt.Sprintf(`{"name":"T-Shirts","slug":"cat-t-shirts","parent":%d,"position":1}`, cids["cat-clothing"]),
+		))
+		req.AddCookie(mt)
+
+		TestRouter.ServeHTTP(res, req)
+		assert.Equal(http.StatusOK, res.Code)
+
+		list := categoryProducts(cids["cat-shirts"])
+		assert.Equal(int64(2), list.Total)
+	})
+
+	t.Run("test delete category", func(t *testing.T) {
+		res := httptest.NewRecorder()
+		req := httptest.NewRequest("DELETE", fmt.Sprintf("/category/%d", cids["cat-shirts"]), nil)
+		req.AddCookie(mt)
+
+		TestRouter.ServeHTTP(res, req)
+		assert.Equal(http.StatusOK, res.Code)
+
+		res = httptest.NewRecorder()
+		req = httptest.NewRequest("GET", fmt.Sprintf("/product/%d", pids[0]), nil)
+
+		TestRouter.ServeHTTP(res, req)
+		assert.Equal(http.StatusOK, res.Code)
+
+		pd := handler.GetProductResponse{}
+		assert.Nil(json.NewDecoder(res.Body).Decode(&pd))
+		assert.Len(pd.Categories, 0)
+
+		list := categoryProducts(cids["cat-clothing"])
+		assert.Equal(int64(2), list.Total)
+	})
+}
@@ -0,0 +1,197 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"simple-go-server/db"
+	"simple-go-server/model"
+
+	"github.com/gin-gonic/gin"
+)
+
+// handleCreateCoupon creates a coupon, priced in the currency of its amount or minimum order,
+// or in the default currency if both are bare numbers.
+func handleCreateCoupon(c *gin.Context) {
+	req := new(CreateCouponRequest)
+
+	if err := json.NewDecoder(c.Request.Body).Decode(&req); err != nil {
+		writeMessage(c, http.StatusBadRequest, "invalid request format")
+		return
+	}
+
+	currency := req.Amount.Currency
+	if currency == "" {
+		currency = req.MinOrder.Currency
+	}
+	if currency == "" {
+		currency = model.DefaultCurrency
+	}
+
+	coupon := model.Coupon{
+		Code:           string(model.CouponCode(req.Code).Normalized()),
+		Kind:           req.Kind,
+		Percent:        req.Percent,
+		Amount:         req.Amount.WithDefaultCurrency(currency),
+		MinOrder:       req.MinOrder.WithDefaultCurrency(currency),
+		Products:       req.Products,
+		Categories:     req.Categories,
+		MaxUses:        req.MaxUses,
+		MaxUsesPerUser: req.MaxUsesPerUser,
+		Starts:         req.Starts,
+		Ends:           req.Ends,
+	}
+
+	if err := coupon.IsValid(); err != nil {
+		writeMessage(c, http.StatusBadRequest, fmt.Sprintf("%v", err))
+		return
+	}
+
+	claims, keep := checkToken(c)
+	if !keep {
+		return
+	}
+
+	if claims.Role != model.RoleManager {
+		writeMessage(c, http.StatusUnauthorized, "general user cannot create coupon")
+		return
+	}
+
+	d, err := db.Get()
+	if err != nil {
+		writeMessage(c, http.StatusInternalServerError, "db failure")
+		return
+	}
+
+	for _, pid := range coupon.Products {
+		product, err := d.SelectProduct(c.Request.Context(), pid)
+		if err != nil {
+			writeMessage(c, http.StatusInternalServerError, fmt.Sprintf("%v", err))
+			return
+		}
+
+		if product == nil {
+			writeMessage(c, http.StatusNotFound, "product not found")
+			return
+		}
+	}
+
+	for _, cid := range coupon.Categories {
+		category, err := d.SelectCategory(c.Request.Context(), cid)
+		if err != nil {
+			writeMessage(c, http.StatusInternalServerError, fmt.Sprintf("%v", err))
+			return
+		}
+
+		if category == nil {
+			writeMessage(c, http.StatusNotFound, "category not found")
+			return
+		}
+	}
+
+	err = d.InsertCoupon(c.Request.Context(), coupon)
+	if err == db.ErrCouponTaken {
+		writeMessage(c, http.StatusConflict, "coupon code already used")
+		return
+	}
+	if err != nil {
+		writeMessage(c, http.StatusInternalServerError, fmt.Sprintf("%v", err))
+		return
+	}
+
+	c.JSON(
+		http.StatusCreated,
+		CreateCouponResponse{
+			coupon.Code,
+			"create coupon success",
+		},
+	)
+}
+
+// handleGetCoupons lists the coupons with their redemption counts to managers.
+func handleGetCoupons(c *gin.Context) {
+	claims, keep := checkToken(c)
+	if !keep {
+		return
+	}
+
+	if claims.Role != model.RoleManager {
+		writeMessage(c, http.StatusUnauthorized, "only manager can check coupons")
+		return
+	}
+
+	db, err := db.Get()
+	if err != nil {
+		writeMessage(c, http.StatusInternalServerError, "db failure")
+		return
+	}
+
+	coupons, err := db.SelectCoupons(c.Request.Context())
+	if err != nil {
+		writeMessage(c, http.StatusInternalServerError, fmt.Sprintf("%v", err))
+		return
+	}
+
+	c.JSON(
+		http.StatusOK,
+		GetCouponsResponse{
+			coupons,
+		},
+	)
+}
+
+// handleDeleteCoupon deletes a coupon, so that it cannot be redeemed any more.
+// Orders keep the discounts of the coupon.
+func handleDeleteCoupon(c *gin.Context) {
+	code := string(model.CouponCode(c.Param("code")).Normalized())
+
+	claims, keep := checkToken(c)
+	if !keep {
+		return
+	}
+
+	if claims.Role != model.RoleManager {
+		writeMessage(c, http.StatusUnauthorized, "general user cannot delete coupon")
+		return
+	}
+
+	db, err := db.Get()
+	if err != nil {
+		writeMessage(c, http.StatusInternalServerError, "db failure")
+		return
+	}
+
+	coupon, err := db.SelectCoupon(c.Request.Context(), code)
+	if err != nil {
+		writeMessage(c, http.StatusInternalServerError, fmt.Sprintf("%v", err))
+		return
+	}
+
+	if coupon == nil {
+		writeMessage(c, http.StatusNotFound, "coupon not found")
+		return
+	}
+
+	if err := db.DeleteCoupon(c.Request.Context(), coupon.Code); err != nil {
+		writeMessage(c, http.StatusInternalServerError, fmt.Sprintf("%v", err))
+		return
+	}
+
+	writeMessage(c, http.StatusOK, "delete coupon success")
+}
+
+// writeCouponError responds why the coupon cannot be redeemed, and returns false
+// if the error is not of redeeming a coupon.
+func writeCouponError(c *gin.Context, err error) bool {
+	switch err {
+	case db.ErrCouponNotFound:
+		writeMessage(c, http.StatusNotFound, "coupon not found")
+	case db.ErrCouponExhausted, db.ErrCouponUserLimit:
+		writeMessage(c, http.StatusConflict, fmt.Sprintf("%v", err))
+	case model.ErrCouponInactive, model.ErrCouponCurrency, model.ErrCouponMinOrder, model.ErrCouponNotEligible:
+		writeMessage(c, http.StatusBadRequest, fmt.Sprintf("%v", err))
+	default:
+		return false
+	}
+	return true
+}
@@ -0,0 +1,279 @@
+package handler_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"simple-go-server/handler"
+	"simple-go-server/model"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHandleCoupon(t *testing.T) {
+	assert := assert.New(t)
+
+	var at, mt *http.Cookie
+	var cid int64
+	var oid int64
+	pids := []int64{}
+
+	// send sends the request with the cookie and returns the response.
+	send := func(k *http.Cookie, method, url, body string) *httptest.ResponseRecorder {
+		res := httptest.NewRecorder()
+		req := httptest.NewRequest(method, url, strings.NewReader(body))
+		req.AddCookie(k)
+
+		TestRouter.ServeHTTP(res, req)
+
+		return res
+	}
+
+	// createOrder orders the products without a cart with the coupon,
+	// and returns the response code and the oid.
+	createOrder := func(coupon string, pids ...int64) (int, int64) {
+		products, _ := json.Marshal(pids)
+
+		res := send(at, "POST", "/order", fmt.Sprintf(`{"products":%s,"coupon":"%s"}`, products, coupon))
+
+		od := handler.CreateOrderResponse{}
+		if res.Code == http.StatusCreated {
+			assert.Nil(json.NewDecoder(res.Body).Decode(&od))
+		}
+
+		return res.Code, od.OID
+	}
+
+	getOrder := func(oid int64) handler.GetOrderResponse {
+		res := send(at, "GET", fmt.Sprintf("/order/%d", oid), "")
+		assert.Equal(http.StatusOK, res.Code)
+
+		od := handler.GetOrderResponse{}
+		assert.Nil(json.NewDecoder(res.Body).Decode(&od))
+
+		return od
+	}
+
+	t.Run("test create user", func(t *testing.T) {
+		res := httptest.NewRecorder()
+		req := httptest.NewRequest("POST", "/user", strings.NewReader(
+			`{"user_id":"handlercoupon1","role":"user","password":"hcp1234++"}`,
+		))
+
+		TestRouter.ServeHTTP(res, req)
+		assert.Equal(http.StatusCreated, res.Code)
+
+		at = login(t, `{"user_id":"handlercoupon1","password":"hcp1234++"}`)
+		mt = login(t, `{"user_id":"master01","password":"pwmaster01++"}`)
+
+		for _, body := range []string{
+			`{"name":"coupon mug","price":1000}`,
+			`{"name":"coupon kettle","price":2000}`,
+		} {
+			res := send(mt, "POST", "/product", body)
+			assert.Equal(http.StatusCreated, res.Code)
+
+			pd := handler.CreateProductResponse{}
+			assert.Nil(json.NewDecoder(res.Body).Decode(&pd))
+
+			pids = append(pids, pd.PID)
+		}
+
+		res = send(mt, "POST", "/category", `{"name":"coupon kitchen","slug":"coupon-kitchen"}`)
+		assert.Equal(http.StatusCreated, res.Code)
+
+		ct := handler.CreateCategoryResponse{}
+		assert.Nil(json.NewDecoder(res.Body).Decode(&ct))
+
+		cid = ct.CID
+
+		res = send(mt, "PUT", fmt.Sprintf("/product/%d/categories", pids[1]), fmt.Sprintf(`{"categories":[%d]}`, cid))
+		assert.Equal(http.StatusOK, res.Code)
+	})
+
+	t.Run("test create coupon; not manager", func(t *testing.T) {
+		res := send(at, "POST", "/coupon", `{"code":"SAVE10","kind":"percent","percent":10}`)
+		assert.Equal(http.StatusUnauthorized, res.Code)
+	})
+
+	t.Run("test create coupon; invalid", func(t *testing.T) {
+		for _, body := range []string{
+			`{"code":"S","kind":"percent","percent":10}`,
+			`{"code":"SAVE10","kind":"percent","percent":0}`,
+			`{"code":"SAVE10","kind":"fixed","amount":0}`,
+			`{"code":"SAVE10","kind":"fixed","amount":{"amount":500,"currency":"USD"},"min_order":{"amount":500,"currency":"EUR"}}`,
+			`{"code":"SAVE10","kind":"percent","percent":10,"starts":200,"ends":100}`,
+		} {
+			res := send(mt, "POST", "/coupon", body)
+			assert.Equal(http.StatusBadRequest, res.Code, body)
+		}
+
+		res := send(mt, "POST", "/coupon", `{"code":"SAVE10","kind":"percent","percent":10,"products":[987654]}`)
+		assert.Equal(http.StatusNotFound, res.Code)
+	})
+
+	t.Run("test create coupon", func(t *testing.T) {
+		for _, body := range []string{
+			`{"code":"save10","kind":"percent","percent":10}`,
+			fmt.Sprintf(`{"code":"KITCHEN5","kind":"fixed","amount":500,"categories":[%d]}`, cid),
+			`{"code":"ONCE","kind":"fixed","amount":100,"max_uses_per_user":1}`,
+			`{"code":"BIGSPEND","kind":"percent","percent":50,"min_order":10000}`,
+			`{"code":"LIMITED","kind":"fixed","amount":100,"max_uses":3}`,
+			`{"code":"EXPIRED","kind":"percent","percent":10,"starts":100,"ends":200}`,
+		} {
+			res := send(mt, "POST", "/coupon", body)
+			assert.Equal(http.StatusCreated, res.Code, body)
+		}
+
+		res := send(mt, "POST", "/coupon", `{"code":"SAVE10","kind":"percent","percent":20}`)
+		assert.Equal(http.StatusConflict, res.Code)
+	})
+
+	t.Run("test create order; coupon", func(t *testing.T) {
+		var code int
+
+		code, oid = createOrder(" save10 ", pids...)
+		assert.Equal(http.StatusCreated, code)
+
+		od := getOrder(oid)
+		assert.Equal(model.NewMoney(3000, "USD"), od.Subtotal)
+		assert.Equal(model.NewMoney(300, "USD"), od.Discount)
+		assert.Equal(model.NewMoney(2700, "USD"), od.Total)
+		assert.Len(od.Discounts, 2)
+		assert.Equal("10% off with SAVE10", od.Discounts[0].Description)
+
+		// an order without a coupon has no discounts.
+		code, noCoupon := createOrder("", pids[0])
+		assert.Equal(http.StatusCreated, code)
+
+		od = getOrder(noCoupon)
+		assert.Empty(od.Discounts)
+		assert.Equal(model.NewMoney(1000, "USD"), od.Total)
+	})
+
+	t.Run("test create order; coupon not applicable", func(t *testing.T) {
+		for _, c := range []struct {
+			coupon string
+			pids   []int64
+			want   int
+		}{
+			{"NOSUCHCODE", pids, http.StatusNotFound},
+			{"EXPIRED", pids, http.StatusBadRequest},
+			{"BIGSPEND", pids, http.StatusBadRequest},
+			{"KITCHEN5", pids[:1], http.StatusBadRequest},
+		} {
+			code, _ := createOrder(c.coupon, c.pids...)
+			assert.Equal(c.want, code, c.coupon)
+		}
+	})
+
+	t.Run("test update order; discounted", func(t *testing.T) {
+		res := send(at, "PUT", fmt.Sprintf("/order/%d", oid), fmt.Sprintf(`{"products":[%d]}`, pids[0]))
+		assert.Equal(http.StatusConflict, res.Code)
+	})
+
+	t.Run("test checkout cart; coupon", func(t *testing.T) {
+		for _, pid := range pids {
+			res := send(at, "POST", "/cart/items", fmt.Sprintf(`{"pid":%d,"quantity":1}`, pid))
+			assert.Equal(http.StatusOK, res.Code)
+		}
+
+		res := send(at, "POST", "/cart/checkout", `{"coupon":"BIGSPEND"}`)
+		assert.Equal(http.StatusBadRequest, res.Code)
+
+		// the cart is kept when the coupon does not apply.
+		res = send(at, "POST", "/cart/checkout", `{"coupon":"KITCHEN5"}`)
+		assert.Equal(http.StatusCreated, res.Code)
+
+		cd := handler.CreateOrderResponse{}
+		assert.Nil(json.NewDecoder(res.Body).Decode(&cd))
+
+		od := getOrder(cd.OID)
+		assert.Len(od.Discounts, 1)
+		assert.Equal(pids[1], od.Discounts[0].PID)
+		assert.Equal(model.NewMoney(500, "USD"), od.Discount)
+		assert.Equal(model.NewMoney(2500, "USD"), od.Total)
+	})
+
+	t.Run("test create order; user limit", func(t *testing.T) {
+		code, _ := createOrder("ONCE", pids[0])
+		assert.Equal(http.StatusCreated, code)
+
+		code, _ = createOrder("ONCE", pids[0])
+		assert.Equal(http.StatusConflict, code)
+	})
+
+	t.Run("test create order; concurrent redemption", func(t *testing.T) {
+		codes := make([]int, 10)
+		oids := make([]int64, 10)
+
+		var wg sync.WaitGroup
+		for i := range codes {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				codes[i], oids[i] = createOrder("LIMITED", pids[0])
+			}(i)
+		}
+		wg.Wait()
+
+		created := []int64{}
+		for i, code := range codes {
+			if code == http.StatusCreated {
+				created = append(created, oids[i])
+				continue
+			}
+			assert.Equal(http.StatusConflict, code)
+		}
+		assert.Len(created, 3)
+
+		// a deleted order gives its redemption back.
+		res := send(at, "DELETE", fmt.Sprintf("/order/%d", created[0]), "")
+		assert.Equal(http.StatusOK, res.Code)
+
+		code, _ := createOrder("LIMITED", pids[0])
+		assert.Equal(http.StatusCreated, code)
+	})
+
+	t.Run("test get coupons", func(t *testing.T) {
+		res := send(at, "GET", "/coupons", "")
+		assert.Equal(http.StatusUnauthorized, res.Code)
+
+		res = send(mt, "GET", "/coupons", "")
+		assert.Equal(http.StatusOK, res.Code)
+
+		cd := handler.GetCouponsResponse{}
+		assert.Nil(json.NewDecoder(res.Body).Decode(&cd))
+
+		uses := map[string]int64{}
+		for _, c := range cd.Coupons {
+			uses[c.Code] = c.Uses
+		}
+		assert.Equal(int64(1), uses["SAVE10"])
+		assert.Equal(int64(3), uses["LIMITED"])
+		assert.Equal(int64(0), uses["EXPIRED"])
+	})
+
+	t.Run("test delete coupon", func(t *testing.T) {
+		res := send(at, "DELETE", "/coupon/SAVE10", "")
+		assert.Equal(http.StatusUnauthorized, res.Code)
+
+		res = send(mt, "DELETE", "/coupon/save10", "")
+		assert.Equal(http.StatusOK, res.Code)
+
+		res = send(mt, "DELETE", "/coupon/SAVE10", "")
+		assert.Equal(http.StatusNotFound, res.Code)
+
+		// the order keeps the discounts of the deleted coupon.
+		od := getOrder(oid)
+		assert.Equal(model.NewMoney(2700, "USD"), od.Total)
+
+		code, _ := createOrder("SAVE10", pids...)
+		assert.Equal(http.StatusNotFound, code)
+	})
+}
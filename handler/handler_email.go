@@ -0,0 +1,223 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+
+	"simple-go-server/db"
+	"simple-go-server/mail"
+	"simple-go-server/model"
+	"simple-go-server/token"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pkg/errors"
+)
+
+const (
+	defaultEmailTokenTTL        = 24 * time.Hour
+	defaultEmailVerificationURL = "http://localhost:8080/email/verify"
+)
+
+// emailTokenTTL returns the lifetime of email verification links set by EMAIL_TOKEN_TTL.
+func emailTokenTTL() time.Duration {
+	d, err := time.ParseDuration(os.Getenv("EMAIL_TOKEN_TTL"))
+	if err != nil || d <= 0 {
+		return defaultEmailTokenTTL
+	}
+	return d
+}
+
+// emailVerificationURL returns the url of verification links set by EMAIL_VERIFICATION_URL,
+// to which the token is added as the token query parameter.
+func emailVerificationURL() string {
+	if v := os.Getenv("EMAIL_VERIFICATION_URL"); v != "" {
+		return v
+	}
+	return defaultEmailVerificationURL
+}
+
+// sendEmailVerification mails the link verifying that
+// the user of uid receives mails at the email.
+func sendEmailVerification(ctx context.Context, uid int64, email string) error {
+	ttl := emailTokenTTL()
+
+	t, err := token.CreateEmailVerificationToken(uid, email, ttl)
+	if err != nil {
+		return errors.Wrap(err, "email token failure")
+	}
+
+	link, err := url.Parse(emailVerificationURL())
+	if err != nil {
+		return errors.Wrap(err, "invalid email verification url")
+	}
+
+	q := link.Query()
+	q.Set("token", t)
+	link.RawQuery = q.Encode()
+
+	err = mail.Default().Send(ctx, mail.Mail{
+		To:      email,
+		Subject: "Email verification",
+		Body: fmt.Sprintf(
+			"Open the link below to verify your email until %s.\n%s\n",
+			time.Now().Add(ttl).UTC().Format(time.RFC1123),
+			link.String(),
+		),
+	})
+	if err != nil {
+		return errors.Errorf("mail failure")
+	}
+
+	return nil
+}
+
+func handleUpdateProfile(c *gin.Context) {
+	userID := c.Param("user_id")
+
+	req := new(UpdateProfileRequest)
+	if err := json.NewDecoder(c.Request.Body).Decode(&req); err != nil {
+		writeMessage(c, http.StatusBadRequest, "invalid request format")
+		return
+	}
+
+	claims, keep := checkToken(c)
+	if !keep {
+		return
+	}
+
+	if claims.UserID != userID {
+		writeMessage(c, http.StatusUnauthorized, "invalid access token for this user")
+		return
+	}
+
+	profile := req.Profile.Normalized()
+	if err := profile.IsValid(); err != nil {
+		writeViolations(c, "invalid profile format", err)
+		return
+	}
+
+	d, err := db.Get()
+	if err != nil {
+		writeMessage(c, http.StatusInternalServerError, "db failure")
+		return
+	}
+
+	user, err := d.SelectUserByUID(c.Request.Context(), claims.UID)
+	if err != nil {
+		writeMessage(c, http.StatusInternalServerError, fmt.Sprintf("%v", err))
+		return
+	}
+
+	if user == nil {
+		writeMessage(c, http.StatusNotFound, "user not found")
+		return
+	}
+
+	err = d.UpdateUserProfile(c.Request.Context(), user.UID, profile)
+	if err == db.ErrEmailTaken {
+		writeMessage(c, http.StatusConflict, "already registered email")
+		return
+	}
+	if err != nil {
+		writeMessage(c, http.StatusInternalServerError, fmt.Sprintf("%v", err))
+		return
+	}
+
+	// the user can ask for another verification mail if this one fails.
+	if profile.Email != "" && profile.Email != user.Email {
+		if err := sendEmailVerification(c.Request.Context(), user.UID, profile.Email); err != nil {
+			requestLogger(c).Warn("email verification failure", "error", err)
+		}
+	}
+
+	writeMessage(c, http.StatusOK, "profile update success")
+}
+
+// handleSendEmailVerification mails another verification link
+// to the unverified email of the user.
+func handleSendEmailVerification(c *gin.Context) {
+	userID := c.Param("user_id")
+
+	claims, keep := checkToken(c)
+	if !keep {
+		return
+	}
+
+	if claims.UserID != userID {
+		writeMessage(c, http.StatusUnauthorized, "invalid access token for this user")
+		return
+	}
+
+	db, err := db.Get()
+	if err != nil {
+		writeMessage(c, http.StatusInternalServerError, "db failure")
+		return
+	}
+
+	user, err := db.SelectUserByUID(c.Request.Context(), claims.UID)
+	if err != nil {
+		writeMessage(c, http.StatusInternalServerError, fmt.Sprintf("%v", err))
+		return
+	}
+
+	if user == nil {
+		writeMessage(c, http.StatusNotFound, "user not found")
+		return
+	}
+
+	if user.Email == "" {
+		writeMessage(c, http.StatusBadRequest, "no email registered")
+		return
+	}
+
+	if user.EmailVerified {
+		writeMessage(c, http.StatusConflict, "already verified email")
+		return
+	}
+
+	if err := sendEmailVerification(c.Request.Context(), user.UID, user.Email); err != nil {
+		writeMessage(c, http.StatusInternalServerError, fmt.Sprintf("%v", err))
+		return
+	}
+
+	writeMessage(c, http.StatusAccepted, "email verification sent")
+}
+
+// handleVerifyEmail verifies the email with the token
+// of the link sent to it.
+func handleVerifyEmail(c *gin.Context) {
+	claims, err := token.GetEmailVerificationToken(c.Query("token"))
+	if err != nil {
+		writeMessage(c, http.StatusBadRequest, "invalid or expired email token")
+		return
+	}
+
+	d, err := db.Get()
+	if err != nil {
+		writeMessage(c, http.StatusInternalServerError, "db failure")
+		return
+	}
+
+	// a link sent to a previous email of the user verifies nothing.
+	verified, err := d.VerifyUserEmail(c.Request.Context(), claims.UID, model.NormalizeEmail(claims.Email))
+	if err == db.ErrEmailTaken {
+		writeMessage(c, http.StatusConflict, "already registered email")
+		return
+	}
+	if err != nil {
+		writeMessage(c, http.StatusInternalServerError, fmt.Sprintf("%v", err))
+		return
+	}
+
+	if !verified {
+		writeMessage(c, http.StatusBadRequest, "invalid or expired email token")
+		return
+	}
+
+	writeMessage(c, http.StatusOK, "email verification success")
+}
@@ -0,0 +1,234 @@
+package handler_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+
+	"simple-go-server/handler"
+	"simple-go-server/mail"
+	"simple-go-server/token"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var emailLinkRegex = regexp.MustCompile(`(http\S+)`)
+
+// emailLink returns the path and query of the last verification link mailed to the address.
+func emailLink(sender *mail.MemorySender, to string) string {
+	mails := sender.Mails(to)
+	if len(mails) == 0 {
+		return ""
+	}
+
+	m := emailLinkRegex.FindStringSubmatch(mails[len(mails)-1].Body)
+	if len(m) != 2 {
+		return ""
+	}
+
+	return strings.TrimPrefix(m[1], "http://localhost:8080")
+}
+
+func TestHandleEmailVerification(t *testing.T) {
+	assert := assert.New(t)
+
+	sender := mail.NewMemorySender()
+
+	old := mail.Default()
+	mail.SetDefault(sender)
+	defer mail.SetDefault(old)
+
+	var at *http.Cookie
+
+	t.Run("test create user; invalid profile", func(t *testing.T) {
+		res := httptest.NewRecorder()
+		req := httptest.NewRequest("POST", "/user", strings.NewReader(
+			`{"user_id":"emailver1","role":"user","password":"ev1234++","email":"not an email","phone":"010"}`,
+		))
+
+		TestRouter.ServeHTTP(res, req)
+		assert.Equal(http.StatusBadRequest, res.Code)
+		assert.Contains(res.Body.String(), `"rule":"email"`)
+		assert.Contains(res.Body.String(), `"rule":"phone"`)
+	})
+
+	var claimLink string
+
+	t.Run("test create user; unverified claim", func(t *testing.T) {
+		res := httptest.NewRecorder()
+		req := httptest.NewRequest("POST", "/user", strings.NewReader(
+			`{"user_id":"emailclaim1","role":"user","password":"ev1234++","email":"emailver1@example.com"}`,
+		))
+
+		TestRouter.ServeHTTP(res, req)
+		assert.Equal(http.StatusCreated, res.Code)
+
+		claimLink = emailLink(sender, "emailver1@example.com")
+	})
+
+	t.Run("test create user", func(t *testing.T) {
+		res := httptest.NewRecorder()
+		req := httptest.NewRequest("POST", "/user", strings.NewReader(
+			`{"user_id":"emailver1","role":"user","password":"ev1234++","email":" EmailVer1@Example.com ","display_name":"Email Ver"}`,
+		))
+
+		TestRouter.ServeHTTP(res, req)
+		// an unverified claim of the email does not keep its owner from registering it.
+		assert.Equal(http.StatusCreated, res.Code)
+		assert.Len(sender.Mails("emailver1@example.com"), 2)
+	})
+
+	t.Run("test login by email; unverified", func(t *testing.T) {
+		res := httptest.NewRecorder()
+		req := httptest.NewRequest("POST", "/login", strings.NewReader(
+			`{"email":"emailver1@example.com","password":"ev1234++"}`,
+		))
+
+		TestRouter.ServeHTTP(res, req)
+		assert.Equal(http.StatusUnauthorized, res.Code)
+	})
+
+	t.Run("test verify email; invalid token", func(t *testing.T) {
+		res := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", "/email/verify?token=invalid", nil)
+
+		TestRouter.ServeHTTP(res, req)
+		assert.Equal(http.StatusBadRequest, res.Code)
+	})
+
+	t.Run("test verify email", func(t *testing.T) {
+		link := emailLink(sender, "emailver1@example.com")
+		assert.NotEmpty(link)
+
+		res := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", link, nil)
+
+		TestRouter.ServeHTTP(res, req)
+		assert.Equal(http.StatusOK, res.Code)
+		assert.Equal(`{"message":"email verification success"}`, res.Body.String())
+	})
+
+	t.Run("test verify email; verified by other user", func(t *testing.T) {
+		res := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", claimLink, nil)
+
+		TestRouter.ServeHTTP(res, req)
+		assert.Equal(http.StatusConflict, res.Code)
+	})
+
+	t.Run("test create user; email taken", func(t *testing.T) {
+		res := httptest.NewRecorder()
+		req := httptest.NewRequest("POST", "/user", strings.NewReader(
+			`{"user_id":"emailver2","role":"user","password":"ev1234++","email":"emailver1@example.com"}`,
+		))
+
+		TestRouter.ServeHTTP(res, req)
+		assert.Equal(http.StatusConflict, res.Code)
+	})
+
+	t.Run("test login by email", func(t *testing.T) {
+		res := httptest.NewRecorder()
+		req := httptest.NewRequest("POST", "/login", strings.NewReader(
+			`{"email":"EMAILVER1@example.com","password":"ev1234++"}`,
+		))
+
+		TestRouter.ServeHTTP(res, req)
+		assert.Equal(http.StatusOK, res.Code)
+
+		for _, k := range res.Result().Cookies() {
+			if k.Name == token.ACCESS_TOKEN_NAME {
+				at = k
+			}
+		}
+	})
+
+	t.Run("test get user; verified", func(t *testing.T) {
+		ui := handler.GetPrivateUserResponse{}
+
+		res := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", "/user/emailver1", nil)
+		req.AddCookie(at)
+
+		TestRouter.ServeHTTP(res, req)
+		assert.Equal(http.StatusOK, res.Code)
+
+		err := json.NewDecoder(res.Body).Decode(&ui)
+		assert.Nil(err)
+		assert.Equal("emailver1@example.com", ui.Email)
+		assert.Equal("Email Ver", ui.DisplayName)
+		assert.True(ui.EmailVerified)
+	})
+
+	t.Run("test send email verification; already verified", func(t *testing.T) {
+		res := httptest.NewRecorder()
+		req := httptest.NewRequest("POST", "/user/emailver1/email/verify", nil)
+		req.AddCookie(at)
+
+		TestRouter.ServeHTTP(res, req)
+		assert.Equal(http.StatusConflict, res.Code)
+	})
+
+	var oldLink string
+
+	t.Run("test update profile", func(t *testing.T) {
+		oldLink = emailLink(sender, "emailver1@example.com")
+
+		res := httptest.NewRecorder()
+		req := httptest.NewRequest("PUT", "/user/emailver1/profile", strings.NewReader(
+			`{"email":"emailver1@example.org","display_name":"Email Ver","phone":"+821012345678"}`,
+		))
+		req.AddCookie(at)
+
+		TestRouter.ServeHTTP(res, req)
+		assert.Equal(http.StatusOK, res.Code)
+		assert.Len(sender.Mails("emailver1@example.org"), 1)
+	})
+
+	t.Run("test login by email; changed email unverified", func(t *testing.T) {
+		res := httptest.NewRecorder()
+		req := httptest.NewRequest("POST", "/login", strings.NewReader(
+			`{"email":"emailver1@example.org","password":"ev1234++"}`,
+		))
+
+		TestRouter.ServeHTTP(res, req)
+		assert.Equal(http.StatusUnauthorized, res.Code)
+	})
+
+	t.Run("test verify email; previous email", func(t *testing.T) {
+		res := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", oldLink, nil)
+
+		TestRouter.ServeHTTP(res, req)
+		assert.Equal(http.StatusBadRequest, res.Code)
+	})
+
+	t.Run("test send email verification", func(t *testing.T) {
+		res := httptest.NewRecorder()
+		req := httptest.NewRequest("POST", "/user/emailver1/email/verify", nil)
+		req.AddCookie(at)
+
+		TestRouter.ServeHTTP(res, req)
+		assert.Equal(http.StatusAccepted, res.Code)
+		assert.Len(sender.Mails("emailver1@example.org"), 2)
+
+		res = httptest.NewRecorder()
+		req = httptest.NewRequest("GET", emailLink(sender, "emailver1@example.org"), nil)
+
+		TestRouter.ServeHTTP(res, req)
+		assert.Equal(http.StatusOK, res.Code)
+	})
+
+	t.Run("test update profile; other user", func(t *testing.T) {
+		res := httptest.NewRecorder()
+		req := httptest.NewRequest("PUT", "/user/master01/profile", strings.NewReader(
+			`{"display_name":"Master"}`,
+		))
+		req.AddCookie(at)
+
+		TestRouter.ServeHTTP(res, req)
+		assert.Equal(http.StatusUnauthorized, res.Code)
+	})
+}
@@ -0,0 +1,137 @@
+package handler
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+
+	"simple-go-server/db"
+	"simple-go-server/model"
+
+	"github.com/gin-gonic/gin"
+)
+
+// erasuresLimit is the number of latest erasures shown to managers.
+const erasuresLimit = 100
+
+// erasurePolicy returns the retention policy of the orders
+// of erased users set by ERASURE_ORDERS, "anonymize" (default) or "purge".
+func erasurePolicy() string {
+	if os.Getenv("ERASURE_ORDERS") == model.ErasurePurge {
+		return model.ErasurePurge
+	}
+	return model.ErasureAnonymize
+}
+
+// handleExportUser responds with a json archive
+// of all the data kept about the user.
+func handleExportUser(c *gin.Context) {
+	userID := c.Param("user_id")
+
+	claims, keep := checkToken(c)
+	if !keep {
+		return
+	}
+
+	if claims.UserID != userID {
+		writeMessage(c, http.StatusUnauthorized, "invalid access token for this user")
+		return
+	}
+
+	db, err := db.Get()
+	if err != nil {
+		writeMessage(c, http.StatusInternalServerError, "db failure")
+		return
+	}
+
+	user, err := db.SelectUserByUID(c.Request.Context(), claims.UID)
+	if err != nil {
+		writeMessage(c, http.StatusInternalServerError, fmt.Sprintf("%v", err))
+		return
+	}
+
+	if user == nil {
+		writeMessage(c, http.StatusNotFound, "user not found")
+		return
+	}
+
+	orders, err := db.SelectUserOrders(c.Request.Context(), user.UID)
+	if err != nil {
+		writeMessage(c, http.StatusInternalServerError, fmt.Sprintf("%v", err))
+		return
+	}
+
+	exported := make([]ExportOrder, len(orders))
+	for i, od := range orders {
+		products, err := db.SelectOrderProduct(c.Request.Context(), od.OID)
+		if err != nil {
+			writeMessage(c, http.StatusInternalServerError, fmt.Sprintf("%v", err))
+			return
+		}
+
+		pids := make([]int64, len(products))
+		for j, p := range products {
+			pids[j] = p.PID
+		}
+
+		exported[i] = ExportOrder{od.OID, od.Date, pids}
+	}
+
+	logins, err := db.SelectAllLoginHistory(c.Request.Context(), user.UID)
+	if err != nil {
+		writeMessage(c, http.StatusInternalServerError, fmt.Sprintf("%v", err))
+		return
+	}
+
+	tf, err := db.SelectTOTP(c.Request.Context(), user.UID)
+	if err != nil {
+		writeMessage(c, http.StatusInternalServerError, fmt.Sprintf("%v", err))
+		return
+	}
+
+	cart, err := db.SelectCartItems(c.Request.Context(), model.CartOwner{UID: user.UID})
+	if err != nil {
+		writeMessage(c, http.StatusInternalServerError, fmt.Sprintf("%v", err))
+		return
+	}
+
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s-export.json"`, user.UserID))
+
+	c.JSON(
+		http.StatusOK,
+		ExportUserResponse{
+			time.Now().Unix(),
+			user.Private(),
+			exported,
+			logins,
+			tf != nil && tf.Enabled,
+			cart,
+		},
+	)
+}
+
+func handleGetErasures(c *gin.Context) {
+	if _, keep := checkManager(c); !keep {
+		return
+	}
+
+	db, err := db.Get()
+	if err != nil {
+		writeMessage(c, http.StatusInternalServerError, "db failure")
+		return
+	}
+
+	erasures, err := db.SelectErasures(c.Request.Context(), erasuresLimit)
+	if err != nil {
+		writeMessage(c, http.StatusInternalServerError, fmt.Sprintf("%v", err))
+		return
+	}
+
+	c.JSON(
+		http.StatusOK,
+		GetErasuresResponse{
+			erasures,
+		},
+	)
+}
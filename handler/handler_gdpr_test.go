@@ -0,0 +1,180 @@
+package handler_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"simple-go-server/db"
+	"simple-go-server/handler"
+	"simple-go-server/model"
+	"simple-go-server/token"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUserDataErasure(t *testing.T) {
+	assert := assert.New(t)
+
+	var mt *http.Cookie
+	var pid int64
+
+	login := func(userID, pw string) *http.Cookie {
+		res := httptest.NewRecorder()
+		req := httptest.NewRequest("POST", "/login", strings.NewReader(
+			fmt.Sprintf(`{"user_id":"%s","password":"%s"}`, userID, pw),
+		))
+
+		TestRouter.ServeHTTP(res, req)
+		assert.Equal(http.StatusOK, res.Code)
+
+		for _, k := range res.Result().Cookies() {
+			if k.Name == token.ACCESS_TOKEN_NAME {
+				return k
+			}
+		}
+		return nil
+	}
+
+	// signUpAndOrder creates the user with an order and returns its access-token and oid.
+	signUpAndOrder := func(userID string) (*http.Cookie, int64) {
+		res := httptest.NewRecorder()
+		req := httptest.NewRequest("POST", "/user", strings.NewReader(
+			fmt.Sprintf(`{"user_id":"%s","role":"user","password":"gd1234++"}`, userID),
+		))
+
+		TestRouter.ServeHTTP(res, req)
+		assert.Equal(http.StatusCreated, res.Code)
+
+		at := login(userID, "gd1234++")
+
+		res = httptest.NewRecorder()
+		req = httptest.NewRequest("POST", "/order", strings.NewReader(
+			fmt.Sprintf(`{"products":[%d]}`, pid),
+		))
+		req.AddCookie(at)
+
+		TestRouter.ServeHTTP(res, req)
+		assert.Equal(http.StatusCreated, res.Code)
+
+		order := handler.CreateOrderResponse{}
+		assert.Nil(json.NewDecoder(res.Body).Decode(&order))
+
+		return at, order.OID
+	}
+
+	t.Run("test create product", func(t *testing.T) {
+		mt = login("master01", "pwmaster01++")
+
+		res := httptest.NewRecorder()
+		req := httptest.NewRequest("POST", "/product", strings.NewReader(
+			`{"name":"gdprcookie","price":500}`,
+		))
+		req.AddCookie(mt)
+
+		TestRouter.ServeHTTP(res, req)
+		assert.Equal(http.StatusCreated, res.Code)
+
+		product := handler.CreateProductResponse{}
+		assert.Nil(json.NewDecoder(res.Body).Decode(&product))
+
+		pid = product.PID
+	})
+
+	t.Run("test export", func(t *testing.T) {
+		at, oid := signUpAndOrder("gdprexport1")
+
+		res := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", "/user/gdprexport1/export", nil)
+		req.AddCookie(at)
+
+		TestRouter.ServeHTTP(res, req)
+		assert.Equal(http.StatusOK, res.Code)
+		assert.Contains(res.Header().Get("Content-Disposition"), "gdprexport1-export.json")
+		assert.NotContains(res.Body.String(), "password")
+
+		export := handler.ExportUserResponse{}
+		assert.Nil(json.NewDecoder(res.Body).Decode(&export))
+		assert.Equal("gdprexport1", export.Profile.UserID)
+		assert.Len(export.Orders, 1)
+		assert.Equal(oid, export.Orders[0].OID)
+		assert.Equal([]int64{pid}, export.Orders[0].Products)
+		assert.Len(export.Logins, 1)
+		assert.False(export.SecondFactor)
+
+		res = httptest.NewRecorder()
+		req = httptest.NewRequest("GET", "/user/master01/export", nil)
+		req.AddCookie(at)
+
+		TestRouter.ServeHTTP(res, req)
+		assert.Equal(http.StatusUnauthorized, res.Code)
+	})
+
+	t.Run("test erase; anonymize orders", func(t *testing.T) {
+		at, oid := signUpAndOrder("gdprerase1")
+
+		res := httptest.NewRecorder()
+		req := httptest.NewRequest("DELETE", "/user/gdprerase1", nil)
+		req.AddCookie(at)
+
+		TestRouter.ServeHTTP(res, req)
+		assert.Equal(http.StatusOK, res.Code)
+
+		d, err := db.Get()
+		assert.Nil(err)
+
+		order, err := d.SelectOrder(context.Background(), oid)
+		assert.Nil(err)
+		assert.NotNil(order)
+		assert.Equal(int64(0), order.UID)
+	})
+
+	t.Run("test erase; purge orders", func(t *testing.T) {
+		t.Setenv("ERASURE_ORDERS", "purge")
+
+		_, oid := signUpAndOrder("gdprerase2")
+
+		res := httptest.NewRecorder()
+		req := httptest.NewRequest("DELETE", "/user/gdprerase2", nil)
+		req.AddCookie(mt)
+
+		TestRouter.ServeHTTP(res, req)
+		assert.Equal(http.StatusOK, res.Code)
+
+		d, err := db.Get()
+		assert.Nil(err)
+
+		order, err := d.SelectOrder(context.Background(), oid)
+		assert.Nil(err)
+		assert.Nil(order)
+
+		products, err := d.SelectOrderProduct(context.Background(), oid)
+		assert.Nil(err)
+		assert.Empty(products)
+	})
+
+	t.Run("test erasure records", func(t *testing.T) {
+		res := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", "/erasures", nil)
+		req.AddCookie(mt)
+
+		TestRouter.ServeHTTP(res, req)
+		assert.Equal(http.StatusOK, res.Code)
+		assert.NotContains(res.Body.String(), "gdprerase")
+
+		list := handler.GetErasuresResponse{}
+		assert.Nil(json.NewDecoder(res.Body).Decode(&list))
+		assert.GreaterOrEqual(len(list.Erasures), 2)
+
+		purged, anonymized := list.Erasures[0], list.Erasures[1]
+		assert.Equal(model.ErasurePurge, purged.Policy)
+		assert.Equal(int64(1), purged.Orders)
+		assert.NotEqual(purged.UID, purged.RequestedBy)
+		assert.Equal(model.ErasureAnonymize, anonymized.Policy)
+		assert.Equal(anonymized.UID, anonymized.RequestedBy)
+	})
+}
@@ -0,0 +1,80 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"strconv"
+
+	"simple-go-server/db"
+	"simple-go-server/health"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pkg/errors"
+)
+
+const defaultMinFreeDiskMB = 64
+
+// registerHealthChecks registers the database checks to the readiness registry.
+// Checks of other components (e.g. workers) are registered by their owners.
+func registerHealthChecks() {
+	health.Readiness.Register("database", health.CheckerFunc(checkDatabase))
+	health.Readiness.Register("migration", health.CheckerFunc(checkMigration))
+
+	if !db.InMemory() {
+		health.Readiness.Register("disk", health.DiskSpace(db.Path(), minFreeDisk()))
+	}
+}
+
+func checkDatabase(ctx context.Context) error {
+	d, err := db.Get()
+	if err != nil {
+		return err
+	}
+
+	return d.PingContext(ctx)
+}
+
+func checkMigration(ctx context.Context) error {
+	d, err := db.Get()
+	if err != nil {
+		return err
+	}
+
+	version, err := d.SchemaVersion(ctx)
+	if err != nil {
+		return err
+	}
+
+	if latest := db.LatestSchemaVersion(); version != latest {
+		return errors.Errorf("schema version %d, expected %d", version, latest)
+	}
+
+	return nil
+}
+
+func minFreeDisk() uint64 {
+	mb, err := strconv.ParseUint(os.Getenv("DB_MIN_FREE_DISK_MB"), 10, 64)
+	if err != nil {
+		mb = defaultMinFreeDiskMB
+	}
+
+	return mb << 20
+}
+
+func handleHealthz(c *gin.Context) {
+	writeReport(c, health.Liveness.Run(c.Request.Context()))
+}
+
+func handleReadyz(c *gin.Context) {
+	writeReport(c, health.Readiness.Run(c.Request.Context()))
+}
+
+func writeReport(c *gin.Context, report health.Report) {
+	code := http.StatusOK
+	if !report.OK() {
+		code = http.StatusServiceUnavailable
+	}
+
+	c.JSON(code, report)
+}
@@ -0,0 +1,73 @@
+package handler_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"simple-go-server/health"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHandleReadyz(t *testing.T) {
+	assert := assert.New(t)
+
+	t.Run("test readyz", func(t *testing.T) {
+		res := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", "/readyz", nil)
+
+		TestRouter.ServeHTTP(res, req)
+		assert.Equal(http.StatusOK, res.Code)
+
+		var report health.Report
+
+		err := json.NewDecoder(res.Body).Decode(&report)
+		assert.Nil(err)
+		assert.Equal(health.StatusOK, report.Status)
+
+		names := []string{}
+		for _, c := range report.Checks {
+			names = append(names, c.Name)
+			assert.Equal(health.StatusOK, c.Status)
+		}
+		assert.Contains(names, "database")
+		assert.Contains(names, "migration")
+	})
+}
+
+func TestHandleHealthz(t *testing.T) {
+	assert := assert.New(t)
+
+	t.Run("test healthz", func(t *testing.T) {
+		res := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", "/healthz", nil)
+
+		TestRouter.ServeHTTP(res, req)
+		assert.Equal(http.StatusOK, res.Code)
+	})
+
+	t.Run("test healthz; failing check", func(t *testing.T) {
+		health.Liveness.Register("failing", health.CheckerFunc(func(ctx context.Context) error {
+			return errors.New("broken")
+		}))
+		defer health.Liveness.Unregister("failing")
+
+		res := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", "/healthz", nil)
+
+		TestRouter.ServeHTTP(res, req)
+		assert.Equal(http.StatusServiceUnavailable, res.Code)
+
+		var report health.Report
+
+		err := json.NewDecoder(res.Body).Decode(&report)
+		assert.Nil(err)
+		assert.Equal(health.StatusFail, report.Status)
+		assert.Len(report.Checks, 1)
+		assert.Equal("broken", report.Checks[0].Error)
+	})
+}
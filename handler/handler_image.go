@@ -0,0 +1,316 @@
+package handler
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"strconv"
+	"time"
+
+	"simple-go-server/db"
+	"simple-go-server/media"
+	"simple-go-server/model"
+	"simple-go-server/storage"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pkg/errors"
+)
+
+const (
+	defaultMaxImageBytes = 5 << 20
+	// multipartOverhead is allowed on top of the image for the multipart boundaries and headers.
+	multipartOverhead = 64 << 10
+	defaultImageURL   = "/images/"
+	imageCacheControl = "public, max-age=31536000, immutable"
+)
+
+var imageContentTypes = map[string]string{
+	".jpg": "image/jpeg",
+	".png": "image/png",
+}
+
+// maxImageBytes returns the size limit of uploaded images set by IMAGE_MAX_BYTES.
+func maxImageBytes() int64 {
+	n, err := strconv.ParseInt(os.Getenv("IMAGE_MAX_BYTES"), 10, 64)
+	if err != nil || n <= 0 {
+		return defaultMaxImageBytes
+	}
+	return n
+}
+
+// imageURL returns the url of the stored file, under IMAGE_BASE_URL
+// if the files are served by another host, e.g. a cdn.
+func imageURL(key string) string {
+	if v := os.Getenv("IMAGE_BASE_URL"); v != "" {
+		return v + key
+	}
+	return defaultImageURL + key
+}
+
+func imageLinks(images []model.ProductImage) []ProductImageLink {
+	links := make([]ProductImageLink, len(images))
+	for i, img := range images {
+		links[i] = ProductImageLink{
+			IID:          img.IID,
+			URL:          imageURL(img.Key),
+			ThumbnailURL: imageURL(img.ThumbKey),
+			Width:        img.Width,
+			Height:       img.Height,
+		}
+	}
+	return links
+}
+
+// newImageKey returns a random storage key, so that the files of a key never change
+// and are cached for good.
+func newImageKey() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(b), nil
+}
+
+// deleteImageFiles deletes the files of the images from the storage.
+// The records are deleted already, so failures are only logged.
+func deleteImageFiles(c *gin.Context, images ...model.ProductImage) {
+	for _, img := range images {
+		for _, key := range []string{img.Key, img.ThumbKey} {
+			if err := storage.Default().Delete(c.Request.Context(), key); err != nil {
+				requestLogger(c).Warn("image file delete failure", "key", key, "error", err)
+			}
+		}
+	}
+}
+
+// readImage reads the image file of the multipart form up to the size limit
+// and checks its content type, writing the error response if it fails.
+func readImage(c *gin.Context) ([]byte, bool) {
+	max := maxImageBytes()
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, max+multipartOverhead)
+
+	file, header, err := c.Request.FormFile("image")
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			writeMessage(c, http.StatusRequestEntityTooLarge, fmt.Sprintf("image must be at most %d bytes", max))
+			return nil, false
+		}
+		writeMessage(c, http.StatusBadRequest, "image file required")
+		return nil, false
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(io.LimitReader(file, max+1))
+	if err != nil {
+		writeMessage(c, http.StatusBadRequest, "image file read failure")
+		return nil, false
+	}
+
+	if int64(len(data)) > max {
+		writeMessage(c, http.StatusRequestEntityTooLarge, fmt.Sprintf("image must be at most %d bytes", max))
+		return nil, false
+	}
+
+	contentType, err := media.ContentType(data)
+	if err != nil {
+		writeMessage(c, http.StatusUnsupportedMediaType, "image must be jpeg or png")
+		return nil, false
+	}
+
+	// the declared type is not trusted, but must not contradict the content.
+	if declared, _, err := mime.ParseMediaType(header.Header.Get("Content-Type")); err == nil &&
+		declared != "application/octet-stream" && declared != contentType {
+		writeMessage(c, http.StatusUnsupportedMediaType, "image content type mismatch")
+		return nil, false
+	}
+
+	return data, true
+}
+
+// handleUploadProductImage stores the uploaded image of a product without its metadata,
+// and a thumbnail of it.
+func handleUploadProductImage(c *gin.Context) {
+	pid, err := strconv.Atoi(c.Param("pid"))
+	if err != nil {
+		writeMessage(c, http.StatusBadRequest, "invalid product id format")
+		return
+	}
+
+	claims, keep := checkToken(c)
+	if !keep {
+		return
+	}
+
+	if claims.Role != model.RoleManager {
+		writeMessage(c, http.StatusUnauthorized, "general user cannot upload product image")
+		return
+	}
+
+	db, err := db.Get()
+	if err != nil {
+		writeMessage(c, http.StatusInternalServerError, "db failure")
+		return
+	}
+
+	product, err := db.SelectProduct(c.Request.Context(), int64(pid))
+	if err != nil {
+		writeMessage(c, http.StatusInternalServerError, fmt.Sprintf("%v", err))
+		return
+	}
+
+	if product == nil {
+		writeMessage(c, http.StatusNotFound, "product not found")
+		return
+	}
+
+	data, keep := readImage(c)
+	if !keep {
+		return
+	}
+
+	img, err := media.Process(data)
+	if err == media.ErrTooLarge {
+		writeMessage(c, http.StatusRequestEntityTooLarge, fmt.Sprintf("image must be at most %dx%d pixels", media.MaxDimension, media.MaxDimension))
+		return
+	}
+	if err == media.ErrUnsupportedType {
+		writeMessage(c, http.StatusUnsupportedMediaType, "image must be jpeg or png")
+		return
+	}
+	if err != nil {
+		writeMessage(c, http.StatusInternalServerError, fmt.Sprintf("%v", err))
+		return
+	}
+
+	key, err := newImageKey()
+	if err != nil {
+		writeMessage(c, http.StatusInternalServerError, "image key failure")
+		return
+	}
+
+	record := model.ProductImage{
+		PID:      product.PID,
+		Key:      key + img.Ext,
+		ThumbKey: key + "_thumb" + img.Ext,
+		Width:    img.Width,
+		Height:   img.Height,
+	}
+
+	store := storage.Default()
+
+	if err := store.Put(c.Request.Context(), record.Key, bytes.NewReader(img.Data)); err != nil {
+		writeMessage(c, http.StatusInternalServerError, fmt.Sprintf("%v", err))
+		return
+	}
+
+	if err := store.Put(c.Request.Context(), record.ThumbKey, bytes.NewReader(img.Thumbnail)); err != nil {
+		deleteImageFiles(c, record)
+		writeMessage(c, http.StatusInternalServerError, fmt.Sprintf("%v", err))
+		return
+	}
+
+	iid, err := db.InsertProductImage(c.Request.Context(), record)
+	if err != nil {
+		deleteImageFiles(c, record)
+		writeMessage(c, http.StatusInternalServerError, fmt.Sprintf("%v", err))
+		return
+	}
+
+	c.JSON(
+		http.StatusCreated,
+		CreateProductImageResponse{
+			iid,
+			imageURL(record.Key),
+			imageURL(record.ThumbKey),
+			"upload product image success",
+		},
+	)
+}
+
+func handleDeleteProductImage(c *gin.Context) {
+	pid, err := strconv.Atoi(c.Param("pid"))
+	if err != nil {
+		writeMessage(c, http.StatusBadRequest, "invalid product id format")
+		return
+	}
+
+	iid, err := strconv.Atoi(c.Param("iid"))
+	if err != nil {
+		writeMessage(c, http.StatusBadRequest, "invalid image id format")
+		return
+	}
+
+	claims, keep := checkToken(c)
+	if !keep {
+		return
+	}
+
+	if claims.Role != model.RoleManager {
+		writeMessage(c, http.StatusUnauthorized, "general user cannot delete product image")
+		return
+	}
+
+	db, err := db.Get()
+	if err != nil {
+		writeMessage(c, http.StatusInternalServerError, "db failure")
+		return
+	}
+
+	img, err := db.SelectProductImage(c.Request.Context(), int64(iid))
+	if err != nil {
+		writeMessage(c, http.StatusInternalServerError, fmt.Sprintf("%v", err))
+		return
+	}
+
+	if img == nil || img.PID != int64(pid) {
+		writeMessage(c, http.StatusNotFound, "image not found")
+		return
+	}
+
+	if err := db.DeleteProductImage(c.Request.Context(), img.IID); err != nil {
+		writeMessage(c, http.StatusInternalServerError, fmt.Sprintf("%v", err))
+		return
+	}
+
+	deleteImageFiles(c, *img)
+
+	writeMessage(c, http.StatusOK, "delete product image success")
+}
+
+// handleGetImage serves a stored image file.
+// Keys are random and files never change, so they are cached for good.
+func handleGetImage(c *gin.Context) {
+	key := c.Param("key")
+
+	contentType, found := imageContentTypes[path.Ext(key)]
+	if !found {
+		writeMessage(c, http.StatusNotFound, "image not found")
+		return
+	}
+
+	f, err := storage.Default().Open(c.Request.Context(), key)
+	if err == storage.ErrNotExist {
+		writeMessage(c, http.StatusNotFound, "image not found")
+		return
+	}
+	if err != nil {
+		writeMessage(c, http.StatusInternalServerError, fmt.Sprintf("%v", err))
+		return
+	}
+	defer f.Close()
+
+	c.Header("Content-Type", contentType)
+	c.Header("Cache-Control", imageCacheControl)
+	c.Header("ETag", `"`+key+`"`)
+	c.Header("X-Content-Type-Options", "nosniff")
+
+	http.ServeContent(c.Writer, c.Request, key, time.Time{}, f)
+}
@@ -0,0 +1,231 @@
+package handler_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/textproto"
+	"strings"
+	"testing"
+
+	"simple-go-server/handler"
+	"simple-go-server/storage"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// exifJPEG returns a w x h jpeg with an EXIF segment of the orientation
+// and a camera model, as phones write them.
+func exifJPEG(t *testing.T, w, h int, orientation uint16) []byte {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for x := 0; x < w; x++ {
+		for y := 0; y < h; y++ {
+			img.Set(x, y, color.RGBA{uint8(x), uint8(y), 128, 255})
+		}
+	}
+
+	b := bytes.Buffer{}
+	assert.Nil(t, jpeg.Encode(&b, img, nil))
+
+	// a big endian TIFF with an IFD of the orientation and the model.
+	tiff := []byte{'M', 'M', 0, 42, 0, 0, 0, 8, 0, 2,
+		0x01, 0x12, 0, 3, 0, 0, 0, 1, byte(orientation >> 8), byte(orientation), 0, 0,
+		0x01, 0x10, 0, 2, 0, 0, 0, 4, 'G', 'P', 'S', 0,
+		0, 0, 0, 0}
+	app1 := append([]byte("Exif\x00\x00"), tiff...)
+	segment := append([]byte{0xff, 0xe1, byte((len(app1) + 2) >> 8), byte(len(app1) + 2)}, app1...)
+
+	data := b.Bytes()
+	return append(append(append([]byte{}, data[:2]...), segment...), data[2:]...)
+}
+
+// multipartImage returns the multipart form of the image file and its content type.
+func multipartImage(t *testing.T, data []byte, contentType string) (*bytes.Buffer, string) {
+	body := bytes.Buffer{}
+	w := multipart.NewWriter(&body)
+
+	h := textproto.MIMEHeader{}
+	h.Set("Content-Disposition", `form-data; name="image"; filename="photo"`)
+	if contentType != "" {
+		h.Set("Content-Type", contentType)
+	}
+
+	part, err := w.CreatePart(h)
+	assert.Nil(t, err)
+
+	_, err = part.Write(data)
+	assert.Nil(t, err)
+	assert.Nil(t, w.Close())
+
+	return &body, w.FormDataContentType()
+}
+
+func TestHandleProductImage(t *testing.T) {
+	assert := assert.New(t)
+
+	old := storage.Default()
+	storage.SetDefault(storage.NewLocalStorage(t.TempDir()))
+	defer storage.SetDefault(old)
+
+	var at, mt *http.Cookie
+	var pid int64
+	var uploaded handler.CreateProductImageResponse
+
+	// upload uploads the image file to the product and returns the response.
+	upload := func(k *http.Cookie, data []byte, contentType string) *httptest.ResponseRecorder {
+		body, formType := multipartImage(t, data, contentType)
+
+		res := httptest.NewRecorder()
+		req := httptest.NewRequest("POST", fmt.Sprintf("/product/%d/image", pid), body)
+		req.Header.Set("Content-Type", formType)
+		req.AddCookie(k)
+
+		TestRouter.ServeHTTP(res, req)
+
+		return res
+	}
+
+	t.Run("test create user", func(t *testing.T) {
+		res := httptest.NewRecorder()
+		req := httptest.NewRequest("POST", "/user", strings.NewReader(
+			`{"user_id":"handlerimage1","role":"user","password":"him1234++"}`,
+		))
+
+		TestRouter.ServeHTTP(res, req)
+		assert.Equal(http.StatusCreated, res.Code)
+
+		at = login(t, `{"user_id":"handlerimage1","password":"him1234++"}`)
+		mt = login(t, `{"user_id":"master01","password":"pwmaster01++"}`)
+	})
+
+	t.Run("test create product", func(t *testing.T) {
+		res := httptest.NewRecorder()
+		req := httptest.NewRequest("POST", "/product", strings.NewReader(`{"name":"image camera","price":30000}`))
+		req.AddCookie(mt)
+
+		TestRouter.ServeHTTP(res, req)
+		assert.Equal(http.StatusCreated, res.Code)
+
+		pd := handler.CreateProductResponse{}
+		assert.Nil(json.NewDecoder(res.Body).Decode(&pd))
+
+		pid = pd.PID
+	})
+
+	t.Run("test upload image; not manager", func(t *testing.T) {
+		res := upload(at, exifJPEG(t, 40, 20, 1), "image/jpeg")
+		assert.Equal(http.StatusUnauthorized, res.Code)
+	})
+
+	t.Run("test upload image; invalid", func(t *testing.T) {
+		res := upload(mt, []byte("GIF89a not really"), "image/gif")
+		assert.Equal(http.StatusUnsupportedMediaType, res.Code)
+
+		res = upload(mt, []byte("<svg xmlns='http://www.w3.org/2000/svg'></svg>"), "image/jpeg")
+		assert.Equal(http.StatusUnsupportedMediaType, res.Code)
+
+		b := bytes.Buffer{}
+		assert.Nil(png.Encode(&b, image.NewRGBA(image.Rect(0, 0, 4, 4))))
+
+		res = upload(mt, b.Bytes(), "image/jpeg")
+		assert.Equal(http.StatusUnsupportedMediaType, res.Code)
+
+		t.Setenv("IMAGE_MAX_BYTES", "100")
+
+		res = upload(mt, exifJPEG(t, 40, 20, 1), "image/jpeg")
+		assert.Equal(http.StatusRequestEntityTooLarge, res.Code)
+	})
+
+	t.Run("test upload image", func(t *testing.T) {
+		res := upload(mt, exifJPEG(t, 400, 200, 6), "image/jpeg")
+		assert.Equal(http.StatusCreated, res.Code)
+
+		assert.Nil(json.NewDecoder(res.Body).Decode(&uploaded))
+		assert.True(strings.HasPrefix(uploaded.URL, "/images/"))
+		assert.True(strings.HasSuffix(uploaded.ThumbnailURL, "_thumb.jpg"))
+	})
+
+	t.Run("test get product; images", func(t *testing.T) {
+		res := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", fmt.Sprintf("/product/%d", pid), nil)
+
+		TestRouter.ServeHTTP(res, req)
+		assert.Equal(http.StatusOK, res.Code)
+
+		pd := handler.GetProductResponse{}
+		assert.Nil(json.NewDecoder(res.Body).Decode(&pd))
+		assert.Len(pd.Images, 1)
+		assert.Equal(uploaded.IID, pd.Images[0].IID)
+		assert.Equal(uploaded.URL, pd.Images[0].URL)
+
+		// the orientation is applied, turning the image upright.
+		assert.Equal(200, pd.Images[0].Width)
+		assert.Equal(400, pd.Images[0].Height)
+	})
+
+	t.Run("test get image", func(t *testing.T) {
+		res := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", uploaded.URL, nil)
+
+		TestRouter.ServeHTTP(res, req)
+		assert.Equal(http.StatusOK, res.Code)
+		assert.Equal("image/jpeg", res.Header().Get("Content-Type"))
+		assert.Contains(res.Header().Get("Cache-Control"), "immutable")
+		assert.False(bytes.Contains(res.Body.Bytes(), []byte("Exif")))
+
+		etag := res.Header().Get("ETag")
+		assert.NotEmpty(etag)
+
+		res = httptest.NewRecorder()
+		req = httptest.NewRequest("GET", uploaded.URL, nil)
+		req.Header.Set("If-None-Match", etag)
+
+		TestRouter.ServeHTTP(res, req)
+		assert.Equal(http.StatusNotModified, res.Code)
+	})
+
+	t.Run("test get thumbnail", func(t *testing.T) {
+		res := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", uploaded.ThumbnailURL, nil)
+
+		TestRouter.ServeHTTP(res, req)
+		assert.Equal(http.StatusOK, res.Code)
+
+		config, err := jpeg.DecodeConfig(res.Body)
+		assert.Nil(err)
+		assert.Equal(160, config.Width)
+		assert.Equal(320, config.Height)
+	})
+
+	t.Run("test get image; not found", func(t *testing.T) {
+		for _, path := range []string{"/images/unknown.jpg", "/images/..%2Fsecret.jpg", "/images/notes.txt"} {
+			res := httptest.NewRecorder()
+			req := httptest.NewRequest("GET", path, nil)
+
+			TestRouter.ServeHTTP(res, req)
+			assert.Equal(http.StatusNotFound, res.Code)
+		}
+	})
+
+	t.Run("test delete image", func(t *testing.T) {
+		res := httptest.NewRecorder()
+		req := httptest.NewRequest("DELETE", fmt.Sprintf("/product/%d/image/%d", pid, uploaded.IID), nil)
+		req.AddCookie(mt)
+
+		TestRouter.ServeHTTP(res, req)
+		assert.Equal(http.StatusOK, res.Code)
+
+		res = httptest.NewRecorder()
+		req = httptest.NewRequest("GET", uploaded.URL, nil)
+
+		TestRouter.ServeHTTP(res, req)
+		assert.Equal(http.StatusNotFound, res.Code)
+	})
+}
@@ -3,16 +3,18 @@ package handler
 import (
 	"encoding/json"
 	"fmt"
-	"log"
 	"net/http"
 	"simple-go-server/db"
 	"simple-go-server/model"
 	"sort"
 	"strconv"
+	"time"
 
 	"github.com/gin-gonic/gin"
 )
 
+// handleCreateOrder orders the products without a cart, recording the current rate
+// to the currency of the currency query, if any, and redeeming the coupon of the request, if any.
 func handleCreateOrder(c *gin.Context) {
 	req := new(CreateOrderRequest)
 
@@ -21,8 +23,14 @@ func handleCreateOrder(c *gin.Context) {
 		return
 	}
 
+	converter, keep := newPriceConverter(c)
+	if !keep {
+		return
+	}
+
 	if len(req.Products) == 0 {
 		writeMessage(c, http.StatusBadRequest, "empty products")
+		return
 	}
 
 	claims, keep := checkToken(c)
@@ -36,51 +44,57 @@ func handleCreateOrder(c *gin.Context) {
 		return
 	}
 
+	// an order is paid in a single currency.
+	currency := model.Currency("")
+
 	for _, pid := range req.Products {
-		product, err := db.SelectProduct(pid)
+		product, err := db.SelectProduct(c.Request.Context(), pid)
 		if err != nil {
 			writeMessage(c, http.StatusInternalServerError, fmt.Sprintf("%v", err))
 			return
 		}
 
-		if product == nil {
+		if product == nil || !product.Published {
 			writeMessage(c, http.StatusNotFound, "product not found")
-			break
+			return
 		}
-	}
 
-	oid, err := db.InsertOrder(claims.UID)
-	if err != nil {
-		writeMessage(c, http.StatusInternalServerError, fmt.Sprintf("%v", err))
-		return
-	}
-
-	pids := []int64{}
-	var insertErr error = nil
-	for _, pid := range req.Products {
-		err := db.InsertOrderProduct(oid, pid)
+		hasVariants, err := db.HasVariants(c.Request.Context(), pid)
 		if err != nil {
-			insertErr = err
-			break
+			writeMessage(c, http.StatusInternalServerError, fmt.Sprintf("%v", err))
+			return
 		}
-		pids = append(pids, pid)
-	}
 
-	if len(pids) != len(req.Products) || insertErr != nil {
-		err := db.DeleteOrder(oid)
-		if err != nil {
-			log.Println("failed to delete order from database, oid: ", oid)
+		if hasVariants {
+			writeMessage(c, http.StatusBadRequest, "product with variants must be ordered through the cart")
+			return
 		}
-		for _, pid := range pids {
-			err := db.DeleteOrderProduct(oid, pid)
-			if err != nil {
-				log.Printf("failed to delete order product from database, oid: %d, pid: %d", oid, pid)
-			}
+
+		if currency != "" && product.Price.Currency != currency {
+			writeMessage(c, http.StatusBadRequest, "products of an order must be in a single currency")
+			return
 		}
-		writeMessage(c, http.StatusInternalServerError, "order product insert failure")
+		currency = product.Price.Currency
+	}
+
+	rate, keep := converter.rate(c, db, currency)
+	if !keep {
 		return
 	}
 
+	coupon := string(model.CouponCode(req.Coupon).Normalized())
+
+	oid, err := db.CreateOrder(c.Request.Context(), claims.UID, req.Products, rate, coupon)
+	if writeCouponError(c, err) {
+		return
+	}
+	if err != nil {
+		writeMessage(c, http.StatusInternalServerError, fmt.Sprintf("%v", err))
+		return
+	}
+
+	ordersCreated.Inc()
+
 	c.JSON(
 		http.StatusCreated,
 		CreateOrderResponse{
@@ -90,6 +104,9 @@ func handleCreateOrder(c *gin.Context) {
 	)
 }
 
+// handleGetOrder responds with the order of the user.
+// The prices are converted to the currency of the currency query at the rate recorded at purchase,
+// or for other currencies at the rate effective at the order date.
 func handleGetOrder(c *gin.Context) {
 	oid, err := strconv.Atoi(c.Param("oid"))
 	if err != nil {
@@ -97,6 +114,11 @@ func handleGetOrder(c *gin.Context) {
 		return
 	}
 
+	converter, keep := newPriceConverter(c)
+	if !keep {
+		return
+	}
+
 	claims, keep := checkToken(c)
 	if !keep {
 		return
@@ -108,7 +130,7 @@ func handleGetOrder(c *gin.Context) {
 		return
 	}
 
-	order, err := db.SelectOrder(int64(oid))
+	order, err := db.SelectOrder(c.Request.Context(), int64(oid))
 	if err != nil {
 		writeMessage(c, http.StatusInternalServerError, fmt.Sprintf("%v", err))
 		return
@@ -124,7 +146,7 @@ func handleGetOrder(c *gin.Context) {
 		return
 	}
 
-	orders, err := db.SelectOrderProduct(int64(oid))
+	orders, err := db.SelectOrderProduct(c.Request.Context(), int64(oid))
 	if err != nil {
 		writeMessage(c, http.StatusInternalServerError, fmt.Sprintf("%v", err))
 		return
@@ -136,16 +158,70 @@ func handleGetOrder(c *gin.Context) {
 	}
 
 	products := make([]int64, len(orders))
+	prices := make([]model.Money, len(orders))
 	for i, od := range orders {
 		products[i] = od.PID
+		prices[i] = od.Subtotal()
+	}
+
+	currency := orders[0].Price.Currency
+
+	subtotal, err := model.Sum(currency, prices...)
+	if err != nil {
+		writeMessage(c, http.StatusInternalServerError, fmt.Sprintf("%v", err))
+		return
+	}
+
+	discounts, err := db.SelectOrderDiscounts(c.Request.Context(), int64(oid))
+	if err != nil {
+		writeMessage(c, http.StatusInternalServerError, fmt.Sprintf("%v", err))
+		return
+	}
+
+	amounts := make([]model.Money, len(discounts))
+	for i, d := range discounts {
+		amounts[i] = d.Amount
+	}
+
+	discount, err := model.Sum(currency, amounts...)
+	if err != nil {
+		writeMessage(c, http.StatusInternalServerError, fmt.Sprintf("%v", err))
+		return
+	}
+
+	total := model.NewMoney(subtotal.Amount-discount.Amount, currency)
+
+	converter.at = time.Unix(order.Date, 0)
+	if r := order.ExchangeRate; r != nil && r.Quote == converter.quote {
+		converter.rates[r.Base] = r
+	}
+
+	// the sums are converted as a whole, as they were charged.
+	converted := []*model.Money{&subtotal, &discount, &total}
+	for i := range orders {
+		converted = append(converted, &orders[i].Price)
+	}
+	for i := range discounts {
+		converted = append(converted, &discounts[i].Amount)
+	}
+
+	if !converter.convert(c, db, converted...) {
+		return
 	}
 
 	c.JSON(
 		http.StatusOK,
 		GetOrderResponse{
-			OID:      order.OID,
-			UID:      order.UID,
-			Products: products,
+			OID:           order.OID,
+			UID:           order.UID,
+			Products:      products,
+			Items:         orders,
+			Subtotal:      subtotal,
+			Discounts:     discounts,
+			Discount:      discount,
+			Total:         total,
+			ExchangeRate:  order.ExchangeRate,
+			ExchangeRates: converter.used(),
 		},
 	)
 }
@@ -175,7 +251,7 @@ func handleUpdateOrder(c *gin.Context) {
 		return
 	}
 
-	order, err := db.SelectOrder(int64(oid))
+	order, err := db.SelectOrder(c.Request.Context(), int64(oid))
 	if err != nil {
 		writeMessage(c, http.StatusInternalServerError, fmt.Sprintf("%v", err))
 		return
@@ -191,19 +267,51 @@ func handleUpdateOrder(c *gin.Context) {
 		return
 	}
 
+	// discounts are granted for the products ordered, so the order is fixed.
+	discounts, err := db.SelectOrderDiscounts(c.Request.Context(), int64(oid))
+	if err != nil {
+		writeMessage(c, http.StatusInternalServerError, fmt.Sprintf("%v", err))
+		return
+	}
+
+	if len(discounts) > 0 {
+		writeMessage(c, http.StatusConflict, "order with discounts cannot be changed")
+		return
+	}
+
 	newProducts := map[int64]struct{}{}
 
+	// an order is paid in a single currency.
+	currency := model.Currency("")
+
 	for _, pid := range req.Products {
-		product, err := db.SelectProduct(pid)
+		product, err := db.SelectProduct(c.Request.Context(), pid)
 		if err != nil {
 			writeMessage(c, http.StatusInternalServerError, fmt.Sprintf("%v", err))
 			return
 		}
 
-		if product == nil {
+		if product == nil || !product.Published {
 			writeMessage(c, http.StatusNotFound, "product not found")
-			break
+			return
+		}
+
+		hasVariants, err := db.HasVariants(c.Request.Context(), pid)
+		if err != nil {
+			writeMessage(c, http.StatusInternalServerError, fmt.Sprintf("%v", err))
+			return
+		}
+
+		if hasVariants {
+			writeMessage(c, http.StatusBadRequest, "product with variants must be ordered through the cart")
+			return
+		}
+
+		if currency != "" && product.Price.Currency != currency {
+			writeMessage(c, http.StatusBadRequest, "products of an order must be in a single currency")
+			return
 		}
+		currency = product.Price.Currency
 
 		if _, found := newProducts[pid]; found {
 			writeMessage(c, http.StatusBadRequest, "duplicate product found in request")
@@ -213,7 +321,7 @@ func handleUpdateOrder(c *gin.Context) {
 		newProducts[pid] = struct{}{}
 	}
 
-	orders, err := db.SelectOrderProduct(int64(oid))
+	orders, err := db.SelectOrderProduct(c.Request.Context(), int64(oid))
 	if err != nil {
 		writeMessage(c, http.StatusInternalServerError, fmt.Sprintf("%v", err))
 		return
@@ -237,7 +345,7 @@ func handleUpdateOrder(c *gin.Context) {
 			continue
 		}
 
-		err := db.DeleteOrderProduct(int64(oid), pid)
+		err := db.DeleteOrderProduct(c.Request.Context(), int64(oid), pid)
 		if err != nil {
 			deleteErr = err
 			break
@@ -248,9 +356,9 @@ func handleUpdateOrder(c *gin.Context) {
 
 	if deleteErr != nil {
 		for _, pid := range deletedOrderProduct {
-			err := db.InsertOrderProduct(int64(oid), pid)
+			err := db.InsertOrderProduct(c.Request.Context(), int64(oid), pid)
 			if err != nil {
-				log.Printf("failed to insert order product into database, oid: %d, pid: %d", oid, pid)
+				requestLogger(c).Error("failed to insert order product into database", "oid", oid, "pid", pid, "error", err)
 			}
 		}
 		writeMessage(c, http.StatusInternalServerError, "order product delete failure")
@@ -265,7 +373,7 @@ func handleUpdateOrder(c *gin.Context) {
 			continue
 		}
 
-		err := db.InsertOrderProduct(int64(oid), pid)
+		err := db.InsertOrderProduct(c.Request.Context(), int64(oid), pid)
 		if err != nil {
 			insertErr = err
 			break
@@ -276,16 +384,16 @@ func handleUpdateOrder(c *gin.Context) {
 
 	if insertErr != nil {
 		for _, pid := range insertedOrderProduct {
-			err := db.DeleteOrderProduct(int64(oid), pid)
+			err := db.DeleteOrderProduct(c.Request.Context(), int64(oid), pid)
 			if err != nil {
-				log.Printf("failed to delete order product from database, oid: %d, pid: %d", oid, pid)
+				requestLogger(c).Error("failed to delete order product from database", "oid", oid, "pid", pid, "error", err)
 			}
 		}
 		writeMessage(c, http.StatusInternalServerError, "order product insert failure")
 		return
 	}
 
-	err = db.UpdateOrder(int64(oid))
+	err = db.UpdateOrder(c.Request.Context(), int64(oid))
 	if err != nil {
 		writeMessage(c, http.StatusInternalServerError, fmt.Sprintf("%v", err))
 		return
@@ -312,7 +420,7 @@ func handleDeleteOrder(c *gin.Context) {
 		return
 	}
 
-	order, err := db.SelectOrder(int64(oid))
+	order, err := db.SelectOrder(c.Request.Context(), int64(oid))
 	if err != nil {
 		writeMessage(c, http.StatusInternalServerError, fmt.Sprintf("%v", err))
 		return
@@ -328,7 +436,7 @@ func handleDeleteOrder(c *gin.Context) {
 		return
 	}
 
-	orders, err := db.SelectOrderProduct(int64(oid))
+	orders, err := db.SelectOrderProduct(c.Request.Context(), int64(oid))
 	if err != nil {
 		writeMessage(c, http.StatusInternalServerError, fmt.Sprintf("%v", err))
 		return
@@ -339,35 +447,8 @@ func handleDeleteOrder(c *gin.Context) {
 		return
 	}
 
-	products := make([]int64, len(orders))
-	for i, od := range orders {
-		products[i] = od.PID
-	}
-
-	deletedOrderProduct := []int64{}
-
-	var deleteErr error = nil
-	for _, pid := range products {
-		if err := db.DeleteOrderProduct(int64(oid), pid); err != nil {
-			deleteErr = err
-			break
-		}
-
-		deletedOrderProduct = append(deletedOrderProduct, pid)
-	}
-
-	if deleteErr != nil {
-		for _, pid := range deletedOrderProduct {
-			err := db.InsertOrderProduct(int64(oid), pid)
-			if err != nil {
-				log.Printf("failed to insert order product into database, oid: %d, pid: %d", oid, pid)
-			}
-		}
-		writeMessage(c, http.StatusInternalServerError, "order product delete failure")
-		return
-	}
-
-	err = db.DeleteOrder(int64(oid))
+	// the products are deleted with the order, and their variants returned to stock.
+	err = db.DeleteOrder(c.Request.Context(), int64(oid))
 	if err != nil {
 		writeMessage(c, http.StatusInternalServerError, fmt.Sprintf("%v", err))
 		return
@@ -393,7 +474,7 @@ func handleGetOrders(c *gin.Context) {
 		return
 	}
 
-	orders, err := db.SelectOrders()
+	orders, err := db.SelectOrders(c.Request.Context())
 	if err != nil {
 		writeMessage(c, http.StatusInternalServerError, fmt.Sprintf("%v", err))
 		return
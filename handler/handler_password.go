@@ -0,0 +1,227 @@
+package handler
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"simple-go-server/db"
+	"simple-go-server/logger"
+	"simple-go-server/model"
+	"simple-go-server/notify"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pkg/errors"
+)
+
+const defaultResetTokenTTL = 30 * time.Minute
+
+// resetSendTimeout bounds a password reset sent after the response of its request.
+const resetSendTimeout = 30 * time.Second
+
+// resetSends tracks the password resets sent after the response of their requests.
+var resetSends sync.WaitGroup
+
+// WaitPasswordResets waits until the password resets sent in the background are done,
+// so that the server can stop without cutting them off. It fails when ctx is done first.
+func WaitPasswordResets(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		resetSends.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return errors.Wrap(ctx.Err(), "password resets did not finish in time")
+	}
+}
+
+// resetTokenTTL returns the lifetime of password reset tokens set by RESET_TOKEN_TTL.
+func resetTokenTTL() time.Duration {
+	d, err := time.ParseDuration(os.Getenv("RESET_TOKEN_TTL"))
+	if err != nil || d <= 0 {
+		return defaultResetTokenTTL
+	}
+	return d
+}
+
+// newResetToken returns a random token sent to the user
+// and its hash stored in the database.
+func newResetToken() (string, string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", err
+	}
+
+	t := base64.RawURLEncoding.EncodeToString(b)
+
+	return t, hashResetToken(t), nil
+}
+
+func hashResetToken(t string) string {
+	h := sha256.Sum256([]byte(t))
+	return hex.EncodeToString(h[:])
+}
+
+// sendPasswordReset issues a reset token of the user,
+// revoking the previous ones, and notifies the user of it.
+func sendPasswordReset(ctx context.Context, db *db.Database, user *model.User) error {
+	t, hash, err := newResetToken()
+	if err != nil {
+		return errors.Wrap(err, "reset token failure")
+	}
+
+	expires := time.Now().Add(resetTokenTTL())
+
+	if err := db.InsertPasswordReset(ctx, user.UID, hash, expires); err != nil {
+		return err
+	}
+
+	err = notify.Default().Notify(ctx, notify.Message{
+		To:      user.UserID,
+		Subject: "Password reset",
+		Body: fmt.Sprintf(
+			"Use the token below to reset your password until %s.\ntoken: %s\n",
+			expires.UTC().Format(time.RFC1123),
+			t,
+		),
+	})
+	if err != nil {
+		return errors.Errorf("notification failure")
+	}
+
+	return nil
+}
+
+func handleForgotPassword(c *gin.Context) {
+	req := new(ForgotPasswordRequest)
+
+	if err := json.NewDecoder(c.Request.Body).Decode(&req); err != nil {
+		writeMessage(c, http.StatusBadRequest, "invalid request format")
+		return
+	}
+
+	// the user id policy is not checked, as it may have changed
+	// since existing users signed up.
+	userID := model.UserID(req.UserID)
+	if !isCredential(string(userID)) {
+		writeMessage(c, http.StatusBadRequest, "invalid user id format")
+		return
+	}
+
+	db, err := db.Get()
+	if err != nil {
+		writeMessage(c, http.StatusInternalServerError, "db failure")
+		return
+	}
+
+	user, err := db.SelectUser(c.Request.Context(), string(userID))
+	if err != nil {
+		writeMessage(c, http.StatusInternalServerError, fmt.Sprintf("%v", err))
+		return
+	}
+
+	// the response is the same whether the user exists or not,
+	// and the reset is sent after it, so that neither the response
+	// nor its time reveals registered user ids.
+	if user != nil && !user.Suspended {
+		log := requestLogger(c)
+
+		resetSends.Add(1)
+		go func() {
+			defer resetSends.Done()
+
+			ctx, cancel := context.WithTimeout(logger.WithContext(context.Background(), log), resetSendTimeout)
+			defer cancel()
+
+			if err := sendPasswordReset(ctx, db, user); err != nil {
+				log.Error("password reset failure", "uid", user.UID, "error", err)
+			}
+		}()
+	}
+
+	writeMessage(c, http.StatusAccepted, "password reset requested")
+}
+
+func handleResetPassword(c *gin.Context) {
+	req := new(ResetPasswordRequest)
+
+	if err := json.NewDecoder(c.Request.Body).Decode(&req); err != nil {
+		writeMessage(c, http.StatusBadRequest, "invalid request format")
+		return
+	}
+
+	db, err := db.Get()
+	if err != nil {
+		writeMessage(c, http.StatusInternalServerError, "db failure")
+		return
+	}
+
+	reset, err := db.SelectPasswordReset(c.Request.Context(), hashResetToken(req.Token))
+	if err != nil {
+		writeMessage(c, http.StatusInternalServerError, fmt.Sprintf("%v", err))
+		return
+	}
+
+	if reset == nil {
+		writeMessage(c, http.StatusBadRequest, "invalid or expired reset token")
+		return
+	}
+
+	user, err := db.SelectUserByUID(c.Request.Context(), reset.UID)
+	if err != nil {
+		writeMessage(c, http.StatusInternalServerError, fmt.Sprintf("%v", err))
+		return
+	}
+
+	if user == nil {
+		writeMessage(c, http.StatusBadRequest, "invalid or expired reset token")
+		return
+	}
+
+	pw := model.Password(req.Password)
+	if err := pw.IsValid(model.UserID(user.UserID)); err != nil {
+		writeViolations(c, "invalid password format", err)
+		return
+	}
+
+	pwHash, err := pw.Hash()
+	if err != nil {
+		writeMessage(c, http.StatusInternalServerError, "password hashing failure")
+		return
+	}
+
+	used, err := db.UsePasswordReset(c.Request.Context(), reset.RID, time.Now())
+	if err != nil {
+		writeMessage(c, http.StatusInternalServerError, fmt.Sprintf("%v", err))
+		return
+	}
+
+	if !used {
+		writeMessage(c, http.StatusBadRequest, "invalid or expired reset token")
+		return
+	}
+
+	if err := db.UpdateUserPassword(c.Request.Context(), user.UID, pwHash); err != nil {
+		writeMessage(c, http.StatusInternalServerError, fmt.Sprintf("%v", err))
+		return
+	}
+
+	if err := db.DeleteLoginFailure(c.Request.Context(), user.UserID); err != nil {
+		writeMessage(c, http.StatusInternalServerError, fmt.Sprintf("%v", err))
+		return
+	}
+
+	writeMessage(c, http.StatusOK, "password reset success")
+}
@@ -0,0 +1,167 @@
+package handler_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"simple-go-server/handler"
+	"simple-go-server/notify"
+	"simple-go-server/token"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var resetTokenRegex = regexp.MustCompile(`token: (\S+)`)
+
+func TestHandleResetPassword(t *testing.T) {
+	assert := assert.New(t)
+
+	notifier := notify.NewMemoryNotifier()
+
+	old := notify.Default()
+	notify.SetDefault(notifier)
+	defer notify.SetDefault(old)
+
+	var at *http.Cookie
+	var resetToken string
+
+	t.Run("test create user", func(t *testing.T) {
+		res := httptest.NewRecorder()
+		req := httptest.NewRequest("POST", "/user", strings.NewReader(
+			`{"user_id":"resetpw1","role":"user","password":"rp1234++"}`,
+		))
+
+		TestRouter.ServeHTTP(res, req)
+		assert.Equal(http.StatusCreated, res.Code)
+	})
+
+	t.Run("test login", func(t *testing.T) {
+		res := httptest.NewRecorder()
+		req := httptest.NewRequest("POST", "/login", strings.NewReader(
+			`{"user_id":"resetpw1","password":"rp1234++"}`,
+		))
+
+		TestRouter.ServeHTTP(res, req)
+		assert.Equal(http.StatusOK, res.Code)
+
+		for _, k := range res.Result().Cookies() {
+			if k.Name == token.ACCESS_TOKEN_NAME {
+				at = k
+			}
+		}
+	})
+
+	t.Run("test forgot password; unknown user", func(t *testing.T) {
+		res := httptest.NewRecorder()
+		req := httptest.NewRequest("POST", "/password/forgot", strings.NewReader(
+			`{"user_id":"resetpwnone"}`,
+		))
+
+		TestRouter.ServeHTTP(res, req)
+		assert.Equal(http.StatusAccepted, res.Code)
+		assert.Equal(`{"message":"password reset requested"}`, res.Body.String())
+		assert.Len(notifier.Messages("resetpwnone"), 0)
+	})
+
+	t.Run("test forgot password", func(t *testing.T) {
+		res := httptest.NewRecorder()
+		req := httptest.NewRequest("POST", "/password/forgot", strings.NewReader(
+			`{"user_id":"resetpw1"}`,
+		))
+
+		TestRouter.ServeHTTP(res, req)
+		assert.Equal(http.StatusAccepted, res.Code)
+		assert.Equal(`{"message":"password reset requested"}`, res.Body.String())
+
+		// the reset is sent after the response.
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		assert.Nil(handler.WaitPasswordResets(ctx))
+
+		msgs := notifier.Messages("resetpw1")
+		if !assert.Len(msgs, 1) {
+			return
+		}
+
+		m := resetTokenRegex.FindStringSubmatch(msgs[0].Body)
+		assert.Len(m, 2)
+
+		resetToken = m[1]
+	})
+
+	t.Run("test reset password; invalid password", func(t *testing.T) {
+		res := httptest.NewRecorder()
+		req := httptest.NewRequest("POST", "/password/reset", strings.NewReader(
+			fmt.Sprintf(`{"token":"%s","password":"short"}`, resetToken),
+		))
+
+		TestRouter.ServeHTTP(res, req)
+		assert.Equal(http.StatusBadRequest, res.Code)
+	})
+
+	t.Run("test reset password; invalid token", func(t *testing.T) {
+		res := httptest.NewRecorder()
+		req := httptest.NewRequest("POST", "/password/reset", strings.NewReader(
+			`{"token":"invalid","password":"rp5678++"}`,
+		))
+
+		TestRouter.ServeHTTP(res, req)
+		assert.Equal(http.StatusBadRequest, res.Code)
+	})
+
+	t.Run("test reset password", func(t *testing.T) {
+		res := httptest.NewRecorder()
+		req := httptest.NewRequest("POST", "/password/reset", strings.NewReader(
+			fmt.Sprintf(`{"token":"%s","password":"rp5678++"}`, resetToken),
+		))
+
+		TestRouter.ServeHTTP(res, req)
+		assert.Equal(http.StatusOK, res.Code)
+		assert.Equal(`{"message":"password reset success"}`, res.Body.String())
+	})
+
+	t.Run("test reset password; token already used", func(t *testing.T) {
+		res := httptest.NewRecorder()
+		req := httptest.NewRequest("POST", "/password/reset", strings.NewReader(
+			fmt.Sprintf(`{"token":"%s","password":"rp9999++"}`, resetToken),
+		))
+
+		TestRouter.ServeHTTP(res, req)
+		assert.Equal(http.StatusBadRequest, res.Code)
+	})
+
+	t.Run("test old session revoked", func(t *testing.T) {
+		res := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", "/user/resetpw1/logins", nil)
+		req.AddCookie(at)
+
+		TestRouter.ServeHTTP(res, req)
+		assert.Equal(http.StatusUnauthorized, res.Code)
+	})
+
+	t.Run("test login; old password", func(t *testing.T) {
+		res := httptest.NewRecorder()
+		req := httptest.NewRequest("POST", "/login", strings.NewReader(
+			`{"user_id":"resetpw1","password":"rp1234++"}`,
+		))
+
+		TestRouter.ServeHTTP(res, req)
+		assert.Equal(http.StatusUnauthorized, res.Code)
+	})
+
+	t.Run("test login; new password", func(t *testing.T) {
+		res := httptest.NewRecorder()
+		req := httptest.NewRequest("POST", "/login", strings.NewReader(
+			`{"user_id":"resetpw1","password":"rp5678++"}`,
+		))
+
+		TestRouter.ServeHTTP(res, req)
+		assert.Equal(http.StatusOK, res.Code)
+	})
+}
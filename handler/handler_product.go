@@ -11,6 +11,31 @@ import (
 	"github.com/gin-gonic/gin"
 )
 
+// checkProductDetails checks the description and the attributes of a product.
+func checkProductDetails(c *gin.Context, description string, attributes model.ProductAttributes) bool {
+	if err := model.ProductDescription(description).IsValid(); err != nil {
+		writeMessage(c, http.StatusBadRequest, fmt.Sprintf("%v", err))
+		return false
+	}
+
+	if err := attributes.IsValid(); err != nil {
+		writeMessage(c, http.StatusBadRequest, fmt.Sprintf("%v", err))
+		return false
+	}
+
+	return true
+}
+
+// checkPrice checks the price of a product or a variant.
+func checkPrice(c *gin.Context, price model.Money) bool {
+	if err := price.IsValid(); err != nil {
+		writeMessage(c, http.StatusBadRequest, fmt.Sprintf("invalid price: %v", err))
+		return false
+	}
+
+	return true
+}
+
 func handleCreateProduct(c *gin.Context) {
 	req := new(CreateProductRequest)
 
@@ -19,12 +44,21 @@ func handleCreateProduct(c *gin.Context) {
 		return
 	}
 
-	name := model.ProductName(req.Name)
+	name := model.ProductName(req.Name).Normalized()
 	if err := name.IsValid(); err != nil {
 		writeMessage(c, http.StatusBadRequest, "invalid product name format")
 		return
 	}
 
+	price := req.Price.WithDefaultCurrency(model.DefaultCurrency)
+	if !checkPrice(c, price) {
+		return
+	}
+
+	if !checkProductDetails(c, req.Description, req.Attributes) {
+		return
+	}
+
 	claims, keep := checkToken(c)
 	if !keep {
 		return
@@ -41,7 +75,15 @@ func handleCreateProduct(c *gin.Context) {
 		return
 	}
 
-	pid, err := db.InsertProduct(req.Name, req.Price)
+	product := model.Product{
+		Name:        string(name),
+		Price:       price,
+		Description: string(model.ProductDescription(req.Description).Sanitized()),
+		Attributes:  req.Attributes,
+		Published:   req.Published == nil || *req.Published,
+	}
+
+	pid, err := db.InsertProduct(c.Request.Context(), product)
 	if err != nil {
 		writeMessage(c, http.StatusInternalServerError, fmt.Sprintf("%v", err))
 		return
@@ -56,6 +98,9 @@ func handleCreateProduct(c *gin.Context) {
 	)
 }
 
+// handleGetProduct responds with the product, which is not found
+// by anyone but managers while it is a draft.
+// The prices are converted to the currency of the currency query, if any.
 func handleGetProduct(c *gin.Context) {
 	pid, err := strconv.Atoi(c.Param("pid"))
 	if err != nil {
@@ -63,26 +108,71 @@ func handleGetProduct(c *gin.Context) {
 		return
 	}
 
+	converter, keep := newPriceConverter(c)
+	if !keep {
+		return
+	}
+
+	claims, keep := optionalToken(c)
+	if !keep {
+		return
+	}
+
 	db, err := db.Get()
 	if err != nil {
 		writeMessage(c, http.StatusInternalServerError, "db failure")
 		return
 	}
 
-	product, err := db.SelectProduct(int64(pid))
+	product, err := db.SelectProduct(c.Request.Context(), int64(pid))
 	if err != nil {
 		writeMessage(c, http.StatusInternalServerError, fmt.Sprintf("%v", err))
 		return
 	}
 
-	if product == nil {
+	if product == nil || !product.Published && (claims == nil || claims.Role != model.RoleManager) {
 		writeMessage(c, http.StatusNotFound, "product not found")
 		return
 	}
 
+	categories, err := db.SelectProductCategories(c.Request.Context(), product.PID)
+	if err != nil {
+		writeMessage(c, http.StatusInternalServerError, fmt.Sprintf("%v", err))
+		return
+	}
+
+	options, err := db.SelectProductOptions(c.Request.Context(), product.PID)
+	if err != nil {
+		writeMessage(c, http.StatusInternalServerError, fmt.Sprintf("%v", err))
+		return
+	}
+
+	variants, err := db.SelectVariants(c.Request.Context(), product.PID)
+	if err != nil {
+		writeMessage(c, http.StatusInternalServerError, fmt.Sprintf("%v", err))
+		return
+	}
+
+	images, err := db.SelectProductImages(c.Request.Context(), product.PID)
+	if err != nil {
+		writeMessage(c, http.StatusInternalServerError, fmt.Sprintf("%v", err))
+		return
+	}
+
+	prices := []*model.Money{&product.Price}
+	for i := range variants {
+		if variants[i].Price != nil {
+			prices = append(prices, variants[i].Price)
+		}
+	}
+
+	if !converter.convert(c, db, prices...) {
+		return
+	}
+
 	c.JSON(
 		http.StatusOK,
-		GetProductResponse{*product},
+		GetProductResponse{*product, categories, options, variants, imageLinks(images), converter.used()},
 	)
 }
 
@@ -100,7 +190,7 @@ func handleUpdateProduct(c *gin.Context) {
 		return
 	}
 
-	name := model.ProductName(req.Name)
+	name := model.ProductName(req.Name).Normalized()
 	if err := name.IsValid(); err != nil {
 		writeMessage(c, http.StatusBadRequest, "invalid product name format")
 		return
@@ -122,7 +212,7 @@ func handleUpdateProduct(c *gin.Context) {
 		return
 	}
 
-	product, err := db.SelectProduct(int64(pid))
+	product, err := db.SelectProduct(c.Request.Context(), int64(pid))
 	if err != nil {
 		writeMessage(c, http.StatusInternalServerError, fmt.Sprintf("%v", err))
 		return
@@ -133,7 +223,48 @@ func handleUpdateProduct(c *gin.Context) {
 		return
 	}
 
-	err = db.UpdateProduct(int64(pid), req.Name, req.Price)
+	price := req.Price.WithDefaultCurrency(product.Price.Currency)
+	if !checkPrice(c, price) {
+		return
+	}
+
+	// variant prices are in the product currency,
+	// so it cannot change while any variant overrides the price.
+	if price.Currency != product.Price.Currency {
+		priced, err := db.HasPricedVariants(c.Request.Context(), product.PID)
+		if err != nil {
+			writeMessage(c, http.StatusInternalServerError, fmt.Sprintf("%v", err))
+			return
+		}
+
+		if priced {
+			writeMessage(c, http.StatusConflict, "product currency cannot change while variants override its price")
+			return
+		}
+	}
+
+	product.Name = string(name)
+	product.Price = price
+
+	if req.Description != nil {
+		product.Description = *req.Description
+	}
+
+	if req.Attributes != nil {
+		product.Attributes = *req.Attributes
+	}
+
+	if req.Published != nil {
+		product.Published = *req.Published
+	}
+
+	if !checkProductDetails(c, product.Description, product.Attributes) {
+		return
+	}
+
+	product.Description = string(model.ProductDescription(product.Description).Sanitized())
+
+	err = db.UpdateProduct(c.Request.Context(), *product)
 	if err != nil {
 		writeMessage(c, http.StatusInternalServerError, fmt.Sprintf("%v", err))
 		return
@@ -165,7 +296,7 @@ func handleDeleteProduct(c *gin.Context) {
 		return
 	}
 
-	product, err := db.SelectProduct(int64(pid))
+	product, err := db.SelectProduct(c.Request.Context(), int64(pid))
 	if err != nil {
 		writeMessage(c, http.StatusInternalServerError, fmt.Sprintf("%v", err))
 		return
@@ -176,11 +307,19 @@ func handleDeleteProduct(c *gin.Context) {
 		return
 	}
 
-	err = db.DeleteProduct(int64(pid))
+	images, err := db.SelectProductImages(c.Request.Context(), product.PID)
 	if err != nil {
 		writeMessage(c, http.StatusInternalServerError, fmt.Sprintf("%v", err))
 		return
 	}
 
+	err = db.DeleteProduct(c.Request.Context(), int64(pid))
+	if err != nil {
+		writeMessage(c, http.StatusInternalServerError, fmt.Sprintf("%v", err))
+		return
+	}
+
+	deleteImageFiles(c, images...)
+
 	writeMessage(c, http.StatusOK, "delete product success")
 }
@@ -350,3 +350,180 @@ func TestHandleDeleteProduct(t *testing.T) {
 		assert.Equal(`{"message":"logout success"}`, res.Body.String())
 	})
 }
+
+func TestHandleProductDetails(t *testing.T) {
+	assert := assert.New(t)
+
+	var at, mt *http.Cookie
+	var pid int64
+
+	// getProduct returns the response code and the product seen with the cookie.
+	getProduct := func(k *http.Cookie) (int, handler.GetProductResponse) {
+		res := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", fmt.Sprintf("/product/%d", pid), nil)
+		if k != nil {
+			req.AddCookie(k)
+		}
+
+		TestRouter.ServeHTTP(res, req)
+
+		pd := handler.GetProductResponse{}
+		if res.Code == http.StatusOK {
+			assert.Nil(json.NewDecoder(res.Body).Decode(&pd))
+		}
+
+		return res.Code, pd
+	}
+
+	t.Run("test create user", func(t *testing.T) {
+		res := httptest.NewRecorder()
+		req := httptest.NewRequest("POST", "/user", strings.NewReader(
+			`{"user_id":"handlerdetail1","role":"user","password":"hdt1234++"}`,
+		))
+
+		TestRouter.ServeHTTP(res, req)
+		assert.Equal(http.StatusCreated, res.Code)
+
+		at = login(t, `{"user_id":"handlerdetail1","password":"hdt1234++"}`)
+		mt = login(t, `{"user_id":"master01","password":"pwmaster01++"}`)
+	})
+
+	t.Run("test create product; invalid attributes", func(t *testing.T) {
+		for _, attributes := range []string{
+			`[{"key":"weight","type":"number","value":"heavy"}]`,
+			`[{"key":"Color","type":"string","value":"red"}]`,
+			`[{"key":"a","type":"bool","value":true},{"key":"a","type":"bool","value":false}]`,
+		} {
+			res := httptest.NewRecorder()
+			req := httptest.NewRequest("POST", "/product", strings.NewReader(
+				fmt.Sprintf(`{"name":"detail tea","price":100,"attributes":%s}`, attributes),
+			))
+			req.AddCookie(mt)
+
+			TestRouter.ServeHTTP(res, req)
+			assert.Equal(http.StatusBadRequest, res.Code)
+		}
+	})
+
+	t.Run("test create product; draft", func(t *testing.T) {
+		res := httptest.NewRecorder()
+		req := httptest.NewRequest("POST", "/product", strings.NewReader(
+			`{"name":" Thé vert 緑茶 ","price":900,"published":false,`+
+				`"description":"## Tea\n<img src=x onerror=alert(1)> [more](javascript:alert(1))",`+
+				`"attributes":[{"key":"origin","type":"string","value":"Jeju"},{"key":"weight_g","type":"number","value":80},{"key":"organic","type":"bool","value":true}]}`,
+		))
+		req.AddCookie(mt)
+
+		TestRouter.ServeHTTP(res, req)
+		assert.Equal(http.StatusCreated, res.Code)
+
+		pd := handler.CreateProductResponse{}
+		assert.Nil(json.NewDecoder(res.Body).Decode(&pd))
+
+		pid = pd.PID
+	})
+
+	t.Run("test get product; draft", func(t *testing.T) {
+		code, _ := getProduct(nil)
+		assert.Equal(http.StatusNotFound, code)
+
+		code, _ = getProduct(at)
+		assert.Equal(http.StatusNotFound, code)
+
+		code, pd := getProduct(mt)
+		assert.Equal(http.StatusOK, code)
+		assert.Equal("Thé vert 緑茶", pd.Name)
+		assert.False(pd.Published)
+		assert.Equal("## Tea\n&lt;img src=x onerror=alert(1)> [more]())", pd.Description)
+		assert.Len(pd.Attributes, 3)
+		assert.Equal(float64(80), pd.Attributes[1].Value)
+		assert.Equal(true, pd.Attributes[2].Value)
+	})
+
+	t.Run("test order draft", func(t *testing.T) {
+		res := httptest.NewRecorder()
+		req := httptest.NewRequest("POST", "/cart/items", strings.NewReader(
+			fmt.Sprintf(`{"pid":%d,"quantity":1}`, pid),
+		))
+		req.AddCookie(mt)
+
+		TestRouter.ServeHTTP(res, req)
+		assert.Equal(http.StatusNotFound, res.Code)
+
+		res = httptest.NewRecorder()
+		req = httptest.NewRequest("POST", "/order", strings.NewReader(
+			fmt.Sprintf(`{"products":[%d]}`, pid),
+		))
+		req.AddCookie(at)
+
+		TestRouter.ServeHTTP(res, req)
+		assert.Equal(http.StatusNotFound, res.Code)
+
+		res = httptest.NewRecorder()
+		req = httptest.NewRequest("POST", "/order", strings.NewReader(`{"products":[]}`))
+		req.AddCookie(at)
+
+		TestRouter.ServeHTTP(res, req)
+		assert.Equal(http.StatusBadRequest, res.Code)
+
+		// neither request created an order.
+		res = httptest.NewRecorder()
+		req = httptest.NewRequest("GET", "/user/handlerdetail1/orders", nil)
+		req.AddCookie(at)
+
+		TestRouter.ServeHTTP(res, req)
+		assert.Equal(http.StatusOK, res.Code)
+
+		od := handler.GetUserOrdersResponse{}
+		assert.Nil(json.NewDecoder(res.Body).Decode(&od))
+		assert.Empty(od.Orders)
+	})
+
+	t.Run("test publish product", func(t *testing.T) {
+		res := httptest.NewRecorder()
+		req := httptest.NewRequest("PUT", fmt.Sprintf("/product/%d", pid), strings.NewReader(
+			`{"name":"Thé vert 緑茶","price":900,"published":true}`,
+		))
+		req.AddCookie(mt)
+
+		TestRouter.ServeHTTP(res, req)
+		assert.Equal(http.StatusOK, res.Code)
+
+		code, pd := getProduct(nil)
+		assert.Equal(http.StatusOK, code)
+		assert.True(pd.Published)
+		assert.Len(pd.Attributes, 3)
+		assert.Contains(pd.Description, "## Tea")
+
+		res = httptest.NewRecorder()
+		req = httptest.NewRequest("POST", "/cart/items", strings.NewReader(
+			fmt.Sprintf(`{"pid":%d,"quantity":1}`, pid),
+		))
+		req.AddCookie(at)
+
+		TestRouter.ServeHTTP(res, req)
+		assert.Equal(http.StatusOK, res.Code)
+	})
+
+	t.Run("test unpublish product; in cart", func(t *testing.T) {
+		res := httptest.NewRecorder()
+		req := httptest.NewRequest("PUT", fmt.Sprintf("/product/%d", pid), strings.NewReader(
+			`{"name":"Thé vert 緑茶","price":900,"published":false}`,
+		))
+		req.AddCookie(mt)
+
+		TestRouter.ServeHTTP(res, req)
+		assert.Equal(http.StatusOK, res.Code)
+
+		res = httptest.NewRecorder()
+		req = httptest.NewRequest("POST", "/cart/checkout", nil)
+		req.AddCookie(at)
+
+		TestRouter.ServeHTTP(res, req)
+		assert.Equal(http.StatusConflict, res.Code)
+
+		cart := handler.GetCartResponse{}
+		assert.Nil(json.NewDecoder(res.Body).Decode(&cart))
+		assert.Equal("product_deleted", cart.Items[0].Issue)
+	})
+}
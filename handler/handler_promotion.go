@@ -0,0 +1,340 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"simple-go-server/db"
+	"simple-go-server/model"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxDryRunItems is the greatest number of items of a dry run.
+const maxDryRunItems = 100
+
+// promotionOf returns the promotion of the request,
+// whose bare prices are in the default currency.
+func promotionOf(req CreatePromotionRequest) model.Promotion {
+	rule := req.Rule
+
+	if rule.Price != nil {
+		price := rule.Price.WithDefaultCurrency(model.DefaultCurrency)
+		rule.Price = &price
+	}
+	if rule.MinOrder != nil {
+		minOrder := rule.MinOrder.WithDefaultCurrency(model.DefaultCurrency)
+		rule.MinOrder = &minOrder
+	}
+
+	return model.Promotion{
+		Name:     strings.TrimSpace(req.Name),
+		Kind:     req.Kind,
+		Priority: req.Priority,
+		Rule:     rule,
+		Starts:   req.Starts,
+		Ends:     req.Ends,
+	}
+}
+
+func handleCreatePromotion(c *gin.Context) {
+	req := new(CreatePromotionRequest)
+
+	if err := json.NewDecoder(c.Request.Body).Decode(&req); err != nil {
+		writeMessage(c, http.StatusBadRequest, "invalid request format")
+		return
+	}
+
+	promotion := promotionOf(*req)
+
+	if err := promotion.IsValid(); err != nil {
+		writeMessage(c, http.StatusBadRequest, fmt.Sprintf("%v", err))
+		return
+	}
+
+	claims, keep := checkToken(c)
+	if !keep {
+		return
+	}
+
+	if claims.Role != model.RoleManager {
+		writeMessage(c, http.StatusUnauthorized, "general user cannot create promotion")
+		return
+	}
+
+	db, err := db.Get()
+	if err != nil {
+		writeMessage(c, http.StatusInternalServerError, "db failure")
+		return
+	}
+
+	pids := append([]int64{}, promotion.Rule.Products...)
+	if promotion.Rule.Product != 0 {
+		pids = append(pids, promotion.Rule.Product)
+	}
+
+	for _, pid := range pids {
+		product, err := db.SelectProduct(c.Request.Context(), pid)
+		if err != nil {
+			writeMessage(c, http.StatusInternalServerError, fmt.Sprintf("%v", err))
+			return
+		}
+
+		if product == nil {
+			writeMessage(c, http.StatusNotFound, "product not found")
+			return
+		}
+	}
+
+	prid, err := db.InsertPromotion(c.Request.Context(), promotion)
+	if err != nil {
+		writeMessage(c, http.StatusInternalServerError, fmt.Sprintf("%v", err))
+		return
+	}
+
+	c.JSON(
+		http.StatusCreated,
+		CreatePromotionResponse{
+			prid,
+			"create promotion success",
+		},
+	)
+}
+
+// handleGetPromotions lists all promotions, past and future, in order of evaluation to managers.
+func handleGetPromotions(c *gin.Context) {
+	claims, keep := checkToken(c)
+	if !keep {
+		return
+	}
+
+	if claims.Role != model.RoleManager {
+		writeMessage(c, http.StatusUnauthorized, "only manager can check promotions")
+		return
+	}
+
+	db, err := db.Get()
+	if err != nil {
+		writeMessage(c, http.StatusInternalServerError, "db failure")
+		return
+	}
+
+	promotions, err := db.SelectPromotions(c.Request.Context())
+	if err != nil {
+		writeMessage(c, http.StatusInternalServerError, fmt.Sprintf("%v", err))
+		return
+	}
+
+	c.JSON(
+		http.StatusOK,
+		GetPromotionsResponse{
+			promotions,
+		},
+	)
+}
+
+// handleDeletePromotion deletes a promotion, so that it applies to no more orders.
+// Orders keep the discounts of the promotion.
+func handleDeletePromotion(c *gin.Context) {
+	prid, err := strconv.Atoi(c.Param("prid"))
+	if err != nil {
+		writeMessage(c, http.StatusBadRequest, "invalid promotion id format")
+		return
+	}
+
+	claims, keep := checkToken(c)
+	if !keep {
+		return
+	}
+
+	if claims.Role != model.RoleManager {
+		writeMessage(c, http.StatusUnauthorized, "general user cannot delete promotion")
+		return
+	}
+
+	db, err := db.Get()
+	if err != nil {
+		writeMessage(c, http.StatusInternalServerError, "db failure")
+		return
+	}
+
+	promotion, err := db.SelectPromotion(c.Request.Context(), int64(prid))
+	if err != nil {
+		writeMessage(c, http.StatusInternalServerError, fmt.Sprintf("%v", err))
+		return
+	}
+
+	if promotion == nil {
+		writeMessage(c, http.StatusNotFound, "promotion not found")
+		return
+	}
+
+	if err := db.DeletePromotion(c.Request.Context(), promotion.PRID); err != nil {
+		writeMessage(c, http.StatusInternalServerError, fmt.Sprintf("%v", err))
+		return
+	}
+
+	writeMessage(c, http.StatusOK, "delete promotion success")
+}
+
+// handleDryRunPromotions evaluates promotions on items at their current prices without ordering,
+// so that managers test rules before they apply to orders.
+// The promotions of the request are evaluated if any, and the stored promotions otherwise,
+// at the date of the request, or now.
+func handleDryRunPromotions(c *gin.Context) {
+	req := new(DryRunPromotionsRequest)
+
+	if err := json.NewDecoder(c.Request.Body).Decode(&req); err != nil {
+		writeMessage(c, http.StatusBadRequest, "invalid request format")
+		return
+	}
+
+	if len(req.Items) == 0 || len(req.Items) > maxDryRunItems {
+		writeMessage(c, http.StatusBadRequest, fmt.Sprintf("dry run takes 1 to %d items", maxDryRunItems))
+		return
+	}
+
+	promotions := []model.Promotion{}
+	for i, p := range req.Promotions {
+		promotion := promotionOf(p)
+		if err := promotion.IsValid(); err != nil {
+			writeMessage(c, http.StatusBadRequest, fmt.Sprintf("promotion %d: %v", i, err))
+			return
+		}
+
+		promotions = append(promotions, promotion)
+	}
+
+	claims, keep := checkToken(c)
+	if !keep {
+		return
+	}
+
+	if claims.Role != model.RoleManager {
+		writeMessage(c, http.StatusUnauthorized, "general user cannot run promotions")
+		return
+	}
+
+	db, err := db.Get()
+	if err != nil {
+		writeMessage(c, http.StatusInternalServerError, "db failure")
+		return
+	}
+
+	type itemKey struct{ pid, vid int64 }
+	seen := map[itemKey]struct{}{}
+
+	items := []model.OrderProduct{}
+
+	for _, item := range req.Items {
+		if item.Quantity < 1 || item.Quantity > model.MaxCartQuantity {
+			writeMessage(c, http.StatusBadRequest, fmt.Sprintf("quantity must be between 1 and %d", model.MaxCartQuantity))
+			return
+		}
+
+		if _, found := seen[itemKey{item.PID, item.VID}]; found {
+			writeMessage(c, http.StatusBadRequest, "duplicate item found in request")
+			return
+		}
+		seen[itemKey{item.PID, item.VID}] = struct{}{}
+
+		product, err := db.SelectProduct(c.Request.Context(), item.PID)
+		if err != nil {
+			writeMessage(c, http.StatusInternalServerError, fmt.Sprintf("%v", err))
+			return
+		}
+
+		if product == nil || !product.Published {
+			writeMessage(c, http.StatusNotFound, "product not found")
+			return
+		}
+
+		price := product.Price
+
+		if item.VID != 0 {
+			variant, err := db.SelectVariant(c.Request.Context(), item.VID)
+			if err != nil {
+				writeMessage(c, http.StatusInternalServerError, fmt.Sprintf("%v", err))
+				return
+			}
+
+			if variant == nil || variant.PID != product.PID {
+				writeMessage(c, http.StatusNotFound, "variant not found")
+				return
+			}
+
+			price = variant.UnitPrice(product)
+		} else {
+			hasVariants, err := db.HasVariants(c.Request.Context(), item.PID)
+			if err != nil {
+				writeMessage(c, http.StatusInternalServerError, fmt.Sprintf("%v", err))
+				return
+			}
+
+			if hasVariants {
+				writeMessage(c, http.StatusBadRequest, "vid required for product with variants")
+				return
+			}
+		}
+
+		if len(items) > 0 && items[0].Price.Currency != price.Currency {
+			writeMessage(c, http.StatusBadRequest, "products of an order must be in a single currency")
+			return
+		}
+
+		items = append(items, model.OrderProduct{PID: item.PID, VID: item.VID, Quantity: item.Quantity, Price: price})
+	}
+
+	if len(promotions) == 0 {
+		if promotions, err = db.SelectPromotions(c.Request.Context()); err != nil {
+			writeMessage(c, http.StatusInternalServerError, fmt.Sprintf("%v", err))
+			return
+		}
+	}
+
+	at := time.Now()
+	if req.Date != 0 {
+		at = time.Unix(req.Date, 0)
+	}
+
+	results := model.EvaluatePromotions(promotions, items, at)
+
+	currency := items[0].Price.Currency
+	subtotals := []model.Money{}
+	for _, item := range items {
+		subtotals = append(subtotals, item.Subtotal())
+	}
+
+	amounts := []model.Money{}
+	for _, result := range results {
+		for _, d := range result.Discounts {
+			amounts = append(amounts, d.Amount)
+		}
+	}
+
+	subtotal, err := model.Sum(currency, subtotals...)
+	if err != nil {
+		writeMessage(c, http.StatusInternalServerError, fmt.Sprintf("%v", err))
+		return
+	}
+
+	discount, err := model.Sum(currency, amounts...)
+	if err != nil {
+		writeMessage(c, http.StatusInternalServerError, fmt.Sprintf("%v", err))
+		return
+	}
+
+	c.JSON(
+		http.StatusOK,
+		DryRunPromotionsResponse{
+			Items:    items,
+			Subtotal: subtotal,
+			Results:  results,
+			Discount: discount,
+			Total:    model.NewMoney(subtotal.Amount-discount.Amount, currency),
+		},
+	)
+}
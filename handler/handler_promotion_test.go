@@ -0,0 +1,194 @@
+package handler_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"simple-go-server/handler"
+	"simple-go-server/model"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHandlePromotion(t *testing.T) {
+	assert := assert.New(t)
+
+	var at, mt *http.Cookie
+	pids := []int64{}
+	prids := []int64{}
+
+	// send sends the request with the cookie and returns the response.
+	send := func(k *http.Cookie, method, url, body string) *httptest.ResponseRecorder {
+		res := httptest.NewRecorder()
+		req := httptest.NewRequest(method, url, strings.NewReader(body))
+		req.AddCookie(k)
+
+		TestRouter.ServeHTTP(res, req)
+
+		return res
+	}
+
+	// dryRun evaluates the promotions of the body and returns the evaluation.
+	dryRun := func(body string) handler.DryRunPromotionsResponse {
+		res := send(mt, "POST", "/promotions/dry-run", body)
+		assert.Equal(http.StatusOK, res.Code)
+
+		dr := handler.DryRunPromotionsResponse{}
+		assert.Nil(json.NewDecoder(res.Body).Decode(&dr))
+
+		return dr
+	}
+
+	items := func() string {
+		return fmt.Sprintf(`[{"pid":%d,"quantity":2},{"pid":%d,"quantity":1}]`, pids[0], pids[1])
+	}
+
+	t.Run("test create user", func(t *testing.T) {
+		res := httptest.NewRecorder()
+		req := httptest.NewRequest("POST", "/user", strings.NewReader(
+			`{"user_id":"handlerpromo1","role":"user","password":"hpr1234++"}`,
+		))
+
+		TestRouter.ServeHTTP(res, req)
+		assert.Equal(http.StatusCreated, res.Code)
+
+		at = login(t, `{"user_id":"handlerpromo1","password":"hpr1234++"}`)
+		mt = login(t, `{"user_id":"master01","password":"pwmaster01++"}`)
+
+		for _, body := range []string{
+			`{"name":"promo candle","price":1000}`,
+			`{"name":"promo matches","price":300}`,
+		} {
+			res := send(mt, "POST", "/product", body)
+			assert.Equal(http.StatusCreated, res.Code)
+
+			pd := handler.CreateProductResponse{}
+			assert.Nil(json.NewDecoder(res.Body).Decode(&pd))
+
+			pids = append(pids, pd.PID)
+		}
+	})
+
+	t.Run("test create promotion; not manager", func(t *testing.T) {
+		res := send(at, "POST", "/promotion", `{"name":"bogo","kind":"buy_x_get_y","rule":{"buy":1,"get":1}}`)
+		assert.Equal(http.StatusUnauthorized, res.Code)
+	})
+
+	t.Run("test create promotion; invalid", func(t *testing.T) {
+		for _, body := range []string{
+			`{"name":"","kind":"buy_x_get_y","rule":{"buy":1,"get":1}}`,
+			`{"name":"bogo","kind":"buy_x_get_y","rule":{"buy":1}}`,
+			`{"name":"bundle","kind":"bundle","rule":{"products":[1,2]}}`,
+			`{"name":"tiers","kind":"tiered","rule":{"tiers":[{"quantity":5,"percent":10},{"quantity":3,"percent":20}]}}`,
+			`{"name":"gift","kind":"free_item","rule":{"product":1}}`,
+		} {
+			res := send(mt, "POST", "/promotion", body)
+			assert.Equal(http.StatusBadRequest, res.Code, body)
+		}
+
+		res := send(mt, "POST", "/promotion", `{"name":"gift","kind":"free_item","rule":{"product":987654,"min_order":2000}}`)
+		assert.Equal(http.StatusNotFound, res.Code)
+	})
+
+	t.Run("test create promotion", func(t *testing.T) {
+		for _, body := range []string{
+			fmt.Sprintf(`{"name":"candle bogo","kind":"buy_x_get_y","rule":{"products":[%d],"buy":1,"get":1}}`, pids[0]),
+			fmt.Sprintf(`{"name":"free matches","kind":"free_item","priority":1,"rule":{"product":%d,"min_order":2000}}`, pids[1]),
+		} {
+			res := send(mt, "POST", "/promotion", body)
+			assert.Equal(http.StatusCreated, res.Code, body)
+
+			pd := handler.CreatePromotionResponse{}
+			assert.Nil(json.NewDecoder(res.Body).Decode(&pd))
+
+			prids = append(prids, pd.PRID)
+		}
+
+		res := send(mt, "GET", "/promotions", "")
+		assert.Equal(http.StatusOK, res.Code)
+
+		pd := handler.GetPromotionsResponse{}
+		assert.Nil(json.NewDecoder(res.Body).Decode(&pd))
+		assert.Len(pd.Promotions, 2)
+		assert.Equal(model.NewMoney(2000, "USD"), *pd.Promotions[1].Rule.MinOrder)
+
+		res = send(at, "GET", "/promotions", "")
+		assert.Equal(http.StatusUnauthorized, res.Code)
+	})
+
+	t.Run("test dry run", func(t *testing.T) {
+		res := send(at, "POST", "/promotions/dry-run", fmt.Sprintf(`{"items":%s}`, items()))
+		assert.Equal(http.StatusUnauthorized, res.Code)
+
+		res = send(mt, "POST", "/promotions/dry-run", `{"items":[]}`)
+		assert.Equal(http.StatusBadRequest, res.Code)
+
+		dr := dryRun(fmt.Sprintf(`{"items":%s}`, items()))
+		assert.Equal(model.NewMoney(2300, "USD"), dr.Subtotal)
+		assert.Equal(model.NewMoney(1300, "USD"), dr.Discount)
+		assert.Equal(model.NewMoney(1000, "USD"), dr.Total)
+		assert.Len(dr.Results, 2)
+		assert.True(dr.Results[0].Applied)
+		assert.True(dr.Results[1].Applied)
+
+		// the free item is below the minimum without the second candle.
+		dr = dryRun(fmt.Sprintf(`{"items":[{"pid":%d,"quantity":1},{"pid":%d,"quantity":1}]}`, pids[0], pids[1]))
+		assert.Equal(model.NewMoney(0, "USD"), dr.Discount)
+		assert.Equal("needs 2 eligible items, the order has 1", dr.Results[0].Explanation)
+		assert.Equal("order subtotal $13.00 is below $20.00", dr.Results[1].Explanation)
+
+		// unsaved rules are evaluated instead of the stored promotions.
+		dr = dryRun(fmt.Sprintf(`{"items":%s,"promotions":[{"name":"half","kind":"tiered","rule":{"products":[%d],"tiers":[{"quantity":2,"percent":50}]}}]}`,
+			items(), pids[0]))
+		assert.Len(dr.Results, 1)
+		assert.Equal(model.NewMoney(1000, "USD"), dr.Discount)
+	})
+
+	t.Run("test checkout cart; promotions", func(t *testing.T) {
+		res := send(at, "POST", "/cart/items", fmt.Sprintf(`{"pid":%d,"quantity":2}`, pids[0]))
+		assert.Equal(http.StatusOK, res.Code)
+
+		res = send(at, "POST", "/cart/items", fmt.Sprintf(`{"pid":%d,"quantity":1}`, pids[1]))
+		assert.Equal(http.StatusOK, res.Code)
+
+		res = send(at, "POST", "/cart/checkout", "")
+		assert.Equal(http.StatusCreated, res.Code)
+
+		cd := handler.CreateOrderResponse{}
+		assert.Nil(json.NewDecoder(res.Body).Decode(&cd))
+
+		res = send(at, "GET", fmt.Sprintf("/order/%d", cd.OID), "")
+		assert.Equal(http.StatusOK, res.Code)
+
+		od := handler.GetOrderResponse{}
+		assert.Nil(json.NewDecoder(res.Body).Decode(&od))
+		assert.Equal(model.NewMoney(2300, "USD"), od.Subtotal)
+		assert.Equal(model.NewMoney(1000, "USD"), od.Total)
+		assert.Len(od.Discounts, 2)
+		assert.Equal("candle bogo: buy 1 get 1 free", od.Discounts[0].Description)
+		assert.Equal("free matches: free item over $20.00", od.Discounts[1].Description)
+		assert.Equal(model.DiscountPromotion, od.Discounts[1].Source)
+		assert.Equal(fmt.Sprint(prids[1]), od.Discounts[1].Ref)
+	})
+
+	t.Run("test delete promotion", func(t *testing.T) {
+		res := send(at, "DELETE", fmt.Sprintf("/promotion/%d", prids[0]), "")
+		assert.Equal(http.StatusUnauthorized, res.Code)
+
+		for _, prid := range prids {
+			res = send(mt, "DELETE", fmt.Sprintf("/promotion/%d", prid), "")
+			assert.Equal(http.StatusOK, res.Code)
+		}
+
+		res = send(mt, "DELETE", fmt.Sprintf("/promotion/%d", prids[0]), "")
+		assert.Equal(http.StatusNotFound, res.Code)
+
+		dr := dryRun(fmt.Sprintf(`{"items":%s}`, items()))
+		assert.Empty(dr.Results)
+		assert.Equal(model.NewMoney(2300, "USD"), dr.Total)
+	})
+}
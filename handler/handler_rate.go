@@ -0,0 +1,228 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"simple-go-server/db"
+	"simple-go-server/model"
+
+	"github.com/gin-gonic/gin"
+)
+
+// priceConverter converts prices to the currency of the currency query
+// at the rates effective at a time, looking up the rate of each currency once.
+// Without the query, prices are kept in their own currency.
+type priceConverter struct {
+	quote model.Currency
+	at    time.Time
+	rates map[model.Currency]*model.ExchangeRate
+}
+
+// newPriceConverter returns the converter of the currency query at the current rates.
+func newPriceConverter(c *gin.Context) (*priceConverter, bool) {
+	quote := model.Currency(c.Query("currency"))
+
+	if quote != "" {
+		if err := quote.IsValid(); err != nil {
+			writeMessage(c, http.StatusBadRequest, fmt.Sprintf("%v", err))
+			return nil, false
+		}
+	}
+
+	return &priceConverter{quote, time.Now(), map[model.Currency]*model.ExchangeRate{}}, true
+}
+
+// rate returns the rate from the currency to the currency of the query,
+// or nil if they are the same, writing the error response if no rate is effective.
+func (p *priceConverter) rate(c *gin.Context, db *db.Database, base model.Currency) (*model.ExchangeRate, bool) {
+	if p.quote == "" || base == p.quote {
+		return nil, true
+	}
+
+	if r, found := p.rates[base]; found {
+		return r, true
+	}
+
+	r, err := db.SelectEffectiveExchangeRate(c.Request.Context(), base, p.quote, p.at)
+	if err != nil {
+		writeMessage(c, http.StatusInternalServerError, fmt.Sprintf("%v", err))
+		return nil, false
+	}
+
+	if r == nil {
+		writeMessage(c, http.StatusBadRequest, fmt.Sprintf("no exchange rate from %s to %s", base, p.quote))
+		return nil, false
+	}
+
+	p.rates[base] = r
+
+	return r, true
+}
+
+// convert converts the prices in place.
+func (p *priceConverter) convert(c *gin.Context, db *db.Database, prices ...*model.Money) bool {
+	for _, price := range prices {
+		r, keep := p.rate(c, db, price.Currency)
+		if !keep {
+			return false
+		}
+
+		if r == nil {
+			continue
+		}
+
+		converted, err := r.Convert(*price)
+		if err != nil {
+			writeMessage(c, http.StatusInternalServerError, fmt.Sprintf("%v", err))
+			return false
+		}
+
+		*price = converted
+	}
+
+	return true
+}
+
+// used returns the rates the prices were converted at, by their currency.
+func (p *priceConverter) used() []model.ExchangeRate {
+	rates := []model.ExchangeRate{}
+	for _, r := range p.rates {
+		rates = append(rates, *r)
+	}
+
+	sort.Slice(rates, func(i, j int) bool {
+		return rates[i].Base < rates[j].Base
+	})
+
+	return rates
+}
+
+func handleCreateExchangeRate(c *gin.Context) {
+	req := new(CreateExchangeRateRequest)
+
+	if err := json.NewDecoder(c.Request.Body).Decode(&req); err != nil {
+		writeMessage(c, http.StatusBadRequest, "invalid request format")
+		return
+	}
+
+	rate := model.ExchangeRate{
+		Base:      req.Base,
+		Quote:     req.Quote,
+		Rate:      req.Rate,
+		Effective: req.Effective,
+	}
+
+	if rate.Effective == 0 {
+		rate.Effective = time.Now().Unix()
+	}
+
+	if err := rate.IsValid(); err != nil {
+		writeMessage(c, http.StatusBadRequest, fmt.Sprintf("%v", err))
+		return
+	}
+
+	claims, keep := checkToken(c)
+	if !keep {
+		return
+	}
+
+	if claims.Role != model.RoleManager {
+		writeMessage(c, http.StatusUnauthorized, "general user cannot register exchange rate")
+		return
+	}
+
+	d, err := db.Get()
+	if err != nil {
+		writeMessage(c, http.StatusInternalServerError, "db failure")
+		return
+	}
+
+	rid, err := d.InsertExchangeRate(c.Request.Context(), rate)
+	if err == db.ErrExchangeRateTaken {
+		writeMessage(c, http.StatusConflict, "exchange rate of the pair already effective from the date")
+		return
+	}
+	if err != nil {
+		writeMessage(c, http.StatusInternalServerError, fmt.Sprintf("%v", err))
+		return
+	}
+
+	c.JSON(
+		http.StatusCreated,
+		CreateExchangeRateResponse{
+			rid,
+			"register exchange rate success",
+		},
+	)
+}
+
+// handleGetExchangeRates lists all rates, past and future, to anyone.
+func handleGetExchangeRates(c *gin.Context) {
+	db, err := db.Get()
+	if err != nil {
+		writeMessage(c, http.StatusInternalServerError, "db failure")
+		return
+	}
+
+	rates, err := db.SelectExchangeRates(c.Request.Context())
+	if err != nil {
+		writeMessage(c, http.StatusInternalServerError, fmt.Sprintf("%v", err))
+		return
+	}
+
+	c.JSON(
+		http.StatusOK,
+		GetExchangeRatesResponse{
+			rates,
+		},
+	)
+}
+
+// handleDeleteExchangeRate deletes a rate, e.g. one entered by mistake.
+// Orders keep the rate they were placed at.
+func handleDeleteExchangeRate(c *gin.Context) {
+	rid, err := strconv.Atoi(c.Param("rid"))
+	if err != nil {
+		writeMessage(c, http.StatusBadRequest, "invalid exchange rate id format")
+		return
+	}
+
+	claims, keep := checkToken(c)
+	if !keep {
+		return
+	}
+
+	if claims.Role != model.RoleManager {
+		writeMessage(c, http.StatusUnauthorized, "general user cannot delete exchange rate")
+		return
+	}
+
+	db, err := db.Get()
+	if err != nil {
+		writeMessage(c, http.StatusInternalServerError, "db failure")
+		return
+	}
+
+	rate, err := db.SelectExchangeRate(c.Request.Context(), int64(rid))
+	if err != nil {
+		writeMessage(c, http.StatusInternalServerError, fmt.Sprintf("%v", err))
+		return
+	}
+
+	if rate == nil {
+		writeMessage(c, http.StatusNotFound, "exchange rate not found")
+		return
+	}
+
+	if err := db.DeleteExchangeRate(c.Request.Context(), rate.RID); err != nil {
+		writeMessage(c, http.StatusInternalServerError, fmt.Sprintf("%v", err))
+		return
+	}
+
+	writeMessage(c, http.StatusOK, "delete exchange rate success")
+}
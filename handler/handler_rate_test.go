@@ -0,0 +1,220 @@
+package handler_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"simple-go-server/handler"
+	"simple-go-server/model"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHandleExchangeRate(t *testing.T) {
+	assert := assert.New(t)
+
+	var at, mt *http.Cookie
+	var pid, rid, oid int64
+
+	effective := time.Now().Add(-time.Hour).Unix()
+
+	// createRate registers the rate of the body and returns the response.
+	createRate := func(k *http.Cookie, body string) *httptest.ResponseRecorder {
+		res := httptest.NewRecorder()
+		req := httptest.NewRequest("POST", "/exchange-rate", strings.NewReader(body))
+		req.AddCookie(k)
+
+		TestRouter.ServeHTTP(res, req)
+
+		return res
+	}
+
+	// getOrder returns the response code and the order seen in the currency.
+	getOrder := func(currency string) (int, handler.GetOrderResponse) {
+		res := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", fmt.Sprintf("/order/%d?currency=%s", oid, currency), nil)
+		req.AddCookie(at)
+
+		TestRouter.ServeHTTP(res, req)
+
+		od := handler.GetOrderResponse{}
+		if res.Code == http.StatusOK {
+			assert.Nil(json.NewDecoder(res.Body).Decode(&od))
+		}
+
+		return res.Code, od
+	}
+
+	t.Run("test create user", func(t *testing.T) {
+		res := httptest.NewRecorder()
+		req := httptest.NewRequest("POST", "/user", strings.NewReader(
+			`{"user_id":"handlerrate1","role":"user","password":"hra1234++"}`,
+		))
+
+		TestRouter.ServeHTTP(res, req)
+		assert.Equal(http.StatusCreated, res.Code)
+
+		at = login(t, `{"user_id":"handlerrate1","password":"hra1234++"}`)
+		mt = login(t, `{"user_id":"master01","password":"pwmaster01++"}`)
+
+		res = httptest.NewRecorder()
+		req = httptest.NewRequest("POST", "/product", strings.NewReader(`{"name":"rate lamp","price":1999}`))
+		req.AddCookie(mt)
+
+		TestRouter.ServeHTTP(res, req)
+		assert.Equal(http.StatusCreated, res.Code)
+
+		pd := handler.CreateProductResponse{}
+		assert.Nil(json.NewDecoder(res.Body).Decode(&pd))
+
+		pid = pd.PID
+	})
+
+	t.Run("test create exchange rate; not manager", func(t *testing.T) {
+		res := createRate(at, `{"base":"USD","quote":"EUR","rate":"0.9215"}`)
+		assert.Equal(http.StatusUnauthorized, res.Code)
+	})
+
+	t.Run("test create exchange rate; invalid", func(t *testing.T) {
+		for _, body := range []string{
+			`{"base":"USD","quote":"USD","rate":"1"}`,
+			`{"base":"USD","quote":"XYZ","rate":"1.5"}`,
+			`{"base":"USD","quote":"EUR","rate":"-0.9"}`,
+			`{"base":"USD","quote":"EUR","rate":"0"}`,
+		} {
+			res := createRate(mt, body)
+			assert.Equal(http.StatusBadRequest, res.Code, body)
+		}
+	})
+
+	t.Run("test create exchange rate", func(t *testing.T) {
+		res := createRate(mt, fmt.Sprintf(`{"base":"USD","quote":"EUR","rate":"0.9215","effective":%d}`, effective))
+		assert.Equal(http.StatusCreated, res.Code)
+
+		rd := handler.CreateExchangeRateResponse{}
+		assert.Nil(json.NewDecoder(res.Body).Decode(&rd))
+
+		rid = rd.RID
+
+		res = createRate(mt, fmt.Sprintf(`{"base":"USD","quote":"EUR","rate":"0.93","effective":%d}`, effective))
+		assert.Equal(http.StatusConflict, res.Code)
+
+		// a rate effective tomorrow is not used yet.
+		res = createRate(mt, fmt.Sprintf(`{"base":"USD","quote":"EUR","rate":"0.5","effective":%d}`, time.Now().Add(24*time.Hour).Unix()))
+		assert.Equal(http.StatusCreated, res.Code)
+	})
+
+	t.Run("test get exchange rates", func(t *testing.T) {
+		res := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", "/exchange-rates", nil)
+
+		TestRouter.ServeHTTP(res, req)
+		assert.Equal(http.StatusOK, res.Code)
+
+		rd := handler.GetExchangeRatesResponse{}
+		assert.Nil(json.NewDecoder(res.Body).Decode(&rd))
+		assert.Len(rd.Rates, 2)
+		assert.Equal(rid, rd.Rates[1].RID)
+	})
+
+	t.Run("test get product; currency", func(t *testing.T) {
+		res := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", fmt.Sprintf("/product/%d?currency=EUR", pid), nil)
+
+		TestRouter.ServeHTTP(res, req)
+		assert.Equal(http.StatusOK, res.Code)
+
+		pd := handler.GetProductResponse{}
+		assert.Nil(json.NewDecoder(res.Body).Decode(&pd))
+		assert.Equal(model.NewMoney(1842, "EUR"), pd.Price)
+		assert.Len(pd.ExchangeRates, 1)
+		assert.Equal("0.9215", pd.ExchangeRates[0].Rate)
+
+		for _, currency := range []string{"JPY", "eur"} {
+			res = httptest.NewRecorder()
+			req = httptest.NewRequest("GET", fmt.Sprintf("/product/%d?currency=%s", pid, currency), nil)
+
+			TestRouter.ServeHTTP(res, req)
+			assert.Equal(http.StatusBadRequest, res.Code, currency)
+		}
+	})
+
+	t.Run("test checkout cart; currency", func(t *testing.T) {
+		res := httptest.NewRecorder()
+		req := httptest.NewRequest("POST", "/cart/items", strings.NewReader(
+			fmt.Sprintf(`{"pid":%d,"quantity":2}`, pid),
+		))
+		req.AddCookie(at)
+
+		TestRouter.ServeHTTP(res, req)
+		assert.Equal(http.StatusOK, res.Code)
+
+		res = httptest.NewRecorder()
+		req = httptest.NewRequest("POST", "/cart/checkout?currency=JPY", nil)
+		req.AddCookie(at)
+
+		TestRouter.ServeHTTP(res, req)
+		assert.Equal(http.StatusBadRequest, res.Code)
+
+		res = httptest.NewRecorder()
+		req = httptest.NewRequest("POST", "/cart/checkout?currency=EUR", nil)
+		req.AddCookie(at)
+
+		TestRouter.ServeHTTP(res, req)
+		assert.Equal(http.StatusCreated, res.Code)
+
+		od := handler.CreateOrderResponse{}
+		assert.Nil(json.NewDecoder(res.Body).Decode(&od))
+
+		oid = od.OID
+	})
+
+	t.Run("test get order; currency", func(t *testing.T) {
+		code, od := getOrder("")
+		assert.Equal(http.StatusOK, code)
+		assert.Equal(model.NewMoney(3998, "USD"), od.Total)
+		assert.NotNil(od.ExchangeRate)
+		assert.Equal("0.9215", od.ExchangeRate.Rate)
+		assert.Empty(od.ExchangeRates)
+
+		code, od = getOrder("EUR")
+		assert.Equal(http.StatusOK, code)
+		assert.Equal(model.NewMoney(1842, "EUR"), od.Items[0].Price)
+		assert.Equal(model.NewMoney(3684, "EUR"), od.Total)
+
+		code, _ = getOrder("JPY")
+		assert.Equal(http.StatusBadRequest, code)
+	})
+
+	t.Run("test delete exchange rate", func(t *testing.T) {
+		res := httptest.NewRecorder()
+		req := httptest.NewRequest("DELETE", fmt.Sprintf("/exchange-rate/%d", rid), nil)
+		req.AddCookie(at)
+
+		TestRouter.ServeHTTP(res, req)
+		assert.Equal(http.StatusUnauthorized, res.Code)
+
+		res = httptest.NewRecorder()
+		req = httptest.NewRequest("DELETE", fmt.Sprintf("/exchange-rate/%d", rid), nil)
+		req.AddCookie(mt)
+
+		TestRouter.ServeHTTP(res, req)
+		assert.Equal(http.StatusOK, res.Code)
+
+		// the order keeps the rate it was placed at.
+		code, od := getOrder("EUR")
+		assert.Equal(http.StatusOK, code)
+		assert.Equal(model.NewMoney(3684, "EUR"), od.Total)
+
+		res = httptest.NewRecorder()
+		req = httptest.NewRequest("GET", fmt.Sprintf("/product/%d?currency=EUR", pid), nil)
+
+		TestRouter.ServeHTTP(res, req)
+		assert.Equal(http.StatusBadRequest, res.Code)
+	})
+}
@@ -0,0 +1,399 @@
+package handler
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"simple-go-server/db"
+	"simple-go-server/model"
+	"simple-go-server/token"
+	"simple-go-server/totp"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	defaultTOTPIssuer = "simple-go-server"
+
+	recoveryCodeCount  = 10
+	recoveryCodeLength = 10
+	// recoveryCodeAlphabet leaves out characters easily confused with each other.
+	recoveryCodeAlphabet = "abcdefghjkmnpqrstuvwxyz23456789"
+)
+
+// requireManagerTOTP returns true if REQUIRE_MANAGER_2FA requires
+// every manager to log in with a second factor.
+func requireManagerTOTP() bool {
+	required, _ := strconv.ParseBool(os.Getenv("REQUIRE_MANAGER_2FA"))
+	return required
+}
+
+func totpIssuer() string {
+	if v := os.Getenv("TOTP_ISSUER"); v != "" {
+		return v
+	}
+	return defaultTOTPIssuer
+}
+
+// newRecoveryCodes returns random recovery codes shown to the user once
+// and their hashes stored in the database.
+func newRecoveryCodes() ([]string, []string, error) {
+	codes := make([]string, recoveryCodeCount)
+	hashes := make([]string, recoveryCodeCount)
+
+	b := make([]byte, recoveryCodeLength)
+	for i := range codes {
+		if _, err := rand.Read(b); err != nil {
+			return nil, nil, err
+		}
+
+		code := make([]byte, recoveryCodeLength)
+		for j := range b {
+			code[j] = recoveryCodeAlphabet[int(b[j])%len(recoveryCodeAlphabet)]
+		}
+
+		half := recoveryCodeLength / 2
+		codes[i] = string(code[:half]) + "-" + string(code[half:])
+		hashes[i] = hashRecoveryCode(codes[i])
+	}
+
+	return codes, hashes, nil
+}
+
+func hashRecoveryCode(code string) string {
+	normalized := strings.ReplaceAll(strings.ToLower(strings.TrimSpace(code)), "-", "")
+
+	h := sha256.Sum256([]byte(normalized))
+	return hex.EncodeToString(h[:])
+}
+
+// enrollTOTP sets a new pending secret of the user
+// and responds with the secret, its otpauth uri and the recovery codes.
+func enrollTOTP(c *gin.Context, db *db.Database, user *model.User) {
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		writeMessage(c, http.StatusInternalServerError, "totp secret failure")
+		return
+	}
+
+	codes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		writeMessage(c, http.StatusInternalServerError, "recovery code failure")
+		return
+	}
+
+	if err := db.InsertTOTP(c.Request.Context(), user.UID, secret, hashes); err != nil {
+		writeMessage(c, http.StatusInternalServerError, fmt.Sprintf("%v", err))
+		return
+	}
+
+	c.JSON(
+		http.StatusCreated,
+		EnrollTOTPResponse{
+			Secret:        secret,
+			URI:           totp.URI(totpIssuer(), user.UserID, secret),
+			RecoveryCodes: codes,
+			Message:       "verify a code to enable the second factor",
+		},
+	)
+}
+
+// verifySecondFactor checks the totp code, or the recovery code if given.
+// A pending secret is enabled by its first valid code.
+func verifySecondFactor(ctx context.Context, db *db.Database, tf *model.TOTP, req SecondFactorRequest) (bool, error) {
+	if req.RecoveryCode != "" {
+		if !tf.Enabled {
+			return false, nil
+		}
+		return db.UseRecoveryCode(ctx, tf.UID, hashRecoveryCode(req.RecoveryCode))
+	}
+
+	step, ok := totp.Validate(tf.Secret, req.Code, time.Now(), tf.LastStep)
+	if !ok {
+		return false, nil
+	}
+
+	if !tf.Enabled {
+		return true, db.EnableTOTP(ctx, tf.UID, step)
+	}
+
+	return db.UseTOTPStep(ctx, tf.UID, step)
+}
+
+func handleLoginSecondFactor(c *gin.Context) {
+	req := SecondFactorRequest{}
+
+	if err := json.NewDecoder(c.Request.Body).Decode(&req); err != nil {
+		writeMessage(c, http.StatusBadRequest, "invalid request format")
+		return
+	}
+
+	claims, user, keep := verifyToken(c, token.PRE_AUTH_TOKEN_NAME, token.PurposePreAuth)
+	if !keep {
+		return
+	}
+	setUser(c, claims)
+
+	db, err := db.Get()
+	if err != nil {
+		writeMessage(c, http.StatusInternalServerError, "db failure")
+		return
+	}
+
+	ip := c.ClientIP()
+
+	wait, err := loginRetryAfter(c.Request.Context(), db, user.UserID, ip)
+	if err != nil {
+		writeMessage(c, http.StatusInternalServerError, fmt.Sprintf("%v", err))
+		return
+	}
+
+	if wait > 0 {
+		loginFailures.Inc("locked")
+		c.Header("Retry-After", ceilSeconds(wait))
+		writeMessage(c, http.StatusTooManyRequests, "too many failed login attempts")
+		return
+	}
+
+	tf, err := db.SelectTOTP(c.Request.Context(), user.UID)
+	if err != nil {
+		writeMessage(c, http.StatusInternalServerError, fmt.Sprintf("%v", err))
+		return
+	}
+
+	if tf == nil {
+		writeMessage(c, http.StatusBadRequest, "second factor not enrolled")
+		return
+	}
+
+	verified, err := verifySecondFactor(c.Request.Context(), db, tf, req)
+	if err != nil {
+		writeMessage(c, http.StatusInternalServerError, fmt.Sprintf("%v", err))
+		return
+	}
+
+	if !verified {
+		loginFailures.Inc("wrong_second_factor")
+
+		if err := recordLoginFailure(c.Request.Context(), db, user.UserID, ip); err != nil {
+			writeMessage(c, http.StatusInternalServerError, fmt.Sprintf("%v", err))
+			return
+		}
+
+		if err := db.InsertLoginHistory(c.Request.Context(), user.UID, ip, false); err != nil {
+			writeMessage(c, http.StatusInternalServerError, fmt.Sprintf("%v", err))
+			return
+		}
+
+		writeMessage(c, http.StatusUnauthorized, "invalid second factor")
+		return
+	}
+
+	c.SetCookie(token.PRE_AUTH_TOKEN_NAME, "", -1, "/login", "localhost", false, true)
+
+	completeLogin(c, db, user)
+}
+
+// handleLoginEnrollTOTP enrolls the second factor of a manager
+// who is required to have one but has not enrolled yet.
+func handleLoginEnrollTOTP(c *gin.Context) {
+	claims, user, keep := verifyToken(c, token.PRE_AUTH_TOKEN_NAME, token.PurposePreAuth)
+	if !keep {
+		return
+	}
+	setUser(c, claims)
+
+	if user.Role != model.RoleManager || !requireManagerTOTP() {
+		writeMessage(c, http.StatusForbidden, "second factor enrollment not required")
+		return
+	}
+
+	db, err := db.Get()
+	if err != nil {
+		writeMessage(c, http.StatusInternalServerError, "db failure")
+		return
+	}
+
+	tf, err := db.SelectTOTP(c.Request.Context(), user.UID)
+	if err != nil {
+		writeMessage(c, http.StatusInternalServerError, fmt.Sprintf("%v", err))
+		return
+	}
+
+	if tf != nil && tf.Enabled {
+		writeMessage(c, http.StatusConflict, "second factor already enabled")
+		return
+	}
+
+	enrollTOTP(c, db, user)
+}
+
+func handleEnrollTOTP(c *gin.Context) {
+	userID := c.Param("user_id")
+
+	claims, keep := checkToken(c)
+	if !keep {
+		return
+	}
+
+	if claims.UserID != userID {
+		writeMessage(c, http.StatusUnauthorized, "invalid access token for this user")
+		return
+	}
+
+	db, err := db.Get()
+	if err != nil {
+		writeMessage(c, http.StatusInternalServerError, "db failure")
+		return
+	}
+
+	user, err := db.SelectUserByUID(c.Request.Context(), claims.UID)
+	if err != nil {
+		writeMessage(c, http.StatusInternalServerError, fmt.Sprintf("%v", err))
+		return
+	}
+
+	if user == nil {
+		writeMessage(c, http.StatusNotFound, "user not found")
+		return
+	}
+
+	tf, err := db.SelectTOTP(c.Request.Context(), user.UID)
+	if err != nil {
+		writeMessage(c, http.StatusInternalServerError, fmt.Sprintf("%v", err))
+		return
+	}
+
+	if tf != nil && tf.Enabled {
+		writeMessage(c, http.StatusConflict, "second factor already enabled")
+		return
+	}
+
+	enrollTOTP(c, db, user)
+}
+
+func handleVerifyTOTP(c *gin.Context) {
+	userID := c.Param("user_id")
+
+	req := SecondFactorRequest{}
+	if err := json.NewDecoder(c.Request.Body).Decode(&req); err != nil {
+		writeMessage(c, http.StatusBadRequest, "invalid request format")
+		return
+	}
+
+	claims, keep := checkToken(c)
+	if !keep {
+		return
+	}
+
+	if claims.UserID != userID {
+		writeMessage(c, http.StatusUnauthorized, "invalid access token for this user")
+		return
+	}
+
+	db, err := db.Get()
+	if err != nil {
+		writeMessage(c, http.StatusInternalServerError, "db failure")
+		return
+	}
+
+	tf, err := db.SelectTOTP(c.Request.Context(), claims.UID)
+	if err != nil {
+		writeMessage(c, http.StatusInternalServerError, fmt.Sprintf("%v", err))
+		return
+	}
+
+	if tf == nil {
+		writeMessage(c, http.StatusNotFound, "second factor not enrolled")
+		return
+	}
+
+	if tf.Enabled {
+		writeMessage(c, http.StatusConflict, "second factor already enabled")
+		return
+	}
+
+	verified, err := verifySecondFactor(c.Request.Context(), db, tf, SecondFactorRequest{Code: req.Code})
+	if err != nil {
+		writeMessage(c, http.StatusInternalServerError, fmt.Sprintf("%v", err))
+		return
+	}
+
+	if !verified {
+		writeMessage(c, http.StatusUnauthorized, "invalid second factor")
+		return
+	}
+
+	writeMessage(c, http.StatusOK, "second factor enabled")
+}
+
+func handleDeleteTOTP(c *gin.Context) {
+	userID := c.Param("user_id")
+
+	req := SecondFactorRequest{}
+	if err := json.NewDecoder(c.Request.Body).Decode(&req); err != nil {
+		writeMessage(c, http.StatusBadRequest, "invalid request format")
+		return
+	}
+
+	claims, keep := checkToken(c)
+	if !keep {
+		return
+	}
+
+	if claims.UserID != userID {
+		writeMessage(c, http.StatusUnauthorized, "invalid access token for this user")
+		return
+	}
+
+	if claims.Role == model.RoleManager && requireManagerTOTP() {
+		writeMessage(c, http.StatusForbidden, "manager must keep the second factor")
+		return
+	}
+
+	db, err := db.Get()
+	if err != nil {
+		writeMessage(c, http.StatusInternalServerError, "db failure")
+		return
+	}
+
+	tf, err := db.SelectTOTP(c.Request.Context(), claims.UID)
+	if err != nil {
+		writeMessage(c, http.StatusInternalServerError, fmt.Sprintf("%v", err))
+		return
+	}
+
+	if tf == nil {
+		writeMessage(c, http.StatusNotFound, "second factor not enrolled")
+		return
+	}
+
+	if tf.Enabled {
+		verified, err := verifySecondFactor(c.Request.Context(), db, tf, req)
+		if err != nil {
+			writeMessage(c, http.StatusInternalServerError, fmt.Sprintf("%v", err))
+			return
+		}
+
+		if !verified {
+			writeMessage(c, http.StatusUnauthorized, "invalid second factor")
+			return
+		}
+	}
+
+	if err := db.DeleteTOTP(c.Request.Context(), claims.UID); err != nil {
+		writeMessage(c, http.StatusInternalServerError, fmt.Sprintf("%v", err))
+		return
+	}
+
+	writeMessage(c, http.StatusOK, "second factor disabled")
+}
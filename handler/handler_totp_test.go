@@ -0,0 +1,366 @@
+package handler_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"simple-go-server/db"
+	"simple-go-server/handler"
+	"simple-go-server/token"
+	"simple-go-server/totp"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHandleTOTP(t *testing.T) {
+	assert := assert.New(t)
+
+	var at, pt *http.Cookie
+	var enrolled handler.EnrollTOTPResponse
+
+	t.Run("test create user", func(t *testing.T) {
+		res := httptest.NewRecorder()
+		req := httptest.NewRequest("POST", "/user", strings.NewReader(
+			`{"user_id":"totpuser1","role":"user","password":"tu1234++"}`,
+		))
+
+		TestRouter.ServeHTTP(res, req)
+		assert.Equal(http.StatusCreated, res.Code)
+	})
+
+	t.Run("test login", func(t *testing.T) {
+		res := httptest.NewRecorder()
+		req := httptest.NewRequest("POST", "/login", strings.NewReader(
+			`{"user_id":"totpuser1","password":"tu1234++"}`,
+		))
+
+		TestRouter.ServeHTTP(res, req)
+		assert.Equal(http.StatusOK, res.Code)
+
+		for _, k := range res.Result().Cookies() {
+			if k.Name == token.ACCESS_TOKEN_NAME {
+				at = k
+			}
+		}
+	})
+
+	t.Run("test enroll; other user", func(t *testing.T) {
+		res := httptest.NewRecorder()
+		req := httptest.NewRequest("POST", "/user/master01/2fa", nil)
+		req.AddCookie(at)
+
+		TestRouter.ServeHTTP(res, req)
+		assert.Equal(http.StatusUnauthorized, res.Code)
+	})
+
+	t.Run("test enroll", func(t *testing.T) {
+		res := httptest.NewRecorder()
+		req := httptest.NewRequest("POST", "/user/totpuser1/2fa", nil)
+		req.AddCookie(at)
+
+		TestRouter.ServeHTTP(res, req)
+		assert.Equal(http.StatusCreated, res.Code)
+
+		assert.NoError(json.Unmarshal(res.Body.Bytes(), &enrolled))
+		assert.NotEmpty(enrolled.Secret)
+		assert.True(strings.HasPrefix(enrolled.URI, "otpauth://totp/"))
+		assert.Len(enrolled.RecoveryCodes, 10)
+	})
+
+	t.Run("test login; second factor pending", func(t *testing.T) {
+		res := httptest.NewRecorder()
+		req := httptest.NewRequest("POST", "/login", strings.NewReader(
+			`{"user_id":"totpuser1","password":"tu1234++"}`,
+		))
+
+		TestRouter.ServeHTTP(res, req)
+		assert.Equal(http.StatusOK, res.Code)
+	})
+
+	t.Run("test verify; wrong code", func(t *testing.T) {
+		res := httptest.NewRecorder()
+		req := httptest.NewRequest("POST", "/user/totpuser1/2fa/verify", strings.NewReader(
+			`{"code":"abcdef"}`,
+		))
+		req.AddCookie(at)
+
+		TestRouter.ServeHTTP(res, req)
+		assert.Equal(http.StatusUnauthorized, res.Code)
+	})
+
+	t.Run("test verify", func(t *testing.T) {
+		code, err := totp.Code(enrolled.Secret, time.Now())
+		assert.NoError(err)
+
+		res := httptest.NewRecorder()
+		req := httptest.NewRequest("POST", "/user/totpuser1/2fa/verify", strings.NewReader(
+			fmt.Sprintf(`{"code":"%s"}`, code),
+		))
+		req.AddCookie(at)
+
+		TestRouter.ServeHTTP(res, req)
+		assert.Equal(http.StatusOK, res.Code)
+		assert.Equal(`{"message":"second factor enabled"}`, res.Body.String())
+	})
+
+	t.Run("test enroll; already enabled", func(t *testing.T) {
+		res := httptest.NewRecorder()
+		req := httptest.NewRequest("POST", "/user/totpuser1/2fa", nil)
+		req.AddCookie(at)
+
+		TestRouter.ServeHTTP(res, req)
+		assert.Equal(http.StatusConflict, res.Code)
+	})
+
+	t.Run("test login; second factor required", func(t *testing.T) {
+		res := httptest.NewRecorder()
+		req := httptest.NewRequest("POST", "/login", strings.NewReader(
+			`{"user_id":"totpuser1","password":"tu1234++"}`,
+		))
+
+		TestRouter.ServeHTTP(res, req)
+		assert.Equal(http.StatusAccepted, res.Code)
+
+		pt = nil
+		for _, k := range res.Result().Cookies() {
+			assert.NotEqual(token.ACCESS_TOKEN_NAME, k.Name)
+			if k.Name == token.PRE_AUTH_TOKEN_NAME {
+				pt = k
+			}
+		}
+		assert.NotNil(pt)
+	})
+
+	t.Run("test pre-auth token; not an access token", func(t *testing.T) {
+		res := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", "/user/totpuser1/logins", nil)
+		req.AddCookie(pt)
+
+		TestRouter.ServeHTTP(res, req)
+		assert.Equal(http.StatusUnauthorized, res.Code)
+	})
+
+	t.Run("test login second factor; wrong code", func(t *testing.T) {
+		res := httptest.NewRecorder()
+		req := httptest.NewRequest("POST", "/login/2fa", strings.NewReader(
+			`{"code":"000000"}`,
+		))
+		req.AddCookie(pt)
+
+		TestRouter.ServeHTTP(res, req)
+		assert.Equal(http.StatusUnauthorized, res.Code)
+	})
+
+	t.Run("test login; second factor failures kept", func(t *testing.T) {
+		res := httptest.NewRecorder()
+		req := httptest.NewRequest("POST", "/login", strings.NewReader(
+			`{"user_id":"totpuser1","password":"tu1234++"}`,
+		))
+
+		TestRouter.ServeHTTP(res, req)
+		assert.Equal(http.StatusAccepted, res.Code)
+
+		// the password alone does not clear the failures of the second factor.
+		d, err := db.Get()
+		assert.Nil(err)
+
+		f, err := d.SelectLoginFailure(context.Background(), "totpuser1")
+		assert.Nil(err)
+		if assert.NotNil(f) {
+			assert.Equal(int64(1), f.Count)
+		}
+	})
+
+	t.Run("test login second factor", func(t *testing.T) {
+		// the code of the next step, as the current one was used to verify.
+		code, err := totp.Code(enrolled.Secret, time.Now().Add(totp.Period))
+		assert.NoError(err)
+
+		res := httptest.NewRecorder()
+		req := httptest.NewRequest("POST", "/login/2fa", strings.NewReader(
+			fmt.Sprintf(`{"code":"%s"}`, code),
+		))
+		req.AddCookie(pt)
+
+		TestRouter.ServeHTTP(res, req)
+		assert.Equal(http.StatusOK, res.Code)
+
+		at = nil
+		for _, k := range res.Result().Cookies() {
+			if k.Name == token.ACCESS_TOKEN_NAME {
+				at = k
+			}
+		}
+		assert.NotNil(at)
+
+		d, err := db.Get()
+		assert.Nil(err)
+
+		f, err := d.SelectLoginFailure(context.Background(), "totpuser1")
+		assert.Nil(err)
+		assert.Nil(f)
+
+		// the code cannot be used again.
+		res = httptest.NewRecorder()
+		req = httptest.NewRequest("POST", "/login/2fa", strings.NewReader(
+			fmt.Sprintf(`{"code":"%s"}`, code),
+		))
+		req.AddCookie(pt)
+
+		TestRouter.ServeHTTP(res, req)
+		assert.Equal(http.StatusUnauthorized, res.Code)
+	})
+
+	t.Run("test login second factor; recovery code", func(t *testing.T) {
+		res := httptest.NewRecorder()
+		req := httptest.NewRequest("POST", "/login/2fa", strings.NewReader(
+			fmt.Sprintf(`{"recovery_code":"%s"}`, strings.ToUpper(enrolled.RecoveryCodes[0])),
+		))
+		req.AddCookie(pt)
+
+		TestRouter.ServeHTTP(res, req)
+		assert.Equal(http.StatusOK, res.Code)
+
+		// recovery codes are single-use.
+		res = httptest.NewRecorder()
+		req = httptest.NewRequest("POST", "/login/2fa", strings.NewReader(
+			fmt.Sprintf(`{"recovery_code":"%s"}`, enrolled.RecoveryCodes[0]),
+		))
+		req.AddCookie(pt)
+
+		TestRouter.ServeHTTP(res, req)
+		assert.Equal(http.StatusUnauthorized, res.Code)
+	})
+
+	t.Run("test delete; without second factor", func(t *testing.T) {
+		res := httptest.NewRecorder()
+		req := httptest.NewRequest("DELETE", "/user/totpuser1/2fa", strings.NewReader(`{}`))
+		req.AddCookie(at)
+
+		TestRouter.ServeHTTP(res, req)
+		assert.Equal(http.StatusUnauthorized, res.Code)
+	})
+
+	t.Run("test delete", func(t *testing.T) {
+		res := httptest.NewRecorder()
+		req := httptest.NewRequest("DELETE", "/user/totpuser1/2fa", strings.NewReader(
+			fmt.Sprintf(`{"recovery_code":"%s"}`, enrolled.RecoveryCodes[1]),
+		))
+		req.AddCookie(at)
+
+		TestRouter.ServeHTTP(res, req)
+		assert.Equal(http.StatusOK, res.Code)
+		assert.Equal(`{"message":"second factor disabled"}`, res.Body.String())
+	})
+
+	t.Run("test login; second factor disabled", func(t *testing.T) {
+		res := httptest.NewRecorder()
+		req := httptest.NewRequest("POST", "/login", strings.NewReader(
+			`{"user_id":"totpuser1","password":"tu1234++"}`,
+		))
+
+		TestRouter.ServeHTTP(res, req)
+		assert.Equal(http.StatusOK, res.Code)
+	})
+}
+
+func TestRequireManagerTOTP(t *testing.T) {
+	assert := assert.New(t)
+
+	var at, pt *http.Cookie
+	var enrolled handler.EnrollTOTPResponse
+
+	t.Run("test login; manager", func(t *testing.T) {
+		res := httptest.NewRecorder()
+		req := httptest.NewRequest("POST", "/login", strings.NewReader(
+			`{"user_id":"master01","password":"pwmaster01++"}`,
+		))
+
+		TestRouter.ServeHTTP(res, req)
+		assert.Equal(http.StatusOK, res.Code)
+
+		for _, k := range res.Result().Cookies() {
+			if k.Name == token.ACCESS_TOKEN_NAME {
+				at = k
+			}
+		}
+	})
+
+	t.Run("test create manager", func(t *testing.T) {
+		res := httptest.NewRecorder()
+		req := httptest.NewRequest("POST", "/user", strings.NewReader(
+			`{"user_id":"totpmgr1","role":"manager","password":"tm1234++"}`,
+		))
+		req.AddCookie(at)
+
+		TestRouter.ServeHTTP(res, req)
+		assert.Equal(http.StatusCreated, res.Code)
+	})
+
+	t.Setenv("REQUIRE_MANAGER_2FA", "true")
+
+	t.Run("test login; enrollment required", func(t *testing.T) {
+		res := httptest.NewRecorder()
+		req := httptest.NewRequest("POST", "/login", strings.NewReader(
+			`{"user_id":"totpmgr1","password":"tm1234++"}`,
+		))
+
+		TestRouter.ServeHTTP(res, req)
+		assert.Equal(http.StatusAccepted, res.Code)
+		assert.Contains(res.Body.String(), "second factor enrollment required")
+
+		for _, k := range res.Result().Cookies() {
+			if k.Name == token.PRE_AUTH_TOKEN_NAME {
+				pt = k
+			}
+		}
+		assert.NotNil(pt)
+	})
+
+	t.Run("test login enroll", func(t *testing.T) {
+		res := httptest.NewRecorder()
+		req := httptest.NewRequest("POST", "/login/2fa/enroll", nil)
+		req.AddCookie(pt)
+
+		TestRouter.ServeHTTP(res, req)
+		assert.Equal(http.StatusCreated, res.Code)
+		assert.NoError(json.Unmarshal(res.Body.Bytes(), &enrolled))
+	})
+
+	t.Run("test login second factor", func(t *testing.T) {
+		code, err := totp.Code(enrolled.Secret, time.Now())
+		assert.NoError(err)
+
+		res := httptest.NewRecorder()
+		req := httptest.NewRequest("POST", "/login/2fa", strings.NewReader(
+			fmt.Sprintf(`{"code":"%s"}`, code),
+		))
+		req.AddCookie(pt)
+
+		TestRouter.ServeHTTP(res, req)
+		assert.Equal(http.StatusOK, res.Code)
+
+		for _, k := range res.Result().Cookies() {
+			if k.Name == token.ACCESS_TOKEN_NAME {
+				at = k
+			}
+		}
+	})
+
+	t.Run("test delete; manager", func(t *testing.T) {
+		res := httptest.NewRecorder()
+		req := httptest.NewRequest("DELETE", "/user/totpmgr1/2fa", strings.NewReader(
+			fmt.Sprintf(`{"recovery_code":"%s"}`, enrolled.RecoveryCodes[0]),
+		))
+		req.AddCookie(at)
+
+		TestRouter.ServeHTTP(res, req)
+		assert.Equal(http.StatusForbidden, res.Code)
+	})
+}
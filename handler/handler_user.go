@@ -22,13 +22,19 @@ func handleCreateUser(c *gin.Context) {
 
 	userID := model.UserID(req.UserID)
 	if err := userID.IsValid(); err != nil {
-		writeMessage(c, http.StatusBadRequest, "invalid user id format")
+		writeViolations(c, "invalid user id format", err)
 		return
 	}
 
 	pw := model.Password(req.Password)
-	if err := pw.IsValid(); err != nil {
-		writeMessage(c, http.StatusBadRequest, "invalid password format")
+	if err := pw.IsValid(userID); err != nil {
+		writeViolations(c, "invalid password format", err)
+		return
+	}
+
+	profile := req.Profile.Normalized()
+	if err := profile.IsValid(); err != nil {
+		writeViolations(c, "invalid profile format", err)
 		return
 	}
 
@@ -48,13 +54,13 @@ func handleCreateUser(c *gin.Context) {
 		}
 	}
 
-	db, err := db.Get()
+	d, err := db.Get()
 	if err != nil {
 		writeMessage(c, http.StatusInternalServerError, "db failure")
 		return
 	}
 
-	user, err := db.SelectUser(req.UserID)
+	user, err := d.SelectUser(c.Request.Context(), req.UserID)
 	if err != nil {
 		writeMessage(c, http.StatusInternalServerError, fmt.Sprintf("%v", err))
 		return
@@ -71,12 +77,23 @@ func handleCreateUser(c *gin.Context) {
 		return
 	}
 
-	uid, err := db.InsertUser(req.UserID, req.Role, pwHash)
+	uid, err := d.InsertUser(c.Request.Context(), req.UserID, req.Role, pwHash, profile)
+	if err == db.ErrEmailTaken {
+		writeMessage(c, http.StatusConflict, "already registered email")
+		return
+	}
 	if err != nil {
 		writeMessage(c, http.StatusInternalServerError, fmt.Sprintf("%v", err))
 		return
 	}
 
+	// the user can ask for another verification mail if this one fails.
+	if profile.Email != "" {
+		if err := sendEmailVerification(c.Request.Context(), uid, profile.Email); err != nil {
+			requestLogger(c).Warn("email verification failure", "error", err)
+		}
+	}
+
 	c.JSON(
 		http.StatusCreated,
 		CreateUserResponse{
@@ -92,13 +109,18 @@ func handleGetUser(c *gin.Context) {
 		writeMessage(c, http.StatusBadRequest, "empty user id")
 	}
 
+	claims, keep := optionalToken(c)
+	if !keep {
+		return
+	}
+
 	db, err := db.Get()
 	if err != nil {
 		writeMessage(c, http.StatusInternalServerError, "db failure")
 		return
 	}
 
-	user, err := db.SelectUser(userID)
+	user, err := db.SelectUser(c.Request.Context(), userID)
 	if err != nil {
 		writeMessage(c, http.StatusInternalServerError, fmt.Sprintf("%v", err))
 		return
@@ -109,9 +131,17 @@ func handleGetUser(c *gin.Context) {
 		return
 	}
 
+	if claims != nil && (claims.UID == user.UID || claims.Role == model.RoleManager) {
+		c.JSON(
+			http.StatusOK,
+			GetPrivateUserResponse{user.Private()},
+		)
+		return
+	}
+
 	c.JSON(
 		http.StatusOK,
-		GetUserResponse{*user},
+		GetUserResponse{user.Public()},
 	)
 }
 
@@ -147,7 +177,7 @@ func handleUpdateUser(c *gin.Context) {
 		return
 	}
 
-	user, err := db.SelectUser(userID)
+	user, err := db.SelectUser(c.Request.Context(), userID)
 	if err != nil {
 		writeMessage(c, http.StatusInternalServerError, fmt.Sprintf("%v", err))
 		return
@@ -166,8 +196,8 @@ func handleUpdateUser(c *gin.Context) {
 	}
 
 	pw := model.Password(req.Password)
-	if err := pw.IsValid(); err != nil {
-		writeMessage(c, http.StatusBadRequest, "invalid password format")
+	if err := pw.IsValid(model.UserID(userID)); err != nil {
+		writeViolations(c, "invalid password format", err)
 		return
 	}
 
@@ -177,7 +207,7 @@ func handleUpdateUser(c *gin.Context) {
 		return
 	}
 
-	err = db.UpdateUser(userID, req.Role, pwHash)
+	err = db.UpdateUser(c.Request.Context(), userID, req.Role, pwHash)
 	if err != nil {
 		writeMessage(c, http.StatusInternalServerError, fmt.Sprintf("%v", err))
 		return
@@ -194,7 +224,7 @@ func handleDeleteUser(c *gin.Context) {
 		return
 	}
 
-	if claims.UserID != userID {
+	if claims.UserID != userID && claims.Role != model.RoleManager {
 		writeMessage(c, http.StatusUnauthorized, "invalid access token for this user")
 		return
 	}
@@ -205,7 +235,7 @@ func handleDeleteUser(c *gin.Context) {
 		return
 	}
 
-	user, err := db.SelectUser(userID)
+	user, err := db.SelectUser(c.Request.Context(), userID)
 	if err != nil {
 		writeMessage(c, http.StatusInternalServerError, fmt.Sprintf("%v", err))
 		return
@@ -216,13 +246,17 @@ func handleDeleteUser(c *gin.Context) {
 		return
 	}
 
-	err = db.DeleteUser(userID)
+	erasure, err := db.EraseUser(c.Request.Context(), user, erasurePolicy(), claims.UID)
 	if err != nil {
 		writeMessage(c, http.StatusInternalServerError, fmt.Sprintf("%v", err))
 		return
 	}
 
-	c.SetCookie(token.ACCESS_TOKEN_NAME, "", -1, "/", "localhost", false, true)
+	requestLogger(c).Info("user erased", "eid", erasure.EID, "target", erasure.UID, "policy", erasure.Policy)
+
+	if claims.UserID == userID {
+		c.SetCookie(token.ACCESS_TOKEN_NAME, "", -1, "/", "localhost", false, true)
+	}
 
 	writeMessage(c, http.StatusOK, "user delete success")
 }
@@ -235,7 +269,7 @@ func handleGetUserOrders(c *gin.Context) {
 		return
 	}
 
-	if claims.UserID != userID {
+	if claims.UserID != userID && claims.Role != model.RoleManager {
 		writeMessage(c, http.StatusUnauthorized, "invalid access token for this user")
 		return
 	}
@@ -246,7 +280,7 @@ func handleGetUserOrders(c *gin.Context) {
 		return
 	}
 
-	user, err := db.SelectUser(userID)
+	user, err := db.SelectUser(c.Request.Context(), userID)
 	if err != nil {
 		writeMessage(c, http.StatusInternalServerError, fmt.Sprintf("%v", err))
 		return
@@ -257,7 +291,7 @@ func handleGetUserOrders(c *gin.Context) {
 		return
 	}
 
-	orders, err := db.SelectUserOrders(user.UID)
+	orders, err := db.SelectUserOrders(c.Request.Context(), user.UID)
 	if err != nil {
 		writeMessage(c, http.StatusInternalServerError, fmt.Sprintf("%v", err))
 		return
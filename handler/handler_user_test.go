@@ -1,6 +1,7 @@
 package handler_test
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"net/http"
@@ -9,6 +10,8 @@ import (
 	"testing"
 
 	"simple-go-server/handler"
+	"simple-go-server/model"
+	"simple-go-server/policy"
 	"simple-go-server/token"
 
 	"github.com/stretchr/testify/assert"
@@ -76,6 +79,43 @@ func TestHandleCreateUser(t *testing.T) {
 
 		TestRouter.ServeHTTP(res, req)
 		assert.Equal(http.StatusBadRequest, res.Code)
+
+		body := struct {
+			Message    string             `json:"message"`
+			Violations []policy.Violation `json:"violations"`
+		}{}
+
+		err := json.NewDecoder(res.Body).Decode(&body)
+		assert.Nil(err)
+		assert.Equal("invalid password format", body.Message)
+
+		rules := []string{}
+		for _, v := range body.Violations {
+			rules = append(rules, v.Rule)
+		}
+		assert.Equal([]string{"min_length", "class_special"}, rules)
+	})
+
+	t.Run("test create user; pw similar to user id", func(t *testing.T) {
+		res := httptest.NewRecorder()
+		req := httptest.NewRequest("POST", "/user", strings.NewReader(
+			`{"user_id":"handlercreate3","role":"user","password":"handlercreate3!"}`,
+		))
+
+		TestRouter.ServeHTTP(res, req)
+		assert.Equal(http.StatusBadRequest, res.Code)
+		assert.Contains(res.Body.String(), `"rule":"user_id_similarity"`)
+	})
+
+	t.Run("test create user; reserved user id", func(t *testing.T) {
+		res := httptest.NewRecorder()
+		req := httptest.NewRequest("POST", "/user", strings.NewReader(
+			`{"user_id":"Admin","role":"user","password":"hc1234++"}`,
+		))
+
+		TestRouter.ServeHTTP(res, req)
+		assert.Equal(http.StatusBadRequest, res.Code)
+		assert.Contains(res.Body.String(), `"rule":"reserved"`)
 	})
 }
 
@@ -134,6 +174,97 @@ func TestHandleGetUser(t *testing.T) {
 		assert.Equal("handlerget2", ui.UserID)
 	})
 
+	t.Run("test get user; anonymous", func(t *testing.T) {
+		res := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", "/user/handlerget1", nil)
+
+		TestRouter.ServeHTTP(res, req)
+		assert.Equal(http.StatusOK, res.Code)
+		assert.JSONEq(`{"user_id":"handlerget1","display_name":""}`, res.Body.String())
+	})
+
+	var at *http.Cookie
+
+	t.Run("test login", func(t *testing.T) {
+		res := httptest.NewRecorder()
+		req := httptest.NewRequest("POST", "/login", strings.NewReader(
+			`{"user_id":"handlerget1","password":"hg1234++"}`,
+		))
+
+		TestRouter.ServeHTTP(res, req)
+		assert.Equal(http.StatusOK, res.Code)
+
+		for _, k := range res.Result().Cookies() {
+			if k.Name == token.ACCESS_TOKEN_NAME {
+				at = k
+			}
+		}
+	})
+
+	t.Run("test get user; self", func(t *testing.T) {
+		ui := handler.GetPrivateUserResponse{}
+
+		res := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", "/user/handlerget1", nil)
+		req.AddCookie(at)
+
+		TestRouter.ServeHTTP(res, req)
+		assert.Equal(http.StatusOK, res.Code)
+		assert.NotContains(res.Body.String(), "password")
+		assert.NotContains(res.Body.String(), "$argon2id$")
+
+		err := json.NewDecoder(res.Body).Decode(&ui)
+		assert.Nil(err)
+		assert.Equal("handlerget1", ui.UserID)
+		assert.Equal(model.RoleUser, ui.Role)
+		assert.NotZero(ui.UID)
+	})
+
+	t.Run("test get user; other user", func(t *testing.T) {
+		res := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", "/user/handlerget2", nil)
+		req.AddCookie(at)
+
+		TestRouter.ServeHTTP(res, req)
+		assert.Equal(http.StatusOK, res.Code)
+		assert.JSONEq(`{"user_id":"handlerget2","display_name":""}`, res.Body.String())
+	})
+
+	t.Run("test get user; manager", func(t *testing.T) {
+		res := httptest.NewRecorder()
+		req := httptest.NewRequest("POST", "/login", strings.NewReader(
+			`{"user_id":"master01","password":"pwmaster01++"}`,
+		))
+
+		TestRouter.ServeHTTP(res, req)
+		assert.Equal(http.StatusOK, res.Code)
+
+		var mt *http.Cookie
+		for _, k := range res.Result().Cookies() {
+			if k.Name == token.ACCESS_TOKEN_NAME {
+				mt = k
+			}
+		}
+
+		res = httptest.NewRecorder()
+		req = httptest.NewRequest("GET", "/user/handlerget2", nil)
+		req.AddCookie(mt)
+
+		TestRouter.ServeHTTP(res, req)
+		assert.Equal(http.StatusOK, res.Code)
+		assert.Contains(res.Body.String(), `"role":"user"`)
+		assert.NotContains(res.Body.String(), "password")
+	})
+
+	t.Run("test get user; invalid token", func(t *testing.T) {
+		res := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", "/user/handlerget1", nil)
+		req.AddCookie(&http.Cookie{Name: token.ACCESS_TOKEN_NAME, Value: "invalid"})
+
+		TestRouter.ServeHTTP(res, req)
+		assert.NotEqual(http.StatusOK, res.Code)
+	})
+
 	t.Run("test get user; not found", func(t *testing.T) {
 		res := httptest.NewRecorder()
 		req := httptest.NewRequest("GET", "/user/999999", nil)
@@ -141,6 +272,17 @@ func TestHandleGetUser(t *testing.T) {
 		TestRouter.ServeHTTP(res, req)
 		assert.Equal(http.StatusNotFound, res.Code)
 	})
+
+	t.Run("test get user; cancelled request", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		res := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", "/user/handlerget1", nil).WithContext(ctx)
+
+		TestRouter.ServeHTTP(res, req)
+		assert.Equal(http.StatusInternalServerError, res.Code)
+	})
 }
 
 func TestHandleUpdateUser(t *testing.T) {
@@ -198,6 +340,15 @@ func TestHandleUpdateUser(t *testing.T) {
 		assert.Equal(`{"message":"user update success"}`, res.Body.String())
 	})
 
+	t.Run("test old session revoked", func(t *testing.T) {
+		res := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", "/user/handlerupdate1/logins", nil)
+		req.AddCookie(at)
+
+		TestRouter.ServeHTTP(res, req)
+		assert.Equal(http.StatusUnauthorized, res.Code)
+	})
+
 	t.Run("test logout", func(t *testing.T) {
 		res := httptest.NewRecorder()
 		req := httptest.NewRequest("POST", "/logout", nil)
@@ -0,0 +1,308 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"simple-go-server/db"
+	"simple-go-server/model"
+
+	"github.com/gin-gonic/gin"
+)
+
+// checkVariant checks the sku, the price override and the stock of the variant of the product.
+// A price override given as a bare amount takes the product currency.
+func checkVariant(c *gin.Context, variant *model.Variant, product *model.Product) bool {
+	if err := model.SKU(variant.SKU).IsValid(); err != nil {
+		writeMessage(c, http.StatusBadRequest, fmt.Sprintf("%v", err))
+		return false
+	}
+
+	if variant.Price != nil {
+		price := variant.Price.WithDefaultCurrency(product.Price.Currency)
+		if !checkPrice(c, price) {
+			return false
+		}
+
+		if price.Currency != product.Price.Currency {
+			writeMessage(c, http.StatusBadRequest, "variant price must be in the product currency")
+			return false
+		}
+
+		variant.Price = &price
+	}
+
+	if variant.Stock < 0 {
+		writeMessage(c, http.StatusBadRequest, "invalid variant stock")
+		return false
+	}
+
+	return true
+}
+
+// productVariant returns the variant of the vid param,
+// if it is a variant of the product of the pid param.
+func productVariant(c *gin.Context, db *db.Database) (*model.Variant, bool) {
+	pid, err := strconv.Atoi(c.Param("pid"))
+	if err != nil {
+		writeMessage(c, http.StatusBadRequest, "invalid product id format")
+		return nil, false
+	}
+
+	vid, err := strconv.Atoi(c.Param("vid"))
+	if err != nil {
+		writeMessage(c, http.StatusBadRequest, "invalid variant id format")
+		return nil, false
+	}
+
+	variant, err := db.SelectVariant(c.Request.Context(), int64(vid))
+	if err != nil {
+		writeMessage(c, http.StatusInternalServerError, fmt.Sprintf("%v", err))
+		return nil, false
+	}
+
+	if variant == nil || variant.PID != int64(pid) {
+		writeMessage(c, http.StatusNotFound, "variant not found")
+		return nil, false
+	}
+
+	return variant, true
+}
+
+// handleSetProductOptions replaces the option axes of a product without variants.
+func handleSetProductOptions(c *gin.Context) {
+	pid, err := strconv.Atoi(c.Param("pid"))
+	if err != nil {
+		writeMessage(c, http.StatusBadRequest, "invalid product id format")
+		return
+	}
+
+	req := new(SetProductOptionsRequest)
+
+	if err := json.NewDecoder(c.Request.Body).Decode(&req); err != nil {
+		writeMessage(c, http.StatusBadRequest, "invalid request format")
+		return
+	}
+
+	if err := req.Options.IsValid(); err != nil {
+		writeMessage(c, http.StatusBadRequest, fmt.Sprintf("%v", err))
+		return
+	}
+
+	claims, keep := checkToken(c)
+	if !keep {
+		return
+	}
+
+	if claims.Role != model.RoleManager {
+		writeMessage(c, http.StatusUnauthorized, "general user cannot update product")
+		return
+	}
+
+	d, err := db.Get()
+	if err != nil {
+		writeMessage(c, http.StatusInternalServerError, "db failure")
+		return
+	}
+
+	product, err := d.SelectProduct(c.Request.Context(), int64(pid))
+	if err != nil {
+		writeMessage(c, http.StatusInternalServerError, fmt.Sprintf("%v", err))
+		return
+	}
+
+	if product == nil {
+		writeMessage(c, http.StatusNotFound, "product not found")
+		return
+	}
+
+	err = d.SetProductOptions(c.Request.Context(), product.PID, req.Options)
+	if err == db.ErrProductHasVariants {
+		writeMessage(c, http.StatusConflict, "product has variants, delete them first")
+		return
+	}
+	if err != nil {
+		writeMessage(c, http.StatusInternalServerError, fmt.Sprintf("%v", err))
+		return
+	}
+
+	writeMessage(c, http.StatusOK, "update product options success")
+}
+
+func handleCreateVariant(c *gin.Context) {
+	pid, err := strconv.Atoi(c.Param("pid"))
+	if err != nil {
+		writeMessage(c, http.StatusBadRequest, "invalid product id format")
+		return
+	}
+
+	req := new(CreateVariantRequest)
+
+	if err := json.NewDecoder(c.Request.Body).Decode(&req); err != nil {
+		writeMessage(c, http.StatusBadRequest, "invalid request format")
+		return
+	}
+
+	variant := model.Variant{
+		PID:     int64(pid),
+		SKU:     req.SKU,
+		Options: req.Options,
+		Price:   req.Price,
+		Stock:   req.Stock,
+	}
+
+	claims, keep := checkToken(c)
+	if !keep {
+		return
+	}
+
+	if claims.Role != model.RoleManager {
+		writeMessage(c, http.StatusUnauthorized, "general user cannot register variant")
+		return
+	}
+
+	d, err := db.Get()
+	if err != nil {
+		writeMessage(c, http.StatusInternalServerError, "db failure")
+		return
+	}
+
+	product, err := d.SelectProduct(c.Request.Context(), variant.PID)
+	if err != nil {
+		writeMessage(c, http.StatusInternalServerError, fmt.Sprintf("%v", err))
+		return
+	}
+
+	if product == nil {
+		writeMessage(c, http.StatusNotFound, "product not found")
+		return
+	}
+
+	if !checkVariant(c, &variant, product) {
+		return
+	}
+
+	options, err := d.SelectProductOptions(c.Request.Context(), product.PID)
+	if err != nil {
+		writeMessage(c, http.StatusInternalServerError, fmt.Sprintf("%v", err))
+		return
+	}
+
+	if err := options.Match(variant.Options); err != nil {
+		writeMessage(c, http.StatusBadRequest, fmt.Sprintf("%v", err))
+		return
+	}
+
+	vid, err := d.InsertVariant(c.Request.Context(), variant)
+	if err == db.ErrVariantTaken {
+		writeMessage(c, http.StatusConflict, "already used variant sku or options")
+		return
+	}
+	if err != nil {
+		writeMessage(c, http.StatusInternalServerError, fmt.Sprintf("%v", err))
+		return
+	}
+
+	c.JSON(
+		http.StatusCreated,
+		CreateVariantResponse{
+			vid,
+			"register variant success",
+		},
+	)
+}
+
+// handleUpdateVariant updates the sku, the price override and the stock of a variant.
+// The options of a variant never change, so that ordered variants keep their meaning.
+func handleUpdateVariant(c *gin.Context) {
+	req := new(UpdateVariantRequest)
+
+	if err := json.NewDecoder(c.Request.Body).Decode(&req); err != nil {
+		writeMessage(c, http.StatusBadRequest, "invalid request format")
+		return
+	}
+
+	claims, keep := checkToken(c)
+	if !keep {
+		return
+	}
+
+	if claims.Role != model.RoleManager {
+		writeMessage(c, http.StatusUnauthorized, "general user cannot update variant")
+		return
+	}
+
+	d, err := db.Get()
+	if err != nil {
+		writeMessage(c, http.StatusInternalServerError, "db failure")
+		return
+	}
+
+	variant, keep := productVariant(c, d)
+	if !keep {
+		return
+	}
+
+	product, err := d.SelectProduct(c.Request.Context(), variant.PID)
+	if err != nil {
+		writeMessage(c, http.StatusInternalServerError, fmt.Sprintf("%v", err))
+		return
+	}
+
+	if product == nil {
+		writeMessage(c, http.StatusNotFound, "product not found")
+		return
+	}
+
+	variant.SKU = req.SKU
+	variant.Price = req.Price
+	variant.Stock = req.Stock
+
+	if !checkVariant(c, variant, product) {
+		return
+	}
+
+	err = d.UpdateVariant(c.Request.Context(), *variant)
+	if err == db.ErrVariantTaken {
+		writeMessage(c, http.StatusConflict, "already used variant sku or options")
+		return
+	}
+	if err != nil {
+		writeMessage(c, http.StatusInternalServerError, fmt.Sprintf("%v", err))
+		return
+	}
+
+	writeMessage(c, http.StatusOK, "update variant success")
+}
+
+func handleDeleteVariant(c *gin.Context) {
+	claims, keep := checkToken(c)
+	if !keep {
+		return
+	}
+
+	if claims.Role != model.RoleManager {
+		writeMessage(c, http.StatusUnauthorized, "general user cannot delete variant")
+		return
+	}
+
+	db, err := db.Get()
+	if err != nil {
+		writeMessage(c, http.StatusInternalServerError, "db failure")
+		return
+	}
+
+	variant, keep := productVariant(c, db)
+	if !keep {
+		return
+	}
+
+	if err := db.DeleteVariant(c.Request.Context(), variant.VID); err != nil {
+		writeMessage(c, http.StatusInternalServerError, fmt.Sprintf("%v", err))
+		return
+	}
+
+	writeMessage(c, http.StatusOK, "delete variant success")
+}
@@ -0,0 +1,398 @@
+package handler_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"simple-go-server/handler"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHandleVariant(t *testing.T) {
+	assert := assert.New(t)
+
+	var at, mt *http.Cookie
+	var pid int64
+	vids := map[string]int64{}
+
+	// createVariant creates the variant of the product and returns the response code.
+	createVariant := func(body string) int {
+		res := httptest.NewRecorder()
+		req := httptest.NewRequest("POST", fmt.Sprintf("/product/%d/variant", pid), strings.NewReader(body))
+		req.AddCookie(mt)
+
+		TestRouter.ServeHTTP(res, req)
+
+		if res.Code == http.StatusCreated {
+			vd := handler.CreateVariantResponse{}
+			assert.Nil(json.NewDecoder(res.Body).Decode(&vd))
+
+			sku := struct {
+				SKU string `json:"sku"`
+			}{}
+			assert.Nil(json.Unmarshal([]byte(body), &sku))
+			vids[sku.SKU] = vd.VID
+		}
+
+		return res.Code
+	}
+
+	// addItem puts the variant in the cart and returns the response code.
+	addItem := func(vid, quantity int64) int {
+		res := httptest.NewRecorder()
+		req := httptest.NewRequest("POST", "/cart/items", strings.NewReader(
+			fmt.Sprintf(`{"pid":%d,"vid":%d,"quantity":%d}`, pid, vid, quantity),
+		))
+		req.AddCookie(at)
+
+		TestRouter.ServeHTTP(res, req)
+
+		return res.Code
+	}
+
+	t.Run("test create user", func(t *testing.T) {
+		res := httptest.NewRecorder()
+		req := httptest.NewRequest("POST", "/user", strings.NewReader(
+			`{"user_id":"handlervariant1","role":"user","password":"hvr1234++"}`,
+		))
+
+		TestRouter.ServeHTTP(res, req)
+		assert.Equal(http.StatusCreated, res.Code)
+
+		at = login(t, `{"user_id":"handlervariant1","password":"hvr1234++"}`)
+		mt = login(t, `{"user_id":"master01","password":"pwmaster01++"}`)
+	})
+
+	t.Run("test create product", func(t *testing.T) {
+		res := httptest.NewRecorder()
+		req := httptest.NewRequest("POST", "/product", strings.NewReader(`{"name":"variant tee","price":2000}`))
+		req.AddCookie(mt)
+
+		TestRouter.ServeHTTP(res, req)
+		assert.Equal(http.StatusCreated, res.Code)
+
+		pd := handler.CreateProductResponse{}
+		assert.Nil(json.NewDecoder(res.Body).Decode(&pd))
+
+		pid = pd.PID
+	})
+
+	t.Run("test set product options; invalid", func(t *testing.T) {
+		for _, options := range []string{
+			`[{"name":"size","values":[]}]`,
+			`[{"name":"size","values":["S","S"]}]`,
+			`[{"name":"size","values":["S"]},{"name":"size","values":["M"]}]`,
+		} {
+			res := httptest.NewRecorder()
+			req := httptest.NewRequest("PUT", fmt.Sprintf("/product/%d/options", pid), strings.NewReader(
+				fmt.Sprintf(`{"options":%s}`, options),
+			))
+			req.AddCookie(mt)
+
+			TestRouter.ServeHTTP(res, req)
+			assert.Equal(http.StatusBadRequest, res.Code)
+		}
+	})
+
+	t.Run("test set product options", func(t *testing.T) {
+		res := httptest.NewRecorder()
+		req := httptest.NewRequest("PUT", fmt.Sprintf("/product/%d/options", pid), strings.NewReader(
+			`{"options":[{"name":"size","values":["S","M","L"]},{"name":"color","values":["red","blue"]}]}`,
+		))
+		req.AddCookie(at)
+
+		TestRouter.ServeHTTP(res, req)
+		assert.Equal(http.StatusUnauthorized, res.Code)
+
+		res = httptest.NewRecorder()
+		req = httptest.NewRequest("PUT", fmt.Sprintf("/product/%d/options", pid), strings.NewReader(
+			`{"options":[{"name":"size","values":["S","M","L"]},{"name":"color","values":["red","blue"]}]}`,
+		))
+		req.AddCookie(mt)
+
+		TestRouter.ServeHTTP(res, req)
+		assert.Equal(http.StatusOK, res.Code)
+	})
+
+	t.Run("test create variant", func(t *testing.T) {
+		assert.Equal(http.StatusCreated, createVariant(`{"sku":"TEE-S-RED","options":{"size":"S","color":"red"},"stock":2}`))
+		assert.Equal(http.StatusCreated, createVariant(`{"sku":"TEE-L-BLUE","options":{"size":"L","color":"blue"},"price":2500,"stock":10}`))
+	})
+
+	t.Run("test create variant; invalid", func(t *testing.T) {
+		assert.Equal(http.StatusBadRequest, createVariant(`{"sku":"TEE S","options":{"size":"S","color":"blue"}}`))
+		assert.Equal(http.StatusBadRequest, createVariant(`{"sku":"TEE-XL","options":{"size":"XL","color":"blue"}}`))
+		assert.Equal(http.StatusBadRequest, createVariant(`{"sku":"TEE-S","options":{"size":"S"}}`))
+		assert.Equal(http.StatusBadRequest, createVariant(`{"sku":"TEE-S-BLUE","options":{"size":"S","color":"blue"},"stock":-1}`))
+		assert.Equal(http.StatusConflict, createVariant(`{"sku":"TEE-S-RED","options":{"size":"S","color":"blue"}}`))
+		assert.Equal(http.StatusConflict, createVariant(`{"sku":"TEE-S-RED-2","options":{"size":"S","color":"red"}}`))
+	})
+
+	t.Run("test set product options; has variants", func(t *testing.T) {
+		res := httptest.NewRecorder()
+		req := httptest.NewRequest("PUT", fmt.Sprintf("/product/%d/options", pid), strings.NewReader(
+			`{"options":[{"name":"size","values":["S"]}]}`,
+		))
+		req.AddCookie(mt)
+
+		TestRouter.ServeHTTP(res, req)
+		assert.Equal(http.StatusConflict, res.Code)
+	})
+
+	t.Run("test get product", func(t *testing.T) {
+		res := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", fmt.Sprintf("/product/%d", pid), nil)
+
+		TestRouter.ServeHTTP(res, req)
+		assert.Equal(http.StatusOK, res.Code)
+
+		pd := handler.GetProductResponse{}
+		assert.Nil(json.NewDecoder(res.Body).Decode(&pd))
+		assert.Len(pd.Options, 2)
+		assert.Equal("size", pd.Options[0].Name)
+		assert.Equal([]string{"S", "M", "L"}, pd.Options[0].Values)
+		assert.Len(pd.Variants, 2)
+		assert.Equal("TEE-S-RED", pd.Variants[0].SKU)
+		assert.Nil(pd.Variants[0].Price)
+		assert.Equal(map[string]string{"size": "L", "color": "blue"}, pd.Variants[1].Options)
+		assert.Equal(int64(2500), pd.Variants[1].Price.Amount)
+	})
+
+	t.Run("test add cart item; variant required", func(t *testing.T) {
+		assert.Equal(http.StatusBadRequest, addItem(0, 1))
+		assert.Equal(http.StatusNotFound, addItem(100000, 1))
+		assert.Equal(http.StatusConflict, addItem(vids["TEE-S-RED"], 3))
+	})
+
+	t.Run("test create order; product with variants", func(t *testing.T) {
+		res := httptest.NewRecorder()
+		req := httptest.NewRequest("POST", "/order", strings.NewReader(
+			fmt.Sprintf(`{"products":[%d]}`, pid),
+		))
+		req.AddCookie(at)
+
+		TestRouter.ServeHTTP(res, req)
+		assert.Equal(http.StatusBadRequest, res.Code)
+	})
+
+	t.Run("test add cart item", func(t *testing.T) {
+		assert.Equal(http.StatusOK, addItem(vids["TEE-S-RED"], 2))
+		assert.Equal(http.StatusOK, addItem(vids["TEE-L-BLUE"], 1))
+
+		res := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", "/cart", nil)
+		req.AddCookie(at)
+
+		TestRouter.ServeHTTP(res, req)
+		assert.Equal(http.StatusOK, res.Code)
+
+		c := handler.GetCartResponse{}
+		assert.Nil(json.NewDecoder(res.Body).Decode(&c))
+		assert.True(c.Valid)
+		assert.Len(c.Items, 2)
+		assert.Equal("TEE-S-RED", c.Items[0].SKU)
+		assert.Equal(int64(2000), c.Items[0].Price.Amount)
+		assert.Equal(int64(2500), c.Items[1].Price.Amount)
+		assert.Equal(int64(6500), c.Total.Amount)
+	})
+
+	t.Run("test update cart item; insufficient stock", func(t *testing.T) {
+		res := httptest.NewRecorder()
+		req := httptest.NewRequest("PUT", fmt.Sprintf("/cart/items/%d?vid=%d", pid, vids["TEE-S-RED"]), strings.NewReader(
+			`{"quantity":3}`,
+		))
+		req.AddCookie(at)
+
+		TestRouter.ServeHTTP(res, req)
+		assert.Equal(http.StatusConflict, res.Code)
+
+		res = httptest.NewRecorder()
+		req = httptest.NewRequest("PUT", fmt.Sprintf("/cart/items/%d", pid), strings.NewReader(
+			`{"quantity":1}`,
+		))
+		req.AddCookie(at)
+
+		TestRouter.ServeHTTP(res, req)
+		assert.Equal(http.StatusNotFound, res.Code)
+	})
+
+	t.Run("test checkout cart; out of stock", func(t *testing.T) {
+		res := httptest.NewRecorder()
+		req := httptest.NewRequest("PUT", fmt.Sprintf("/product/%d/variant/%d", pid, vids["TEE-S-RED"]), strings.NewReader(
+			`{"sku":"TEE-S-RED","stock":1}`,
+		))
+		req.AddCookie(mt)
+
+		TestRouter.ServeHTTP(res, req)
+		assert.Equal(http.StatusOK, res.Code)
+
+		res = httptest.NewRecorder()
+		req = httptest.NewRequest("POST", "/cart/checkout", nil)
+		req.AddCookie(at)
+
+		TestRouter.ServeHTTP(res, req)
+		assert.Equal(http.StatusConflict, res.Code)
+
+		c := handler.GetCartResponse{}
+		assert.Nil(json.NewDecoder(res.Body).Decode(&c))
+		assert.Equal("out_of_stock", c.Items[0].Issue)
+
+		res = httptest.NewRecorder()
+		req = httptest.NewRequest("POST", "/cart/refresh", nil)
+		req.AddCookie(at)
+
+		TestRouter.ServeHTTP(res, req)
+		assert.Equal(http.StatusOK, res.Code)
+
+		c = handler.GetCartResponse{}
+		assert.Nil(json.NewDecoder(res.Body).Decode(&c))
+		assert.True(c.Valid)
+		assert.Equal(int64(1), c.Items[0].Quantity)
+	})
+
+	var oid int64
+
+	t.Run("test checkout cart", func(t *testing.T) {
+		res := httptest.NewRecorder()
+		req := httptest.NewRequest("POST", "/cart/checkout", nil)
+		req.AddCookie(at)
+
+		TestRouter.ServeHTTP(res, req)
+		assert.Equal(http.StatusCreated, res.Code)
+
+		od := handler.CreateOrderResponse{}
+		assert.Nil(json.NewDecoder(res.Body).Decode(&od))
+		oid = od.OID
+
+		res = httptest.NewRecorder()
+		req = httptest.NewRequest("GET", fmt.Sprintf("/product/%d", pid), nil)
+
+		TestRouter.ServeHTTP(res, req)
+		assert.Equal(http.StatusOK, res.Code)
+
+		pd := handler.GetProductResponse{}
+		assert.Nil(json.NewDecoder(res.Body).Decode(&pd))
+		assert.Equal(int64(0), pd.Variants[0].Stock)
+		assert.Equal(int64(9), pd.Variants[1].Stock)
+	})
+
+	t.Run("test get order", func(t *testing.T) {
+		res := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", fmt.Sprintf("/order/%d", oid), nil)
+		req.AddCookie(at)
+
+		TestRouter.ServeHTTP(res, req)
+		assert.Equal(http.StatusOK, res.Code)
+
+		od := handler.GetOrderResponse{}
+		assert.Nil(json.NewDecoder(res.Body).Decode(&od))
+		assert.Len(od.Items, 2)
+		assert.Equal(vids["TEE-S-RED"], od.Items[0].VID)
+		assert.Equal(int64(2000), od.Items[0].Price.Amount)
+		assert.Equal(vids["TEE-L-BLUE"], od.Items[1].VID)
+		assert.Equal(int64(2500), od.Items[1].Price.Amount)
+	})
+
+	t.Run("test add cart item; sold out", func(t *testing.T) {
+		assert.Equal(http.StatusConflict, addItem(vids["TEE-S-RED"], 1))
+	})
+
+	// stocks returns the stock of the variants of the product.
+	stocks := func() []int64 {
+		res := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", fmt.Sprintf("/product/%d", pid), nil)
+
+		TestRouter.ServeHTTP(res, req)
+		assert.Equal(http.StatusOK, res.Code)
+
+		pd := handler.GetProductResponse{}
+		assert.Nil(json.NewDecoder(res.Body).Decode(&pd))
+
+		s := []int64{}
+		for _, v := range pd.Variants {
+			s = append(s, v.Stock)
+		}
+		return s
+	}
+
+	t.Run("test delete order; stock restored", func(t *testing.T) {
+		res := httptest.NewRecorder()
+		req := httptest.NewRequest("DELETE", fmt.Sprintf("/order/%d", oid), nil)
+		req.AddCookie(at)
+
+		TestRouter.ServeHTTP(res, req)
+		assert.Equal(http.StatusOK, res.Code)
+
+		assert.Equal([]int64{1, 10}, stocks())
+	})
+
+	t.Run("test update order; stock restored", func(t *testing.T) {
+		res := httptest.NewRecorder()
+		req := httptest.NewRequest("POST", "/product", strings.NewReader(`{"name":"variant plain tee","price":1500}`))
+		req.AddCookie(mt)
+
+		TestRouter.ServeHTTP(res, req)
+		assert.Equal(http.StatusCreated, res.Code)
+
+		pd := handler.CreateProductResponse{}
+		assert.Nil(json.NewDecoder(res.Body).Decode(&pd))
+
+		assert.Equal(http.StatusOK, addItem(vids["TEE-L-BLUE"], 2))
+
+		res = httptest.NewRecorder()
+		req = httptest.NewRequest("POST", "/cart/checkout", nil)
+		req.AddCookie(at)
+
+		TestRouter.ServeHTTP(res, req)
+		assert.Equal(http.StatusCreated, res.Code)
+
+		od := handler.CreateOrderResponse{}
+		assert.Nil(json.NewDecoder(res.Body).Decode(&od))
+		assert.Equal([]int64{1, 8}, stocks())
+
+		// the variant lines dropped by the update return to stock.
+		res = httptest.NewRecorder()
+		req = httptest.NewRequest("PUT", fmt.Sprintf("/order/%d", od.OID), strings.NewReader(fmt.Sprintf(`{"products":[%d]}`, pd.PID)))
+		req.AddCookie(at)
+
+		TestRouter.ServeHTTP(res, req)
+		assert.Equal(http.StatusOK, res.Code)
+
+		assert.Equal([]int64{1, 10}, stocks())
+	})
+
+	t.Run("test delete variant", func(t *testing.T) {
+		assert.Equal(http.StatusOK, addItem(vids["TEE-L-BLUE"], 1))
+
+		res := httptest.NewRecorder()
+		req := httptest.NewRequest("DELETE", fmt.Sprintf("/product/%d/variant/%d", pid+1, vids["TEE-L-BLUE"]), nil)
+		req.AddCookie(mt)
+
+		TestRouter.ServeHTTP(res, req)
+		assert.Equal(http.StatusNotFound, res.Code)
+
+		res = httptest.NewRecorder()
+		req = httptest.NewRequest("DELETE", fmt.Sprintf("/product/%d/variant/%d", pid, vids["TEE-L-BLUE"]), nil)
+		req.AddCookie(mt)
+
+		TestRouter.ServeHTTP(res, req)
+		assert.Equal(http.StatusOK, res.Code)
+
+		res = httptest.NewRecorder()
+		req = httptest.NewRequest("GET", "/cart", nil)
+		req.AddCookie(at)
+
+		TestRouter.ServeHTTP(res, req)
+		assert.Equal(http.StatusOK, res.Code)
+
+		c := handler.GetCartResponse{}
+		assert.Nil(json.NewDecoder(res.Body).Decode(&c))
+		assert.False(c.Valid)
+		assert.Equal("product_deleted", c.Items[0].Issue)
+	})
+}
@@ -1,8 +1,15 @@
 package handler_test
 
 import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
 	"simple-go-server/handler"
 	"simple-go-server/router"
+	"simple-go-server/token"
 )
 
 var TestRouter *router.Router
@@ -10,7 +17,37 @@ var TestRouter *router.Router
 // init initiate the router used to test handlers
 // before the test starts.
 func init() {
+	// tests send many requests from the same client,
+	// so the rate limits are relaxed for the shared router.
+	os.Setenv("RATE_LIMIT_LOGIN", "10000/m")
+	os.Setenv("RATE_LIMIT_SIGNUP", "10000/m")
+	os.Setenv("RATE_LIMIT_RESET", "10000/m")
+	os.Setenv("RATE_LIMIT_API", "10000/m")
+
 	r := handler.GetRouter()
 	TestRouter = &r
 	TestRouter.LoadAll()
 }
+
+// login logs in with the json body and returns the access-token cookie,
+// or nil if the login fails.
+func login(t *testing.T, body string) *http.Cookie {
+	t.Helper()
+
+	res := httptest.NewRecorder()
+	req := httptest.NewRequest("POST", "/login", strings.NewReader(body))
+
+	TestRouter.ServeHTTP(res, req)
+	if res.Code != http.StatusOK {
+		t.Errorf("login failure: %d %s", res.Code, res.Body.String())
+		return nil
+	}
+
+	for _, k := range res.Result().Cookies() {
+		if k.Name == token.ACCESS_TOKEN_NAME {
+			return k
+		}
+	}
+
+	return nil
+}
@@ -1,7 +1,17 @@
 package handler
 
 import (
+	"fmt"
 	"net/http"
+	"os"
+	"strings"
+
+	"simple-go-server/db"
+	"simple-go-server/logger"
+	"simple-go-server/metrics"
+	"simple-go-server/model"
+	"simple-go-server/policy"
+	"simple-go-server/ratelimit"
 	"simple-go-server/router"
 	"simple-go-server/token"
 
@@ -9,8 +19,30 @@ import (
 	"github.com/golang-jwt/jwt/v5"
 )
 
+// trustedProxies returns the proxies set by TRUSTED_PROXIES, comma separated ips or cidrs,
+// whose X-Forwarded-For headers give the client ip. No proxy is trusted by default,
+// so that clients cannot choose the ip their requests are limited by.
+func trustedProxies() []string {
+	proxies := []string{}
+	for _, p := range strings.Split(os.Getenv("TRUSTED_PROXIES"), ",") {
+		if p = strings.TrimSpace(p); p != "" {
+			proxies = append(proxies, p)
+		}
+	}
+	return proxies
+}
+
 func GetRouter() router.Router {
-	r := router.NewRouter(gin.Default())
+	e := gin.New()
+
+	if err := e.SetTrustedProxies(trustedProxies()); err != nil {
+		logger.Default().Warn("invalid TRUSTED_PROXIES, trusting no proxy", "error", err)
+		e.SetTrustedProxies(nil)
+	}
+
+	e.Use(logger.Middleware(), metrics.Middleware(), gin.CustomRecovery(handlePanic))
+
+	r := router.NewRouter(e)
 
 	r.NoRoute(func(c *gin.Context) {
 		writeMessage(c, http.StatusNotFound, "page not found")
@@ -18,22 +50,84 @@ func GetRouter() router.Router {
 
 	r.AddGet("/", handlePing)
 
+	registerHealthChecks()
+
+	r.AddGet("/healthz", handleHealthz)
+	r.AddGet("/readyz", handleReadyz)
+
+	r.AddGet("/metrics", metrics.Handler())
+
 	r.AddPost("/user", handleCreateUser) // user - post
 
 	r.AddGet("/user/:user_id", handleGetUser)
 	r.AddPut("/user/:user_id", handleUpdateUser)
 	r.AddDelete("/user/:user_id", handleDeleteUser)
 
+	r.AddPut("/user/:user_id/profile", handleUpdateProfile)
+	r.AddPost("/user/:user_id/email/verify", handleSendEmailVerification)
+	r.AddGet("/email/verify", handleVerifyEmail)
+
 	r.AddGet("/user/:user_id/orders", handleGetUserOrders)
+	r.AddGet("/user/:user_id/export", handleExportUser)
+	r.AddGet("/user/:user_id/logins", handleGetLoginHistory)
+	r.AddPost("/user/:user_id/unlock", handleUnlockUser)
+
+	r.AddGet("/users", handleGetUsers)
+	r.AddGet("/erasures", handleGetErasures)
+	r.AddPut("/user/:user_id/role", handleUpdateUserRole)
+	r.AddPost("/user/:user_id/suspend", handleSuspendUser)
+	r.AddPost("/user/:user_id/reactivate", handleReactivateUser)
+	r.AddPost("/user/:user_id/password/reset", handleForceResetPassword)
+
+	r.AddPost("/user/:user_id/2fa", handleEnrollTOTP)
+	r.AddPost("/user/:user_id/2fa/verify", handleVerifyTOTP)
+	r.AddDelete("/user/:user_id/2fa", handleDeleteTOTP)
 
 	r.AddPost("/login", handleLogin)
+	r.AddPost("/login/2fa", handleLoginSecondFactor)
+	r.AddPost("/login/2fa/enroll", handleLoginEnrollTOTP)
 	r.AddPost("/logout", handleLogout)
 
+	r.AddPost("/password/forgot", handleForgotPassword)
+	r.AddPost("/password/reset", handleResetPassword)
+
 	r.AddPost("/product", handleCreateProduct)
 
 	r.AddGet("/product/:pid", handleGetProduct)
 	r.AddPut("/product/:pid", handleUpdateProduct)
 	r.AddDelete("/product/:pid", handleDeleteProduct)
+	r.AddPut("/product/:pid/categories", handleSetProductCategories)
+
+	r.AddPost("/product/:pid/image", handleUploadProductImage)
+	r.AddDelete("/product/:pid/image/:iid", handleDeleteProductImage)
+	r.AddGet("/images/:key", handleGetImage)
+
+	r.AddPut("/product/:pid/options", handleSetProductOptions)
+	r.AddPost("/product/:pid/variant", handleCreateVariant)
+	r.AddPut("/product/:pid/variant/:vid", handleUpdateVariant)
+	r.AddDelete("/product/:pid/variant/:vid", handleDeleteVariant)
+
+	r.AddPost("/category", handleCreateCategory)
+
+	r.AddGet("/category/:cid", handleGetCategory)
+	r.AddPut("/category/:cid", handleUpdateCategory)
+	r.AddDelete("/category/:cid", handleDeleteCategory)
+
+	r.AddGet("/categories", handleGetCategories)
+	r.AddGet("/categories/:cid/products", handleGetCategoryProducts)
+
+	r.AddPost("/exchange-rate", handleCreateExchangeRate)
+	r.AddDelete("/exchange-rate/:rid", handleDeleteExchangeRate)
+	r.AddGet("/exchange-rates", handleGetExchangeRates)
+
+	r.AddPost("/coupon", handleCreateCoupon)
+	r.AddDelete("/coupon/:code", handleDeleteCoupon)
+	r.AddGet("/coupons", handleGetCoupons)
+
+	r.AddPost("/promotion", handleCreatePromotion)
+	r.AddDelete("/promotion/:prid", handleDeletePromotion)
+	r.AddGet("/promotions", handleGetPromotions)
+	r.AddPost("/promotions/dry-run", handleDryRunPromotions)
 
 	r.AddPost("/order", handleCreateOrder)
 
@@ -43,6 +137,16 @@ func GetRouter() router.Router {
 
 	r.AddGet("/orders", handleGetOrders)
 
+	r.AddGet("/cart", handleGetCart)
+	r.AddDelete("/cart", handleDeleteCart)
+	r.AddPost("/cart/items", handleAddCartItem)
+	r.AddPut("/cart/items/:pid", handleUpdateCartItem)
+	r.AddDelete("/cart/items/:pid", handleDeleteCartItem)
+	r.AddPost("/cart/refresh", handleRefreshCart)
+	r.AddPost("/cart/checkout", handleCheckoutCart)
+
+	setRateLimits(&r, ratelimit.NewLimiter(ratelimit.NewMemoryStore()))
+
 	return r
 }
 
@@ -52,42 +156,142 @@ func handlePing(c *gin.Context) {
 	})
 }
 
+// handlePanic responds with an internal server error
+// when a handler panics, instead of dropping the connection.
+func handlePanic(c *gin.Context, recovered any) {
+	requestLogger(c).Error("recovered from panic", "panic", recovered)
+	writeMessage(c, http.StatusInternalServerError, "internal server error")
+	c.Abort()
+}
+
 // checkToken checks whether the access-token exists in the cookie
 // and returns the Claims if it exists.
 func checkToken(c *gin.Context) (*token.Claims, bool) {
-	accessToken, err := c.Cookie(token.ACCESS_TOKEN_NAME)
+	claims, _, keep := verifyToken(c, token.ACCESS_TOKEN_NAME, token.PurposeAccess)
+	if !keep {
+		return nil, false
+	}
+
+	setUser(c, claims)
+
+	return claims, true
+}
+
+// optionalToken is checkToken for apis open to anonymous callers.
+// It returns nil Claims if there is no access-token in the cookie.
+func optionalToken(c *gin.Context) (*token.Claims, bool) {
+	if _, err := c.Cookie(token.ACCESS_TOKEN_NAME); err == http.ErrNoCookie {
+		return nil, true
+	}
+
+	return checkToken(c)
+}
+
+// verifyToken checks the jwt of the purpose in the cookie
+// and returns its Claims and the user it was issued to.
+// Tokens issued before the token version of the user changed are revoked.
+func verifyToken(c *gin.Context, cookie, purpose string) (*token.Claims, *model.User, bool) {
+	accessToken, err := c.Cookie(cookie)
 	if err != nil {
 		if err == http.ErrNoCookie {
 			writeMessage(c, http.StatusUnauthorized, "no cookie")
-			return nil, false
+			return nil, nil, false
 		}
 		writeMessage(c, http.StatusInternalServerError, "lookup cookie failure")
-		return nil, false
+		return nil, nil, false
 	}
 
 	claims, t, err := token.GetJWTToken(accessToken)
 	if err != nil {
 		if err == jwt.ErrSignatureInvalid {
 			writeMessage(c, http.StatusUnauthorized, "invalid jwt signature")
-			return nil, false
+			return nil, nil, false
 		}
 		writeMessage(c, http.StatusInternalServerError, "jwt signature check failure")
-		return nil, false
+		return nil, nil, false
 	}
 
-	if !t.Valid {
+	if !t.Valid || claims.Purpose != purpose {
 		writeMessage(c, http.StatusUnauthorized, "invalid jwt")
-		return nil, false
+		return nil, nil, false
 	}
 
-	return claims, true
+	d, err := db.Get()
+	if err != nil {
+		writeMessage(c, http.StatusInternalServerError, "db failure")
+		return nil, nil, false
+	}
+
+	user, err := d.SelectUserByUID(c.Request.Context(), claims.UID)
+	if err != nil {
+		writeMessage(c, http.StatusInternalServerError, fmt.Sprintf("%v", err))
+		return nil, nil, false
+	}
+
+	if user == nil || user.TokenVersion != claims.Version {
+		writeMessage(c, http.StatusUnauthorized, "revoked jwt")
+		return nil, nil, false
+	}
+
+	if user.Suspended {
+		writeMessage(c, http.StatusForbidden, "suspended user")
+		return nil, nil, false
+	}
+
+	return claims, user, true
 }
 
-func writeMessage(c *gin.Context, code int, msg string) {
-	c.JSON(
-		code,
-		gin.H{
-			"message": msg,
-		},
+// setUser binds the authenticated user to the request
+// so that logs written for the request hold the uid.
+func setUser(c *gin.Context, claims *token.Claims) {
+	c.Set(logger.UIDKey, claims.UID)
+
+	ctx := c.Request.Context()
+	c.Request = c.Request.WithContext(
+		logger.WithContext(ctx, logger.FromContext(ctx).With("uid", claims.UID)),
 	)
 }
+
+// requestLogger returns the logger bound to the request,
+// which writes the request id (and uid if authenticated) with every log.
+func requestLogger(c *gin.Context) *logger.Logger {
+	return logger.FromContext(c.Request.Context())
+}
+
+// writeMessage writes the message as a json response.
+// Error responses also hold the request id to be reported by clients.
+func writeMessage(c *gin.Context, code int, msg string) {
+	res := gin.H{
+		"message": msg,
+	}
+
+	if code >= http.StatusInternalServerError {
+		requestLogger(c).Error("internal error response", "message", msg)
+	}
+
+	if code >= http.StatusBadRequest {
+		if id := logger.RequestID(c.Request.Context()); id != "" {
+			res["request_id"] = id
+		}
+	}
+
+	c.JSON(code, res)
+}
+
+// writeViolations responds bad request with the message
+// and each policy violation in err.
+func writeViolations(c *gin.Context, msg string, err error) {
+	res := gin.H{
+		"message": msg,
+	}
+
+	if v, ok := err.(policy.Violations); ok {
+		res["violations"] = v
+	}
+
+	if id := logger.RequestID(c.Request.Context()); id != "" {
+		res["request_id"] = id
+	}
+
+	c.JSON(http.StatusBadRequest, res)
+}
@@ -7,7 +7,9 @@ import (
 	"testing"
 
 	"simple-go-server/db"
+	"simple-go-server/handler"
 
+	"github.com/gin-gonic/gin"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -32,3 +34,26 @@ func TestHandlePing(t *testing.T) {
 	assert.Nil(err)
 	assert.Equal(expectedResponse, string(response))
 }
+
+func TestHandlePanic(t *testing.T) {
+	expectedResponse := `{"message":"internal server error","request_id":"panic-test-1"}`
+
+	assert := assert.New(t)
+
+	r := handler.GetRouter()
+	r.AddGet("/panic", func(c *gin.Context) {
+		panic("test panic")
+	})
+	r.LoadAll()
+
+	res := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/panic", nil)
+	req.Header.Set("X-Request-ID", "panic-test-1")
+
+	r.ServeHTTP(res, req)
+	assert.Equal(http.StatusInternalServerError, res.Code)
+
+	response, err := io.ReadAll(res.Body)
+	assert.Nil(err)
+	assert.Equal(expectedResponse, string(response))
+}
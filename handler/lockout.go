@@ -0,0 +1,164 @@
+package handler
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"simple-go-server/db"
+	"simple-go-server/model"
+)
+
+// lockoutPolicy decides how failed logins slow down further attempts.
+type lockoutPolicy struct {
+	// window is the time after which failures are forgotten.
+	window time.Duration
+
+	// delayAfter is the number of failures of an account
+	// after which each attempt must wait a doubling delay.
+	delayAfter int64
+	baseDelay  time.Duration
+	maxDelay   time.Duration
+
+	// lockAfter is the number of failures of an account
+	// after which the account is locked for lockFor.
+	lockAfter int64
+	lockFor   time.Duration
+
+	// ipLockAfter is the number of failures from a client ip
+	// in the window after which the client ip is blocked.
+	ipLockAfter int
+}
+
+var loginPolicy = lockoutPolicy{
+	window:      15 * time.Minute,
+	delayAfter:  3,
+	baseDelay:   time.Second,
+	maxDelay:    time.Minute,
+	lockAfter:   10,
+	lockFor:     15 * time.Minute,
+	ipLockAfter: 30,
+}
+
+// delay returns the time to wait after the last failure
+// before the next attempt is allowed.
+func (p lockoutPolicy) delay(failures int64) time.Duration {
+	if failures < p.delayAfter {
+		return 0
+	}
+
+	d := p.baseDelay
+	for i := p.delayAfter; i < failures && d < p.maxDelay; i++ {
+		d *= 2
+	}
+
+	if d > p.maxDelay {
+		return p.maxDelay
+	}
+	return d
+}
+
+// retryAfter returns the time until the next login attempt
+// of the account is allowed, zero if allowed now.
+func (p lockoutPolicy) retryAfter(f *model.LoginFailure, now time.Time) time.Duration {
+	if f == nil {
+		return 0
+	}
+
+	if locked := time.Unix(f.LockedUntil, 0); now.Before(locked) {
+		return locked.Sub(now)
+	}
+
+	last := time.Unix(f.Last, 0)
+	if now.Sub(last) > p.window {
+		return 0
+	}
+
+	if next := last.Add(p.delay(f.Count)); now.Before(next) {
+		return next.Sub(now)
+	}
+
+	return 0
+}
+
+type ipFailure struct {
+	count int
+	first time.Time
+}
+
+// ipFailures counts failed logins per client ip in memory.
+type ipFailures struct {
+	mu       sync.Mutex
+	failures map[string]*ipFailure
+}
+
+var loginIPFailures = &ipFailures{
+	failures: map[string]*ipFailure{},
+}
+
+func (f *ipFailures) add(ip string, now time.Time) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for k, v := range f.failures {
+		if now.Sub(v.first) > loginPolicy.window {
+			delete(f.failures, k)
+		}
+	}
+
+	v, found := f.failures[ip]
+	if !found {
+		v = &ipFailure{first: now}
+		f.failures[ip] = v
+	}
+	v.count++
+}
+
+// retryAfter returns the time until the client ip is unblocked, zero if not blocked.
+func (f *ipFailures) retryAfter(ip string, now time.Time) time.Duration {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	v, found := f.failures[ip]
+	if !found || v.count < loginPolicy.ipLockAfter {
+		return 0
+	}
+
+	if until := v.first.Add(loginPolicy.window); now.Before(until) {
+		return until.Sub(now)
+	}
+
+	return 0
+}
+
+// loginRetryAfter returns the time until the client ip
+// may try to log in to the account, zero if allowed now.
+func loginRetryAfter(ctx context.Context, d *db.Database, userID, ip string) (time.Duration, error) {
+	now := time.Now()
+
+	if wait := loginIPFailures.retryAfter(ip, now); wait > 0 {
+		return wait, nil
+	}
+
+	f, err := d.SelectLoginFailure(ctx, userID)
+	if err != nil {
+		return 0, err
+	}
+
+	return loginPolicy.retryAfter(f, now), nil
+}
+
+// recordLoginFailure counts a failed attempt for the account and the client ip.
+func recordLoginFailure(ctx context.Context, d *db.Database, userID, ip string) error {
+	now := time.Now()
+
+	loginIPFailures.add(ip, now)
+
+	return d.IncrementLoginFailure(ctx, userID, now, now.Add(-loginPolicy.window), loginPolicy.lockAfter, now.Add(loginPolicy.lockFor))
+}
+
+// DeleteExpiredLoginFailures deletes the failed logins of the accounts
+// whose window and lock have both expired at now.
+func DeleteExpiredLoginFailures(ctx context.Context, d *db.Database, now time.Time) error {
+	return d.DeleteExpiredLoginFailures(ctx, now.Add(-loginPolicy.window), now)
+}
@@ -0,0 +1,86 @@
+package handler_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"simple-go-server/logger"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRequestID(t *testing.T) {
+	assert := assert.New(t)
+
+	t.Run("test request id; accepted from header", func(t *testing.T) {
+		res := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", "/product/abc", nil)
+		req.Header.Set("X-Request-ID", "client-id-1")
+
+		TestRouter.ServeHTTP(res, req)
+		assert.Equal(http.StatusBadRequest, res.Code)
+		assert.Equal("client-id-1", res.Header().Get("X-Request-ID"))
+		assert.Equal(`{"message":"invalid product id format","request_id":"client-id-1"}`, res.Body.String())
+	})
+
+	t.Run("test request id; generated", func(t *testing.T) {
+		res := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", "/product/abc", nil)
+		req.Header.Set("X-Request-ID", "invalid id\n")
+
+		TestRouter.ServeHTTP(res, req)
+		assert.Equal(http.StatusBadRequest, res.Code)
+
+		id := res.Header().Get("X-Request-ID")
+		assert.Len(id, 32)
+		assert.Contains(res.Body.String(), id)
+	})
+}
+
+func TestAccessLog(t *testing.T) {
+	assert := assert.New(t)
+
+	buf := new(bytes.Buffer)
+
+	old := logger.Default()
+	logger.SetDefault(logger.New(buf, logger.LevelDebug))
+	defer logger.SetDefault(old)
+
+	t.Run("test access log", func(t *testing.T) {
+		res := httptest.NewRecorder()
+		req := httptest.NewRequest("POST", "/login", strings.NewReader(
+			`{"user_id":"master01","password":"pwmaster01++"}`,
+		))
+		req.Header.Set("X-Request-ID", "access-log-1")
+
+		TestRouter.ServeHTTP(res, req)
+		assert.Equal(http.StatusOK, res.Code)
+
+		lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+
+		var entry map[string]interface{}
+
+		err := json.Unmarshal([]byte(lines[len(lines)-1]), &entry)
+		assert.Nil(err)
+		assert.Equal("info", entry["level"])
+		assert.Equal("request", entry["msg"])
+		assert.Equal("access-log-1", entry["request_id"])
+		assert.Equal("/login", entry["route"])
+		assert.Equal(float64(http.StatusOK), entry["status"])
+	})
+
+	t.Run("test redaction", func(t *testing.T) {
+		buf.Reset()
+
+		logger.Default().With("user_id", "master01").Info("test", "password", "pwmaster01++", "access-token", "abc.def")
+
+		assert.NotContains(buf.String(), "pwmaster01++")
+		assert.NotContains(buf.String(), "abc.def")
+		assert.Contains(buf.String(), `"password":"[REDACTED]"`)
+		assert.Contains(buf.String(), `"user_id":"master01"`)
+	})
+}
@@ -0,0 +1,15 @@
+package handler
+
+import "simple-go-server/metrics"
+
+var (
+	ordersCreated = metrics.NewCounterVec(
+		"orders_created_total",
+		"Total number of created orders.",
+	)
+	loginFailures = metrics.NewCounterVec(
+		"login_failures_total",
+		"Total number of failed logins by reason.",
+		"reason",
+	)
+)
@@ -0,0 +1,55 @@
+package handler_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHandleMetrics(t *testing.T) {
+	assert := assert.New(t)
+
+	t.Run("test request counted by route template", func(t *testing.T) {
+		res := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", "/product/99999999", nil)
+
+		TestRouter.ServeHTTP(res, req)
+		assert.Equal(http.StatusNotFound, res.Code)
+
+		res = httptest.NewRecorder()
+		req = httptest.NewRequest("GET", "/metrics", nil)
+
+		TestRouter.ServeHTTP(res, req)
+		assert.Equal(http.StatusOK, res.Code)
+		assert.True(strings.HasPrefix(res.Header().Get("Content-Type"), "text/plain"))
+
+		body := res.Body.String()
+		assert.Contains(body, `http_requests_total{method="GET",route="/product/:pid",status="404"}`)
+		assert.Contains(body, `http_request_duration_seconds_bucket{method="GET",route="/product/:pid",status="404",le="+Inf"}`)
+		assert.NotContains(body, "/product/99999999")
+	})
+
+	t.Run("test db and business metrics", func(t *testing.T) {
+		res := httptest.NewRecorder()
+		req := httptest.NewRequest("POST", "/login", strings.NewReader(
+			`{"user_id":"master01","password":"wrongpw01++"}`,
+		))
+
+		TestRouter.ServeHTTP(res, req)
+		assert.Equal(http.StatusUnauthorized, res.Code)
+
+		res = httptest.NewRecorder()
+		req = httptest.NewRequest("GET", "/metrics", nil)
+
+		TestRouter.ServeHTTP(res, req)
+		assert.Equal(http.StatusOK, res.Code)
+
+		body := res.Body.String()
+		assert.Contains(body, `login_failures_total{reason="wrong_password"}`)
+		assert.Contains(body, `db_transactions_total{result="commit"}`)
+		assert.Contains(body, "# TYPE db_open_connections gauge")
+	})
+}
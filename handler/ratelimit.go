@@ -0,0 +1,176 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"simple-go-server/logger"
+	"simple-go-server/model"
+	"simple-go-server/ratelimit"
+	"simple-go-server/router"
+	"simple-go-server/token"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	rateLimitLogin  = "login"
+	rateLimitSignup = "signup"
+	rateLimitReset  = "reset"
+	rateLimitAPI    = "api"
+)
+
+// defaultRateLimits are the rules of each route class,
+// overridden by RATE_LIMIT_<CLASS> (e.g. RATE_LIMIT_LOGIN=10/m).
+var defaultRateLimits = map[string]string{
+	rateLimitLogin:  "10/m",
+	rateLimitSignup: "10/h",
+	rateLimitReset:  "5/h",
+	rateLimitAPI:    "300/m",
+}
+
+// rateLimitRule returns the rule of the route class.
+func rateLimitRule(class string) ratelimit.Rule {
+	env := "RATE_LIMIT_" + strings.ToUpper(class)
+
+	if v := os.Getenv(env); v != "" {
+		rule, err := ratelimit.ParseRule(class, v)
+		if err == nil {
+			return rule
+		}
+		logger.Default().Warn("invalid rate limit rule, using default", "env", env, "value", v)
+	}
+
+	rule, err := ratelimit.ParseRule(class, defaultRateLimits[class])
+	if err != nil {
+		panic(err)
+	}
+
+	return rule
+}
+
+// setRateLimits limits the routes of r by their classes.
+// Every route is limited per user (or client ip if not logged in),
+// login additionally per client ip and per account,
+// sign up and password reset per client ip,
+// and email verification mails per user.
+func setRateLimits(r *router.Router, limiter *ratelimit.Limiter) {
+	r.Use(rateLimit(limiter, rateLimitRule(rateLimitAPI), exceptProbes(byUser)))
+
+	r.AddMiddleware(http.MethodPost, "/login", rateLimit(limiter, rateLimitRule(rateLimitLogin), byClientIP, byLoginAccount))
+	r.AddMiddleware(http.MethodPost, "/login/2fa", rateLimit(limiter, rateLimitRule(rateLimitLogin), byClientIP))
+	r.AddMiddleware(http.MethodPost, "/user", rateLimit(limiter, rateLimitRule(rateLimitSignup), byClientIP))
+	r.AddMiddleware(http.MethodPost, "/password/forgot", rateLimit(limiter, rateLimitRule(rateLimitReset), byClientIP))
+	r.AddMiddleware(http.MethodPost, "/password/reset", rateLimit(limiter, rateLimitRule(rateLimitReset), byClientIP))
+	r.AddMiddleware(http.MethodPost, "/user/:user_id/email/verify", rateLimit(limiter, rateLimitRule(rateLimitReset), byUser))
+}
+
+// keyFunc returns the key of the request whose requests share a bucket.
+// An empty key is not limited.
+type keyFunc func(c *gin.Context) string
+
+// probes are polled by monitoring systems and never limited.
+var probes = map[string]struct{}{
+	"/healthz": {},
+	"/readyz":  {},
+	"/metrics": {},
+}
+
+func exceptProbes(f keyFunc) keyFunc {
+	return func(c *gin.Context) string {
+		if _, found := probes[c.FullPath()]; found {
+			return ""
+		}
+		return f(c)
+	}
+}
+
+func byClientIP(c *gin.Context) string {
+	return "ip:" + c.ClientIP()
+}
+
+// byUser returns the uid in a valid access-token, or the client ip.
+func byUser(c *gin.Context) string {
+	if at, err := c.Cookie(token.ACCESS_TOKEN_NAME); err == nil {
+		if claims, t, err := token.GetJWTToken(at); err == nil && t.Valid {
+			return fmt.Sprintf("uid:%d", claims.UID)
+		}
+	}
+
+	return byClientIP(c)
+}
+
+// byLoginAccount returns the user id or email the client tries to log in,
+// leaving the request body readable by the handler.
+func byLoginAccount(c *gin.Context) string {
+	body, err := io.ReadAll(io.LimitReader(c.Request.Body, 1<<20))
+	if err != nil {
+		return ""
+	}
+	c.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+	req := LoginRequest{}
+	if err := json.Unmarshal(body, &req); err != nil {
+		return ""
+	}
+
+	if req.Email != "" {
+		return "account:" + model.NormalizeEmail(req.Email)
+	}
+
+	if req.UserID == "" {
+		return ""
+	}
+
+	return "account:" + strings.ToLower(req.UserID)
+}
+
+// rateLimit returns a middleware which responds 429 if any key of the request
+// is out of tokens. RateLimit-* headers are set on every response.
+func rateLimit(limiter *ratelimit.Limiter, rule ratelimit.Rule, keyFuncs ...keyFunc) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if rule.Disabled() {
+			return
+		}
+
+		keys := []string{}
+		for _, f := range keyFuncs {
+			if k := f(c); k != "" {
+				keys = append(keys, k)
+			}
+		}
+
+		if len(keys) == 0 {
+			return
+		}
+
+		res, err := limiter.Allow(c.Request.Context(), rule, keys...)
+		if err != nil {
+			// the limiter backend must not take the api down.
+			requestLogger(c).Error("rate limiter failure", "class", rule.Class, "error", err)
+			return
+		}
+
+		c.Header("RateLimit-Limit", strconv.Itoa(res.Limit))
+		c.Header("RateLimit-Remaining", strconv.Itoa(res.Remaining))
+		c.Header("RateLimit-Reset", ceilSeconds(res.Reset))
+
+		if !res.Allowed {
+			c.Header("Retry-After", ceilSeconds(res.RetryAfter))
+			writeMessage(c, http.StatusTooManyRequests, "too many requests")
+			c.Abort()
+		}
+	}
+}
+
+func ceilSeconds(d time.Duration) string {
+	return strconv.Itoa(int(math.Ceil(d.Seconds())))
+}
@@ -0,0 +1,121 @@
+package handler_test
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"simple-go-server/handler"
+	"simple-go-server/router"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRateLimit(t *testing.T) {
+	assert := assert.New(t)
+
+	t.Setenv("RATE_LIMIT_LOGIN", "2/m")
+	t.Setenv("RATE_LIMIT_API", "5/m")
+
+	r := handler.GetRouter()
+	r.LoadAll()
+
+	t.Run("test login; limited per account", func(t *testing.T) {
+		for i := 0; i < 2; i++ {
+			res := httptest.NewRecorder()
+			req := httptest.NewRequest("POST", "/login", strings.NewReader(
+				`{"user_id":"ratelimit1","password":"rl1234++"}`,
+			))
+
+			r.ServeHTTP(res, req)
+			assert.NotEqual(http.StatusTooManyRequests, res.Code)
+			assert.Equal("2", res.Header().Get("RateLimit-Limit"))
+			assert.Equal(strconv.Itoa(1-i), res.Header().Get("RateLimit-Remaining"))
+		}
+
+		res := httptest.NewRecorder()
+		req := httptest.NewRequest("POST", "/login", strings.NewReader(
+			`{"user_id":"ratelimit1","password":"rl1234++"}`,
+		))
+
+		r.ServeHTTP(res, req)
+		assert.Equal(http.StatusTooManyRequests, res.Code)
+		assert.Equal("0", res.Header().Get("RateLimit-Remaining"))
+
+		retryAfter, err := strconv.Atoi(res.Header().Get("Retry-After"))
+		assert.Nil(err)
+		assert.Greater(retryAfter, 0)
+		assert.LessOrEqual(retryAfter, 30)
+	})
+
+	t.Run("test api; limited per client", func(t *testing.T) {
+		codes := []int{}
+		for i := 0; i < 4; i++ {
+			res := httptest.NewRecorder()
+			req := httptest.NewRequest("GET", "/product/1", nil)
+
+			r.ServeHTTP(res, req)
+			codes = append(codes, res.Code)
+		}
+
+		// the client already sent three requests to /login.
+		assert.NotEqual(http.StatusTooManyRequests, codes[0])
+		assert.NotEqual(http.StatusTooManyRequests, codes[1])
+		assert.Equal(http.StatusTooManyRequests, codes[2])
+		assert.Equal(http.StatusTooManyRequests, codes[3])
+	})
+
+	t.Run("test probes; not limited", func(t *testing.T) {
+		res := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", "/healthz", nil)
+
+		r.ServeHTTP(res, req)
+		assert.Equal(http.StatusOK, res.Code)
+		assert.Empty(res.Header().Get("RateLimit-Limit"))
+	})
+}
+
+func TestRateLimitClientIP(t *testing.T) {
+	assert := assert.New(t)
+
+	t.Setenv("RATE_LIMIT_RESET", "2/m")
+
+	// forgot sends a password reset request from the address through the forwarded ip.
+	forgot := func(r *router.Router, remoteAddr, forwardedFor string) int {
+		res := httptest.NewRecorder()
+		req := httptest.NewRequest("POST", "/password/forgot", strings.NewReader(`{"user_id":"ratelimitip1"}`))
+		req.RemoteAddr = remoteAddr
+		req.Header.Set("X-Forwarded-For", forwardedFor)
+
+		r.ServeHTTP(res, req)
+		return res.Code
+	}
+
+	t.Run("test spoofed forwarded ip; same bucket", func(t *testing.T) {
+		r := handler.GetRouter()
+		r.LoadAll()
+
+		assert.Equal(http.StatusAccepted, forgot(&r, "192.0.2.1:1234", "198.51.100.1"))
+		assert.Equal(http.StatusAccepted, forgot(&r, "192.0.2.1:1234", "198.51.100.2"))
+		assert.Equal(http.StatusTooManyRequests, forgot(&r, "192.0.2.1:1234", "198.51.100.3"))
+	})
+
+	t.Run("test trusted proxy; forwarded ip", func(t *testing.T) {
+		t.Setenv("TRUSTED_PROXIES", "192.0.2.0/24")
+
+		r := handler.GetRouter()
+		r.LoadAll()
+
+		for i := 1; i <= 3; i++ {
+			assert.Equal(http.StatusAccepted, forgot(&r, "192.0.2.1:1234", fmt.Sprintf("198.51.100.%d", i)))
+		}
+
+		// the forwarded ip of a client that is not a proxy is ignored.
+		assert.Equal(http.StatusAccepted, forgot(&r, "203.0.113.1:1234", "198.51.100.4"))
+		assert.Equal(http.StatusAccepted, forgot(&r, "203.0.113.1:1234", "198.51.100.5"))
+		assert.Equal(http.StatusTooManyRequests, forgot(&r, "203.0.113.1:1234", "198.51.100.6"))
+	})
+}
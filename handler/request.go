@@ -1,7 +1,26 @@
 package handler
 
+import "simple-go-server/model"
+
+// LoginRequest holds either the user id or the email of the user.
 type LoginRequest struct {
 	UserID   string `json:"user_id"`
+	Email    string `json:"email"`
+	Password string `json:"password"`
+}
+
+// SecondFactorRequest holds either a totp code or a recovery code.
+type SecondFactorRequest struct {
+	Code         string `json:"code"`
+	RecoveryCode string `json:"recovery_code"`
+}
+
+type ForgotPasswordRequest struct {
+	UserID string `json:"user_id"`
+}
+
+type ResetPasswordRequest struct {
+	Token    string `json:"token"`
 	Password string `json:"password"`
 }
 
@@ -9,6 +28,7 @@ type CreateUserRequest struct {
 	UserID   string `json:"user_id"`
 	Password string `json:"password"`
 	Role     string `json:"role"`
+	model.Profile
 }
 
 type UpdateUserRequest struct {
@@ -16,20 +36,143 @@ type UpdateUserRequest struct {
 	Role     string `json:"role"`
 }
 
+type UpdateProfileRequest struct {
+	model.Profile
+}
+
+type UpdateUserRoleRequest struct {
+	Role string `json:"role"`
+}
+
+// CreateProductRequest creates a published product unless published is false.
+// A price given as a bare amount is in model.DefaultCurrency.
 type CreateProductRequest struct {
-	Name  string `json:"name"`
-	Price int64  `json:"price"`
+	Name        string                  `json:"name"`
+	Price       model.Money             `json:"price"`
+	Description string                  `json:"description"`
+	Attributes  model.ProductAttributes `json:"attributes"`
+	Published   *bool                   `json:"published"`
 }
 
+// UpdateProductRequest keeps the description, attributes and published flag if they are omitted.
+// A price given as a bare amount keeps the currency of the product.
 type UpdateProductRequest struct {
-	Name  string `json:"name"`
-	Price int64  `json:"price"`
+	Name        string                   `json:"name"`
+	Price       model.Money              `json:"price"`
+	Description *string                  `json:"description"`
+	Attributes  *model.ProductAttributes `json:"attributes"`
+	Published   *bool                    `json:"published"`
 }
 
 type CreateOrderRequest struct {
 	Products []int64 `json:"products"`
+	// Coupon is the code of a coupon to redeem for the order, if any.
+	Coupon string `json:"coupon"`
+}
+
+// CheckoutCartRequest is the optional body of a checkout.
+type CheckoutCartRequest struct {
+	// Coupon is the code of a coupon to redeem for the order, if any.
+	Coupon string `json:"coupon"`
 }
 
 type UpdateOrderRequest struct {
 	Products []int64 `json:"products"`
 }
+
+type AddCartItemRequest struct {
+	PID int64 `json:"pid"`
+	// VID is required for products with variants.
+	VID      int64 `json:"vid"`
+	Quantity int64 `json:"quantity"`
+}
+
+type UpdateCartItemRequest struct {
+	Quantity int64 `json:"quantity"`
+}
+
+type CreateCategoryRequest struct {
+	Name     string `json:"name"`
+	Slug     string `json:"slug"`
+	Parent   int64  `json:"parent"`
+	Position int64  `json:"position"`
+}
+
+type UpdateCategoryRequest struct {
+	Name     string `json:"name"`
+	Slug     string `json:"slug"`
+	Parent   int64  `json:"parent"`
+	Position int64  `json:"position"`
+}
+
+type SetProductCategoriesRequest struct {
+	Categories []int64 `json:"categories"`
+}
+
+type SetProductOptionsRequest struct {
+	Options model.ProductOptions `json:"options"`
+}
+
+// CreateVariantRequest overrides the product price unless price is null.
+// A price given as a bare amount is in the currency of the product.
+type CreateVariantRequest struct {
+	SKU     string            `json:"sku"`
+	Options map[string]string `json:"options"`
+	Price   *model.Money      `json:"price"`
+	Stock   int64             `json:"stock"`
+}
+
+// CreateExchangeRateRequest creates a rate effective from now unless effective is given.
+type CreateExchangeRateRequest struct {
+	Base      model.Currency `json:"base"`
+	Quote     model.Currency `json:"quote"`
+	Rate      string         `json:"rate"`
+	Effective int64          `json:"effective"`
+}
+
+// CreateCouponRequest creates a coupon. The amount and the minimum order
+// are bare numbers of minor units or money objects of a single currency.
+type CreateCouponRequest struct {
+	Code           string      `json:"code"`
+	Kind           string      `json:"kind"`
+	Percent        int64       `json:"percent"`
+	Amount         model.Money `json:"amount"`
+	MinOrder       model.Money `json:"min_order"`
+	Products       []int64     `json:"products"`
+	Categories     []int64     `json:"categories"`
+	MaxUses        int64       `json:"max_uses"`
+	MaxUsesPerUser int64       `json:"max_uses_per_user"`
+	Starts         int64       `json:"starts"`
+	Ends           int64       `json:"ends"`
+}
+
+// CreatePromotionRequest creates a promotion of the rule, see model.PromotionRule.
+// Bare prices of the rule are in the default currency.
+type CreatePromotionRequest struct {
+	Name     string              `json:"name"`
+	Kind     string              `json:"kind"`
+	Priority int64               `json:"priority"`
+	Rule     model.PromotionRule `json:"rule"`
+	Starts   int64               `json:"starts"`
+	Ends     int64               `json:"ends"`
+}
+
+// DryRunPromotionsRequest evaluates the promotions of the request, or the stored promotions if none,
+// on the items at the date, or now.
+type DryRunPromotionsRequest struct {
+	Items      []DryRunItem             `json:"items"`
+	Promotions []CreatePromotionRequest `json:"promotions"`
+	Date       int64                    `json:"date"`
+}
+
+type DryRunItem struct {
+	PID      int64 `json:"pid"`
+	VID      int64 `json:"vid"`
+	Quantity int64 `json:"quantity"`
+}
+
+type UpdateVariantRequest struct {
+	SKU   string       `json:"sku"`
+	Price *model.Money `json:"price"`
+	Stock int64        `json:"stock"`
+}
@@ -7,13 +7,58 @@ type LoginResponse struct {
 	Message string `json:"message"`
 }
 
+type EnrollTOTPResponse struct {
+	Secret        string   `json:"secret"`
+	URI           string   `json:"uri"`
+	RecoveryCodes []string `json:"recovery_codes"`
+	Message       string   `json:"message"`
+}
+
+type GetLoginHistoryResponse struct {
+	UID    int64                `json:"uid"`
+	Logins []model.LoginHistory `json:"logins"`
+}
+
 type CreateUserResponse struct {
 	UID     int64  `json:"uid"`
 	Message string `json:"message"`
 }
 
+// GetUserResponse is the user seen by anonymous callers and other users.
 type GetUserResponse struct {
-	model.User
+	model.PublicUser
+}
+
+// GetPrivateUserResponse is the user seen by the user itself and managers.
+type GetPrivateUserResponse struct {
+	model.PrivateUser
+}
+
+type GetUsersResponse struct {
+	Users   []model.PrivateUser `json:"users"`
+	Page    int                 `json:"page"`
+	PerPage int                 `json:"per_page"`
+	Total   int64               `json:"total"`
+}
+
+// ExportUserResponse is the archive of all the data kept about a user.
+type ExportUserResponse struct {
+	ExportedAt   int64                `json:"exported_at"`
+	Profile      model.PrivateUser    `json:"profile"`
+	Orders       []ExportOrder        `json:"orders"`
+	Logins       []model.LoginHistory `json:"logins"`
+	SecondFactor bool                 `json:"second_factor"`
+	Cart         []model.CartItem     `json:"cart"`
+}
+
+type ExportOrder struct {
+	OID      int64   `json:"oid"`
+	Date     int64   `json:"date"`
+	Products []int64 `json:"products"`
+}
+
+type GetErasuresResponse struct {
+	Erasures []model.Erasure `json:"erasures"`
 }
 
 type CreateProductResponse struct {
@@ -23,6 +68,72 @@ type CreateProductResponse struct {
 
 type GetProductResponse struct {
 	model.Product
+	Categories []int64 `json:"categories"`
+	// Options are the axes of the variant matrix, and Variants its cells.
+	Options  model.ProductOptions `json:"options"`
+	Variants []model.Variant      `json:"variants"`
+	Images   []ProductImageLink   `json:"images"`
+	// ExchangeRates are the rates the prices are converted at
+	// to the currency of the currency query.
+	ExchangeRates []model.ExchangeRate `json:"exchange_rates,omitempty"`
+}
+
+// ProductImageLink is a product image with the urls it is served at.
+type ProductImageLink struct {
+	IID          int64  `json:"iid"`
+	URL          string `json:"url"`
+	ThumbnailURL string `json:"thumbnail_url"`
+	Width        int    `json:"width"`
+	Height       int    `json:"height"`
+}
+
+type CreateProductImageResponse struct {
+	IID          int64  `json:"iid"`
+	URL          string `json:"url"`
+	ThumbnailURL string `json:"thumbnail_url"`
+	Message      string `json:"message"`
+}
+
+type CreateExchangeRateResponse struct {
+	RID     int64  `json:"rid"`
+	Message string `json:"message"`
+}
+
+type GetExchangeRatesResponse struct {
+	Rates []model.ExchangeRate `json:"rates"`
+}
+
+type CreateCouponResponse struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+type GetCouponsResponse struct {
+	Coupons []model.Coupon `json:"coupons"`
+}
+
+type CreatePromotionResponse struct {
+	PRID    int64  `json:"prid"`
+	Message string `json:"message"`
+}
+
+type GetPromotionsResponse struct {
+	Promotions []model.Promotion `json:"promotions"`
+}
+
+// DryRunPromotionsResponse is the evaluation of promotions on items at their current prices.
+type DryRunPromotionsResponse struct {
+	Items    []model.OrderProduct `json:"items"`
+	Subtotal model.Money          `json:"subtotal"`
+	// Results explain each promotion, applied or not, in order of evaluation.
+	Results  []model.PromotionResult `json:"results"`
+	Discount model.Money             `json:"discount"`
+	Total    model.Money             `json:"total"`
+}
+
+type CreateVariantResponse struct {
+	VID     int64  `json:"vid"`
+	Message string `json:"message"`
 }
 
 type CreateOrderResponse struct {
@@ -31,10 +142,23 @@ type CreateOrderResponse struct {
 }
 
 type GetOrderResponse struct {
-	OID      int64   `json:"oid"`
-	UID      int64   `json:"uid"`
-	Products []int64 `json:"products"`
-	Date     string  `json:"date"`
+	OID      int64                `json:"oid"`
+	UID      int64                `json:"uid"`
+	Products []int64              `json:"products"`
+	Items    []model.OrderProduct `json:"items"`
+	// Subtotal is the sum of the items at their unit prices at checkout.
+	Subtotal model.Money `json:"subtotal"`
+	// Discounts are the discounts of the items, and Discount is their sum.
+	Discounts []model.OrderDiscount `json:"discounts"`
+	Discount  model.Money           `json:"discount"`
+	// Total is the subtotal less the discount.
+	Total model.Money `json:"total"`
+	Date  string      `json:"date"`
+	// ExchangeRate is the rate recorded at purchase, if the user chose a currency.
+	ExchangeRate *model.ExchangeRate `json:"exchange_rate,omitempty"`
+	// ExchangeRates are the rates the prices are converted at
+	// to the currency of the currency query.
+	ExchangeRates []model.ExchangeRate `json:"exchange_rates,omitempty"`
 }
 
 type GetUserOrdersResponse struct {
@@ -45,3 +169,62 @@ type GetUserOrdersResponse struct {
 type GetOrdersResponse struct {
 	Orders []string `json:"orders"`
 }
+
+// CartLine is a cart item priced at the current product or variant price.
+type CartLine struct {
+	PID  int64  `json:"pid"`
+	VID  int64  `json:"vid"`
+	Name string `json:"name"`
+	// SKU and Options describe the variant, if any.
+	SKU      string            `json:"sku,omitempty"`
+	Options  map[string]string `json:"options,omitempty"`
+	Quantity int64             `json:"quantity"`
+	// AddedPrice is the price of the product when it was added.
+	AddedPrice model.Money `json:"added_price"`
+	Price      model.Money `json:"price"`
+	Subtotal   model.Money `json:"subtotal"`
+	// Issue is set if the product is deleted or repriced since it was added,
+	// if its variant has less stock than the quantity,
+	// or if it is priced in another currency than the cart.
+	Issue string `json:"issue,omitempty"`
+}
+
+type GetCartResponse struct {
+	UID   int64      `json:"uid"`
+	Items []CartLine `json:"items"`
+	// Total is the sum of the items in the currency of the cart,
+	// which is the currency of its earliest item.
+	Total model.Money `json:"total"`
+	// Valid is false if any item has an issue,
+	// which must be accepted before the checkout.
+	Valid bool `json:"valid"`
+}
+
+type CreateCategoryResponse struct {
+	CID     int64  `json:"cid"`
+	Message string `json:"message"`
+}
+
+type GetCategoryResponse struct {
+	model.Category
+}
+
+// CategoryNode is a category with its children, in the order of their positions.
+type CategoryNode struct {
+	model.Category
+	Children []CategoryNode `json:"children"`
+}
+
+type GetCategoriesResponse struct {
+	Categories []CategoryNode `json:"categories"`
+}
+
+type GetCategoryProductsResponse struct {
+	Products []model.Product `json:"products"`
+	Page     int             `json:"page"`
+	PerPage  int             `json:"per_page"`
+	Total    int64           `json:"total"`
+	// ExchangeRates are the rates the prices are converted at
+	// to the currency of the currency query.
+	ExchangeRates []model.ExchangeRate `json:"exchange_rates,omitempty"`
+}
@@ -0,0 +1,129 @@
+package hasher
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"strings"
+
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/argon2"
+)
+
+// The defaults follow the OWASP recommendation for argon2id.
+const (
+	DefaultArgon2Memory  = 19 * 1024 // KiB
+	DefaultArgon2Time    = 2
+	DefaultArgon2Threads = 1
+
+	argon2SaltLen = 16
+	argon2KeyLen  = 32
+
+	argon2Prefix = "$argon2id$"
+)
+
+// Argon2id hashes passwords with argon2id,
+// encoded in the PHC string format:
+//
+//	$argon2id$v=19$m=<memory>,t=<time>,p=<threads>$<salt>$<hash>
+type Argon2id struct {
+	// Memory is the memory cost in KiB.
+	Memory uint32
+	// Time is the number of passes over the memory.
+	Time uint32
+	// Threads is the degree of parallelism.
+	Threads uint8
+}
+
+type argon2Hash struct {
+	params Argon2id
+	salt   []byte
+	key    []byte
+}
+
+var argon2Encoding = base64.RawStdEncoding
+
+func (a Argon2id) Hash(password string) (string, error) {
+	salt := make([]byte, argon2SaltLen)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+
+	key := argon2.IDKey([]byte(password), salt, a.Time, a.Memory, a.Threads, argon2KeyLen)
+
+	return fmt.Sprintf(
+		"%sv=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2Prefix,
+		argon2.Version,
+		a.Memory, a.Time, a.Threads,
+		argon2Encoding.EncodeToString(salt),
+		argon2Encoding.EncodeToString(key),
+	), nil
+}
+
+func (Argon2id) Identify(encoded string) bool {
+	return strings.HasPrefix(encoded, argon2Prefix)
+}
+
+func (Argon2id) Verify(password, encoded string) (bool, error) {
+	h, err := parseArgon2(encoded)
+	if err != nil {
+		return false, err
+	}
+
+	p := h.params
+	key := argon2.IDKey([]byte(password), h.salt, p.Time, p.Memory, p.Threads, uint32(len(h.key)))
+
+	return subtle.ConstantTimeCompare(key, h.key) == 1, nil
+}
+
+func (a Argon2id) NeedsRehash(encoded string) bool {
+	h, err := parseArgon2(encoded)
+	if err != nil {
+		return true
+	}
+
+	return h.params != a || len(h.key) != argon2KeyLen
+}
+
+func parseArgon2(encoded string) (*argon2Hash, error) {
+	e := errors.Errorf("invalid argon2id hash")
+
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 6 || parts[1] != "argon2id" {
+		return nil, e
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil {
+		return nil, errors.WithMessage(e, "invalid version")
+	}
+
+	if version != argon2.Version {
+		return nil, errors.WithMessage(e, "unsupported version")
+	}
+
+	h := argon2Hash{}
+
+	p := &h.params
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &p.Memory, &p.Time, &p.Threads); err != nil {
+		return nil, errors.WithMessage(e, "invalid parameters")
+	}
+
+	if p.Memory == 0 || p.Time == 0 || p.Threads == 0 {
+		return nil, errors.WithMessage(e, "invalid parameters")
+	}
+
+	var err error
+
+	if h.salt, err = argon2Encoding.DecodeString(parts[4]); err != nil {
+		return nil, errors.WithMessage(e, "invalid salt")
+	}
+
+	if h.key, err = argon2Encoding.DecodeString(parts[5]); err != nil || len(h.key) == 0 {
+		return nil, errors.WithMessage(e, "invalid key")
+	}
+
+	return &h, nil
+}
@@ -0,0 +1,115 @@
+package hasher
+
+import (
+	"math"
+	"os"
+	"strconv"
+	"sync"
+
+	"simple-go-server/logger"
+)
+
+// Hasher hashes passwords into encoded strings holding the algorithm
+// and its parameters, so that hashes of different algorithms and costs
+// can be verified side by side.
+type Hasher interface {
+	// Hash returns the encoded hash of the password.
+	Hash(password string) (string, error)
+	// Identify returns true if the encoded hash is of the algorithm of the hasher.
+	Identify(encoded string) bool
+	// Verify returns true if the encoded hash is the hash of the password.
+	Verify(password, encoded string) (bool, error)
+	// NeedsRehash returns true if the encoded hash was not created
+	// with the algorithm and parameters of the hasher.
+	NeedsRehash(encoded string) bool
+}
+
+var (
+	mu  sync.RWMutex
+	std Hasher
+)
+
+// Default returns the hasher set by PASSWORD_HASHER,
+// "argon2id" (default) or "bcrypt", with the costs set by the environment.
+func Default() Hasher {
+	mu.RLock()
+	h := std
+	mu.RUnlock()
+
+	if h != nil {
+		return h
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	if std == nil {
+		std = fromEnv()
+	}
+
+	return std
+}
+
+// SetDefault replaces the default hasher.
+func SetDefault(h Hasher) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	std = h
+}
+
+// Verify returns true if the encoded hash, of any supported algorithm,
+// is the hash of the password.
+func Verify(password, encoded string) bool {
+	for _, h := range []Hasher{Default(), Argon2id{}, Bcrypt{}} {
+		if !h.Identify(encoded) {
+			continue
+		}
+
+		ok, err := h.Verify(password, encoded)
+		return err == nil && ok
+	}
+
+	return false
+}
+
+// NeedsRehash returns true if the encoded hash should be replaced
+// by a hash of the default hasher.
+func NeedsRehash(encoded string) bool {
+	return Default().NeedsRehash(encoded)
+}
+
+func fromEnv() Hasher {
+	switch v := os.Getenv("PASSWORD_HASHER"); v {
+	case "bcrypt":
+		return Bcrypt{
+			Cost: envInt("BCRYPT_COST", DefaultBcryptCost, maxBcryptCost),
+		}
+	case "", "argon2id":
+	default:
+		logger.Default().Warn("unknown PASSWORD_HASHER, using argon2id", "value", v)
+	}
+
+	return Argon2id{
+		Memory:  uint32(envInt("ARGON2_MEMORY", DefaultArgon2Memory, math.MaxInt32)),
+		Time:    uint32(envInt("ARGON2_TIME", DefaultArgon2Time, math.MaxInt32)),
+		Threads: uint8(envInt("ARGON2_THREADS", DefaultArgon2Threads, math.MaxUint8)),
+	}
+}
+
+// envInt returns the integer set by key, or def if it is not set
+// or outside 1..max, so that it fits the parameter it is converted to.
+func envInt(key string, def, max int) int {
+	v := os.Getenv(key)
+	if v == "" {
+		return def
+	}
+
+	n, err := strconv.Atoi(v)
+	if err != nil || n <= 0 || n > max {
+		logger.Default().Warn("invalid "+key+", using default", "value", v)
+		return def
+	}
+
+	return n
+}
@@ -0,0 +1,143 @@
+package hasher_test
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"simple-go-server/hasher"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestArgon2id(t *testing.T) {
+	assert := assert.New(t)
+
+	h := hasher.Argon2id{Memory: 8 * 1024, Time: 1, Threads: 1}
+
+	encoded, err := h.Hash("pw1234++")
+	assert.Nil(err)
+	assert.True(strings.HasPrefix(encoded, "$argon2id$v=19$m=8192,t=1,p=1$"))
+	assert.True(h.Identify(encoded))
+
+	ok, err := h.Verify("pw1234++", encoded)
+	assert.Nil(err)
+	assert.True(ok)
+
+	ok, err = h.Verify("pw1234--", encoded)
+	assert.Nil(err)
+	assert.False(ok)
+
+	assert.False(h.NeedsRehash(encoded))
+	assert.True(hasher.Argon2id{Memory: 8 * 1024, Time: 2, Threads: 1}.NeedsRehash(encoded))
+
+	_, err = h.Verify("pw1234++", "$argon2id$v=19$m=0,t=1,p=1$c2FsdA$a2V5")
+	assert.NotNil(err)
+}
+
+func TestBcrypt(t *testing.T) {
+	assert := assert.New(t)
+
+	h := hasher.Bcrypt{Cost: 4}
+
+	encoded, err := h.Hash("pw1234++")
+	assert.Nil(err)
+	assert.True(h.Identify(encoded))
+
+	ok, err := h.Verify("pw1234++", encoded)
+	assert.Nil(err)
+	assert.True(ok)
+
+	ok, err = h.Verify("pw1234--", encoded)
+	assert.Nil(err)
+	assert.False(ok)
+
+	assert.False(h.NeedsRehash(encoded))
+	assert.True(hasher.Bcrypt{Cost: 5}.NeedsRehash(encoded))
+	assert.True(hasher.Argon2id{}.NeedsRehash(encoded))
+}
+
+func TestVerify(t *testing.T) {
+	assert := assert.New(t)
+
+	old := hasher.Default()
+	defer hasher.SetDefault(old)
+
+	hasher.SetDefault(hasher.Bcrypt{Cost: 4})
+
+	bcryptHash, err := hasher.Default().Hash("pw1234++")
+	assert.Nil(err)
+
+	hasher.SetDefault(hasher.Argon2id{Memory: 8 * 1024, Time: 1, Threads: 1})
+
+	// hashes of the previous hasher are still verified, but need a rehash.
+	assert.True(hasher.Verify("pw1234++", bcryptHash))
+	assert.False(hasher.Verify("pw1234--", bcryptHash))
+	assert.True(hasher.NeedsRehash(bcryptHash))
+
+	argon2Hash, err := hasher.Default().Hash("pw1234++")
+	assert.Nil(err)
+	assert.True(hasher.Verify("pw1234++", argon2Hash))
+	assert.False(hasher.NeedsRehash(argon2Hash))
+
+	assert.False(hasher.Verify("pw1234++", "plain"))
+}
+
+// The benchmarks below help choosing the costs;
+// a login should take about 100-500ms of hashing on the production host.
+//
+//	go test ./hasher -bench . -benchmem
+
+func BenchmarkArgon2id(b *testing.B) {
+	for _, memory := range []uint32{19 * 1024, 46 * 1024, 64 * 1024} {
+		for _, time := range []uint32{1, 2, 3} {
+			h := hasher.Argon2id{Memory: memory, Time: time, Threads: 1}
+
+			b.Run(fmt.Sprintf("m=%d,t=%d", memory, time), func(b *testing.B) {
+				benchmarkHash(b, h)
+			})
+		}
+	}
+}
+
+func BenchmarkBcrypt(b *testing.B) {
+	for _, cost := range []int{10, 11, 12, 13} {
+		h := hasher.Bcrypt{Cost: cost}
+
+		b.Run(fmt.Sprintf("cost=%d", cost), func(b *testing.B) {
+			benchmarkHash(b, h)
+		})
+	}
+}
+
+func benchmarkHash(b *testing.B, h hasher.Hasher) {
+	for i := 0; i < b.N; i++ {
+		if _, err := h.Hash("pw1234++"); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestDefaultFromEnv(t *testing.T) {
+	assert := assert.New(t)
+
+	old := hasher.Default()
+	defer hasher.SetDefault(old)
+
+	t.Setenv("PASSWORD_HASHER", "argon2id")
+
+	for v, threads := range map[string]uint8{"4": 4, "255": 255, "0": 1, "256": 1, "257": 1, "-1": 1} {
+		t.Setenv("ARGON2_THREADS", v)
+		hasher.SetDefault(nil)
+
+		h, ok := hasher.Default().(hasher.Argon2id)
+		assert.True(ok)
+		assert.Equal(threads, h.Threads, v)
+	}
+
+	t.Setenv("PASSWORD_HASHER", "bcrypt")
+	t.Setenv("BCRYPT_COST", "32")
+	hasher.SetDefault(nil)
+
+	assert.Equal(hasher.Bcrypt{Cost: hasher.DefaultBcryptCost}, hasher.Default())
+}
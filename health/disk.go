@@ -0,0 +1,25 @@
+package health
+
+import (
+	"context"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+)
+
+// DiskSpace returns a checker which fails if the filesystem
+// holding the file at path has less than minFree bytes available.
+func DiskSpace(path string, minFree uint64) Checker {
+	return CheckerFunc(func(ctx context.Context) error {
+		free, err := freeBytes(filepath.Dir(path))
+		if err != nil {
+			return errors.Wrap(err, "disk stat failure")
+		}
+
+		if free < minFree {
+			return errors.Errorf("low disk space, %d bytes free (minimum %d)", free, minFree)
+		}
+
+		return nil
+	})
+}
@@ -0,0 +1,10 @@
+//go:build windows
+
+package health
+
+import "math"
+
+// freeBytes is not supported on windows, so the disk check always passes.
+func freeBytes(dir string) (uint64, error) {
+	return math.MaxUint64, nil
+}
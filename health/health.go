@@ -0,0 +1,159 @@
+package health
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	StatusOK   = "ok"
+	StatusFail = "fail"
+)
+
+const defaultCheckTimeout = 3 * time.Second
+
+// Checker reports whether a dependency of the server is healthy.
+type Checker interface {
+	Check(ctx context.Context) error
+}
+
+// CheckerFunc adapts a function to the Checker interface.
+type CheckerFunc func(ctx context.Context) error
+
+func (f CheckerFunc) Check(ctx context.Context) error {
+	return f(ctx)
+}
+
+// Result is the outcome of a single check.
+type Result struct {
+	Name      string  `json:"name"`
+	Status    string  `json:"status"`
+	LatencyMS float64 `json:"latency_ms"`
+	Error     string  `json:"error,omitempty"`
+}
+
+// Report is the outcome of all checks in a Registry.
+type Report struct {
+	Status string   `json:"status"`
+	Checks []Result `json:"checks"`
+}
+
+func (r Report) OK() bool {
+	return r.Status == StatusOK
+}
+
+// Registry holds named checkers and runs them together.
+type Registry struct {
+	mu       sync.RWMutex
+	checkers map[string]Checker
+	timeout  time.Duration
+}
+
+func NewRegistry() *Registry {
+	return &Registry{
+		checkers: map[string]Checker{},
+		timeout:  defaultCheckTimeout,
+	}
+}
+
+// Liveness holds the checks telling whether the process should be restarted.
+var Liveness = NewRegistry()
+
+// Readiness holds the checks telling whether the server can serve requests.
+var Readiness = NewRegistry()
+
+// Register adds the checker with the name,
+// replacing the checker already registered with the same name.
+func (r *Registry) Register(name string, c Checker) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.checkers[name] = c
+}
+
+func (r *Registry) Unregister(name string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	delete(r.checkers, name)
+}
+
+// Run executes all checkers concurrently, each bounded by the registry timeout,
+// and returns the results sorted by name.
+func (r *Registry) Run(ctx context.Context) Report {
+	r.mu.RLock()
+	checkers := make(map[string]Checker, len(r.checkers))
+	for k, v := range r.checkers {
+		checkers[k] = v
+	}
+	r.mu.RUnlock()
+
+	results := make([]Result, 0, len(checkers))
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+
+	for name, c := range checkers {
+		wg.Add(1)
+		go func(name string, c Checker) {
+			defer wg.Done()
+
+			res := r.run(ctx, name, c)
+
+			mu.Lock()
+			results = append(results, res)
+			mu.Unlock()
+		}(name, c)
+	}
+	wg.Wait()
+
+	sort.Slice(results, func(i, j int) bool {
+		return results[i].Name < results[j].Name
+	})
+
+	report := Report{
+		Status: StatusOK,
+		Checks: results,
+	}
+	for _, res := range results {
+		if res.Status != StatusOK {
+			report.Status = StatusFail
+		}
+	}
+
+	return report
+}
+
+func (r *Registry) run(ctx context.Context, name string, c Checker) Result {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	start := time.Now()
+
+	err := make(chan error, 1)
+	go func() {
+		err <- c.Check(ctx)
+	}()
+
+	res := Result{
+		Name:   name,
+		Status: StatusOK,
+	}
+
+	select {
+	case e := <-err:
+		if e != nil {
+			res.Status = StatusFail
+			res.Error = e.Error()
+		}
+	case <-ctx.Done():
+		res.Status = StatusFail
+		res.Error = ctx.Err().Error()
+	}
+
+	res.LatencyMS = float64(time.Since(start).Microseconds()) / 1000
+
+	return res
+}
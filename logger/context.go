@@ -0,0 +1,63 @@
+package logger
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"regexp"
+)
+
+type contextKey int
+
+const (
+	loggerKey contextKey = iota
+	requestIDKey
+)
+
+// WithContext returns a copy of ctx holding the logger.
+func WithContext(ctx context.Context, l *Logger) context.Context {
+	return context.WithValue(ctx, loggerKey, l)
+}
+
+// FromContext returns the logger held by ctx, or the default logger.
+func FromContext(ctx context.Context) *Logger {
+	if ctx != nil {
+		if l, ok := ctx.Value(loggerKey).(*Logger); ok {
+			return l
+		}
+	}
+	return Default()
+}
+
+// WithRequestID returns a copy of ctx holding the request id
+// and a logger writing the request id with every log.
+func WithRequestID(ctx context.Context, id string) context.Context {
+	ctx = context.WithValue(ctx, requestIDKey, id)
+	return WithContext(ctx, FromContext(ctx).With("request_id", id))
+}
+
+// RequestID returns the request id held by ctx.
+func RequestID(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+	id, _ := ctx.Value(requestIDKey).(string)
+	return id
+}
+
+var requestIDRegex = regexp.MustCompile("^[a-zA-Z0-9._-]{1,128}$")
+
+// ValidRequestID returns true if the id received from a client
+// is safe to be used as a request id.
+func ValidRequestID(id string) bool {
+	return requestIDRegex.MatchString(id)
+}
+
+// NewRequestID returns a random request id.
+func NewRequestID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,59 @@
+package logger
+
+import (
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	RequestIDHeader = "X-Request-ID"
+
+	// RequestIDKey is the gin.Context key of the request id.
+	RequestIDKey = "request_id"
+	// UIDKey is the gin.Context key of the authenticated user's uid.
+	UIDKey = "uid"
+)
+
+// Middleware accepts the request id from the X-Request-ID header or generates one,
+// binds a request logger to the request context and writes an access log
+// after the request is handled.
+func Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+
+		id := c.GetHeader(RequestIDHeader)
+		if !ValidRequestID(id) {
+			id = NewRequestID()
+		}
+
+		c.Set(RequestIDKey, id)
+		c.Header(RequestIDHeader, id)
+		c.Request = c.Request.WithContext(WithRequestID(c.Request.Context(), id))
+
+		c.Next()
+
+		status := c.Writer.Status()
+
+		level := LevelInfo
+		switch {
+		case status >= 500:
+			level = LevelError
+		case status >= 400:
+			level = LevelWarn
+		}
+
+		kv := []interface{}{
+			"method", c.Request.Method,
+			"path", c.Request.URL.Path,
+			"route", c.FullPath(),
+			"status", status,
+			"latency_ms", float64(time.Since(start).Microseconds()) / 1000,
+			"client_ip", c.ClientIP(),
+			"bytes", c.Writer.Size(),
+		}
+
+		// the request logger holds the uid if the handler authenticated the user.
+		FromContext(c.Request.Context()).Log(level, "request", kv...)
+	}
+}
@@ -0,0 +1,195 @@
+package logger
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+type Level int
+
+const (
+	LevelDebug Level = iota
+	LevelInfo
+	LevelWarn
+	LevelError
+)
+
+func (l Level) String() string {
+	switch l {
+	case LevelDebug:
+		return "debug"
+	case LevelInfo:
+		return "info"
+	case LevelWarn:
+		return "warn"
+	case LevelError:
+		return "error"
+	}
+	return fmt.Sprintf("level(%d)", int(l))
+}
+
+// ParseLevel returns the level of the name (debug, info, warn, error).
+// It returns LevelInfo for unknown names.
+func ParseLevel(name string) Level {
+	switch strings.ToLower(name) {
+	case "debug":
+		return LevelDebug
+	case "warn", "warning":
+		return LevelWarn
+	case "error":
+		return LevelError
+	}
+	return LevelInfo
+}
+
+const redacted = "[REDACTED]"
+
+// sensitiveKeys are the parts of field keys whose values are never written.
+var sensitiveKeys = []string{"password", "passwd", "pw", "token", "secret", "authorization", "cookie", "otp", "recovery"}
+
+func isSensitive(key string) bool {
+	k := strings.ToLower(key)
+	for _, s := range sensitiveKeys {
+		if strings.Contains(k, s) {
+			return true
+		}
+	}
+	return false
+}
+
+type field struct {
+	key   string
+	value interface{}
+}
+
+// Logger writes leveled logs as JSON lines.
+// Fields are given as alternating keys and values,
+// and values of sensitive keys such as passwords and tokens are redacted.
+type Logger struct {
+	mu     *sync.Mutex
+	out    io.Writer
+	level  Level
+	fields []field
+}
+
+func New(out io.Writer, level Level) *Logger {
+	return &Logger{
+		mu:    new(sync.Mutex),
+		out:   out,
+		level: level,
+	}
+}
+
+var std = New(os.Stderr, ParseLevel(os.Getenv("LOG_LEVEL")))
+
+// Default returns the logger used when no logger is bound to a context.
+func Default() *Logger {
+	return std
+}
+
+// SetDefault replaces the default logger.
+func SetDefault(l *Logger) {
+	std = l
+}
+
+// With returns a logger which writes the fields with every log.
+func (l *Logger) With(kv ...interface{}) *Logger {
+	nl := *l
+	nl.fields = append(append([]field(nil), l.fields...), toFields(kv)...)
+	return &nl
+}
+
+func (l *Logger) Debug(msg string, kv ...interface{}) {
+	l.log(LevelDebug, msg, kv)
+}
+
+func (l *Logger) Info(msg string, kv ...interface{}) {
+	l.log(LevelInfo, msg, kv)
+}
+
+func (l *Logger) Warn(msg string, kv ...interface{}) {
+	l.log(LevelWarn, msg, kv)
+}
+
+func (l *Logger) Error(msg string, kv ...interface{}) {
+	l.log(LevelError, msg, kv)
+}
+
+// Log writes the message at the given level.
+func (l *Logger) Log(level Level, msg string, kv ...interface{}) {
+	l.log(level, msg, kv)
+}
+
+func (l *Logger) log(level Level, msg string, kv []interface{}) {
+	if level < l.level {
+		return
+	}
+
+	buf := new(bytes.Buffer)
+	buf.WriteByte('{')
+	writeField(buf, "time", time.Now().UTC().Format(time.RFC3339Nano))
+	buf.WriteByte(',')
+	writeField(buf, "level", level.String())
+	buf.WriteByte(',')
+	writeField(buf, "msg", msg)
+
+	for _, f := range append(append([]field(nil), l.fields...), toFields(kv)...) {
+		buf.WriteByte(',')
+		if isSensitive(f.key) {
+			writeField(buf, f.key, redacted)
+			continue
+		}
+		writeField(buf, f.key, f.value)
+	}
+	buf.WriteString("}\n")
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.out.Write(buf.Bytes())
+}
+
+func toFields(kv []interface{}) []field {
+	fields := make([]field, 0, (len(kv)+1)/2)
+	for i := 0; i < len(kv); i += 2 {
+		key, ok := kv[i].(string)
+		if !ok {
+			key = fmt.Sprintf("%v", kv[i])
+		}
+
+		if i+1 == len(kv) {
+			fields = append(fields, field{key: "!BADKEY", value: key})
+			break
+		}
+
+		fields = append(fields, field{key: key, value: kv[i+1]})
+	}
+	return fields
+}
+
+func writeField(buf *bytes.Buffer, key string, value interface{}) {
+	k, _ := json.Marshal(key)
+	buf.Write(k)
+	buf.WriteByte(':')
+
+	switch v := value.(type) {
+	case error:
+		value = v.Error()
+	case time.Duration:
+		value = v.String()
+	case fmt.Stringer:
+		value = v.String()
+	}
+
+	b, err := json.Marshal(value)
+	if err != nil {
+		b, _ = json.Marshal(fmt.Sprintf("%+v", value))
+	}
+	buf.Write(b)
+}
@@ -0,0 +1,45 @@
+package mail
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// FileSender appends mails to a file in the mbox format,
+// standing in for an smtp server in local environments.
+type FileSender struct {
+	mu   sync.Mutex
+	path string
+}
+
+func NewFileSender(path string) *FileSender {
+	return &FileSender{path: path}
+}
+
+func (s *FileSender) Send(ctx context.Context, m Mail) error {
+	if !validHeader(m.To) || !validHeader(m.Subject) {
+		return errors.Errorf("invalid mail header")
+	}
+
+	now := time.Now().UTC()
+
+	msg := fmt.Sprintf("From %s %s\n%s\n\n", From(), now.Format(time.ANSIC), format(From(), m, now))
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	f, err := os.OpenFile(s.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return errors.Wrap(err, "open mail file failure")
+	}
+	defer f.Close()
+
+	_, err = f.WriteString(msg)
+
+	return err
+}
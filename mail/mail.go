@@ -0,0 +1,123 @@
+package mail
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"simple-go-server/logger"
+)
+
+const defaultFrom = "no-reply@localhost"
+
+// Mail is an email sent to a single address.
+type Mail struct {
+	To      string `json:"to"`
+	Subject string `json:"subject"`
+	Body    string `json:"body"`
+}
+
+// Sender sends mails, e.g. through an smtp server.
+type Sender interface {
+	Send(ctx context.Context, m Mail) error
+}
+
+var (
+	mu  sync.RWMutex
+	std Sender
+)
+
+// Default returns the sender set by MAIL_SENDER,
+// "log" (default), "file:<path>" or "smtp://[user:password@]host:port".
+func Default() Sender {
+	mu.RLock()
+	s := std
+	mu.RUnlock()
+
+	if s != nil {
+		return s
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	if std == nil {
+		std = fromEnv()
+	}
+
+	return std
+}
+
+// SetDefault replaces the default sender.
+func SetDefault(s Sender) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	std = s
+}
+
+// From returns the sender address of mails set by MAIL_FROM.
+func From() string {
+	if v := os.Getenv("MAIL_FROM"); v != "" {
+		return v
+	}
+	return defaultFrom
+}
+
+func fromEnv() Sender {
+	v := os.Getenv("MAIL_SENDER")
+
+	if path, found := strings.CutPrefix(v, "file:"); found && path != "" {
+		return NewFileSender(path)
+	}
+
+	if strings.HasPrefix(v, "smtp://") {
+		s, err := NewSMTPSender(v, From())
+		if err == nil {
+			return s
+		}
+		logger.Default().Warn("invalid MAIL_SENDER, using log", "error", err)
+		return LogSender{}
+	}
+
+	if v != "" && v != "log" {
+		logger.Default().Warn("unknown MAIL_SENDER, using log", "value", v)
+	}
+
+	return LogSender{}
+}
+
+// format returns the mail as an RFC 5322 message.
+func format(from string, m Mail, date time.Time) []byte {
+	b := strings.Builder{}
+
+	fmt.Fprintf(&b, "From: %s\r\n", from)
+	fmt.Fprintf(&b, "To: %s\r\n", m.To)
+	fmt.Fprintf(&b, "Subject: %s\r\n", m.Subject)
+	fmt.Fprintf(&b, "Date: %s\r\n", date.Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	b.WriteString("\r\n")
+	b.WriteString(strings.ReplaceAll(m.Body, "\n", "\r\n"))
+
+	return []byte(b.String())
+}
+
+// validHeader returns false if v would inject headers into the message.
+func validHeader(v string) bool {
+	return !strings.ContainsAny(v, "\r\n")
+}
+
+// LogSender writes mails to the log.
+// It is meant for local development only.
+// The body is never written, since it may hold a link with a token, e.g. of a verification;
+// use a FileSender to read the bodies.
+type LogSender struct{}
+
+func (LogSender) Send(ctx context.Context, m Mail) error {
+	logger.FromContext(ctx).Info("mail", "to", m.To, "subject", m.Subject, "length", len(m.Body))
+	return nil
+}
@@ -0,0 +1,40 @@
+package mail
+
+import (
+	"context"
+	"sync"
+)
+
+// MemorySender keeps mails in memory, e.g. for tests.
+type MemorySender struct {
+	mu    sync.Mutex
+	mails []Mail
+}
+
+func NewMemorySender() *MemorySender {
+	return &MemorySender{}
+}
+
+func (s *MemorySender) Send(ctx context.Context, m Mail) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.mails = append(s.mails, m)
+
+	return nil
+}
+
+// Mails returns the mails sent to the address.
+func (s *MemorySender) Mails(to string) []Mail {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	mails := []Mail{}
+	for _, m := range s.mails {
+		if m.To == to {
+			mails = append(mails, m)
+		}
+	}
+
+	return mails
+}
@@ -0,0 +1,68 @@
+package mail
+
+import (
+	"context"
+	"net"
+	"net/smtp"
+	"net/url"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// SMTPSender sends mails through an smtp server.
+type SMTPSender struct {
+	addr string
+	host string
+	from string
+	auth smtp.Auth
+}
+
+// NewSMTPSender returns the sender for the server of the url,
+// smtp://[user:password@]host:port.
+func NewSMTPSender(rawURL, from string) (*SMTPSender, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Scheme != "smtp" || u.Host == "" {
+		return nil, errors.Errorf("invalid smtp url")
+	}
+
+	host, _, err := net.SplitHostPort(u.Host)
+	if err != nil {
+		return nil, errors.Errorf("invalid smtp url, no port")
+	}
+
+	s := &SMTPSender{
+		addr: u.Host,
+		host: host,
+		from: from,
+	}
+
+	if u.User != nil {
+		pw, _ := u.User.Password()
+		s.auth = smtp.PlainAuth("", u.User.Username(), pw, host)
+	}
+
+	return s, nil
+}
+
+func (s *SMTPSender) Send(ctx context.Context, m Mail) error {
+	if !validHeader(m.To) || !validHeader(m.Subject) {
+		return errors.Errorf("invalid mail header")
+	}
+
+	msg := format(s.from, m, time.Now())
+
+	// net/smtp does not take a context, so the send goes on
+	// in the background when ctx is done first.
+	done := make(chan error, 1)
+	go func() {
+		done <- smtp.SendMail(s.addr, s.auth, s.from, []string{m.To}, msg)
+	}()
+
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
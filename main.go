@@ -1,34 +1,139 @@
 package main
 
 import (
-	"log"
+	"context"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
 	"time"
 
 	"simple-go-server/db"
 	"simple-go-server/handler"
+	"simple-go-server/health"
+	"simple-go-server/logger"
+	"simple-go-server/policy"
+	"simple-go-server/worker"
 )
 
+const defaultShutdownTimeout = 10 * time.Second
+
 func main() {
-	defer func() {
-		if r := recover(); r != nil {
-			log.Println(r, ": The server will attempt to recover after 5 seconds.")
-			time.Sleep(5 * time.Second)
-			main()
-		}
-	}()
+	log := logger.Default()
 
-	if err := db.Init(); err != nil {
-		panic(err)
+	p, err := policy.FromEnv()
+	if err != nil {
+		log.Error("policy configuration failure", "error", err)
+		os.Exit(1)
 	}
+	policy.SetDefault(p)
 
-	d, err := db.Get()
-	if err != nil {
-		panic(err)
+	if err := db.Init(); err != nil {
+		log.Error("db init failure", "error", err)
+		os.Exit(1)
 	}
-	defer d.Close()
+
+	workers := worker.NewGroup()
+	registerWorkers(workers)
+	health.Liveness.Register("workers", workers)
 
 	r := handler.GetRouter()
 	r.LoadAll()
 
-	r.Run(":3000")
+	srv := &http.Server{
+		Addr:    ":3000",
+		Handler: r,
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	workers.Start()
+
+	serveErr := make(chan error, 1)
+	go func() {
+		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			serveErr <- err
+		}
+		close(serveErr)
+	}()
+
+	select {
+	case err := <-serveErr:
+		if err != nil {
+			log.Error("server failure", "error", err)
+		}
+	case <-ctx.Done():
+		log.Info("shutdown signal received")
+	}
+	stop()
+
+	shutdown(srv, workers, shutdownTimeout())
+}
+
+// shutdown drains in-flight requests, then stops background workers
+// and finally closes the database, all within the given timeout.
+func shutdown(srv *http.Server, workers *worker.Group, timeout time.Duration) {
+	log := logger.Default()
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	if err := srv.Shutdown(ctx); err != nil {
+		log.Error("server shutdown failure", "error", err)
+	}
+
+	if err := workers.Stop(ctx); err != nil {
+		log.Error("workers shutdown failure", "error", err)
+	}
+
+	if err := handler.WaitPasswordResets(ctx); err != nil {
+		log.Error("password resets shutdown failure", "error", err)
+	}
+
+	if err := db.Close(); err != nil {
+		log.Error("db close failure", "error", err)
+	}
+
+	log.Info("server stopped")
+}
+
+// registerWorkers adds the periodic maintenance tasks.
+func registerWorkers(workers *worker.Group) {
+	workers.Add("password reset cleanup", time.Hour, func(ctx context.Context) error {
+		d, err := db.Get()
+		if err != nil {
+			return err
+		}
+		return d.DeletePasswordResets(ctx, time.Now())
+	})
+	workers.Add("guest cart cleanup", time.Hour, func(ctx context.Context) error {
+		d, err := db.Get()
+		if err != nil {
+			return err
+		}
+		return d.DeleteExpiredGuestCarts(ctx, time.Now())
+	})
+	workers.Add("login failure cleanup", time.Hour, func(ctx context.Context) error {
+		d, err := db.Get()
+		if err != nil {
+			return err
+		}
+		return handler.DeleteExpiredLoginFailures(ctx, d, time.Now())
+	})
+}
+
+func shutdownTimeout() time.Duration {
+	v := os.Getenv("SHUTDOWN_TIMEOUT")
+	if v == "" {
+		return defaultShutdownTimeout
+	}
+
+	d, err := time.ParseDuration(v)
+	if err != nil || d <= 0 {
+		logger.Default().Warn("invalid SHUTDOWN_TIMEOUT, using default", "value", v, "default", defaultShutdownTimeout)
+		return defaultShutdownTimeout
+	}
+
+	return d
 }
@@ -0,0 +1,120 @@
+package media
+
+import (
+	"bytes"
+	"image"
+	"image/draw"
+	"image/jpeg"
+	"image/png"
+	"net/http"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// MaxDimension bounds the width and height of images,
+	// so that a small file cannot decode into a huge bitmap.
+	MaxDimension = 8000
+	// ThumbnailSize is the size of the box thumbnails fit in.
+	ThumbnailSize = 320
+
+	jpegQuality = 90
+)
+
+var (
+	// ErrUnsupportedType is returned for files other than jpeg and png images.
+	ErrUnsupportedType = errors.New("unsupported image type")
+	// ErrTooLarge is returned for images larger than MaxDimension.
+	ErrTooLarge = errors.New("image too large")
+)
+
+// Image is an uploaded image re-encoded without its metadata,
+// and its thumbnail in the same format.
+type Image struct {
+	ContentType string
+	// Ext is the file extension of the content type, with the dot.
+	Ext       string
+	Width     int
+	Height    int
+	Data      []byte
+	Thumbnail []byte
+}
+
+// ContentType returns the type sniffed from the data,
+// which must be one of the supported image types.
+func ContentType(data []byte) (string, error) {
+	switch t := http.DetectContentType(data); t {
+	case "image/jpeg", "image/png":
+		return t, nil
+	default:
+		return "", ErrUnsupportedType
+	}
+}
+
+// Process decodes the image and encodes it again, which drops EXIF and any other metadata.
+// The EXIF orientation of jpeg images is applied to the pixels before it is dropped.
+func Process(data []byte) (*Image, error) {
+	contentType, err := ContentType(data)
+	if err != nil {
+		return nil, err
+	}
+
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, ErrUnsupportedType
+	}
+
+	if config.Width > MaxDimension || config.Height > MaxDimension {
+		return nil, ErrTooLarge
+	}
+
+	src, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, ErrUnsupportedType
+	}
+
+	img := image.NewRGBA(image.Rect(0, 0, src.Bounds().Dx(), src.Bounds().Dy()))
+	draw.Draw(img, img.Bounds(), src, src.Bounds().Min, draw.Src)
+
+	if contentType == "image/jpeg" {
+		img = orient(img, exifOrientation(data))
+	}
+
+	result := &Image{
+		ContentType: contentType,
+		Ext:         ".png",
+		Width:       img.Bounds().Dx(),
+		Height:      img.Bounds().Dy(),
+	}
+
+	if contentType == "image/jpeg" {
+		result.Ext = ".jpg"
+	}
+
+	if result.Data, err = encode(img, contentType); err != nil {
+		return nil, err
+	}
+
+	if result.Thumbnail, err = encode(fit(img, ThumbnailSize), contentType); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+func encode(img image.Image, contentType string) ([]byte, error) {
+	b := bytes.Buffer{}
+
+	var err error
+	if contentType == "image/jpeg" {
+		err = jpeg.Encode(&b, img, &jpeg.Options{Quality: jpegQuality})
+	} else {
+		err = png.Encode(&b, img)
+	}
+
+	if err != nil {
+		return nil, errors.Wrap(err, "image encoding failure")
+	}
+
+	return b.Bytes(), nil
+}
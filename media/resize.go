@@ -0,0 +1,115 @@
+package media
+
+import "image"
+
+// fit returns the image scaled down to fit in a size x size box,
+// keeping its aspect ratio. Smaller images are returned as is.
+func fit(img *image.RGBA, size int) *image.RGBA {
+	w, h := img.Bounds().Dx(), img.Bounds().Dy()
+	if w <= size && h <= size {
+		return img
+	}
+
+	tw, th := size, h*size/w
+	if h > w {
+		tw, th = w*size/h, size
+	}
+	if tw < 1 {
+		tw = 1
+	}
+	if th < 1 {
+		th = 1
+	}
+
+	return scale(img, tw, th)
+}
+
+// scale downscales the image by averaging the source pixels
+// each target pixel covers (a box filter), in pure Go.
+// The pixels are premultiplied, so that transparent pixels do not darken the edges.
+func scale(src *image.RGBA, tw, th int) *image.RGBA {
+	sw, sh := src.Bounds().Dx(), src.Bounds().Dy()
+	dst := image.NewRGBA(image.Rect(0, 0, tw, th))
+
+	for ty := 0; ty < th; ty++ {
+		y0, y1 := ty*sh/th, (ty+1)*sh/th
+		if y1 == y0 {
+			y1 = y0 + 1
+		}
+
+		for tx := 0; tx < tw; tx++ {
+			x0, x1 := tx*sw/tw, (tx+1)*sw/tw
+			if x1 == x0 {
+				x1 = x0 + 1
+			}
+
+			var r, g, b, a, n uint64
+
+			for y := y0; y < y1; y++ {
+				i := y*src.Stride + x0*4
+				for x := x0; x < x1; x++ {
+					r += uint64(src.Pix[i])
+					g += uint64(src.Pix[i+1])
+					b += uint64(src.Pix[i+2])
+					a += uint64(src.Pix[i+3])
+					n++
+					i += 4
+				}
+			}
+
+			j := ty*dst.Stride + tx*4
+			dst.Pix[j] = uint8(r / n)
+			dst.Pix[j+1] = uint8(g / n)
+			dst.Pix[j+2] = uint8(b / n)
+			dst.Pix[j+3] = uint8(a / n)
+		}
+	}
+
+	return dst
+}
+
+// orient returns the image turned upright by the EXIF orientation, 1 to 8.
+func orient(src *image.RGBA, orientation int) *image.RGBA {
+	if orientation < 2 || orientation > 8 {
+		return src
+	}
+
+	w, h := src.Bounds().Dx(), src.Bounds().Dy()
+
+	// orientations 5 to 8 swap the width and height.
+	dw, dh := w, h
+	if orientation >= 5 {
+		dw, dh = h, w
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			var dx, dy int
+
+			switch orientation {
+			case 2: // mirrored
+				dx, dy = w-1-x, y
+			case 3: // rotated 180
+				dx, dy = w-1-x, h-1-y
+			case 4: // mirrored vertically
+				dx, dy = x, h-1-y
+			case 5: // mirrored along the top-left diagonal
+				dx, dy = y, x
+			case 6: // rotated 90 clockwise to be upright
+				dx, dy = h-1-y, x
+			case 7: // mirrored along the top-right diagonal
+				dx, dy = h-1-y, w-1-x
+			case 8: // rotated 90 counterclockwise to be upright
+				dx, dy = y, w-1-x
+			}
+
+			i := y*src.Stride + x*4
+			j := dy*dst.Stride + dx*4
+			copy(dst.Pix[j:j+4], src.Pix[i:i+4])
+		}
+	}
+
+	return dst
+}
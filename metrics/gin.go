@@ -0,0 +1,55 @@
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+var (
+	httpRequests = NewCounterVec(
+		"http_requests_total",
+		"Total number of http requests.",
+		"method", "route", "status",
+	)
+	httpRequestDuration = NewHistogramVec(
+		"http_request_duration_seconds",
+		"Latency of http requests in seconds.",
+		nil,
+		"method", "route", "status",
+	)
+)
+
+// unmatchedRoute labels the requests which do not match any route,
+// so arbitrary paths cannot blow up the number of label values.
+const unmatchedRoute = "unmatched"
+
+// Middleware records the count and the latency of http requests
+// labelled by method, route template and status code.
+func Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+
+		c.Next()
+
+		route := c.FullPath()
+		if route == "" {
+			route = unmatchedRoute
+		}
+		status := strconv.Itoa(c.Writer.Status())
+
+		httpRequests.Inc(c.Request.Method, route, status)
+		httpRequestDuration.Observe(time.Since(start).Seconds(), c.Request.Method, route, status)
+	}
+}
+
+// Handler serves the metrics of the Default registry.
+func Handler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Header("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		c.Status(http.StatusOK)
+		Default.WriteTo(c.Writer)
+	}
+}
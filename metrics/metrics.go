@@ -0,0 +1,199 @@
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// DefaultBuckets are the histogram buckets in seconds used for latencies.
+var DefaultBuckets = []float64{.001, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// CounterVec is a monotonically increasing value partitioned by labels.
+type CounterVec struct {
+	n      string
+	help   string
+	labels []string
+
+	mu     sync.Mutex
+	values map[string]float64
+	sets   map[string][]string
+}
+
+// NewCounterVec creates a counter and registers it in the Default registry.
+func NewCounterVec(name, help string, labels ...string) *CounterVec {
+	c := &CounterVec{
+		n:      name,
+		help:   help,
+		labels: labels,
+		values: map[string]float64{},
+		sets:   map[string][]string{},
+	}
+	Default.register(c)
+	return c
+}
+
+// Inc increases the counter of the label values by 1.
+func (c *CounterVec) Inc(values ...string) {
+	c.Add(1, values...)
+}
+
+// Add increases the counter of the label values by v.
+func (c *CounterVec) Add(v float64, values ...string) {
+	checkLabels(c.n, c.labels, values)
+
+	k := labelKey(values)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, found := c.sets[k]; !found {
+		c.sets[k] = append([]string(nil), values...)
+	}
+	c.values[k] += v
+}
+
+func (c *CounterVec) name() string {
+	return c.n
+}
+
+func (c *CounterVec) write(w *bufio.Writer) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	writeHeader(w, c.n, c.help, "counter")
+	for _, k := range sortedKeys(c.values) {
+		writeSample(w, c.n, c.labels, c.sets[k], c.values[k])
+	}
+}
+
+type histogramValue struct {
+	labels []string
+	counts []uint64
+	sum    float64
+	count  uint64
+}
+
+// HistogramVec counts observations in buckets partitioned by labels.
+type HistogramVec struct {
+	n       string
+	help    string
+	labels  []string
+	buckets []float64
+
+	mu     sync.Mutex
+	values map[string]*histogramValue
+}
+
+// NewHistogramVec creates a histogram and registers it in the Default registry.
+// DefaultBuckets are used if buckets is empty.
+func NewHistogramVec(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	if len(buckets) == 0 {
+		buckets = DefaultBuckets
+	}
+
+	b := append([]float64(nil), buckets...)
+	sort.Float64s(b)
+
+	h := &HistogramVec{
+		n:       name,
+		help:    help,
+		labels:  labels,
+		buckets: b,
+		values:  map[string]*histogramValue{},
+	}
+	Default.register(h)
+	return h
+}
+
+// Observe adds the observation v to the histogram of the label values.
+func (h *HistogramVec) Observe(v float64, values ...string) {
+	checkLabels(h.n, h.labels, values)
+
+	k := labelKey(values)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	hv, found := h.values[k]
+	if !found {
+		hv = &histogramValue{
+			labels: append([]string(nil), values...),
+			counts: make([]uint64, len(h.buckets)),
+		}
+		h.values[k] = hv
+	}
+
+	for i, b := range h.buckets {
+		if v <= b {
+			hv.counts[i]++
+		}
+	}
+	hv.sum += v
+	hv.count++
+}
+
+func (h *HistogramVec) name() string {
+	return h.n
+}
+
+func (h *HistogramVec) write(w *bufio.Writer) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	writeHeader(w, h.n, h.help, "histogram")
+
+	labels := append(append([]string(nil), h.labels...), "le")
+	for _, k := range sortedKeys(h.values) {
+		hv := h.values[k]
+
+		values := append(append([]string(nil), hv.labels...), "")
+		for i, b := range h.buckets {
+			values[len(values)-1] = formatFloat(b)
+			writeSample(w, h.n+"_bucket", labels, values, float64(hv.counts[i]))
+		}
+		values[len(values)-1] = "+Inf"
+		writeSample(w, h.n+"_bucket", labels, values, float64(hv.count))
+		writeSample(w, h.n+"_sum", h.labels, hv.labels, hv.sum)
+		writeSample(w, h.n+"_count", h.labels, hv.labels, float64(hv.count))
+	}
+}
+
+// ValueFunc is a metric whose value is read from a function on every scrape.
+type ValueFunc struct {
+	n    string
+	help string
+	typ  string
+	fn   func() float64
+}
+
+// NewGaugeFunc creates a gauge read from fn and registers it in the Default registry.
+func NewGaugeFunc(name, help string, fn func() float64) *ValueFunc {
+	g := &ValueFunc{n: name, help: help, typ: "gauge", fn: fn}
+	Default.register(g)
+	return g
+}
+
+// NewCounterFunc creates a counter read from fn and registers it in the Default registry.
+// fn must return a monotonically increasing value.
+func NewCounterFunc(name, help string, fn func() float64) *ValueFunc {
+	c := &ValueFunc{n: name, help: help, typ: "counter", fn: fn}
+	Default.register(c)
+	return c
+}
+
+func (f *ValueFunc) name() string {
+	return f.n
+}
+
+func (f *ValueFunc) write(w *bufio.Writer) {
+	writeHeader(w, f.n, f.help, f.typ)
+	writeSample(w, f.n, nil, nil, f.fn())
+}
+
+func checkLabels(name string, labels, values []string) {
+	if len(labels) != len(values) {
+		panic(fmt.Sprintf("metric %s expects %d label values, got %d", name, len(labels), len(values)))
+	}
+}
@@ -0,0 +1,104 @@
+package metrics_test
+
+import (
+	"strings"
+	"sync"
+	"testing"
+
+	"simple-go-server/metrics"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// scrape returns the metrics of the Default registry in the text format.
+func scrape(t *testing.T) string {
+	t.Helper()
+
+	b := strings.Builder{}
+	if _, err := metrics.Default.WriteTo(&b); err != nil {
+		t.Fatal(err)
+	}
+
+	return b.String()
+}
+
+func TestMetrics(t *testing.T) {
+	assert := assert.New(t)
+
+	t.Run("test counter; label escaping", func(t *testing.T) {
+		c := metrics.NewCounterVec("test_escape_total", "Escaped labels.", "path")
+		c.Inc("a\\b\"c\nd")
+
+		assert.Contains(scrape(t), `test_escape_total{path="a\\b\"c\nd"} 1`+"\n")
+	})
+
+	t.Run("test histogram; buckets, sum and count", func(t *testing.T) {
+		// buckets are sorted, and an observation counts in every bucket at or above it.
+		h := metrics.NewHistogramVec("test_latency_seconds", "Latencies.", []float64{1, 0.1, 0.5}, "route")
+		for _, v := range []float64{0.25, 0.5, 2} {
+			h.Observe(v, "/a")
+		}
+
+		assert.Contains(scrape(t), strings.Join([]string{
+			`test_latency_seconds_bucket{route="/a",le="0.1"} 0`,
+			`test_latency_seconds_bucket{route="/a",le="0.5"} 2`,
+			`test_latency_seconds_bucket{route="/a",le="1"} 2`,
+			`test_latency_seconds_bucket{route="/a",le="+Inf"} 3`,
+			`test_latency_seconds_sum{route="/a"} 2.75`,
+			`test_latency_seconds_count{route="/a"} 3`,
+		}, "\n")+"\n")
+	})
+
+	t.Run("test text format", func(t *testing.T) {
+		metrics.NewGaugeFunc("test_gauge", "A gauge\nof two lines.", func() float64 { return 1.5 })
+
+		c := metrics.NewCounterVec("test_format_total", "Formatted samples.", "method", "status")
+		c.Inc("POST", "500")
+		c.Add(2, "GET", "200")
+
+		body := scrape(t)
+
+		// the samples of a metric follow its header, sorted by their label values.
+		assert.Contains(body, strings.Join([]string{
+			`# HELP test_format_total Formatted samples.`,
+			`# TYPE test_format_total counter`,
+			`test_format_total{method="GET",status="200"} 2`,
+			`test_format_total{method="POST",status="500"} 1`,
+		}, "\n")+"\n")
+		assert.Contains(body, "# HELP test_gauge A gauge of two lines.\n# TYPE test_gauge gauge\ntest_gauge 1.5\n")
+
+		// metrics are sorted by name.
+		assert.Less(strings.Index(body, "# HELP test_format_total"), strings.Index(body, "# HELP test_gauge"))
+	})
+
+	t.Run("test registration", func(t *testing.T) {
+		assert.Panics(func() { metrics.NewCounterVec("test_format_total", "Duplicate.") })
+		assert.Panics(func() { metrics.NewCounterVec("test_labels_total", "Labels.", "a").Inc() })
+	})
+
+	t.Run("test concurrent inc and observe", func(t *testing.T) {
+		c := metrics.NewCounterVec("test_concurrent_total", "Concurrent increments.", "worker")
+		h := metrics.NewHistogramVec("test_concurrent_seconds", "Concurrent observations.", []float64{1}, "worker")
+
+		wg := sync.WaitGroup{}
+		for i := 0; i < 50; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for j := 0; j < 100; j++ {
+					c.Inc("w")
+					h.Observe(0.5, "w")
+				}
+			}()
+
+			// scrapes run along the updates.
+			scrape(t)
+		}
+		wg.Wait()
+
+		body := scrape(t)
+		assert.Contains(body, `test_concurrent_total{worker="w"} 5000`+"\n")
+		assert.Contains(body, `test_concurrent_seconds_bucket{worker="w",le="1"} 5000`+"\n")
+		assert.Contains(body, `test_concurrent_seconds_count{worker="w"} 5000`+"\n")
+	})
+}
@@ -0,0 +1,56 @@
+package model
+
+import "github.com/pkg/errors"
+
+// MaxCartQuantity is the greatest quantity of a product in a cart.
+const MaxCartQuantity = 99
+
+// Issues of cart items found by the validation of a cart.
+const (
+	// CartIssueDeleted is the issue of an item whose product or variant is deleted.
+	CartIssueDeleted = "product_deleted"
+	// CartIssueRepriced is the issue of an item whose product price
+	// changed since the item was added.
+	CartIssueRepriced = "price_changed"
+	// CartIssueOutOfStock is the issue of an item whose variant
+	// has less stock than the quantity.
+	CartIssueOutOfStock = "out_of_stock"
+	// CartIssueCurrency is the issue of an item priced in another currency
+	// than the rest of the cart, which cannot be ordered together.
+	CartIssueCurrency = "currency_mismatch"
+)
+
+// CartOwner is the user or the guest a cart belongs to.
+// Guests are identified by the GID in a signed cookie.
+type CartOwner struct {
+	UID int64
+	GID string
+}
+
+// IsGuest returns true if the cart belongs to a visitor not logged in.
+func (o CartOwner) IsGuest() bool {
+	return o.UID == 0
+}
+
+// CartItem is a product put in the cart of a user or a guest.
+type CartItem struct {
+	// UID is 0 for the items of guest carts.
+	UID int64 `json:"-"`
+	PID int64 `json:"pid"`
+	// VID is the variant of the product, or 0 for products without variants.
+	VID      int64 `json:"vid"`
+	Quantity int64 `json:"quantity"`
+	// Price is the product price when the item was added,
+	// or when the user accepted the current price.
+	Price Money `json:"price"`
+	Date  int64 `json:"date"`
+}
+
+type CartQuantity int64
+
+func (q CartQuantity) IsValid() error {
+	if q < 1 || q > MaxCartQuantity {
+		return errors.Errorf("quantity must be between 1 and %d", MaxCartQuantity)
+	}
+	return nil
+}
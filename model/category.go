@@ -0,0 +1,52 @@
+package model
+
+import (
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/pkg/errors"
+)
+
+const maxCategoryNameLength = 50
+
+// categorySlugRegex matches lower case words joined by hyphens, e.g. "t-shirts".
+var categorySlugRegex = regexp.MustCompile(`^[a-z0-9]+(-[a-z0-9]+)*$`)
+
+// Category is a node of the category tree.
+type Category struct {
+	CID int64 `json:"cid"`
+	// Parent is the cid of the parent category, or 0 for a root category.
+	Parent int64  `json:"parent"`
+	Name   string `json:"name"`
+	// Slug names the category in urls, unique among all categories.
+	Slug string `json:"slug"`
+	// Position orders the categories of the same parent, in ascending order.
+	Position int64 `json:"position"`
+}
+
+type CategoryName string
+
+func (n CategoryName) IsValid() error {
+	s := string(n)
+
+	if strings.TrimSpace(s) != s || s == "" || utf8.RuneCountInString(s) > maxCategoryNameLength {
+		return errors.Errorf("category name must be 1 to %d characters without surrounding spaces", maxCategoryNameLength)
+	}
+
+	if strings.IndexFunc(s, unicode.IsControl) >= 0 {
+		return errors.Errorf("category name must not contain control characters")
+	}
+
+	return nil
+}
+
+type CategorySlug string
+
+func (s CategorySlug) IsValid() error {
+	if len(s) > maxCategoryNameLength || !categorySlugRegex.MatchString(string(s)) {
+		return errors.Errorf("category slug must be lower case letters and digits joined by hyphens")
+	}
+	return nil
+}
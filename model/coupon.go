@@ -0,0 +1,208 @@
+package model
+
+import (
+	"fmt"
+	"math/big"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Kinds of coupons.
+const (
+	// CouponPercent takes a percentage off the eligible items.
+	CouponPercent = "percent"
+	// CouponFixed takes a fixed amount off the eligible items, split over them.
+	CouponFixed = "fixed"
+)
+
+const maxCouponRestrictions = 100
+
+var couponCodeRegex = regexp.MustCompile(`^[A-Z0-9][A-Z0-9_-]{2,31}$`)
+
+// Reasons a coupon does not apply to an order.
+var (
+	ErrCouponInactive    = errors.New("coupon is not valid at this time")
+	ErrCouponCurrency    = errors.New("coupon is for orders in another currency")
+	ErrCouponMinOrder    = errors.New("order is below the coupon minimum")
+	ErrCouponNotEligible = errors.New("no product of the order is eligible for the coupon")
+)
+
+type CouponCode string
+
+// Normalized returns the code in upper case without surrounding spaces,
+// as customers type codes in any case.
+func (c CouponCode) Normalized() CouponCode {
+	return CouponCode(strings.ToUpper(strings.TrimSpace(string(c))))
+}
+
+func (c CouponCode) IsValid() error {
+	if !couponCodeRegex.MatchString(string(c)) {
+		return errors.Errorf("coupon code must be 3 to 32 upper case letters, digits, '-' or '_'")
+	}
+	return nil
+}
+
+// Coupon is a discount code managers hand out to customers.
+type Coupon struct {
+	Code string `json:"code"`
+	Kind string `json:"kind"`
+	// Percent is the discount of percent coupons, from 1 to 100.
+	Percent int64 `json:"percent"`
+	// Amount is the discount of fixed coupons, up to the eligible subtotal.
+	Amount Money `json:"amount"`
+	// MinOrder is the least subtotal of the orders the coupon applies to.
+	// Coupons apply only to orders in the currency of Amount and MinOrder.
+	MinOrder Money `json:"min_order"`
+	// Products and Categories restrict the eligible items to the products
+	// and the products of the categories or their descendants, if either is not empty.
+	Products   []int64 `json:"products"`
+	Categories []int64 `json:"categories"`
+	// MaxUses and MaxUsesPerUser cap the redemptions, 0 for no cap.
+	MaxUses        int64 `json:"max_uses"`
+	MaxUsesPerUser int64 `json:"max_uses_per_user"`
+	// Starts and Ends bound the validity window (unix int64), 0 for no bound.
+	Starts int64 `json:"starts"`
+	Ends   int64 `json:"ends"`
+	// Uses is the number of redemptions.
+	Uses int64 `json:"uses"`
+}
+
+func (c Coupon) IsValid() error {
+	if err := CouponCode(c.Code).IsValid(); err != nil {
+		return err
+	}
+
+	switch c.Kind {
+	case CouponPercent:
+		if c.Percent < 1 || c.Percent > 100 {
+			return errors.Errorf("percent must be between 1 and 100")
+		}
+		if c.Amount.Amount != 0 {
+			return errors.Errorf("percent coupons take no amount")
+		}
+	case CouponFixed:
+		if c.Amount.Amount <= 0 {
+			return errors.Errorf("amount must be positive")
+		}
+		if c.Percent != 0 {
+			return errors.Errorf("fixed coupons take no percent")
+		}
+	default:
+		return errors.Errorf("coupon kind must be %s or %s", CouponPercent, CouponFixed)
+	}
+
+	for _, m := range []Money{c.Amount, c.MinOrder} {
+		if err := m.IsValid(); err != nil {
+			return err
+		}
+	}
+
+	if c.Amount.Currency != c.MinOrder.Currency {
+		return ErrCurrencyMismatch
+	}
+
+	if len(c.Products) > maxCouponRestrictions || len(c.Categories) > maxCouponRestrictions {
+		return errors.Errorf("at most %d products and %d categories", maxCouponRestrictions, maxCouponRestrictions)
+	}
+
+	if c.MaxUses < 0 || c.MaxUsesPerUser < 0 {
+		return errors.Errorf("usage caps must not be negative")
+	}
+
+	if c.Starts < 0 || c.Ends < 0 || c.Ends != 0 && c.Ends <= c.Starts {
+		return errors.Errorf("coupon must end after it starts")
+	}
+
+	return nil
+}
+
+// Active returns ErrCouponInactive if the time is outside the validity window.
+func (c Coupon) Active(now time.Time) error {
+	if now.Unix() < c.Starts || c.Ends != 0 && now.Unix() >= c.Ends {
+		return ErrCouponInactive
+	}
+	return nil
+}
+
+// Discounts returns the discounts of the coupon on the items of an order,
+// whose eligible items are told by eligible.
+// The earlier discounts of the items, e.g. of promotions, are taken off their subtotals first.
+// Percent discounts are rounded half to even on each item,
+// and fixed discounts are split over the eligible items in proportion to their subtotals.
+func (c Coupon) Discounts(items []OrderProduct, earlier []OrderDiscount, eligible func(OrderProduct) bool) ([]OrderDiscount, error) {
+	currency := c.Amount.Currency
+
+	net, err := netSubtotals(currency, items, earlier)
+	if err != nil {
+		return nil, ErrCouponCurrency
+	}
+
+	var subtotal int64
+	for _, amount := range net {
+		subtotal += amount
+	}
+
+	if subtotal < c.MinOrder.Amount {
+		return nil, ErrCouponMinOrder
+	}
+
+	lines := []OrderProduct{}
+	weights := []int64{}
+	var eligibleTotal int64
+
+	for i, item := range items {
+		if eligible(item) && net[i] > 0 {
+			lines = append(lines, item)
+			weights = append(weights, net[i])
+			eligibleTotal += net[i]
+		}
+	}
+
+	if len(lines) == 0 {
+		return nil, ErrCouponNotEligible
+	}
+
+	amounts := make([]int64, len(lines))
+	description := ""
+
+	switch c.Kind {
+	case CouponPercent:
+		rate := big.NewRat(c.Percent, 100)
+		for i := range lines {
+			amount, err := NewMoney(weights[i], currency).MulRat(rate)
+			if err != nil {
+				return nil, err
+			}
+			amounts[i] = amount.Amount
+		}
+		description = fmt.Sprintf("%d%% off with %s", c.Percent, c.Code)
+	case CouponFixed:
+		amount := c.Amount.Amount
+		if amount > eligibleTotal {
+			amount = eligibleTotal
+		}
+		amounts = splitAmount(amount, weights)
+		description = fmt.Sprintf("%s off with %s", c.Amount, c.Code)
+	}
+
+	discounts := []OrderDiscount{}
+	for i, line := range lines {
+		if amounts[i] == 0 {
+			continue
+		}
+
+		discounts = append(discounts, OrderDiscount{
+			PID:         line.PID,
+			VID:         line.VID,
+			Source:      DiscountCoupon,
+			Ref:         c.Code,
+			Description: description,
+			Amount:      NewMoney(amounts[i], currency),
+		})
+	}
+
+	return discounts, nil
+}
@@ -0,0 +1,113 @@
+package model_test
+
+import (
+	"testing"
+	"time"
+
+	"simple-go-server/model"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCoupon(t *testing.T) {
+	assert := assert.New(t)
+
+	all := func(model.OrderProduct) bool { return true }
+
+	items := []model.OrderProduct{
+		{PID: 1, Quantity: 1, Price: model.NewMoney(1000, "USD")},
+		{PID: 2, Quantity: 2, Price: model.NewMoney(1000, "USD")},
+		{PID: 3, Quantity: 1, Price: model.NewMoney(333, "USD")},
+	}
+
+	t.Run("test validation", func(t *testing.T) {
+		assert.Nil(model.Coupon{Code: "SAVE10", Kind: model.CouponPercent, Percent: 10,
+			Amount: model.NewMoney(0, "USD"), MinOrder: model.NewMoney(0, "USD")}.IsValid())
+		assert.Nil(model.Coupon{Code: "FIVE-OFF", Kind: model.CouponFixed, Amount: model.NewMoney(500, "EUR"),
+			MinOrder: model.NewMoney(2000, "EUR"), Starts: 100, Ends: 200}.IsValid())
+
+		for _, c := range []model.Coupon{
+			{Code: "S1", Kind: model.CouponPercent, Percent: 10},
+			{Code: "save10", Kind: model.CouponPercent, Percent: 10},
+			{Code: "SAVE10", Kind: "bogo", Percent: 10},
+			{Code: "SAVE10", Kind: model.CouponPercent, Percent: 101},
+			{Code: "SAVE10", Kind: model.CouponFixed, Amount: model.NewMoney(0, "USD"), MinOrder: model.NewMoney(0, "USD")},
+			{Code: "SAVE10", Kind: model.CouponFixed, Amount: model.NewMoney(500, "USD"), MinOrder: model.NewMoney(0, "EUR")},
+			{Code: "SAVE10", Kind: model.CouponFixed, Amount: model.NewMoney(500, "USD"), MinOrder: model.NewMoney(0, "USD"), MaxUses: -1},
+			{Code: "SAVE10", Kind: model.CouponFixed, Amount: model.NewMoney(500, "USD"), MinOrder: model.NewMoney(0, "USD"), Starts: 200, Ends: 100},
+		} {
+			assert.NotNil(c.IsValid(), "%+v", c)
+		}
+
+		assert.Equal(model.CouponCode("SAVE10"), model.CouponCode(" save10 ").Normalized())
+	})
+
+	t.Run("test active", func(t *testing.T) {
+		c := model.Coupon{Starts: 100, Ends: 200}
+
+		assert.Equal(model.ErrCouponInactive, c.Active(time.Unix(99, 0)))
+		assert.Nil(c.Active(time.Unix(100, 0)))
+		assert.Equal(model.ErrCouponInactive, c.Active(time.Unix(200, 0)))
+		assert.Nil(model.Coupon{}.Active(time.Now()))
+	})
+
+	t.Run("test percent discounts", func(t *testing.T) {
+		c := model.Coupon{Code: "SAVE15", Kind: model.CouponPercent, Percent: 15,
+			Amount: model.NewMoney(0, "USD"), MinOrder: model.NewMoney(0, "USD")}
+
+		discounts, err := c.Discounts(items, nil, all)
+		assert.Nil(err)
+		assert.Len(discounts, 3)
+
+		// 15% of 333 is 49.95, rounded to 50.
+		for i, want := range []int64{150, 300, 50} {
+			assert.Equal(model.NewMoney(want, "USD"), discounts[i].Amount)
+			assert.Equal(items[i].PID, discounts[i].PID)
+			assert.Equal(model.DiscountCoupon, discounts[i].Source)
+			assert.Equal("SAVE15", discounts[i].Ref)
+			assert.Equal("15% off with SAVE15", discounts[i].Description)
+		}
+	})
+
+	t.Run("test fixed discounts", func(t *testing.T) {
+		c := model.Coupon{Code: "TENOFF", Kind: model.CouponFixed,
+			Amount: model.NewMoney(1000, "USD"), MinOrder: model.NewMoney(0, "USD")}
+
+		// 1000 split over 1000, 2000 and 333 leaves a minor unit to the largest remainder.
+		discounts, err := c.Discounts(items, nil, all)
+		assert.Nil(err)
+		assert.Len(discounts, 3)
+
+		var sum int64
+		for i, want := range []int64{300, 600, 100} {
+			assert.Equal(want, discounts[i].Amount.Amount)
+			sum += discounts[i].Amount.Amount
+		}
+		assert.Equal(int64(1000), sum)
+		assert.Equal("$10.00 off with TENOFF", discounts[0].Description)
+
+		// the discount is capped at the eligible items.
+		discounts, err = c.Discounts(items, nil, func(item model.OrderProduct) bool { return item.PID == 3 })
+		assert.Nil(err)
+		assert.Len(discounts, 1)
+		assert.Equal(model.NewMoney(333, "USD"), discounts[0].Amount)
+	})
+
+	t.Run("test discounts; not applicable", func(t *testing.T) {
+		c := model.Coupon{Code: "TENOFF", Kind: model.CouponFixed,
+			Amount: model.NewMoney(1000, "USD"), MinOrder: model.NewMoney(5000, "USD")}
+
+		_, err := c.Discounts(items, nil, all)
+		assert.Equal(model.ErrCouponMinOrder, err)
+
+		c.MinOrder.Amount = 0
+
+		_, err = c.Discounts(items, nil, func(model.OrderProduct) bool { return false })
+		assert.Equal(model.ErrCouponNotEligible, err)
+
+		c.Amount.Currency, c.MinOrder.Currency = "EUR", "EUR"
+
+		_, err = c.Discounts(items, nil, all)
+		assert.Equal(model.ErrCouponCurrency, err)
+	})
+}
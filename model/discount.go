@@ -0,0 +1,90 @@
+package model
+
+import (
+	"math/big"
+	"sort"
+)
+
+// Sources of order discounts.
+const (
+	DiscountCoupon    = "coupon"
+	DiscountPromotion = "promotion"
+)
+
+// OrderDiscount is the discount of an order item, kept with the order
+// so that the breakdown survives changes of its source.
+type OrderDiscount struct {
+	OID int64 `json:"-"`
+	PID int64 `json:"pid"`
+	VID int64 `json:"vid"`
+	// Source is what granted the discount, and Ref identifies it in the source,
+	// e.g. the coupon code or the prid of the promotion.
+	Source      string `json:"source"`
+	Ref         string `json:"ref"`
+	Description string `json:"description"`
+	Amount      Money  `json:"amount"`
+}
+
+// netSubtotals returns the subtotals of the items in the currency
+// less the discounts of the items, or ErrCurrencyMismatch if an item is in another currency.
+func netSubtotals(currency Currency, items []OrderProduct, discounts []OrderDiscount) ([]int64, error) {
+	net := make([]int64, len(items))
+
+	for i, item := range items {
+		subtotal := item.Subtotal()
+		if subtotal.Currency != currency {
+			return nil, ErrCurrencyMismatch
+		}
+
+		net[i] = subtotal.Amount
+		for _, d := range discounts {
+			if d.PID == item.PID && d.VID == item.VID {
+				net[i] -= d.Amount.Amount
+			}
+		}
+	}
+
+	return net, nil
+}
+
+// splitAmount splits the amount over the weights in proportion,
+// giving the minor units left by rounding down to the largest remainders,
+// and to the earliest weights among equal remainders, so that the shares add up to the amount.
+func splitAmount(amount int64, weights []int64) []int64 {
+	shares := make([]int64, len(weights))
+
+	total := big.NewInt(0)
+	for _, w := range weights {
+		total.Add(total, big.NewInt(w))
+	}
+
+	if total.Sign() == 0 {
+		return shares
+	}
+
+	remainders := make([]*big.Int, len(weights))
+	left := amount
+
+	for i, w := range weights {
+		q, r := new(big.Int).QuoRem(new(big.Int).Mul(big.NewInt(amount), big.NewInt(w)), total, new(big.Int))
+		shares[i] = q.Int64()
+		remainders[i] = r
+		left -= shares[i]
+	}
+
+	order := make([]int, len(weights))
+	for i := range order {
+		order[i] = i
+	}
+
+	sort.SliceStable(order, func(a, b int) bool {
+		return remainders[order[a]].Cmp(remainders[order[b]]) > 0
+	})
+
+	for i := 0; left > 0; i++ {
+		shares[order[i%len(order)]]++
+		left--
+	}
+
+	return shares
+}
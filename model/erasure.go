@@ -0,0 +1,23 @@
+package model
+
+// Retention policies of the orders of erased users.
+const (
+	// ErasureAnonymize keeps the orders without the link to the user.
+	ErasureAnonymize = "anonymize"
+	// ErasurePurge deletes the orders.
+	ErasurePurge = "purge"
+)
+
+// Erasure is the audit record of an erased user.
+// It holds no personal data of the user.
+type Erasure struct {
+	EID int64 `json:"eid"`
+	// UID is the uid the user had, which is never reused.
+	UID int64 `json:"uid"`
+	// RequestedBy is the uid of the user or manager who requested the erasure.
+	RequestedBy int64  `json:"requested_by"`
+	Policy      string `json:"policy"`
+	// Orders is the number of orders anonymized or purged.
+	Orders int64 `json:"orders"`
+	Date   int64 `json:"date"`
+}
@@ -0,0 +1,13 @@
+package model
+
+// ProductImage is an image of a product kept in the storage.
+type ProductImage struct {
+	IID int64 `json:"iid"`
+	PID int64 `json:"pid"`
+	// Key and ThumbKey are the storage keys of the image and its thumbnail.
+	Key      string `json:"key"`
+	ThumbKey string `json:"thumb_key"`
+	Width    int    `json:"width"`
+	Height   int    `json:"height"`
+	Date     int64  `json:"date"`
+}
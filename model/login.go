@@ -0,0 +1,28 @@
+package model
+
+type LoginHistory struct {
+	LID     int64  `json:"lid"`
+	UID     int64  `json:"uid"`
+	IP      string `json:"ip"`
+	Success bool   `json:"success"`
+	Date    int64  `json:"date"`
+}
+
+// LoginFailure counts the consecutive failed logins of a user id,
+// whether the user exists or not.
+type LoginFailure struct {
+	UserID      string `json:"user_id"`
+	Count       int64  `json:"count"`
+	Last        int64  `json:"last"`
+	LockedUntil int64  `json:"locked_until"`
+}
+
+// PasswordReset is a single-use token to reset the password of a user.
+// Only the hash of the token is stored.
+type PasswordReset struct {
+	RID       int64  `json:"rid"`
+	UID       int64  `json:"uid"`
+	TokenHash string `json:"-"`
+	Expires   int64  `json:"expires"`
+	Used      bool   `json:"used"`
+}
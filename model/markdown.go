@@ -0,0 +1,91 @@
+package model
+
+import (
+	"html"
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+// markdownBreak matches the spaces before a destination, which may continue on the next line
+// after the markers of the block quote the link is in.
+const markdownBreak = `[ \t]*(?:\n[ \t]*(?:>[ \t]*)*)?`
+
+// markdownLinkRegex matches the destination of inline links and images, e.g. [text](url "title").
+var markdownLinkRegex = regexp.MustCompile(`(\]\(` + markdownBreak + `)([^)\s]*)`)
+
+// markdownRefRegex matches the destination of link reference definitions, e.g. [ref]: url.
+// Every "]:" is matched wherever it is, so that definitions in block quotes and list items,
+// and labels with escaped brackets, are never missed.
+var markdownRefRegex = regexp.MustCompile(`(\]:` + markdownBreak + `)(\S*)`)
+
+var safeLinkSchemes = []string{"http:", "https:", "mailto:"}
+
+// SanitizeMarkdown returns the Markdown text safe to render as html:
+// raw html is escaped so that it renders as text,
+// link destinations with schemes other than http, https and mailto are dropped,
+// and control characters other than tabs and newlines are removed.
+func SanitizeMarkdown(s string) string {
+	s = strings.ReplaceAll(s, "\r\n", "\n")
+	s = strings.Map(func(r rune) rune {
+		if r == '\t' || r == '\n' {
+			return r
+		}
+		if r < 0x20 || r == 0x7f || (r >= 0x80 && r < 0xa0) {
+			return -1
+		}
+		return r
+	}, s)
+
+	// every tag, comment and autolink starts with '<',
+	// which the escaped form renders the same outside of code.
+	s = strings.ReplaceAll(s, "<", "&lt;")
+
+	s = markdownLinkRegex.ReplaceAllStringFunc(s, func(m string) string {
+		sub := markdownLinkRegex.FindStringSubmatch(m)
+		if isSafeLink(sub[2]) {
+			return m
+		}
+		return sub[1]
+	})
+
+	s = markdownRefRegex.ReplaceAllStringFunc(s, func(m string) string {
+		sub := markdownRefRegex.FindStringSubmatch(m)
+		if isSafeLink(sub[2]) {
+			return m
+		}
+		return sub[1] + "#"
+	})
+
+	return s
+}
+
+// isSafeLink allows relative links and the safe schemes.
+// Entities are decoded and spaces removed before the scheme is checked,
+// as browsers do, so that "java&#115;cript:" is not missed.
+func isSafeLink(link string) bool {
+	l := strings.Map(func(r rune) rune {
+		if unicode.IsSpace(r) || unicode.IsControl(r) {
+			return -1
+		}
+		return unicode.ToLower(r)
+	}, html.UnescapeString(link))
+
+	colon := strings.Index(l, ":")
+	if colon < 0 {
+		return true
+	}
+
+	// a colon after a path, query or fragment does not start a scheme.
+	if slash := strings.IndexAny(l, "/?#"); slash >= 0 && slash < colon {
+		return true
+	}
+
+	for _, scheme := range safeLinkSchemes {
+		if strings.HasPrefix(l, scheme) {
+			return true
+		}
+	}
+
+	return false
+}
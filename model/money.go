@@ -0,0 +1,242 @@
+package model
+
+import (
+	"encoding/json"
+	"math/big"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// DefaultCurrency is the currency of amounts given without one,
+// and of the prices stored before currencies were supported.
+const DefaultCurrency Currency = "USD"
+
+// MaxMoneyAmount bounds amounts in minor units,
+// so that line totals of MaxCartQuantity units and order totals never overflow.
+const MaxMoneyAmount = 10_000_000_000_000
+
+var (
+	// ErrCurrencyMismatch is returned when amounts of different currencies are added up.
+	ErrCurrencyMismatch = errors.New("currency mismatch")
+	// ErrMoneyOverflow is returned when an amount is out of the range of amounts.
+	ErrMoneyOverflow = errors.New("amount out of range")
+)
+
+// Currency is an ISO 4217 currency code.
+type Currency string
+
+type currencyInfo struct {
+	// exponent is the number of digits of the minor unit, e.g. 2 for cents.
+	exponent int
+	symbol   string
+}
+
+var currencies = map[Currency]currencyInfo{
+	"USD": {2, "$"},
+	"EUR": {2, "€"},
+	"GBP": {2, "£"},
+	"JPY": {0, "¥"},
+	"KRW": {0, "₩"},
+	"CNY": {2, "CN¥"},
+	"CAD": {2, "CA$"},
+	"AUD": {2, "A$"},
+	"CHF": {2, "CHF "},
+	"INR": {2, "₹"},
+	"KWD": {3, "KWD "},
+	"BHD": {3, "BHD "},
+}
+
+func (c Currency) IsValid() error {
+	if _, found := currencies[c]; !found {
+		return errors.Errorf("unsupported currency %q", string(c))
+	}
+	return nil
+}
+
+// Exponent returns the number of digits of the minor unit of the currency.
+func (c Currency) Exponent() int {
+	return currencies[c].exponent
+}
+
+// Money is an amount in the minor unit of its currency, e.g. cents of USD.
+type Money struct {
+	Amount   int64    `json:"amount"`
+	Currency Currency `json:"currency"`
+}
+
+func NewMoney(amount int64, currency Currency) Money {
+	return Money{amount, currency}
+}
+
+// IsValid checks the money as a price: a supported currency
+// and an amount from 0 to MaxMoneyAmount.
+func (m Money) IsValid() error {
+	if err := m.Currency.IsValid(); err != nil {
+		return err
+	}
+
+	if m.Amount < 0 {
+		return errors.Errorf("amount must not be negative")
+	}
+
+	if m.Amount > MaxMoneyAmount {
+		return errors.Errorf("amount must be at most %d", int64(MaxMoneyAmount))
+	}
+
+	return nil
+}
+
+// WithDefaultCurrency returns the money in the currency
+// if it was given without one, e.g. as a bare amount.
+func (m Money) WithDefaultCurrency(c Currency) Money {
+	if m.Currency == "" {
+		m.Currency = c
+	}
+	return m
+}
+
+// Add returns the sum of the amounts, which must be of the same currency.
+func (m Money) Add(o Money) (Money, error) {
+	if m.Currency != o.Currency {
+		return Money{}, ErrCurrencyMismatch
+	}
+
+	return Money{m.Amount + o.Amount, m.Currency}, nil
+}
+
+// Mul returns the money multiplied by the quantity.
+func (m Money) Mul(quantity int64) Money {
+	return Money{m.Amount * quantity, m.Currency}
+}
+
+// MulRat returns the money multiplied by the rational number,
+// rounded to the minor unit half to even, so that rounding errors cancel out on average.
+// It returns ErrMoneyOverflow if the product is out of the range of int64.
+func (m Money) MulRat(r *big.Rat) (Money, error) {
+	v := new(big.Rat).Mul(new(big.Rat).SetInt64(m.Amount), r)
+
+	amount, err := RoundHalfEven(v)
+	if err != nil {
+		return Money{}, err
+	}
+
+	return Money{amount, m.Currency}, nil
+}
+
+// RoundHalfEven rounds the number to an integer, ties to the even integer.
+// It returns ErrMoneyOverflow if the integer is out of the range of int64.
+func RoundHalfEven(r *big.Rat) (int64, error) {
+	num, den := r.Num(), r.Denom()
+
+	q, rem := new(big.Int).QuoRem(num, den, new(big.Int))
+
+	// compare twice the remainder to the denominator to tell below, at or above the half.
+	twice := new(big.Int).Mul(new(big.Int).Abs(rem), big.NewInt(2))
+	switch twice.Cmp(den) {
+	case 1:
+		q.Add(q, big.NewInt(int64(num.Sign())))
+	case 0:
+		if q.Bit(0) == 1 {
+			q.Add(q, big.NewInt(int64(num.Sign())))
+		}
+	}
+
+	if !q.IsInt64() {
+		return 0, ErrMoneyOverflow
+	}
+
+	return q.Int64(), nil
+}
+
+// Sum adds up the amounts, which must all be of the same currency.
+// The sum of no amounts is 0 of the currency.
+func Sum(currency Currency, amounts ...Money) (Money, error) {
+	total := Money{0, currency}
+
+	for _, m := range amounts {
+		var err error
+		if total, err = total.Add(m); err != nil {
+			return Money{}, err
+		}
+	}
+
+	return total, nil
+}
+
+// String formats the money with the symbol and minor unit digits of its currency,
+// e.g. $1,234.50 or ₩1,234.
+func (m Money) String() string {
+	info, found := currencies[m.Currency]
+	if !found {
+		s := strconv.FormatInt(m.Amount, 10)
+		if m.Currency != "" {
+			s += " " + string(m.Currency)
+		}
+		return s
+	}
+
+	amount := m.Amount
+	sign := ""
+	if amount < 0 {
+		sign = "-"
+		amount = -amount
+	}
+
+	digits := strconv.FormatInt(amount, 10)
+	if len(digits) <= info.exponent {
+		digits = strings.Repeat("0", info.exponent-len(digits)+1) + digits
+	}
+
+	major, minor := digits[:len(digits)-info.exponent], digits[len(digits)-info.exponent:]
+
+	b := strings.Builder{}
+	b.WriteString(sign)
+	b.WriteString(info.symbol)
+
+	for i, d := range major {
+		if i > 0 && (len(major)-i)%3 == 0 {
+			b.WriteByte(',')
+		}
+		b.WriteRune(d)
+	}
+
+	if minor != "" {
+		b.WriteByte('.')
+		b.WriteString(minor)
+	}
+
+	return b.String()
+}
+
+// MarshalJSON writes the money with its formatted form.
+func (m Money) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Amount    int64    `json:"amount"`
+		Currency  Currency `json:"currency"`
+		Formatted string   `json:"formatted"`
+	}{m.Amount, m.Currency, m.String()})
+}
+
+// UnmarshalJSON reads an object of the amount and the currency,
+// or a bare amount without a currency; see WithDefaultCurrency.
+func (m *Money) UnmarshalJSON(b []byte) error {
+	var amount int64
+	if err := json.Unmarshal(b, &amount); err == nil {
+		*m = Money{Amount: amount}
+		return nil
+	}
+
+	v := struct {
+		Amount   int64    `json:"amount"`
+		Currency Currency `json:"currency"`
+	}{}
+
+	if err := json.Unmarshal(b, &v); err != nil {
+		return errors.Errorf("money must be an amount in minor units or an object of the amount and the currency")
+	}
+
+	*m = Money{v.Amount, v.Currency}
+	return nil
+}
@@ -0,0 +1,131 @@
+package model_test
+
+import (
+	"encoding/json"
+	"math/big"
+	"testing"
+
+	"simple-go-server/model"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMoney(t *testing.T) {
+	assert := assert.New(t)
+
+	t.Run("test validation", func(t *testing.T) {
+		assert.Nil(model.NewMoney(0, "USD").IsValid())
+		assert.Nil(model.NewMoney(1200, "KRW").IsValid())
+
+		assert.NotNil(model.NewMoney(-1, "USD").IsValid())
+		assert.NotNil(model.NewMoney(100, "XYZ").IsValid())
+		assert.NotNil(model.NewMoney(100, "").IsValid())
+		assert.NotNil(model.NewMoney(model.MaxMoneyAmount+1, "USD").IsValid())
+
+		// a line of the greatest quantity at the cap fits in int64.
+		assert.Equal(int64(model.MaxMoneyAmount*model.MaxCartQuantity), model.NewMoney(model.MaxMoneyAmount, "USD").Mul(model.MaxCartQuantity).Amount)
+	})
+
+	t.Run("test format", func(t *testing.T) {
+		assert.Equal("$1,234.56", model.NewMoney(123456, "USD").String())
+		assert.Equal("$0.05", model.NewMoney(5, "USD").String())
+		assert.Equal("-€10.00", model.NewMoney(-1000, "EUR").String())
+		assert.Equal("₩1,234,567", model.NewMoney(1234567, "KRW").String())
+		assert.Equal("¥980", model.NewMoney(980, "JPY").String())
+		assert.Equal("KWD 1.250", model.NewMoney(1250, "KWD").String())
+	})
+
+	t.Run("test add", func(t *testing.T) {
+		m, err := model.NewMoney(150, "USD").Add(model.NewMoney(250, "USD"))
+		assert.Nil(err)
+		assert.Equal(model.NewMoney(400, "USD"), m)
+
+		_, err = model.NewMoney(150, "USD").Add(model.NewMoney(250, "EUR"))
+		assert.Equal(model.ErrCurrencyMismatch, err)
+
+		m, err = model.Sum("EUR")
+		assert.Nil(err)
+		assert.Equal(model.NewMoney(0, "EUR"), m)
+
+		_, err = model.Sum("EUR", model.NewMoney(1, "EUR"), model.NewMoney(1, "GBP"))
+		assert.Equal(model.ErrCurrencyMismatch, err)
+	})
+
+	t.Run("test round half to even", func(t *testing.T) {
+		for _, c := range []struct {
+			amount int64
+			rat    string
+			want   int64
+		}{
+			{5, "1/2", 2},
+			{15, "1/2", 8},
+			{25, "1/2", 12},
+			{-5, "1/2", -2},
+			{-15, "1/2", -8},
+			{100, "1/3", 33},
+			{200, "1/3", 67},
+			{1999, "9/10", 1799},
+		} {
+			r, _ := new(big.Rat).SetString(c.rat)
+			got, err := model.NewMoney(c.amount, "USD").MulRat(r)
+			assert.Nil(err)
+			assert.Equal(c.want, got.Amount, "%d * %s", c.amount, c.rat)
+		}
+
+		_, err := model.NewMoney(model.MaxMoneyAmount, "USD").MulRat(big.NewRat(1_000_000_000, 1))
+		assert.Equal(model.ErrMoneyOverflow, err)
+	})
+
+	t.Run("test json", func(t *testing.T) {
+		b, err := json.Marshal(model.NewMoney(123456, "USD"))
+		assert.Nil(err)
+		assert.JSONEq(`{"amount":123456,"currency":"USD","formatted":"$1,234.56"}`, string(b))
+
+		m := model.Money{}
+		assert.Nil(json.Unmarshal([]byte(`1500`), &m))
+		assert.Equal(model.NewMoney(1500, "USD"), m.WithDefaultCurrency("USD"))
+
+		assert.Nil(json.Unmarshal([]byte(`{"amount":900,"currency":"JPY","formatted":"¥900"}`), &m))
+		assert.Equal(model.NewMoney(900, "JPY"), m.WithDefaultCurrency("USD"))
+
+		assert.NotNil(json.Unmarshal([]byte(`"12.50"`), &m))
+		assert.NotNil(json.Unmarshal([]byte(`12.5`), &m))
+	})
+
+	t.Run("test exchange rate", func(t *testing.T) {
+		assert.Nil(model.ExchangeRate{Base: "USD", Quote: "EUR", Rate: "0.9215"}.IsValid())
+
+		assert.NotNil(model.ExchangeRate{Base: "USD", Quote: "USD", Rate: "1"}.IsValid())
+		assert.NotNil(model.ExchangeRate{Base: "USD", Quote: "EUR", Rate: "0"}.IsValid())
+		assert.NotNil(model.ExchangeRate{Base: "USD", Quote: "EUR", Rate: "-1.2"}.IsValid())
+		assert.NotNil(model.ExchangeRate{Base: "USD", Quote: "EUR", Rate: "1e3"}.IsValid())
+		assert.NotNil(model.ExchangeRate{Base: "USD", Quote: "XYZ", Rate: "1.5"}.IsValid())
+
+		for _, c := range []struct {
+			rate model.ExchangeRate
+			from model.Money
+			want model.Money
+		}{
+			{model.ExchangeRate{Base: "USD", Quote: "EUR", Rate: "0.9215"}, model.NewMoney(1999, "USD"), model.NewMoney(1842, "EUR")},
+			{model.ExchangeRate{Base: "USD", Quote: "JPY", Rate: "151.37"}, model.NewMoney(1999, "USD"), model.NewMoney(3026, "JPY")},
+			{model.ExchangeRate{Base: "KRW", Quote: "USD", Rate: "0.00073"}, model.NewMoney(25000, "KRW"), model.NewMoney(1825, "USD")},
+			{model.ExchangeRate{Base: "EUR", Quote: "KWD", Rate: "0.333"}, model.NewMoney(1000, "EUR"), model.NewMoney(3330, "KWD")},
+			// 0.5 of the minor unit rounds to the even 2, not 3.
+			{model.ExchangeRate{Base: "USD", Quote: "EUR", Rate: "0.5"}, model.NewMoney(5, "USD"), model.NewMoney(2, "EUR")},
+		} {
+			got, err := c.rate.Convert(c.from)
+			assert.Nil(err)
+			assert.Equal(c.want, got, "%s at %s", c.from, c.rate.Rate)
+		}
+
+		_, err := model.ExchangeRate{Base: "USD", Quote: "EUR", Rate: "0.9"}.Convert(model.NewMoney(100, "GBP"))
+		assert.Equal(model.ErrCurrencyMismatch, err)
+
+		// a price at the cap converted at the greatest rate does not fit in int64.
+		_, err = model.ExchangeRate{Base: "KWD", Quote: "KRW", Rate: "999999999.999999999"}.Convert(model.NewMoney(model.MaxMoneyAmount, "KWD"))
+		assert.Equal(model.ErrMoneyOverflow, err)
+
+		_, err = model.ExchangeRate{Base: "USD", Quote: "KRW", Rate: "1400"}.Convert(model.NewMoney(model.MaxMoneyAmount, "USD"))
+		assert.Equal(model.ErrMoneyOverflow, err)
+	})
+}
@@ -4,9 +4,24 @@ type Order struct {
 	OID  int64 `json:"oid"`
 	UID  int64 `json:"uid"`
 	Date int64 `json:"date"`
+	// ExchangeRate is the rate from the currency of the items to the currency
+	// the user chose at purchase, recorded for audits, or nil if none was chosen.
+	ExchangeRate *ExchangeRate `json:"exchange_rate,omitempty"`
 }
 
 type OrderProduct struct {
 	OID int64 `json:"oid"`
 	PID int64 `json:"pid"`
+	// VID is the ordered variant, or 0 for products without variants.
+	VID int64 `json:"vid"`
+	// Quantity is 1 for products ordered without a cart.
+	Quantity int64 `json:"quantity"`
+	// Price is the unit price at checkout, or at ordering for products ordered without a cart.
+	// Products ordered without a cart before prices were recorded for them have 0.
+	Price Money `json:"price"`
+}
+
+// Subtotal returns the price of the item times its quantity.
+func (o OrderProduct) Subtotal() Money {
+	return o.Price.Mul(o.Quantity)
 }
@@ -1,24 +1,184 @@
 package model
 
 import (
+	"database/sql/driver"
+	"encoding/json"
+	"math"
 	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
 
 	"github.com/pkg/errors"
+	"golang.org/x/text/unicode/norm"
 )
 
-var productNameRegex = regexp.MustCompile("^[a-zA-Z0-9 ]{3,50}")
+const (
+	minProductNameLength       = 3
+	maxProductNameLength       = 50
+	maxProductDescriptionBytes = 10000
+	maxProductAttributes       = 50
+	maxAttributeValueLength    = 200
+)
+
+var attributeKeyRegex = regexp.MustCompile(`^[a-z][a-z0-9_]{0,39}$`)
 
 type ProductName string
 
+// Normalized returns the name in the unicode NFC form without surrounding spaces.
+func (p ProductName) Normalized() ProductName {
+	return ProductName(strings.TrimSpace(norm.NFC.String(string(p))))
+}
+
+// IsValid allows letters, marks, digits, punctuation, symbols and spaces of any script.
 func (p ProductName) IsValid() error {
-	if !productNameRegex.MatchString(string(p)) {
+	s := string(p)
+	n := utf8.RuneCountInString(s)
+
+	if n < minProductNameLength || n > maxProductNameLength {
 		return errors.Errorf("invalid product name")
 	}
+
+	if !utf8.ValidString(s) || strings.IndexFunc(s, invalidNameRune) >= 0 {
+		return errors.Errorf("invalid product name")
+	}
+
+	return nil
+}
+
+func invalidNameRune(r rune) bool {
+	if r == ' ' {
+		return false
+	}
+	return !unicode.IsLetter(r) && !unicode.IsMark(r) && !unicode.IsNumber(r) &&
+		!unicode.IsPunct(r) && !unicode.IsSymbol(r)
+}
+
+// ProductDescription is the long-form description of a product, written in Markdown.
+type ProductDescription string
+
+func (d ProductDescription) IsValid() error {
+	if len(d) > maxProductDescriptionBytes {
+		return errors.Errorf("description must be at most %d bytes", maxProductDescriptionBytes)
+	}
+	if !utf8.ValidString(string(d)) {
+		return errors.Errorf("description must be utf-8")
+	}
 	return nil
 }
 
+// Sanitized returns the description safe to render as Markdown; see SanitizeMarkdown.
+func (d ProductDescription) Sanitized() ProductDescription {
+	return ProductDescription(SanitizeMarkdown(string(d)))
+}
+
+// Types of product attribute values.
+const (
+	AttributeString = "string"
+	AttributeNumber = "number"
+	AttributeBool   = "bool"
+)
+
+// ProductAttribute is a typed key-value property of a product,
+// e.g. the material "cotton" or the weight 0.2.
+type ProductAttribute struct {
+	Key  string `json:"key"`
+	Type string `json:"type"`
+	// Value is a string, a float64 or a bool by the type.
+	Value interface{} `json:"value"`
+}
+
+// ProductAttributes are the attributes of a product, each with a unique key.
+type ProductAttributes []ProductAttribute
+
+func (a ProductAttributes) IsValid() error {
+	if len(a) > maxProductAttributes {
+		return errors.Errorf("at most %d attributes", maxProductAttributes)
+	}
+
+	keys := map[string]struct{}{}
+
+	for _, attr := range a {
+		if !attributeKeyRegex.MatchString(attr.Key) {
+			return errors.Errorf("attribute key must be 1 to 40 lower case letters, digits or '_', starting with a letter")
+		}
+
+		if _, found := keys[attr.Key]; found {
+			return errors.Errorf("duplicate attribute %q", attr.Key)
+		}
+		keys[attr.Key] = struct{}{}
+
+		if err := attr.isValidValue(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (a ProductAttribute) isValidValue() error {
+	switch a.Type {
+	case AttributeString:
+		v, ok := a.Value.(string)
+		if !ok || !utf8.ValidString(v) || utf8.RuneCountInString(v) > maxAttributeValueLength {
+			return errors.Errorf("attribute %q must be a string of at most %d characters", a.Key, maxAttributeValueLength)
+		}
+	case AttributeNumber:
+		v, ok := a.Value.(float64)
+		if !ok || math.IsNaN(v) || math.IsInf(v, 0) {
+			return errors.Errorf("attribute %q must be a number", a.Key)
+		}
+	case AttributeBool:
+		if _, ok := a.Value.(bool); !ok {
+			return errors.Errorf("attribute %q must be a bool", a.Key)
+		}
+	default:
+		return errors.Errorf("attribute type must be %s, %s or %s", AttributeString, AttributeNumber, AttributeBool)
+	}
+
+	return nil
+}
+
+// Value writes the attributes as json text in the database.
+func (a ProductAttributes) Value() (driver.Value, error) {
+	if a == nil {
+		a = ProductAttributes{}
+	}
+
+	b, err := json.Marshal(a)
+	if err != nil {
+		return nil, err
+	}
+
+	return string(b), nil
+}
+
+// Scan reads the attributes from their json text in the database.
+func (a *ProductAttributes) Scan(src interface{}) error {
+	var b []byte
+
+	switch v := src.(type) {
+	case nil:
+		*a = ProductAttributes{}
+		return nil
+	case string:
+		b = []byte(v)
+	case []byte:
+		b = v
+	default:
+		return errors.Errorf("invalid attributes column")
+	}
+
+	return json.Unmarshal(b, a)
+}
+
 type Product struct {
-	PID   int64  `json:"pid"`
-	Name  string `json:"name"`
-	Price int64  `json:"price"`
+	PID         int64             `json:"pid"`
+	Name        string            `json:"name"`
+	Price       Money             `json:"price"`
+	Description string            `json:"description"`
+	Attributes  ProductAttributes `json:"attributes"`
+	// Published is false for drafts, which only managers see
+	// and nobody can order.
+	Published bool `json:"published"`
 }
@@ -0,0 +1,58 @@
+package model_test
+
+import (
+	"testing"
+
+	"simple-go-server/model"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProduct(t *testing.T) {
+	assert := assert.New(t)
+
+	t.Run("test product name", func(t *testing.T) {
+		assert.Nil(model.ProductName("Café crème 250ml").IsValid())
+		assert.Nil(model.ProductName("초코 쿠키 (大)").IsValid())
+		assert.Equal(model.ProductName("Café"), model.ProductName(" Café ").Normalized())
+
+		assert.NotNil(model.ProductName("ab").IsValid())
+		assert.NotNil(model.ProductName("tab\tname").IsValid())
+		assert.NotNil(model.ProductName("new\nline").IsValid())
+	})
+
+	t.Run("test sanitize markdown", func(t *testing.T) {
+		assert.Equal(
+			"# Title\n\n**bold** &lt;script>alert(1)&lt;/script>",
+			model.SanitizeMarkdown("# Title\r\n\r\n**bold** <script>alert(1)</script>"),
+		)
+		assert.Equal(
+			"[site](https://example.com/?a=1&b=2) [rel](/products/1) [x]()) ![img]( \"t\")",
+			model.SanitizeMarkdown("[site](https://example.com/?a=1&b=2) [rel](/products/1) [x](javascript:alert(1)) ![img](JaVa&#115;cript:x \"t\")"),
+		)
+		assert.Equal(
+			"[ref]: #\n[ok]: mailto:shop@example.com",
+			model.SanitizeMarkdown("[ref]: data:text/html,x\n[ok]: mailto:shop@example.com"),
+		)
+		assert.Equal(
+			"> [r]: #\n- [r]: #\n[a\\]b]: #\n> [r]:\n> #\n[x](\n> ))",
+			model.SanitizeMarkdown("> [r]: javascript:alert(1)\n- [r]: javascript:alert(1)\n[a\\]b]: javascript:alert(1)\n> [r]:\n> javascript:alert(1)\n[x](\n> javascript:alert(1))"),
+		)
+	})
+
+	t.Run("test attributes", func(t *testing.T) {
+		assert.Nil(model.ProductAttributes{
+			{Key: "material", Type: model.AttributeString, Value: "cotton"},
+			{Key: "weight_kg", Type: model.AttributeNumber, Value: 0.2},
+			{Key: "organic", Type: model.AttributeBool, Value: true},
+		}.IsValid())
+
+		assert.NotNil(model.ProductAttributes{{Key: "Material", Type: model.AttributeString, Value: "cotton"}}.IsValid())
+		assert.NotNil(model.ProductAttributes{{Key: "weight", Type: model.AttributeNumber, Value: "0.2"}}.IsValid())
+		assert.NotNil(model.ProductAttributes{{Key: "size", Type: "enum", Value: "M"}}.IsValid())
+		assert.NotNil(model.ProductAttributes{
+			{Key: "organic", Type: model.AttributeBool, Value: true},
+			{Key: "organic", Type: model.AttributeBool, Value: false},
+		}.IsValid())
+	})
+}
@@ -0,0 +1,75 @@
+package model
+
+import (
+	"net/mail"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"simple-go-server/policy"
+)
+
+const (
+	maxEmailLength       = 254
+	maxDisplayNameLength = 50
+)
+
+// phoneRegex matches phone numbers in the E.164 format, e.g. +821012345678.
+var phoneRegex = regexp.MustCompile(`^\+[1-9][0-9]{6,14}$`)
+
+// Profile holds the optional fields of a user chosen by the user.
+type Profile struct {
+	Email       string `json:"email"`
+	DisplayName string `json:"display_name"`
+	Phone       string `json:"phone"`
+}
+
+// Normalized returns the profile with the email in lower case
+// and surrounding spaces trimmed, as it is stored.
+func (p Profile) Normalized() Profile {
+	return Profile{
+		Email:       NormalizeEmail(p.Email),
+		DisplayName: strings.TrimSpace(p.DisplayName),
+		Phone:       strings.TrimSpace(p.Phone),
+	}
+}
+
+// IsValid checks the fields of the normalized profile.
+// Empty fields are valid. The returned error is policy.Violations.
+func (p Profile) IsValid() error {
+	v := policy.Violations{}
+
+	if p.Email != "" && !isEmail(p.Email) {
+		v = append(v, policy.Violation{Rule: "email", Message: "invalid email address"})
+	}
+
+	if utf8.RuneCountInString(p.DisplayName) > maxDisplayNameLength {
+		v = append(v, policy.Violation{Rule: "display_name_length", Message: "display name must be at most 50 characters"})
+	}
+
+	if strings.IndexFunc(p.DisplayName, unicode.IsControl) >= 0 {
+		v = append(v, policy.Violation{Rule: "display_name_character", Message: "display name must not contain control characters"})
+	}
+
+	if p.Phone != "" && !phoneRegex.MatchString(p.Phone) {
+		v = append(v, policy.Violation{Rule: "phone", Message: "phone number must be in the E.164 format, e.g. +821012345678"})
+	}
+
+	return v.Err()
+}
+
+// NormalizeEmail returns the email as it is stored and looked up.
+func NormalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+// isEmail returns true if the email is a bare address, without a name.
+func isEmail(email string) bool {
+	if len(email) > maxEmailLength {
+		return false
+	}
+
+	addr, err := mail.ParseAddress(email)
+	return err == nil && addr.Address == email && addr.Name == ""
+}
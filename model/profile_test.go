@@ -0,0 +1,32 @@
+package model_test
+
+import (
+	"testing"
+
+	"simple-go-server/model"
+	"simple-go-server/policy"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProfile(t *testing.T) {
+	assert := assert.New(t)
+
+	t.Run("test normalized", func(t *testing.T) {
+		p := model.Profile{Email: " User@Example.COM ", DisplayName: " User ", Phone: " +821012345678"}.Normalized()
+		assert.Equal(model.Profile{Email: "user@example.com", DisplayName: "User", Phone: "+821012345678"}, p)
+	})
+
+	t.Run("test valid", func(t *testing.T) {
+		assert.Nil(model.Profile{}.IsValid())
+		assert.Nil(model.Profile{Email: "user@example.com", DisplayName: "User", Phone: "+821012345678"}.IsValid())
+	})
+
+	t.Run("test invalid", func(t *testing.T) {
+		err := model.Profile{Email: "User <user@example.com>", DisplayName: "a\nb", Phone: "01012345678"}.IsValid()
+
+		v, ok := err.(policy.Violations)
+		assert.True(ok)
+		assert.Len(v, 3)
+	})
+}
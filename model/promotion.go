@@ -0,0 +1,450 @@
+package model
+
+import (
+	"fmt"
+	"math/big"
+	"sort"
+	"strconv"
+	"time"
+	"unicode/utf8"
+
+	"github.com/pkg/errors"
+)
+
+// Kinds of promotions.
+const (
+	// PromotionBuyXGetY gives Get of every Buy+Get units of the products for free,
+	// the cheapest of each group.
+	PromotionBuyXGetY = "buy_x_get_y"
+	// PromotionTiered takes the percentage of the highest tier reached
+	// by the quantity of the products off them.
+	PromotionTiered = "tiered"
+	// PromotionBundle prices every set of one unit of each of the products at the bundle price.
+	PromotionBundle = "bundle"
+	// PromotionFreeItem gives a unit of the product for free
+	// to orders of at least the minimum subtotal including it.
+	PromotionFreeItem = "free_item"
+)
+
+const (
+	maxPromotionName     = 100
+	maxPromotionProducts = 100
+	maxPromotionTiers    = 10
+	maxBundleProducts    = 10
+	maxPromotionGroup    = 100
+)
+
+// Promotion is a discount applied automatically to the orders its rule matches.
+type Promotion struct {
+	PRID int64  `json:"prid"`
+	Name string `json:"name"`
+	Kind string `json:"kind"`
+	// Priority orders the evaluation of promotions, lower first,
+	// and promotions of the same priority are evaluated in order of prid.
+	Priority int64         `json:"priority"`
+	Rule     PromotionRule `json:"rule"`
+	// Starts and Ends bound the validity window (unix int64), 0 for no bound.
+	Starts int64 `json:"starts"`
+	Ends   int64 `json:"ends"`
+}
+
+// PromotionRule is the definition of a promotion, stored as json.
+// The fields used depend on the kind of the promotion.
+type PromotionRule struct {
+	// Products are the products the promotion applies to, all products if empty,
+	// except for bundles, whose products they are.
+	Products []int64 `json:"products,omitempty"`
+	// Buy and Get are the units bought and given of buy_x_get_y promotions.
+	Buy int64 `json:"buy,omitempty"`
+	Get int64 `json:"get,omitempty"`
+	// Tiers are the tiers of tiered promotions, in increasing quantity.
+	Tiers []PromotionTier `json:"tiers,omitempty"`
+	// Price is the price of a bundle.
+	Price *Money `json:"price,omitempty"`
+	// Product and MinOrder are the free product and the least order subtotal of free_item promotions.
+	Product  int64  `json:"product,omitempty"`
+	MinOrder *Money `json:"min_order,omitempty"`
+}
+
+// PromotionTier takes the percentage off when at least the quantity is ordered.
+type PromotionTier struct {
+	Quantity int64 `json:"quantity"`
+	Percent  int64 `json:"percent"`
+}
+
+// PromotionResult explains the evaluation of a promotion on an order,
+// with the discounts it grants, if any.
+type PromotionResult struct {
+	PRID        int64           `json:"prid"`
+	Name        string          `json:"name"`
+	Applied     bool            `json:"applied"`
+	Explanation string          `json:"explanation"`
+	Discounts   []OrderDiscount `json:"discounts"`
+}
+
+func (p Promotion) IsValid() error {
+	if p.Name == "" || utf8.RuneCountInString(p.Name) > maxPromotionName || !utf8.ValidString(p.Name) {
+		return errors.Errorf("promotion name must be 1 to %d characters", maxPromotionName)
+	}
+
+	if p.Priority < 0 {
+		return errors.Errorf("priority must not be negative")
+	}
+
+	if p.Starts < 0 || p.Ends < 0 || p.Ends != 0 && p.Ends <= p.Starts {
+		return errors.Errorf("promotion must end after it starts")
+	}
+
+	r := p.Rule
+
+	if len(r.Products) > maxPromotionProducts {
+		return errors.Errorf("at most %d products", maxPromotionProducts)
+	}
+
+	switch p.Kind {
+	case PromotionBuyXGetY:
+		if r.Buy < 1 || r.Get < 1 || r.Buy+r.Get > maxPromotionGroup {
+			return errors.Errorf("buy and get must be positive, and at most %d together", maxPromotionGroup)
+		}
+	case PromotionTiered:
+		if len(r.Tiers) == 0 || len(r.Tiers) > maxPromotionTiers {
+			return errors.Errorf("tiered promotions take 1 to %d tiers", maxPromotionTiers)
+		}
+		for i, t := range r.Tiers {
+			if t.Quantity < 1 || i > 0 && t.Quantity <= r.Tiers[i-1].Quantity {
+				return errors.Errorf("tier quantities must be positive and increasing")
+			}
+			if t.Percent < 1 || t.Percent > 100 {
+				return errors.Errorf("tier percent must be between 1 and 100")
+			}
+		}
+	case PromotionBundle:
+		if len(r.Products) < 2 || len(r.Products) > maxBundleProducts {
+			return errors.Errorf("bundles take 2 to %d products", maxBundleProducts)
+		}
+		seen := map[int64]struct{}{}
+		for _, pid := range r.Products {
+			if _, found := seen[pid]; found {
+				return errors.Errorf("duplicate product found in bundle")
+			}
+			seen[pid] = struct{}{}
+		}
+		if r.Price == nil {
+			return errors.Errorf("bundles take a price")
+		}
+		if err := r.Price.IsValid(); err != nil {
+			return err
+		}
+	case PromotionFreeItem:
+		if r.Product < 1 {
+			return errors.Errorf("free item promotions take a product")
+		}
+		if r.MinOrder == nil {
+			return errors.Errorf("free item promotions take a minimum order")
+		}
+		if err := r.MinOrder.IsValid(); err != nil {
+			return err
+		}
+	default:
+		return errors.Errorf("promotion kind must be %s, %s, %s or %s",
+			PromotionBuyXGetY, PromotionTiered, PromotionBundle, PromotionFreeItem)
+	}
+
+	return nil
+}
+
+// Active returns true if the time is inside the validity window.
+func (p Promotion) Active(now time.Time) bool {
+	return now.Unix() >= p.Starts && (p.Ends == 0 || now.Unix() < p.Ends)
+}
+
+// applies returns true if the rule applies to the product.
+func (r PromotionRule) applies(pid int64) bool {
+	if len(r.Products) == 0 {
+		return true
+	}
+	for _, p := range r.Products {
+		if p == pid {
+			return true
+		}
+	}
+	return false
+}
+
+// promotionUnit is a unit of an order item.
+type promotionUnit struct {
+	line  int
+	price int64
+}
+
+// promotionState holds the units of the items not promoted yet while promotions are evaluated.
+type promotionState struct {
+	items    []OrderProduct
+	currency Currency
+	subtotal int64
+	left     []int64
+}
+
+// units returns the units left of the items of the products the rule applies to, in order of the items.
+func (s *promotionState) units(r PromotionRule) []promotionUnit {
+	units := []promotionUnit{}
+	for i, item := range s.items {
+		if !r.applies(item.PID) {
+			continue
+		}
+		for n := int64(0); n < s.left[i]; n++ {
+			units = append(units, promotionUnit{i, item.Price.Amount})
+		}
+	}
+	return units
+}
+
+// take marks the units as promoted.
+func (s *promotionState) take(units []promotionUnit) {
+	for _, u := range units {
+		s.left[u.line]--
+	}
+}
+
+// discounts returns the discounts of the amounts by line.
+func (s *promotionState) discounts(p Promotion, amounts map[int]int64, description string) []OrderDiscount {
+	lines := []int{}
+	for line, amount := range amounts {
+		if amount > 0 {
+			lines = append(lines, line)
+		}
+	}
+	sort.Ints(lines)
+
+	discounts := []OrderDiscount{}
+	for _, line := range lines {
+		discounts = append(discounts, OrderDiscount{
+			PID:         s.items[line].PID,
+			VID:         s.items[line].VID,
+			Source:      DiscountPromotion,
+			Ref:         strconv.FormatInt(p.PRID, 10),
+			Description: description,
+			Amount:      NewMoney(amounts[line], s.currency),
+		})
+	}
+
+	return discounts
+}
+
+// EvaluatePromotions evaluates the promotions on the items of an order in a single currency
+// at the time, in order of priority and prid, and explains the result of each.
+// Each unit of an item is promoted by at most one promotion,
+// so the units a promotion applies to are left out of the promotions evaluated after it.
+// The evaluation depends only on its arguments, so an order is always promoted alike.
+func EvaluatePromotions(promotions []Promotion, items []OrderProduct, now time.Time) []PromotionResult {
+	sorted := append([]Promotion{}, promotions...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		if sorted[i].Priority != sorted[j].Priority {
+			return sorted[i].Priority < sorted[j].Priority
+		}
+		return sorted[i].PRID < sorted[j].PRID
+	})
+
+	s := promotionState{items: items, left: make([]int64, len(items))}
+	for i, item := range items {
+		s.left[i] = item.Quantity
+		s.subtotal += item.Subtotal().Amount
+	}
+	if len(items) > 0 {
+		s.currency = items[0].Price.Currency
+	}
+
+	results := []PromotionResult{}
+
+	for _, p := range sorted {
+		result := PromotionResult{PRID: p.PRID, Name: p.Name, Discounts: []OrderDiscount{}}
+
+		if !p.Active(now) {
+			result.Explanation = "promotion is not valid at this time"
+		} else {
+			var explanation string
+			switch p.Kind {
+			case PromotionBuyXGetY:
+				result.Discounts, explanation = s.buyXGetY(p)
+			case PromotionTiered:
+				result.Discounts, explanation = s.tiered(p)
+			case PromotionBundle:
+				result.Discounts, explanation = s.bundle(p)
+			case PromotionFreeItem:
+				result.Discounts, explanation = s.freeItem(p)
+			}
+
+			if result.Discounts == nil {
+				result.Discounts = []OrderDiscount{}
+			}
+			result.Applied = len(result.Discounts) > 0
+			result.Explanation = explanation
+		}
+
+		results = append(results, result)
+	}
+
+	return results
+}
+
+func (s *promotionState) buyXGetY(p Promotion) ([]OrderDiscount, string) {
+	r := p.Rule
+	group := r.Buy + r.Get
+
+	units := s.units(r)
+	if int64(len(units)) < group {
+		return nil, fmt.Sprintf("needs %d eligible items, the order has %d", group, len(units))
+	}
+
+	// the most expensive units are bought, and the cheapest of each group are free.
+	sort.SliceStable(units, func(i, j int) bool {
+		return units[i].price > units[j].price
+	})
+
+	grouped := units[:int64(len(units))/group*group]
+	amounts := map[int]int64{}
+	var free int64
+
+	for i, u := range grouped {
+		if int64(i)%group >= r.Buy {
+			amounts[u.line] += u.price
+			free++
+		}
+	}
+
+	s.take(grouped)
+
+	description := fmt.Sprintf("%s: buy %d get %d free", p.Name, r.Buy, r.Get)
+	return s.discounts(p, amounts, description), fmt.Sprintf("%d of %d eligible items free", free, len(grouped))
+}
+
+func (s *promotionState) tiered(p Promotion) ([]OrderDiscount, string) {
+	r := p.Rule
+
+	units := s.units(r)
+
+	var tier *PromotionTier
+	for i := range r.Tiers {
+		if int64(len(units)) >= r.Tiers[i].Quantity {
+			tier = &r.Tiers[i]
+		}
+	}
+
+	if tier == nil {
+		return nil, fmt.Sprintf("needs %d eligible items, the order has %d", r.Tiers[0].Quantity, len(units))
+	}
+
+	subtotals := map[int]int64{}
+	for _, u := range units {
+		subtotals[u.line] += u.price
+	}
+
+	rate := big.NewRat(tier.Percent, 100)
+	amounts := map[int]int64{}
+	for line, subtotal := range subtotals {
+		amount, err := NewMoney(subtotal, s.currency).MulRat(rate)
+		if err != nil {
+			return nil, fmt.Sprintf("%v", err)
+		}
+		amounts[line] = amount.Amount
+	}
+
+	s.take(units)
+
+	description := fmt.Sprintf("%s: %d%% off %d or more", p.Name, tier.Percent, tier.Quantity)
+	return s.discounts(p, amounts, description), fmt.Sprintf("%d eligible items reach the tier of %d", len(units), tier.Quantity)
+}
+
+func (s *promotionState) bundle(p Promotion) ([]OrderDiscount, string) {
+	r := p.Rule
+
+	if r.Price.Currency != s.currency {
+		return nil, "bundle is priced in another currency"
+	}
+
+	// the units of each product of the bundle, the cheapest first.
+	byProduct := [][]promotionUnit{}
+	var count int64 = -1
+
+	for _, pid := range r.Products {
+		units := s.units(PromotionRule{Products: []int64{pid}})
+		if len(units) == 0 {
+			return nil, fmt.Sprintf("product %d of the bundle is not in the order", pid)
+		}
+
+		sort.SliceStable(units, func(i, j int) bool {
+			return units[i].price < units[j].price
+		})
+
+		byProduct = append(byProduct, units)
+		if count == -1 || int64(len(units)) < count {
+			count = int64(len(units))
+		}
+	}
+
+	bundled := []promotionUnit{}
+	weights := map[int]int64{}
+	var value int64
+
+	for _, units := range byProduct {
+		for _, u := range units[:count] {
+			bundled = append(bundled, u)
+			weights[u.line] += u.price
+			value += u.price
+		}
+	}
+
+	amount := value - r.Price.Amount*count
+	if amount <= 0 {
+		return nil, fmt.Sprintf("bundle price %s is not below the prices of its products", *r.Price)
+	}
+
+	lines := []int{}
+	for line := range weights {
+		lines = append(lines, line)
+	}
+	sort.Ints(lines)
+
+	shares := []int64{}
+	for _, line := range lines {
+		shares = append(shares, weights[line])
+	}
+
+	amounts := map[int]int64{}
+	for i, share := range splitAmount(amount, shares) {
+		amounts[lines[i]] = share
+	}
+
+	s.take(bundled)
+
+	description := fmt.Sprintf("%s: bundle for %s", p.Name, *r.Price)
+	return s.discounts(p, amounts, description), fmt.Sprintf("%d bundles of %d products", count, len(r.Products))
+}
+
+func (s *promotionState) freeItem(p Promotion) ([]OrderDiscount, string) {
+	r := p.Rule
+
+	if r.MinOrder.Currency != s.currency {
+		return nil, "minimum order is in another currency"
+	}
+
+	if s.subtotal < r.MinOrder.Amount {
+		return nil, fmt.Sprintf("order subtotal %s is below %s", NewMoney(s.subtotal, s.currency), *r.MinOrder)
+	}
+
+	units := s.units(PromotionRule{Products: []int64{r.Product}})
+	if len(units) == 0 {
+		return nil, fmt.Sprintf("free product %d is not in the order", r.Product)
+	}
+
+	// the cheapest unit is free, e.g. of the variants of the product.
+	sort.SliceStable(units, func(i, j int) bool {
+		return units[i].price < units[j].price
+	})
+
+	free := units[:1]
+	s.take(free)
+
+	description := fmt.Sprintf("%s: free item over %s", p.Name, *r.MinOrder)
+	return s.discounts(p, map[int]int64{free[0].line: free[0].price}, description), "order subtotal reaches the minimum"
+}
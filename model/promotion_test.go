@@ -0,0 +1,157 @@
+package model_test
+
+import (
+	"testing"
+	"time"
+
+	"simple-go-server/model"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPromotion(t *testing.T) {
+	assert := assert.New(t)
+
+	now := time.Unix(1000, 0)
+
+	usd := func(amount int64) *model.Money {
+		m := model.NewMoney(amount, "USD")
+		return &m
+	}
+
+	items := []model.OrderProduct{
+		{PID: 1, Quantity: 3, Price: model.NewMoney(1000, "USD")},
+		{PID: 2, Quantity: 2, Price: model.NewMoney(500, "USD")},
+		{PID: 3, Quantity: 1, Price: model.NewMoney(300, "USD")},
+	}
+
+	// amounts returns the discount amounts of the result by pid.
+	amounts := func(result model.PromotionResult) map[int64]int64 {
+		m := map[int64]int64{}
+		for _, d := range result.Discounts {
+			assert.Equal(model.DiscountPromotion, d.Source)
+			m[d.PID] += d.Amount.Amount
+		}
+		return m
+	}
+
+	buy2get1 := model.Promotion{PRID: 2, Name: "mugs", Kind: model.PromotionBuyXGetY,
+		Rule: model.PromotionRule{Products: []int64{1, 2}, Buy: 2, Get: 1}}
+	tiered := model.Promotion{PRID: 1, Name: "volume", Kind: model.PromotionTiered, Priority: 1,
+		Rule: model.PromotionRule{Tiers: []model.PromotionTier{{Quantity: 2, Percent: 10}, {Quantity: 3, Percent: 20}}}}
+	bundle := model.Promotion{PRID: 3, Name: "set", Kind: model.PromotionBundle,
+		Rule: model.PromotionRule{Products: []int64{1, 3}, Price: usd(1100)}}
+	freeItem := model.Promotion{PRID: 4, Name: "gift", Kind: model.PromotionFreeItem,
+		Rule: model.PromotionRule{Product: 3, MinOrder: usd(4000)}}
+
+	t.Run("test validation", func(t *testing.T) {
+		for _, p := range []model.Promotion{buy2get1, tiered, bundle, freeItem} {
+			assert.Nil(p.IsValid(), p.Name)
+		}
+
+		for _, p := range []model.Promotion{
+			{Name: "", Kind: model.PromotionBuyXGetY, Rule: model.PromotionRule{Buy: 1, Get: 1}},
+			{Name: "x", Kind: "mystery"},
+			{Name: "x", Kind: model.PromotionBuyXGetY, Rule: model.PromotionRule{Buy: 1}},
+			{Name: "x", Kind: model.PromotionTiered},
+			{Name: "x", Kind: model.PromotionTiered, Rule: model.PromotionRule{Tiers: []model.PromotionTier{{Quantity: 3, Percent: 10}, {Quantity: 2, Percent: 20}}}},
+			{Name: "x", Kind: model.PromotionTiered, Rule: model.PromotionRule{Tiers: []model.PromotionTier{{Quantity: 3, Percent: 120}}}},
+			{Name: "x", Kind: model.PromotionBundle, Rule: model.PromotionRule{Products: []int64{1}, Price: usd(100)}},
+			{Name: "x", Kind: model.PromotionBundle, Rule: model.PromotionRule{Products: []int64{1, 1}, Price: usd(100)}},
+			{Name: "x", Kind: model.PromotionBundle, Rule: model.PromotionRule{Products: []int64{1, 2}}},
+			{Name: "x", Kind: model.PromotionFreeItem, Rule: model.PromotionRule{Product: 1}},
+			{Name: "x", Kind: model.PromotionFreeItem, Rule: model.PromotionRule{Product: 1, MinOrder: usd(100)}, Starts: 200, Ends: 100},
+		} {
+			assert.NotNil(p.IsValid(), "%+v", p)
+		}
+	})
+
+	t.Run("test buy x get y", func(t *testing.T) {
+		results := model.EvaluatePromotions([]model.Promotion{buy2get1}, items, now)
+		assert.Len(results, 1)
+		assert.True(results[0].Applied)
+		// of 1000, 1000, 1000, 500 and 500 the third is free, and the last two make no group.
+		assert.Equal(map[int64]int64{1: 1000}, amounts(results[0]))
+		assert.Equal("1 of 3 eligible items free", results[0].Explanation)
+		assert.Equal("mugs: buy 2 get 1 free", results[0].Discounts[0].Description)
+		assert.Equal("2", results[0].Discounts[0].Ref)
+	})
+
+	t.Run("test tiered", func(t *testing.T) {
+		results := model.EvaluatePromotions([]model.Promotion{tiered}, items, now)
+		assert.True(results[0].Applied)
+		assert.Equal(map[int64]int64{1: 600, 2: 200, 3: 60}, amounts(results[0]))
+
+		results = model.EvaluatePromotions([]model.Promotion{tiered}, items[2:], now)
+		assert.False(results[0].Applied)
+		assert.Empty(results[0].Discounts)
+		assert.Equal("needs 2 eligible items, the order has 1", results[0].Explanation)
+	})
+
+	t.Run("test bundle", func(t *testing.T) {
+		results := model.EvaluatePromotions([]model.Promotion{bundle}, items, now)
+		assert.True(results[0].Applied)
+		// 1300 of a bundle for 1100 takes 200 off, split 1000 to 300.
+		assert.Equal(map[int64]int64{1: 154, 3: 46}, amounts(results[0]))
+
+		results = model.EvaluatePromotions([]model.Promotion{bundle}, items[:2], now)
+		assert.False(results[0].Applied)
+		assert.Equal("product 3 of the bundle is not in the order", results[0].Explanation)
+	})
+
+	t.Run("test free item", func(t *testing.T) {
+		results := model.EvaluatePromotions([]model.Promotion{freeItem}, items, now)
+		assert.True(results[0].Applied)
+		assert.Equal(map[int64]int64{3: 300}, amounts(results[0]))
+
+		expensive := freeItem
+		expensive.Rule.MinOrder = usd(5000)
+
+		results = model.EvaluatePromotions([]model.Promotion{expensive}, items, now)
+		assert.False(results[0].Applied)
+		assert.Equal("order subtotal $43.00 is below $50.00", results[0].Explanation)
+	})
+
+	t.Run("test evaluation order", func(t *testing.T) {
+		// the buy x get y of priority 0 takes its group of units first,
+		// and the tier is reached by the 3 units left.
+		results := model.EvaluatePromotions([]model.Promotion{tiered, buy2get1}, items, now)
+		assert.Len(results, 2)
+		assert.Equal(int64(2), results[0].PRID)
+		assert.Equal(map[int64]int64{1: 1000}, amounts(results[0]))
+		assert.Equal(map[int64]int64{2: 200, 3: 60}, amounts(results[1]))
+
+		first := tiered
+		first.Priority = 0
+		first.PRID = 1
+
+		results = model.EvaluatePromotions([]model.Promotion{buy2get1, first}, items, now)
+		assert.Equal(int64(1), results[0].PRID)
+		assert.False(results[1].Applied)
+		assert.Equal("needs 3 eligible items, the order has 0", results[1].Explanation)
+
+		// an evaluation is always the same.
+		assert.Equal(results, model.EvaluatePromotions([]model.Promotion{buy2get1, first}, items, now))
+	})
+
+	t.Run("test inactive", func(t *testing.T) {
+		later := freeItem
+		later.Starts = now.Add(time.Hour).Unix()
+
+		results := model.EvaluatePromotions([]model.Promotion{later}, items, now)
+		assert.False(results[0].Applied)
+		assert.Equal("promotion is not valid at this time", results[0].Explanation)
+	})
+
+	t.Run("test coupon after promotions", func(t *testing.T) {
+		results := model.EvaluatePromotions([]model.Promotion{buy2get1}, items, now)
+
+		c := model.Coupon{Code: "SAVE10", Kind: model.CouponPercent, Percent: 10,
+			Amount: model.NewMoney(0, "USD"), MinOrder: model.NewMoney(0, "USD")}
+
+		discounts, err := c.Discounts(items, results[0].Discounts, func(model.OrderProduct) bool { return true })
+		assert.Nil(err)
+		assert.Equal(model.NewMoney(200, "USD"), discounts[0].Amount)
+		assert.Equal(model.NewMoney(100, "USD"), discounts[1].Amount)
+	})
+}
@@ -0,0 +1,85 @@
+package model
+
+import (
+	"math/big"
+	"regexp"
+
+	"github.com/pkg/errors"
+)
+
+var rateRegex = regexp.MustCompile(`^[0-9]{1,9}(\.[0-9]{1,9})?$`)
+
+// ExchangeRate is the rate of a currency pair maintained by managers,
+// applying from its effective date until the next rate of the pair.
+type ExchangeRate struct {
+	RID   int64    `json:"rid"`
+	Base  Currency `json:"base"`
+	Quote Currency `json:"quote"`
+	// Rate is the decimal amount of the quote currency
+	// a unit of the base currency buys, e.g. "0.9215" for USD to EUR.
+	Rate string `json:"rate"`
+	// Effective is the date the rate applies from (unix int64).
+	Effective int64 `json:"effective"`
+}
+
+func (r ExchangeRate) IsValid() error {
+	if err := r.Base.IsValid(); err != nil {
+		return err
+	}
+
+	if err := r.Quote.IsValid(); err != nil {
+		return err
+	}
+
+	if r.Base == r.Quote {
+		return errors.Errorf("base and quote currencies must differ")
+	}
+
+	if !rateRegex.MatchString(r.Rate) {
+		return errors.Errorf("rate must be a decimal of at most 9 digits before and after the point")
+	}
+
+	if r.rat().Sign() <= 0 {
+		return errors.Errorf("rate must be positive")
+	}
+
+	return nil
+}
+
+func (r ExchangeRate) rat() *big.Rat {
+	v, ok := new(big.Rat).SetString(r.Rate)
+	if !ok {
+		return new(big.Rat)
+	}
+	return v
+}
+
+// Convert returns the money of the base currency in the quote currency,
+// rounded to the minor unit of the quote currency half to even.
+// It returns ErrMoneyOverflow if the converted amount is above MaxMoneyAmount.
+func (r ExchangeRate) Convert(m Money) (Money, error) {
+	if m.Currency != r.Base {
+		return Money{}, ErrCurrencyMismatch
+	}
+
+	// amounts are in minor units, so the rate is scaled by the difference of the exponents.
+	v := r.rat()
+	v.Mul(v, new(big.Rat).SetFrac(pow10(r.Quote.Exponent()), pow10(r.Base.Exponent())))
+
+	converted, err := m.MulRat(v)
+	if err != nil {
+		return Money{}, err
+	}
+
+	if converted.Amount > MaxMoneyAmount || converted.Amount < -MaxMoneyAmount {
+		return Money{}, ErrMoneyOverflow
+	}
+
+	converted.Currency = r.Quote
+
+	return converted, nil
+}
+
+func pow10(n int) *big.Int {
+	return new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(n)), nil)
+}
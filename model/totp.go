@@ -0,0 +1,12 @@
+package model
+
+// TOTP is the second factor of a user.
+// It is pending until the user verifies the first code.
+type TOTP struct {
+	UID     int64  `json:"uid"`
+	Secret  string `json:"-"`
+	Enabled bool   `json:"enabled"`
+	// LastStep is the time step of the last accepted code,
+	// so that a code cannot be replayed.
+	LastStep int64 `json:"-"`
+}
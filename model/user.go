@@ -1,68 +1,46 @@
 package model
 
 import (
-	"regexp"
+	"simple-go-server/hasher"
+	"simple-go-server/policy"
 
-	"github.com/pkg/errors"
-	"golang.org/x/crypto/bcrypt"
-)
-
-var (
-	passwordEntireRegex     = regexp.MustCompile("^[a-zA-Z0-9!@#$%^&*+]{8,}$")
-	passwordSpecialChrRegex = regexp.MustCompile("[!@#$%^&*+]+")
-	passwordNumRegex        = regexp.MustCompile("[0-9]+")
-	passwordChrRegex        = regexp.MustCompile("[a-zA-Z]+")
+	"golang.org/x/text/unicode/norm"
 )
 
 type Password string
 
-func (p Password) IsValid() error {
-	e := errors.Errorf("invalid password")
-
-	pw := string(p)
-
-	if !passwordEntireRegex.MatchString(pw) {
-		return errors.WithMessage(e, "invalid character or short length")
-	}
-
-	if !passwordSpecialChrRegex.MatchString(pw) {
-		return errors.WithMessage(e, "no special character")
-	}
-
-	if !passwordNumRegex.MatchString(pw) {
-		return errors.WithMessage(e, "no digit")
-	}
-
-	if !passwordChrRegex.MatchString(pw) {
-		return errors.WithMessage(e, "no alphabet character")
-	}
-
-	return nil
+// IsValid checks the password against the password policy.
+// The user id is the id of the user choosing the password,
+// which the password must not be similar to.
+// The returned error is policy.Violations.
+func (p Password) IsValid(userID UserID) error {
+	return policy.Default().CheckPassword(string(p), string(userID)).Err()
 }
 
 // Hash returns the hash value of the password
-// to be inserted into the database.
+// to be inserted into the database, created by the default hasher.
 func (p Password) Hash() (string, error) {
-	bytes, err := bcrypt.GenerateFromPassword([]byte(p), bcrypt.DefaultCost)
-	return string(bytes), err
+	return hasher.Default().Hash(p.normalized())
 }
 
 // CompareWithHash returns true if the argument
 // 'hash' is the hash value of the password.
 func (p Password) CompareWithHash(hash string) bool {
-	err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(p))
-	return err == nil
+	return hasher.Verify(p.normalized(), hash)
 }
 
-var userIDRegex = regexp.MustCompile("^[a-zA-Z0-9]{3,18}$")
+// normalized returns the password in the unicode NFKC form,
+// so that the same password typed on different devices matches.
+func (p Password) normalized() string {
+	return norm.NFKC.String(string(p))
+}
 
 type UserID string
 
+// IsValid checks the user id against the user id policy.
+// The returned error is policy.Violations.
 func (id UserID) IsValid() error {
-	if !userIDRegex.MatchString(string(id)) {
-		return errors.Errorf("invalid user id")
-	}
-	return nil
+	return policy.Default().CheckUserID(string(id)).Err()
 }
 
 const (
@@ -70,9 +48,55 @@ const (
 	RoleManager = "manager"
 )
 
+// User is the user as stored in the database.
+// It is never written to responses as is; see Public and Private.
 type User struct {
 	UID      int64  `json:"uid"`
 	UserID   string `json:"user_id"`
 	Role     string `json:"role"`
-	Password string `json:"password"`
+	Password string `json:"-"`
+	// TokenVersion is increased to revoke all access-tokens of the user.
+	TokenVersion int64 `json:"-"`
+	// Suspended users cannot log in until a manager reactivates them.
+	Suspended bool `json:"suspended"`
+	Profile
+	// EmailVerified is true once the user opened the verification link
+	// sent to the current email.
+	EmailVerified bool `json:"email_verified"`
+}
+
+// PublicUser is the user visible to anyone.
+type PublicUser struct {
+	UserID      string `json:"user_id"`
+	DisplayName string `json:"display_name"`
+}
+
+// PrivateUser is the user visible to the user itself and managers.
+type PrivateUser struct {
+	PublicUser
+	UID           int64  `json:"uid"`
+	Role          string `json:"role"`
+	Suspended     bool   `json:"suspended"`
+	Email         string `json:"email"`
+	EmailVerified bool   `json:"email_verified"`
+	Phone         string `json:"phone"`
+}
+
+func (u *User) Public() PublicUser {
+	return PublicUser{
+		UserID:      u.UserID,
+		DisplayName: u.DisplayName,
+	}
+}
+
+func (u *User) Private() PrivateUser {
+	return PrivateUser{
+		PublicUser:    u.Public(),
+		UID:           u.UID,
+		Role:          u.Role,
+		Suspended:     u.Suspended,
+		Email:         u.Email,
+		EmailVerified: u.EmailVerified,
+		Phone:         u.Phone,
+	}
 }
@@ -0,0 +1,51 @@
+package model_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"simple-go-server/model"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUserSerialization(t *testing.T) {
+	assert := assert.New(t)
+
+	user := &model.User{
+		UID:          7,
+		UserID:       "serialize1",
+		Role:         model.RoleManager,
+		Password:     "$argon2id$v=19$m=19456,t=2,p=1$c2FsdA$a2V5",
+		TokenVersion: 3,
+		Profile: model.Profile{
+			Email:       "serialize1@example.com",
+			DisplayName: "Serialize",
+			Phone:       "+821012345678",
+		},
+	}
+
+	t.Run("test user", func(t *testing.T) {
+		b, err := json.Marshal(user)
+		assert.Nil(err)
+
+		assert.NotContains(string(b), "argon2id")
+		assert.NotContains(string(b), "password")
+		assert.NotContains(string(b), "version")
+	})
+
+	t.Run("test public user", func(t *testing.T) {
+		b, err := json.Marshal(user.Public())
+		assert.Nil(err)
+		assert.JSONEq(`{"user_id":"serialize1","display_name":"Serialize"}`, string(b))
+	})
+
+	t.Run("test private user", func(t *testing.T) {
+		b, err := json.Marshal(user.Private())
+		assert.Nil(err)
+		assert.JSONEq(`{
+			"uid":7,"user_id":"serialize1","display_name":"Serialize","role":"manager","suspended":false,
+			"email":"serialize1@example.com","email_verified":false,"phone":"+821012345678"
+		}`, string(b))
+	})
+}
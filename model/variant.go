@@ -0,0 +1,132 @@
+package model
+
+import (
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	maxOptionAxes        = 3
+	maxOptionValues      = 50
+	maxOptionValueLength = 30
+)
+
+var skuRegex = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_-]{0,63}$`)
+
+// ProductOption is an axis the variants of a product differ in,
+// e.g. size with the values S, M and L.
+type ProductOption struct {
+	Name   string   `json:"name"`
+	Values []string `json:"values"`
+}
+
+// ProductOptions are the axes of a product in their order.
+type ProductOptions []ProductOption
+
+func (o ProductOptions) IsValid() error {
+	if len(o) > maxOptionAxes {
+		return errors.Errorf("at most %d options", maxOptionAxes)
+	}
+
+	names := map[string]struct{}{}
+
+	for _, opt := range o {
+		if !isOptionValue(opt.Name) {
+			return errors.Errorf("option name must be 1 to %d characters without surrounding spaces", maxOptionValueLength)
+		}
+
+		if _, found := names[opt.Name]; found {
+			return errors.Errorf("duplicate option %q", opt.Name)
+		}
+		names[opt.Name] = struct{}{}
+
+		if len(opt.Values) == 0 || len(opt.Values) > maxOptionValues {
+			return errors.Errorf("option %q must have 1 to %d values", opt.Name, maxOptionValues)
+		}
+
+		values := map[string]struct{}{}
+		for _, v := range opt.Values {
+			if !isOptionValue(v) {
+				return errors.Errorf("option value must be 1 to %d characters without surrounding spaces", maxOptionValueLength)
+			}
+
+			if _, found := values[v]; found {
+				return errors.Errorf("duplicate value %q of option %q", v, opt.Name)
+			}
+			values[v] = struct{}{}
+		}
+	}
+
+	return nil
+}
+
+// Match checks that the variant options hold a value of every axis, and nothing else.
+func (o ProductOptions) Match(options map[string]string) error {
+	if len(o) == 0 {
+		return errors.Errorf("product has no options")
+	}
+
+	if len(options) != len(o) {
+		return errors.Errorf("variant must have a value of every option")
+	}
+
+	for _, opt := range o {
+		v, found := options[opt.Name]
+		if !found {
+			return errors.Errorf("variant has no value of option %q", opt.Name)
+		}
+
+		valid := false
+		for _, value := range opt.Values {
+			if v == value {
+				valid = true
+				break
+			}
+		}
+
+		if !valid {
+			return errors.Errorf("invalid value %q of option %q", v, opt.Name)
+		}
+	}
+
+	return nil
+}
+
+func isOptionValue(v string) bool {
+	return v != "" && strings.TrimSpace(v) == v && utf8.RuneCountInString(v) <= maxOptionValueLength
+}
+
+// Variant is a purchasable version of a product,
+// e.g. the t-shirt in size M and color red.
+type Variant struct {
+	VID int64 `json:"vid"`
+	PID int64 `json:"pid"`
+	// SKU is the stock keeping unit, unique among all variants.
+	SKU string `json:"sku"`
+	// Options maps each option name of the product to a value.
+	Options map[string]string `json:"options"`
+	// Price overrides the product price if it is not nil,
+	// and is always in the product currency.
+	Price *Money `json:"price"`
+	Stock int64  `json:"stock"`
+}
+
+// UnitPrice returns the price of the variant of the product.
+func (v *Variant) UnitPrice(p *Product) Money {
+	if v.Price != nil {
+		return *v.Price
+	}
+	return p.Price
+}
+
+type SKU string
+
+func (s SKU) IsValid() error {
+	if !skuRegex.MatchString(string(s)) {
+		return errors.Errorf("sku must be 1 to 64 letters, digits, '-' or '_'")
+	}
+	return nil
+}
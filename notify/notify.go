@@ -0,0 +1,155 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"simple-go-server/logger"
+
+	"github.com/pkg/errors"
+)
+
+// Message is a notification delivered to a user.
+type Message struct {
+	To      string `json:"to"`
+	Subject string `json:"subject"`
+	Body    string `json:"body"`
+}
+
+// Notifier delivers messages to users, e.g. by mail or sms.
+type Notifier interface {
+	Notify(ctx context.Context, msg Message) error
+}
+
+var (
+	mu  sync.RWMutex
+	std Notifier
+)
+
+// Default returns the notifier set by NOTIFIER,
+// "log" (default) or "file:<path>".
+func Default() Notifier {
+	mu.RLock()
+	n := std
+	mu.RUnlock()
+
+	if n != nil {
+		return n
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	if std == nil {
+		std = fromEnv()
+	}
+
+	return std
+}
+
+// SetDefault replaces the default notifier.
+func SetDefault(n Notifier) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	std = n
+}
+
+func fromEnv() Notifier {
+	v := os.Getenv("NOTIFIER")
+
+	if path, found := strings.CutPrefix(v, "file:"); found && path != "" {
+		return NewFileNotifier(path)
+	}
+
+	if v != "" && v != "log" {
+		logger.Default().Warn("unknown NOTIFIER, using log", "value", v)
+	}
+
+	return LogNotifier{}
+}
+
+// LogNotifier writes messages to the log.
+// It is meant for local development only.
+// The body is never written, since it may hold a token, e.g. of a password reset;
+// use a FileNotifier to read the bodies.
+type LogNotifier struct{}
+
+func (LogNotifier) Notify(ctx context.Context, msg Message) error {
+	logger.FromContext(ctx).Info("notification", "to", msg.To, "subject", msg.Subject, "length", len(msg.Body))
+	return nil
+}
+
+// FileNotifier appends messages to a file as json lines.
+type FileNotifier struct {
+	mu   sync.Mutex
+	path string
+}
+
+func NewFileNotifier(path string) *FileNotifier {
+	return &FileNotifier{path: path}
+}
+
+func (n *FileNotifier) Notify(ctx context.Context, msg Message) error {
+	b, err := json.Marshal(struct {
+		Message
+		Date string `json:"date"`
+	}{
+		msg,
+		time.Now().UTC().Format(time.RFC3339),
+	})
+	if err != nil {
+		return err
+	}
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	f, err := os.OpenFile(n.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return errors.Wrap(err, "open notification file failure")
+	}
+	defer f.Close()
+
+	_, err = f.Write(append(b, '\n'))
+
+	return err
+}
+
+// MemoryNotifier keeps messages in memory, e.g. for tests.
+type MemoryNotifier struct {
+	mu       sync.Mutex
+	messages []Message
+}
+
+func NewMemoryNotifier() *MemoryNotifier {
+	return &MemoryNotifier{}
+}
+
+func (n *MemoryNotifier) Notify(ctx context.Context, msg Message) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	n.messages = append(n.messages, msg)
+
+	return nil
+}
+
+// Messages returns the messages sent to the recipient.
+func (n *MemoryNotifier) Messages(to string) []Message {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	msgs := []Message{}
+	for _, m := range n.messages {
+		if m.To == to {
+			msgs = append(msgs, m)
+		}
+	}
+
+	return msgs
+}
@@ -0,0 +1,137 @@
+package policy
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/pkg/errors"
+)
+
+// Class is a class of characters a password may be required to contain.
+type Class string
+
+const (
+	ClassLower   Class = "lower"
+	ClassUpper   Class = "upper"
+	ClassLetter  Class = "letter"
+	ClassDigit   Class = "digit"
+	ClassSpecial Class = "special"
+)
+
+var classMatchers = map[Class]func(r rune) bool{
+	ClassLower:  unicode.IsLower,
+	ClassUpper:  unicode.IsUpper,
+	ClassLetter: unicode.IsLetter,
+	ClassDigit:  unicode.IsDigit,
+	ClassSpecial: func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r) && !unicode.IsSpace(r)
+	},
+}
+
+// ParseClasses parses a comma separated list of classes, e.g. "letter,digit".
+func ParseClasses(v string) ([]Class, error) {
+	classes := []Class{}
+	for _, s := range splitList(v) {
+		c := Class(s)
+		if _, ok := classMatchers[c]; !ok {
+			return nil, errors.Errorf("unknown character class: %q", s)
+		}
+		classes = append(classes, c)
+	}
+	return classes, nil
+}
+
+// PasswordPolicy holds the rules of passwords.
+type PasswordPolicy struct {
+	// MinLength and MaxLength are counted in characters.
+	MinLength int
+	MaxLength int
+	// Classes are the classes of characters required at least once.
+	Classes []Class
+	// Unicode allows any printable character,
+	// otherwise only printable ascii characters are allowed.
+	Unicode bool
+	// Blocklist holds breached or common passwords in lower case.
+	Blocklist map[string]struct{}
+	// MaxUserIDSimilarity is the greatest similarity (0 to 1)
+	// of the password to the user id; 1 disables the check.
+	MaxUserIDSimilarity float64
+}
+
+// Check returns the violations of the password
+// chosen by the user of the user id.
+func (p PasswordPolicy) Check(password, userID string) Violations {
+	v := Violations{}
+
+	n := utf8.RuneCountInString(password)
+
+	if n < p.MinLength {
+		v = append(v, Violation{"min_length", fmt.Sprintf("password must be at least %d characters", p.MinLength)})
+	}
+
+	if n > p.MaxLength {
+		v = append(v, Violation{"max_length", fmt.Sprintf("password must be at most %d characters", p.MaxLength)})
+	}
+
+	if !utf8.ValidString(password) || strings.IndexFunc(password, p.invalidRune) >= 0 {
+		if p.Unicode {
+			v = append(v, Violation{"invalid_character", "password must not contain control characters"})
+		} else {
+			v = append(v, Violation{"invalid_character", "password must contain only printable ascii characters"})
+		}
+	}
+
+	for _, c := range p.Classes {
+		if strings.IndexFunc(password, classMatchers[c]) < 0 {
+			v = append(v, Violation{"class_" + string(c), fmt.Sprintf("password must contain a %s character", c)})
+		}
+	}
+
+	if _, blocked := p.Blocklist[strings.ToLower(password)]; blocked {
+		v = append(v, Violation{"blocklist", "password is too common or known to be breached"})
+	}
+
+	if userID != "" && p.MaxUserIDSimilarity < 1 && similar(password, userID, p.MaxUserIDSimilarity) {
+		v = append(v, Violation{"user_id_similarity", "password must not be similar to the user id"})
+	}
+
+	return v
+}
+
+func (p PasswordPolicy) invalidRune(r rune) bool {
+	if p.Unicode {
+		return unicode.IsControl(r)
+	}
+	return r < 0x20 || r > 0x7e
+}
+
+// LoadBlocklist reads passwords from the file, one per line.
+// Empty lines and lines starting with '#' are skipped.
+func LoadBlocklist(path string) (map[string]struct{}, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "open password blocklist failure")
+	}
+	defer f.Close()
+
+	list := map[string]struct{}{}
+
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		line := strings.TrimSpace(s.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		list[strings.ToLower(line)] = struct{}{}
+	}
+
+	if err := s.Err(); err != nil {
+		return nil, errors.Wrap(err, "read password blocklist failure")
+	}
+
+	return list, nil
+}
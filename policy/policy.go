@@ -0,0 +1,203 @@
+package policy
+
+import (
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+
+	"simple-go-server/logger"
+
+	"github.com/pkg/errors"
+)
+
+// Violation is a single rule broken by a password or user id.
+type Violation struct {
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+}
+
+// Violations are all the rules broken by a password or user id.
+type Violations []Violation
+
+func (v Violations) Error() string {
+	msgs := make([]string, len(v))
+	for i := range v {
+		msgs[i] = v[i].Message
+	}
+	return strings.Join(msgs, ", ")
+}
+
+// Err returns nil if there is no violation,
+// so that the result can be returned as an error.
+func (v Violations) Err() error {
+	if len(v) == 0 {
+		return nil
+	}
+	return v
+}
+
+// Policy holds the rules of passwords and user ids.
+type Policy struct {
+	Password PasswordPolicy
+	UserID   UserIDPolicy
+}
+
+// CheckPassword returns the violations of the password
+// chosen by the user of the user id.
+func (p *Policy) CheckPassword(password, userID string) Violations {
+	return p.Password.Check(password, userID)
+}
+
+// CheckUserID returns the violations of the user id.
+func (p *Policy) CheckUserID(userID string) Violations {
+	return p.UserID.Check(userID)
+}
+
+var (
+	mu  sync.RWMutex
+	std *Policy
+)
+
+// Default returns the policy set by SetDefault,
+// or else the policy configured by the environment.
+func Default() *Policy {
+	mu.RLock()
+	p := std
+	mu.RUnlock()
+
+	if p != nil {
+		return p
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	if std == nil {
+		p, err := FromEnv()
+		if err != nil {
+			logger.Default().Warn("invalid policy configuration, using defaults", "error", err)
+			p = New()
+		}
+		std = p
+	}
+
+	return std
+}
+
+// SetDefault replaces the default policy.
+func SetDefault(p *Policy) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	std = p
+}
+
+// New returns the default policy.
+func New() *Policy {
+	return &Policy{
+		Password: PasswordPolicy{
+			MinLength:           8,
+			MaxLength:           64,
+			Classes:             []Class{ClassLetter, ClassDigit, ClassSpecial},
+			MaxUserIDSimilarity: 0.7,
+		},
+		UserID: UserIDPolicy{
+			MinLength: 3,
+			MaxLength: 18,
+			Reserved:  []string{"admin", "administrator", "root", "system", "support"},
+		},
+	}
+}
+
+// FromEnv returns the default policy overridden by the environment.
+// It is called at startup so that invalid configurations stop the server.
+func FromEnv() (*Policy, error) {
+	p := New()
+
+	var err error
+
+	ints := []struct {
+		key string
+		v   *int
+	}{
+		{"PASSWORD_MIN_LENGTH", &p.Password.MinLength},
+		{"PASSWORD_MAX_LENGTH", &p.Password.MaxLength},
+		{"USER_ID_MIN_LENGTH", &p.UserID.MinLength},
+		{"USER_ID_MAX_LENGTH", &p.UserID.MaxLength},
+	}
+
+	for _, i := range ints {
+		v := os.Getenv(i.key)
+		if v == "" {
+			continue
+		}
+
+		if *i.v, err = strconv.Atoi(v); err != nil || *i.v < 1 {
+			return nil, errors.Errorf("invalid %s: %q", i.key, v)
+		}
+	}
+
+	bools := []struct {
+		key string
+		v   *bool
+	}{
+		{"PASSWORD_UNICODE", &p.Password.Unicode},
+		{"USER_ID_UNICODE", &p.UserID.Unicode},
+	}
+
+	for _, b := range bools {
+		v := os.Getenv(b.key)
+		if v == "" {
+			continue
+		}
+
+		if *b.v, err = strconv.ParseBool(v); err != nil {
+			return nil, errors.Errorf("invalid %s: %q", b.key, v)
+		}
+	}
+
+	if v, ok := os.LookupEnv("PASSWORD_CLASSES"); ok {
+		if p.Password.Classes, err = ParseClasses(v); err != nil {
+			return nil, errors.WithMessage(err, "invalid PASSWORD_CLASSES")
+		}
+	}
+
+	if v := os.Getenv("PASSWORD_USER_ID_SIMILARITY"); v != "" {
+		s, err := strconv.ParseFloat(v, 64)
+		if err != nil || s < 0 || s > 1 {
+			return nil, errors.Errorf("invalid PASSWORD_USER_ID_SIMILARITY: %q", v)
+		}
+		p.Password.MaxUserIDSimilarity = s
+	}
+
+	if path := os.Getenv("PASSWORD_BLOCKLIST"); path != "" {
+		if p.Password.Blocklist, err = LoadBlocklist(path); err != nil {
+			return nil, err
+		}
+	}
+
+	if v, ok := os.LookupEnv("USER_ID_RESERVED"); ok {
+		p.UserID.Reserved = splitList(v)
+	}
+
+	if p.Password.MinLength > p.Password.MaxLength {
+		return nil, errors.Errorf("PASSWORD_MIN_LENGTH is greater than PASSWORD_MAX_LENGTH")
+	}
+
+	if p.UserID.MinLength > p.UserID.MaxLength {
+		return nil, errors.Errorf("USER_ID_MIN_LENGTH is greater than USER_ID_MAX_LENGTH")
+	}
+
+	return p, nil
+}
+
+func splitList(v string) []string {
+	list := []string{}
+	for _, s := range strings.Split(v, ",") {
+		if s = strings.TrimSpace(s); s != "" {
+			list = append(list, s)
+		}
+	}
+	return list
+}
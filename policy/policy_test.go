@@ -0,0 +1,99 @@
+package policy_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"simple-go-server/policy"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func rules(v policy.Violations) []string {
+	r := []string{}
+	for _, violation := range v {
+		r = append(r, violation.Rule)
+	}
+	return r
+}
+
+func TestCheckPassword(t *testing.T) {
+	assert := assert.New(t)
+
+	p := policy.New()
+
+	assert.Empty(p.CheckPassword("pw1234++", "policy1"))
+	assert.Nil(p.CheckPassword("pw1234++", "policy1").Err())
+
+	// every violation is reported
+	assert.Equal(
+		[]string{"min_length", "class_digit", "class_special"},
+		rules(p.CheckPassword("short", "policy1")),
+	)
+
+	assert.Equal([]string{"invalid_character"}, rules(p.CheckPassword("pässwort12+", "policy1")))
+
+	p.Password.Unicode = true
+	assert.Empty(p.CheckPassword("pässwort12+", "policy1"))
+	assert.Equal([]string{"invalid_character"}, rules(p.CheckPassword("pass\x00word12+", "policy1")))
+
+	assert.Equal([]string{"user_id_similarity"}, rules(p.CheckPassword("policy1++", "policy1")))
+	assert.Equal([]string{"user_id_similarity"}, rules(p.CheckPassword("+1yciLop+", "policy1")))
+	assert.Equal([]string{"user_id_similarity"}, rules(p.CheckPassword("policx12+", "policy12")))
+
+	p.Password.MaxUserIDSimilarity = 1
+	assert.Empty(p.CheckPassword("policy1++", "policy1"))
+
+	p.Password.Classes = []policy.Class{policy.ClassUpper, policy.ClassLower}
+	assert.Equal([]string{"class_upper"}, rules(p.CheckPassword("pw1234++", "policy1")))
+}
+
+func TestCheckUserID(t *testing.T) {
+	assert := assert.New(t)
+
+	p := policy.New()
+
+	assert.Empty(p.CheckUserID("policy1"))
+	assert.Equal([]string{"min_length"}, rules(p.CheckUserID("po")))
+	assert.Equal([]string{"max_length"}, rules(p.CheckUserID("policypolicypolicy1")))
+	assert.Equal([]string{"invalid_character"}, rules(p.CheckUserID("policy_1")))
+	assert.Equal([]string{"reserved"}, rules(p.CheckUserID("Admin")))
+
+	assert.Equal([]string{"invalid_character"}, rules(p.CheckUserID("정책1")))
+
+	p.UserID.Unicode = true
+	assert.Empty(p.CheckUserID("정책1"))
+	assert.Empty(p.CheckUserID("caf\u00e9"))
+	assert.Equal([]string{"not_normalized"}, rules(p.CheckUserID("cafe\u0301")))
+	assert.Equal([]string{"invalid_character"}, rules(p.CheckUserID("정책 1")))
+}
+
+func TestFromEnv(t *testing.T) {
+	assert := assert.New(t)
+
+	blocklist := filepath.Join(t.TempDir(), "blocklist.txt")
+	assert.Nil(os.WriteFile(blocklist, []byte("# common passwords\nPassword1!\n\nqwerty12+\n"), 0o600))
+
+	t.Setenv("PASSWORD_MIN_LENGTH", "10")
+	t.Setenv("PASSWORD_CLASSES", "letter,digit")
+	t.Setenv("PASSWORD_BLOCKLIST", blocklist)
+	t.Setenv("USER_ID_RESERVED", "root, webmaster")
+
+	p, err := policy.FromEnv()
+	assert.Nil(err)
+
+	assert.Equal([]string{"blocklist"}, rules(p.CheckPassword("password1!", "policy1")))
+	assert.Equal([]string{"min_length"}, rules(p.CheckPassword("abcd1234", "policy1")))
+	assert.Equal([]string{"reserved"}, rules(p.CheckUserID("webmaster")))
+	assert.Empty(p.CheckUserID("admin"))
+
+	t.Setenv("PASSWORD_CLASSES", "letter,emoji")
+	_, err = policy.FromEnv()
+	assert.NotNil(err)
+
+	t.Setenv("PASSWORD_CLASSES", "")
+	t.Setenv("PASSWORD_BLOCKLIST", filepath.Join(t.TempDir(), "none.txt"))
+	_, err = policy.FromEnv()
+	assert.NotNil(err)
+}
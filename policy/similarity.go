@@ -0,0 +1,77 @@
+package policy
+
+import (
+	"strings"
+)
+
+// similar returns true if the password contains the user id,
+// forwards or backwards, or their similarity exceeds max.
+func similar(password, userID string, max float64) bool {
+	pw := []rune(strings.ToLower(password))
+	id := []rune(strings.ToLower(userID))
+
+	if len(id) >= 3 && (strings.Contains(string(pw), string(id)) || strings.Contains(string(pw), string(reverse(id)))) {
+		return true
+	}
+
+	return similarity(pw, id) > max
+}
+
+// similarity returns 1 minus the levenshtein distance of a and b
+// divided by the length of the longer one.
+func similarity(a, b []rune) float64 {
+	n := len(a)
+	if len(b) > n {
+		n = len(b)
+	}
+
+	if n == 0 {
+		return 1
+	}
+
+	return 1 - float64(levenshtein(a, b))/float64(n)
+}
+
+func levenshtein(a, b []rune) int {
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+
+	for j := range prev {
+		prev[j] = j
+	}
+
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+
+			cur[j] = minInt(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+
+		prev, cur = cur, prev
+	}
+
+	return prev[len(b)]
+}
+
+func reverse(r []rune) []rune {
+	rev := make([]rune, len(r))
+	for i := range r {
+		rev[len(r)-1-i] = r[i]
+	}
+	return rev
+}
+
+func minInt(v ...int) int {
+	m := v[0]
+	for _, i := range v[1:] {
+		if i < m {
+			m = i
+		}
+	}
+	return m
+}
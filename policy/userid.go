@@ -0,0 +1,63 @@
+package policy
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// UserIDPolicy holds the rules of user ids.
+type UserIDPolicy struct {
+	// MinLength and MaxLength are counted in characters.
+	MinLength int
+	MaxLength int
+	// Unicode allows letters, marks and digits of any script in the NFC form,
+	// otherwise only ascii letters and digits are allowed.
+	Unicode bool
+	// Reserved are user ids nobody can sign up with, compared case-insensitively.
+	Reserved []string
+}
+
+// Check returns the violations of the user id.
+func (p UserIDPolicy) Check(userID string) Violations {
+	v := Violations{}
+
+	n := utf8.RuneCountInString(userID)
+
+	if n < p.MinLength {
+		v = append(v, Violation{"min_length", fmt.Sprintf("user id must be at least %d characters", p.MinLength)})
+	}
+
+	if n > p.MaxLength {
+		v = append(v, Violation{"max_length", fmt.Sprintf("user id must be at most %d characters", p.MaxLength)})
+	}
+
+	if !utf8.ValidString(userID) || strings.IndexFunc(userID, p.invalidRune) >= 0 {
+		if p.Unicode {
+			v = append(v, Violation{"invalid_character", "user id must contain only letters and digits"})
+		} else {
+			v = append(v, Violation{"invalid_character", "user id must contain only ascii letters and digits"})
+		}
+	} else if p.Unicode && !norm.NFC.IsNormalString(userID) {
+		v = append(v, Violation{"not_normalized", "user id must be in the unicode NFC form"})
+	}
+
+	for _, r := range p.Reserved {
+		if strings.EqualFold(userID, r) {
+			v = append(v, Violation{"reserved", "user id is reserved"})
+			break
+		}
+	}
+
+	return v
+}
+
+func (p UserIDPolicy) invalidRune(r rune) bool {
+	if p.Unicode {
+		return !unicode.IsLetter(r) && !unicode.IsMark(r) && !unicode.IsDigit(r)
+	}
+	return !('a' <= r && r <= 'z' || 'A' <= r && r <= 'Z' || '0' <= r && r <= '9')
+}
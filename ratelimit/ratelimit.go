@@ -0,0 +1,126 @@
+package ratelimit
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Rule allows Limit requests per Period for each key of a route class.
+// Requests are limited by a token bucket holding up to Limit tokens
+// which refills at Limit / Period.
+type Rule struct {
+	Class  string
+	Limit  int
+	Period time.Duration
+}
+
+// Disabled returns true if the rule does not limit any request.
+func (r Rule) Disabled() bool {
+	return r.Limit <= 0 || r.Period <= 0
+}
+
+var periods = map[string]time.Duration{
+	"s": time.Second,
+	"m": time.Minute,
+	"h": time.Hour,
+	"d": 24 * time.Hour,
+}
+
+// ParseRule parses the rule of the class from a string such as "10/m",
+// which allows 10 requests per minute. "off" or "0" disables the rule.
+func ParseRule(class, s string) (Rule, error) {
+	s = strings.TrimSpace(s)
+	if s == "off" || s == "0" {
+		return Rule{Class: class}, nil
+	}
+
+	n, unit, found := strings.Cut(s, "/")
+	if !found {
+		return Rule{}, errors.Errorf("invalid rate limit rule, %q", s)
+	}
+
+	limit, err := strconv.Atoi(n)
+	if err != nil || limit < 0 {
+		return Rule{}, errors.Errorf("invalid rate limit count, %q", s)
+	}
+
+	period, found := periods[unit]
+	if !found {
+		return Rule{}, errors.Errorf("invalid rate limit period, %q", s)
+	}
+
+	return Rule{
+		Class:  class,
+		Limit:  limit,
+		Period: period,
+	}, nil
+}
+
+// Result is the state of a bucket after a request takes a token.
+type Result struct {
+	Allowed   bool
+	Limit     int
+	Remaining int
+	// Reset is the time until the bucket is full again.
+	Reset time.Duration
+	// RetryAfter is the time until the next request is allowed,
+	// zero if Allowed.
+	RetryAfter time.Duration
+}
+
+// Store keeps token buckets. Implementations backed by
+// a shared storage let several server instances enforce the same limits.
+type Store interface {
+	Take(ctx context.Context, key string, rule Rule, now time.Time) (Result, error)
+}
+
+// Limiter takes tokens for the keys of requests from a Store.
+type Limiter struct {
+	store Store
+}
+
+func NewLimiter(store Store) *Limiter {
+	return &Limiter{store: store}
+}
+
+// Allow takes a token from the bucket of each key
+// and returns the most restrictive result.
+func (l *Limiter) Allow(ctx context.Context, rule Rule, keys ...string) (Result, error) {
+	res := Result{
+		Allowed:   true,
+		Limit:     rule.Limit,
+		Remaining: rule.Limit,
+	}
+
+	if rule.Disabled() {
+		return res, nil
+	}
+
+	now := time.Now()
+
+	for _, k := range keys {
+		r, err := l.store.Take(ctx, rule.Class+":"+k, rule, now)
+		if err != nil {
+			return Result{}, err
+		}
+
+		if !r.Allowed {
+			res.Allowed = false
+		}
+		if r.Remaining < res.Remaining {
+			res.Remaining = r.Remaining
+		}
+		if r.Reset > res.Reset {
+			res.Reset = r.Reset
+		}
+		if r.RetryAfter > res.RetryAfter {
+			res.RetryAfter = r.RetryAfter
+		}
+	}
+
+	return res, nil
+}
@@ -1,16 +1,19 @@
 package router
 
 import (
+	"net/http"
+
 	"github.com/gin-gonic/gin"
 	"github.com/pkg/errors"
 )
 
 type Router struct {
 	*gin.Engine
-	get    map[string]gin.HandlerFunc
-	post   map[string]gin.HandlerFunc
-	put    map[string]gin.HandlerFunc
-	delete map[string]gin.HandlerFunc
+	get        map[string]gin.HandlerFunc
+	post       map[string]gin.HandlerFunc
+	put        map[string]gin.HandlerFunc
+	delete     map[string]gin.HandlerFunc
+	middleware map[string][]gin.HandlerFunc
 }
 
 func NewRouter(e *gin.Engine) Router {
@@ -18,13 +21,15 @@ func NewRouter(e *gin.Engine) Router {
 	post := make(map[string]gin.HandlerFunc)
 	put := make(map[string]gin.HandlerFunc)
 	delete := make(map[string]gin.HandlerFunc)
+	middleware := make(map[string][]gin.HandlerFunc)
 
 	return Router{
-		Engine: e,
-		get:    get,
-		post:   post,
-		put:    put,
-		delete: delete,
+		Engine:     e,
+		get:        get,
+		post:       post,
+		put:        put,
+		delete:     delete,
+		middleware: middleware,
 	}
 }
 
@@ -80,21 +85,38 @@ func (r *Router) AddDelete(api string, handlerFunc gin.HandlerFunc) error {
 	return nil
 }
 
+// AddMiddleware adds handlers which run before the api handler
+// of the method (GET, POST, PUT, DELETE), e.g. a rate limiter for the route.
+func (r *Router) AddMiddleware(method, api string, handlers ...gin.HandlerFunc) {
+	k := method + " " + api
+	r.middleware[k] = append(r.middleware[k], handlers...)
+}
+
+// chain returns the middleware of the api followed by its handler.
+func (r *Router) chain(method, api string, handlerFunc gin.HandlerFunc) []gin.HandlerFunc {
+	mw := r.middleware[method+" "+api]
+
+	handlers := make([]gin.HandlerFunc, 0, len(mw)+1)
+	handlers = append(handlers, mw...)
+
+	return append(handlers, handlerFunc)
+}
+
 // LoadAll sets all api handlers that r(*Router) holds (GET, POST, PUT, DELETE).
 func (r *Router) LoadAll() {
 	for k, v := range r.get {
-		r.GET(k, v)
+		r.GET(k, r.chain(http.MethodGet, k, v)...)
 	}
 
 	for k, v := range r.post {
-		r.POST(k, v)
+		r.POST(k, r.chain(http.MethodPost, k, v)...)
 	}
 
 	for k, v := range r.put {
-		r.PUT(k, v)
+		r.PUT(k, r.chain(http.MethodPut, k, v)...)
 	}
 
 	for k, v := range r.delete {
-		r.DELETE(k, v)
+		r.DELETE(k, r.chain(http.MethodDelete, k, v)...)
 	}
 }
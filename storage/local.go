@@ -0,0 +1,82 @@
+package storage
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+)
+
+// LocalStorage keeps files in a directory of the local disk.
+type LocalStorage struct {
+	dir string
+}
+
+func NewLocalStorage(dir string) *LocalStorage {
+	return &LocalStorage{dir: dir}
+}
+
+// Put writes the file to a temporary file renamed to the key,
+// so that a file is never served half written.
+func (s *LocalStorage) Put(ctx context.Context, key string, r io.Reader) error {
+	if !ValidKey(key) {
+		return errors.Errorf("invalid storage key")
+	}
+
+	if err := os.MkdirAll(s.dir, 0o755); err != nil {
+		return errors.Wrap(err, "create storage directory failure")
+	}
+
+	f, err := os.CreateTemp(s.dir, ".upload-*")
+	if err != nil {
+		return errors.Wrap(err, "create file failure")
+	}
+	defer os.Remove(f.Name())
+
+	if _, err := io.Copy(f, r); err != nil {
+		f.Close()
+		return errors.Wrap(err, "write file failure")
+	}
+
+	if err := f.Close(); err != nil {
+		return errors.Wrap(err, "write file failure")
+	}
+
+	if err := os.Rename(f.Name(), filepath.Join(s.dir, key)); err != nil {
+		return errors.Wrap(err, "rename file failure")
+	}
+
+	return nil
+}
+
+func (s *LocalStorage) Open(ctx context.Context, key string) (io.ReadSeekCloser, error) {
+	if !ValidKey(key) {
+		return nil, ErrNotExist
+	}
+
+	f, err := os.Open(filepath.Join(s.dir, key))
+	if os.IsNotExist(err) {
+		return nil, ErrNotExist
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "open file failure")
+	}
+
+	return f, nil
+}
+
+// Delete removes the file of the key, if any.
+func (s *LocalStorage) Delete(ctx context.Context, key string) error {
+	if !ValidKey(key) {
+		return errors.Errorf("invalid storage key")
+	}
+
+	err := os.Remove(filepath.Join(s.dir, key))
+	if err != nil && !os.IsNotExist(err) {
+		return errors.Wrap(err, "delete file failure")
+	}
+
+	return nil
+}
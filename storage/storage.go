@@ -0,0 +1,70 @@
+package storage
+
+import (
+	"context"
+	"io"
+	"os"
+	"regexp"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+const defaultDir = "uploads"
+
+// keyRegex allows flat keys of lower case letters, digits, '_', '-' and '.',
+// so that no key escapes the storage.
+var keyRegex = regexp.MustCompile(`^[a-z0-9][a-z0-9_.-]{0,127}$`)
+
+// ErrNotExist is returned when a file of the key is not stored.
+var ErrNotExist = errors.New("file not exist")
+
+// Storage keeps files by their keys, e.g. on the local disk or an object store.
+type Storage interface {
+	Put(ctx context.Context, key string, r io.Reader) error
+	Open(ctx context.Context, key string) (io.ReadSeekCloser, error)
+	Delete(ctx context.Context, key string) error
+}
+
+var (
+	mu  sync.RWMutex
+	std Storage
+)
+
+// Default returns the local storage in the directory set by STORAGE_DIR,
+// "uploads" by default.
+func Default() Storage {
+	mu.RLock()
+	s := std
+	mu.RUnlock()
+
+	if s != nil {
+		return s
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	if std == nil {
+		dir := os.Getenv("STORAGE_DIR")
+		if dir == "" {
+			dir = defaultDir
+		}
+		std = NewLocalStorage(dir)
+	}
+
+	return std
+}
+
+// SetDefault replaces the default storage.
+func SetDefault(s Storage) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	std = s
+}
+
+// ValidKey reports whether the key can be stored.
+func ValidKey(key string) bool {
+	return keyRegex.MatchString(key)
+}
@@ -7,22 +7,49 @@ import (
 )
 
 const ACCESS_TOKEN_NAME = "access-token"
+const PRE_AUTH_TOKEN_NAME = "pre-auth-token"
+
+const (
+	PurposeAccess  = "access"
+	PurposePreAuth = "pre-auth"
+)
+
+// PreAuthTokenTTL is the time given to complete the second step of a login.
+const PreAuthTokenTTL = 5 * time.Minute
 
 type Claims struct {
 	UID    int64  `json:"uid"`
 	UserID string `json:"user_id"`
 	Role   string `json:"role"`
+	// Version is the token version of the user when the token is issued.
+	// Tokens with an old version are revoked.
+	Version int64 `json:"ver"`
+	// Purpose tells an access-token from a pre-auth token,
+	// which only allows the second step of a login.
+	Purpose string `json:"purpose"`
 	jwt.RegisteredClaims
 }
 
-func CreateAccessToken(uid int64, userID, role string) (string, error) {
+func CreateAccessToken(uid int64, userID, role string, version int64) (string, error) {
+	return createToken(uid, userID, role, version, PurposeAccess, time.Hour*1)
+}
+
+// CreatePreAuthToken returns a short-lived token issued after the password is verified
+// for a user who must still pass the second factor.
+func CreatePreAuthToken(uid int64, userID, role string, version int64) (string, error) {
+	return createToken(uid, userID, role, version, PurposePreAuth, PreAuthTokenTTL)
+}
+
+func createToken(uid int64, userID, role string, version int64, purpose string, ttl time.Duration) (string, error) {
 	at := jwt.New(jwt.SigningMethodHS256)
 
 	claims := at.Claims.(jwt.MapClaims)
 	claims["uid"] = uid
 	claims["user_id"] = userID
 	claims["role"] = role
-	claims["exp"] = time.Now().Add(time.Hour * 1).Unix()
+	claims["ver"] = version
+	claims["purpose"] = purpose
+	claims["exp"] = time.Now().Add(ttl).Unix()
 
 	t, err := at.SignedString([]byte(JWTSecret()))
 	if err != nil {
@@ -0,0 +1,53 @@
+package token
+
+import (
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/pkg/errors"
+)
+
+const PurposeEmailVerification = "email-verification"
+
+// EmailClaims are the claims of an email verification token,
+// sent to the email in a link.
+type EmailClaims struct {
+	UID     int64  `json:"uid"`
+	Email   string `json:"email"`
+	Purpose string `json:"purpose"`
+	jwt.RegisteredClaims
+}
+
+// CreateEmailVerificationToken returns a token proving that
+// the user of uid received a mail at the email.
+func CreateEmailVerificationToken(uid int64, email string, ttl time.Duration) (string, error) {
+	t := jwt.NewWithClaims(jwt.SigningMethodHS256, EmailClaims{
+		UID:     uid,
+		Email:   email,
+		Purpose: PurposeEmailVerification,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(ttl)),
+		},
+	})
+
+	return t.SignedString([]byte(JWTSecret()))
+}
+
+// GetEmailVerificationToken returns the claims of a valid, unexpired
+// email verification token.
+func GetEmailVerificationToken(t string) (*EmailClaims, error) {
+	claims := EmailClaims{}
+
+	_, err := jwt.ParseWithClaims(t, &claims, func(token *jwt.Token) (interface{}, error) {
+		return JWTSecret(), nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}))
+	if err != nil {
+		return nil, err
+	}
+
+	if claims.Purpose != PurposeEmailVerification || claims.ExpiresAt == nil {
+		return nil, errors.Errorf("invalid email verification token")
+	}
+
+	return &claims, nil
+}
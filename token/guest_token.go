@@ -0,0 +1,51 @@
+package token
+
+import (
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/pkg/errors"
+)
+
+const GUEST_CART_TOKEN_NAME = "guest-cart"
+
+const PurposeGuestCart = "guest-cart"
+
+// GuestClaims are the claims of a guest cart token,
+// identifying the cart of a visitor not logged in.
+type GuestClaims struct {
+	GID     string `json:"gid"`
+	Purpose string `json:"purpose"`
+	jwt.RegisteredClaims
+}
+
+// CreateGuestCartToken returns a token of the guest cart of gid.
+func CreateGuestCartToken(gid string, ttl time.Duration) (string, error) {
+	t := jwt.NewWithClaims(jwt.SigningMethodHS256, GuestClaims{
+		GID:     gid,
+		Purpose: PurposeGuestCart,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(ttl)),
+		},
+	})
+
+	return t.SignedString([]byte(JWTSecret()))
+}
+
+// GetGuestCartToken returns the claims of a valid, unexpired guest cart token.
+func GetGuestCartToken(t string) (*GuestClaims, error) {
+	claims := GuestClaims{}
+
+	_, err := jwt.ParseWithClaims(t, &claims, func(token *jwt.Token) (interface{}, error) {
+		return JWTSecret(), nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}))
+	if err != nil {
+		return nil, err
+	}
+
+	if claims.Purpose != PurposeGuestCart || claims.GID == "" || claims.ExpiresAt == nil {
+		return nil, errors.Errorf("invalid guest cart token")
+	}
+
+	return &claims, nil
+}
@@ -0,0 +1,57 @@
+package totp_test
+
+import (
+	"encoding/base32"
+	"testing"
+	"time"
+
+	"simple-go-server/totp"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCode(t *testing.T) {
+	assert := assert.New(t)
+
+	// test vectors of RFC 6238 appendix B (SHA1), truncated to 6 digits
+	secret := base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString([]byte("12345678901234567890"))
+
+	vectors := map[int64]string{
+		59:         "287082",
+		1111111109: "081804",
+		1111111111: "050471",
+		1234567890: "005924",
+		2000000000: "279037",
+	}
+
+	for ts, expected := range vectors {
+		code, err := totp.Code(secret, time.Unix(ts, 0))
+		assert.Nil(err)
+		assert.Equal(expected, code)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	assert := assert.New(t)
+
+	secret, err := totp.GenerateSecret()
+	assert.Nil(err)
+
+	now := time.Now()
+
+	code, err := totp.Code(secret, now)
+	assert.Nil(err)
+
+	step, ok := totp.Validate(secret, code, now, 0)
+	assert.True(ok)
+	assert.Equal(totp.Step(now), step)
+
+	_, ok = totp.Validate(secret, code, now, step)
+	assert.False(ok, "replayed code")
+
+	_, ok = totp.Validate(secret, code, now.Add(3*totp.Period), 0)
+	assert.False(ok, "expired code")
+
+	_, ok = totp.Validate(secret, "12345", now, 0)
+	assert.False(ok, "short code")
+}
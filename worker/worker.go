@@ -0,0 +1,158 @@
+package worker
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"simple-go-server/logger"
+
+	"github.com/pkg/errors"
+)
+
+// Task is a unit of background work executed periodically by a Group.
+type Task func(ctx context.Context) error
+
+type worker struct {
+	name     string
+	interval time.Duration
+	task     Task
+
+	mu       sync.Mutex
+	lastBeat time.Time
+}
+
+// staleAfter is the number of missed intervals
+// after which a worker is reported as stuck.
+const staleAfter = 3
+
+func (w *worker) beat() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.lastBeat = time.Now()
+}
+
+func (w *worker) lastHeartbeat() time.Time {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	return w.lastBeat
+}
+
+func (w *worker) run(ctx context.Context) {
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+
+	for {
+		if err := w.task(ctx); err != nil && ctx.Err() == nil {
+			logger.Default().Error("worker failure", "worker", w.name, "error", err)
+		}
+		w.beat()
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Group runs background workers and stops them together.
+type Group struct {
+	mu      sync.Mutex
+	workers []*worker
+	cancel  context.CancelFunc
+	started time.Time
+	wg      sync.WaitGroup
+}
+
+func NewGroup() *Group {
+	return &Group{}
+}
+
+// Add registers a task which will be executed every interval
+// after the group starts.
+func (g *Group) Add(name string, interval time.Duration, task Task) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.workers = append(g.workers, &worker{
+		name:     name,
+		interval: interval,
+		task:     task,
+	})
+}
+
+// Start launches all registered workers.
+// Workers keep running until Stop is called.
+func (g *Group) Start() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if g.cancel != nil {
+		return
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	g.cancel = cancel
+	g.started = time.Now()
+
+	for _, w := range g.workers {
+		g.wg.Add(1)
+		go func(w *worker) {
+			defer g.wg.Done()
+			w.run(ctx)
+		}(w)
+	}
+}
+
+// Stop cancels all workers and waits for them to return
+// until ctx is done.
+func (g *Group) Stop(ctx context.Context) error {
+	g.mu.Lock()
+	cancel := g.cancel
+	g.mu.Unlock()
+
+	if cancel == nil {
+		return nil
+	}
+	cancel()
+
+	done := make(chan struct{})
+	go func() {
+		g.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return errors.Wrap(ctx.Err(), "workers did not stop in time")
+	}
+}
+
+// Check fails if any running worker has not sent a heartbeat
+// for several of its intervals, so Group can be used as a health checker.
+func (g *Group) Check(ctx context.Context) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if g.cancel == nil {
+		return nil
+	}
+
+	for _, w := range g.workers {
+		last := w.lastHeartbeat()
+		if last.IsZero() {
+			last = g.started
+		}
+
+		if since := time.Since(last); since > staleAfter*w.interval {
+			return errors.Errorf("worker %s has no heartbeat for %s", w.name, since.Round(time.Second))
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,115 @@
+package worker_test
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"simple-go-server/worker"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGroup(t *testing.T) {
+	assert := assert.New(t)
+
+	t.Run("test run", func(t *testing.T) {
+		var runs int64
+
+		g := worker.NewGroup()
+		g.Add("count", 5*time.Millisecond, func(ctx context.Context) error {
+			atomic.AddInt64(&runs, 1)
+			return nil
+		})
+		g.Start()
+
+		assert.Eventually(func() bool { return atomic.LoadInt64(&runs) >= 3 }, time.Second, time.Millisecond)
+		assert.Nil(g.Check(context.Background()))
+		assert.Nil(g.Stop(context.Background()))
+	})
+
+	t.Run("test stop; in-flight task", func(t *testing.T) {
+		started := make(chan struct{})
+		cancelled := make(chan struct{})
+
+		g := worker.NewGroup()
+		g.Add("block", time.Hour, func(ctx context.Context) error {
+			close(started)
+			<-ctx.Done()
+			close(cancelled)
+			return ctx.Err()
+		})
+		g.Start()
+		<-started
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+
+		// the task is cancelled, and Stop waits until it returns.
+		assert.Nil(g.Stop(ctx))
+
+		select {
+		case <-cancelled:
+		default:
+			t.Error("stop returned before the task")
+		}
+	})
+
+	t.Run("test stop; timeout", func(t *testing.T) {
+		started := make(chan struct{})
+		release := make(chan struct{})
+		defer close(release)
+
+		g := worker.NewGroup()
+		g.Add("stuck", time.Hour, func(ctx context.Context) error {
+			close(started)
+			<-release
+			return nil
+		})
+		g.Start()
+		<-started
+
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		defer cancel()
+
+		err := g.Stop(ctx)
+		assert.NotNil(err)
+		assert.Equal(context.DeadlineExceeded, errors.Cause(err))
+	})
+
+	t.Run("test check; stale heartbeat", func(t *testing.T) {
+		started := make(chan struct{})
+		release := make(chan struct{})
+
+		g := worker.NewGroup()
+		g.Add("slow", 10*time.Millisecond, func(ctx context.Context) error {
+			select {
+			case <-started:
+			default:
+				close(started)
+			}
+			<-release
+			return nil
+		})
+
+		// a group which is not started is healthy.
+		assert.Nil(g.Check(context.Background()))
+
+		g.Start()
+		<-started
+		assert.Nil(g.Check(context.Background()))
+
+		// the task takes more than 3 intervals without a heartbeat.
+		time.Sleep(50 * time.Millisecond)
+
+		err := g.Check(context.Background())
+		assert.NotNil(err)
+		assert.Contains(err.Error(), "worker slow has no heartbeat")
+
+		close(release)
+		assert.Eventually(func() bool { return g.Check(context.Background()) == nil }, time.Second, time.Millisecond)
+		assert.Nil(g.Stop(context.Background()))
+	})
+}